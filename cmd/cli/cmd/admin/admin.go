@@ -0,0 +1,23 @@
+package admin
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/cli"
+	"github.com/spf13/cobra"
+)
+
+type AdminCommand struct{}
+
+func (c *AdminCommand) Mount(parent *cobra.Command) {
+	adminCmd := &cobra.Command{
+		Use:   "admin",
+		Short: "Admin commands",
+		Long:  "Commands for administering the server, which require the server's admin token",
+	}
+
+	cli.GlobalFlagAdminToken(adminCmd)
+
+	(&ExportStateCommand{}).Mount(adminCmd)
+	(&ImportStateCommand{}).Mount(adminCmd)
+
+	parent.AddCommand(adminCmd)
+}
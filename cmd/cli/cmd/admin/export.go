@@ -0,0 +1,42 @@
+package admin
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/cli"
+	"github.com/mcoot/crosswordgame-go/internal/client"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+type ExportStateCommand struct {
+	File string
+}
+
+func (c *ExportStateCommand) Run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	cwg := client.GetClient(ctx).WithAdminToken(cli.FlagAdminToken)
+
+	if c.File == "" {
+		return cwg.ExportState(os.Stdout)
+	}
+
+	f, err := os.Create(c.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return cwg.ExportState(f)
+}
+
+func (c *ExportStateCommand) Mount(parent *cobra.Command) {
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export all server state",
+		Long:  "Export every game, lobby, player, webhook and API token on the server as a JSON Lines dump",
+		RunE:  c.Run,
+	}
+
+	exportCmd.Flags().StringVarP(&c.File, "file", "f", "", "File to write the dump to (default: stdout)")
+
+	parent.AddCommand(exportCmd)
+}
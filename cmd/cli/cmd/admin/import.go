@@ -0,0 +1,47 @@
+package admin
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/cli"
+	"github.com/mcoot/crosswordgame-go/internal/client"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+type ImportStateCommand struct {
+	File string
+}
+
+func (c *ImportStateCommand) Run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	cwg := client.GetClient(ctx).WithAdminToken(cli.FlagAdminToken)
+
+	f, err := os.Open(c.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	resp, err := cwg.ImportState(f)
+	if err != nil {
+		return err
+	}
+
+	return cli.WriteOutput(resp)
+}
+
+func (c *ImportStateCommand) Mount(parent *cobra.Command) {
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import server state",
+		Long:  "Import a JSON Lines dump produced by the export command, overwriting objects with the same IDs",
+		RunE:  c.Run,
+	}
+
+	importCmd.Flags().StringVarP(&c.File, "file", "f", "", "File to read the dump from")
+	err := importCmd.MarkFlagRequired("file")
+	if err != nil {
+		panic(err)
+	}
+
+	parent.AddCommand(importCmd)
+}
@@ -16,6 +16,7 @@ func (c *GameCommand) Mount(parent *cobra.Command) {
 
 	(&CreateGameCommand{}).Mount(gameCmd)
 	(&GetGameStateCommand{}).Mount(gameCmd)
+	(&WatchGameCommand{}).Mount(gameCmd)
 	(&player.PlayerCommand{}).Mount(gameCmd)
 
 	parent.AddCommand(gameCmd)
@@ -0,0 +1,37 @@
+package game
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/cli"
+	"github.com/mcoot/crosswordgame-go/internal/client"
+	"github.com/mcoot/crosswordgame-go/internal/game/types"
+	"github.com/spf13/cobra"
+)
+
+type WatchGameCommand struct {
+	GameId string
+}
+
+func (c *WatchGameCommand) Run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	cwg := client.GetClient(ctx)
+
+	stream, err := cwg.OpenGameEventStream(ctx, types.GameId(c.GameId))
+	if err != nil {
+		return err
+	}
+
+	return cli.WriteEventStream(stream)
+}
+
+func (c *WatchGameCommand) Mount(parent *cobra.Command) {
+	watchCmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Watch a game's events",
+		Long:  "Print each event in a game as it happens, until interrupted",
+		RunE:  c.Run,
+	}
+
+	cli.GameIdFlag(watchCmd, &c.GameId)
+
+	parent.AddCommand(watchCmd)
+}
@@ -0,0 +1,40 @@
+package lobby
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/cli"
+	"github.com/mcoot/crosswordgame-go/internal/client"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"github.com/spf13/cobra"
+)
+
+type TransferLobbyHostCommand struct {
+	LobbyID  string
+	PlayerID string
+}
+
+func (c *TransferLobbyHostCommand) Run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	cwg := client.GetClient(ctx)
+
+	resp, err := cwg.TransferLobbyHost(lobbytypes.LobbyId(c.LobbyID), playertypes.PlayerId(c.PlayerID))
+	if err != nil {
+		return err
+	}
+
+	return cli.WriteOutput(resp)
+}
+
+func (c *TransferLobbyHostCommand) Mount(parent *cobra.Command) {
+	hostCmd := &cobra.Command{
+		Use:   "transfer-host",
+		Short: "Hand hosting a lobby over to another player",
+		Long:  "Hand hosting a lobby over to another of its players, which only its host can do",
+		RunE:  c.Run,
+	}
+
+	cli.LobbyIdFlag(hostCmd, &c.LobbyID)
+	cli.PlayerIdFlag(hostCmd, &c.PlayerID)
+
+	parent.AddCommand(hostCmd)
+}
@@ -11,13 +11,14 @@ import (
 type JoinLobbyCommand struct {
 	LobbyID  string
 	PlayerID string
+	Password string
 }
 
 func (c *JoinLobbyCommand) Run(cmd *cobra.Command, args []string) error {
 	ctx := cmd.Context()
 	cwg := client.GetClient(ctx)
 
-	resp, err := cwg.JoinLobby(lobbytypes.LobbyId(c.LobbyID), playertypes.PlayerId(c.PlayerID))
+	resp, err := cwg.JoinLobby(lobbytypes.LobbyId(c.LobbyID), playertypes.PlayerId(c.PlayerID), c.Password)
 	if err != nil {
 		return err
 	}
@@ -35,6 +36,7 @@ func (c *JoinLobbyCommand) Mount(parent *cobra.Command) {
 
 	cli.LobbyIdFlag(joinCmd, &c.LobbyID)
 	cli.PlayerIdFlag(joinCmd, &c.PlayerID)
+	joinCmd.Flags().StringVar(&c.Password, "password", "", "Password of the lobby, if it has one")
 
 	parent.AddCommand(joinCmd)
 }
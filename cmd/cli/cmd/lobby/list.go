@@ -0,0 +1,31 @@
+package lobby
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/cli"
+	"github.com/mcoot/crosswordgame-go/internal/client"
+	"github.com/spf13/cobra"
+)
+
+type ListLobbiesCommand struct{}
+
+func (c *ListLobbiesCommand) Run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	cwg := client.GetClient(ctx)
+
+	resp, err := cwg.ListLobbies()
+	if err != nil {
+		return err
+	}
+
+	return cli.WriteOutput(resp)
+}
+
+func (c *ListLobbiesCommand) Mount(parent *cobra.Command) {
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the public lobbies",
+		RunE:  c.Run,
+	}
+
+	parent.AddCommand(listCmd)
+}
@@ -12,11 +12,16 @@ func (c *LobbyCommand) Mount(parent *cobra.Command) {
 	}
 
 	(&CreateLobbyCommand{}).Mount(lobbyCmd)
+	(&ListLobbiesCommand{}).Mount(lobbyCmd)
 	(&GetLobbyStateCommand{}).Mount(lobbyCmd)
 	(&JoinLobbyCommand{}).Mount(lobbyCmd)
 	(&RemovePlayerFromLobbyCommand{}).Mount(lobbyCmd)
+	(&TransferLobbyHostCommand{}).Mount(lobbyCmd)
+	(&SetLobbyLockedCommand{}).Mount(lobbyCmd)
+	(&UpdateLobbySettingsCommand{}).Mount(lobbyCmd)
 	(&AttachGameToLobbyCommand{}).Mount(lobbyCmd)
 	(&DetachGameFromLobbyCommand{}).Mount(lobbyCmd)
+	(&WatchLobbyCommand{}).Mount(lobbyCmd)
 
 	parent.AddCommand(lobbyCmd)
 }
@@ -0,0 +1,39 @@
+package lobby
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/cli"
+	"github.com/mcoot/crosswordgame-go/internal/client"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	"github.com/spf13/cobra"
+)
+
+type SetLobbyLockedCommand struct {
+	LobbyID string
+	Unlock  bool
+}
+
+func (c *SetLobbyLockedCommand) Run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	cwg := client.GetClient(ctx)
+
+	resp, err := cwg.SetLobbyLocked(lobbytypes.LobbyId(c.LobbyID), !c.Unlock)
+	if err != nil {
+		return err
+	}
+
+	return cli.WriteOutput(resp)
+}
+
+func (c *SetLobbyLockedCommand) Mount(parent *cobra.Command) {
+	lockCmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Lock a lobby against new players joining",
+		Long:  "Lock a lobby against new players joining, or unlock it with --unlock, which only its host can do",
+		RunE:  c.Run,
+	}
+
+	cli.LobbyIdFlag(lockCmd, &c.LobbyID)
+	lockCmd.Flags().BoolVar(&c.Unlock, "unlock", false, "Unlock the lobby instead")
+
+	parent.AddCommand(lockCmd)
+}
@@ -0,0 +1,71 @@
+package lobby
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/apitypes"
+	"github.com/mcoot/crosswordgame-go/internal/cli"
+	"github.com/mcoot/crosswordgame-go/internal/client"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	"github.com/spf13/cobra"
+)
+
+type UpdateLobbySettingsCommand struct {
+	LobbyID        string
+	MaxPlayers     int
+	Visibility     string
+	Password       string
+	RemovePassword bool
+	BoardSize      int
+}
+
+func (c *UpdateLobbySettingsCommand) Run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	cwg := client.GetClient(ctx)
+
+	// Only the settings given as flags are changed
+	var update apitypes.UpdateLobbySettingsRequest
+	flags := cmd.Flags()
+	if flags.Changed("max-players") {
+		update.MaxPlayers = &c.MaxPlayers
+	}
+	if flags.Changed("visibility") {
+		visibility := lobbytypes.Visibility(c.Visibility)
+		update.Visibility = &visibility
+	}
+	if flags.Changed("password") {
+		update.Password = &c.Password
+	}
+	if c.RemovePassword {
+		noPassword := ""
+		update.Password = &noPassword
+	}
+	if flags.Changed("board-size") {
+		update.GameDefaults = &lobbytypes.GameOptions{BoardSize: c.BoardSize}
+	}
+
+	resp, err := cwg.UpdateLobbySettings(lobbytypes.LobbyId(c.LobbyID), update)
+	if err != nil {
+		return err
+	}
+
+	return cli.WriteOutput(resp)
+}
+
+func (c *UpdateLobbySettingsCommand) Mount(parent *cobra.Command) {
+	settingsCmd := &cobra.Command{
+		Use:   "settings",
+		Short: "Change a lobby's settings",
+		Long:  "Change the settings given as flags, leaving the rest as they are, which only the lobby's host can do",
+		RunE:  c.Run,
+	}
+
+	cli.LobbyIdFlag(settingsCmd, &c.LobbyID)
+	flags := settingsCmd.Flags()
+	flags.IntVar(&c.MaxPlayers, "max-players", 0, "Most players the lobby can hold, or 0 for no limit")
+	flags.StringVar(&c.Visibility, "visibility", "", "public to list the lobby for anyone to find, or private")
+	flags.StringVar(&c.Password, "password", "", "Password needed to join the lobby")
+	flags.BoolVar(&c.RemovePassword, "remove-password", false, "Let players join without a password")
+	flags.IntVar(&c.BoardSize, "board-size", 0, "Board size new games default to")
+	settingsCmd.MarkFlagsMutuallyExclusive("password", "remove-password")
+
+	parent.AddCommand(settingsCmd)
+}
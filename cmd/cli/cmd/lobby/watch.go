@@ -0,0 +1,37 @@
+package lobby
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/cli"
+	"github.com/mcoot/crosswordgame-go/internal/client"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	"github.com/spf13/cobra"
+)
+
+type WatchLobbyCommand struct {
+	LobbyID string
+}
+
+func (c *WatchLobbyCommand) Run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	cwg := client.GetClient(ctx)
+
+	stream, err := cwg.OpenLobbyEventStream(ctx, lobbytypes.LobbyId(c.LobbyID))
+	if err != nil {
+		return err
+	}
+
+	return cli.WriteEventStream(stream)
+}
+
+func (c *WatchLobbyCommand) Mount(parent *cobra.Command) {
+	watchCmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Watch a lobby's events",
+		Long:  "Print each event in a lobby and its running game as it happens, until interrupted",
+		RunE:  c.Run,
+	}
+
+	cli.LobbyIdFlag(watchCmd, &c.LobbyID)
+
+	parent.AddCommand(watchCmd)
+}
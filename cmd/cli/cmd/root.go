@@ -2,9 +2,12 @@ package cmd
 
 import (
 	"context"
+	"github.com/mcoot/crosswordgame-go/cmd/cli/cmd/admin"
 	"github.com/mcoot/crosswordgame-go/cmd/cli/cmd/game"
 	"github.com/mcoot/crosswordgame-go/cmd/cli/cmd/lobby"
 	"github.com/mcoot/crosswordgame-go/cmd/cli/cmd/player"
+	"github.com/mcoot/crosswordgame-go/cmd/cli/cmd/token"
+	"github.com/mcoot/crosswordgame-go/cmd/cli/cmd/webhook"
 	"github.com/mcoot/crosswordgame-go/internal/cli"
 	"github.com/mcoot/crosswordgame-go/internal/client"
 	"github.com/mcoot/crosswordgame-go/internal/logging"
@@ -26,7 +29,10 @@ var (
 			}
 			ctx = logging.AddLoggerToContext(ctx, logger)
 
-			cwgClient := initClient(cli.FlagServer)
+			cwgClient, err := initClient(cli.FlagServer, cli.FlagToken)
+			if err != nil {
+				return err
+			}
 			ctx = client.AddClientToContext(ctx, cwgClient)
 			cmd.SetContext(ctx)
 
@@ -38,16 +44,33 @@ var (
 func init() {
 	cli.GlobalFlagServer(rootCmd)
 	cli.GlobalFlagOutputMode(rootCmd)
+	cli.GlobalFlagToken(rootCmd)
 
 	(&HealthCommand{}).Mount(rootCmd)
 	(&game.GameCommand{}).Mount(rootCmd)
 	(&lobby.LobbyCommand{}).Mount(rootCmd)
 	(&player.PlayerCommand{}).Mount(rootCmd)
+	(&admin.AdminCommand{}).Mount(rootCmd)
+	(&webhook.WebhookCommand{}).Mount(rootCmd)
+	(&token.TokenCommand{}).Mount(rootCmd)
 }
 
-func initClient(baseUrl string) *client.Client {
+// initClient makes a client acting with the given token, or the one saved for the server if none is given
+func initClient(baseUrl string, apiToken string) (*client.Client, error) {
 	httpClient := &http.Client{}
-	return client.NewClient(httpClient, baseUrl)
+	cwgClient := client.NewClient(httpClient, baseUrl)
+
+	if apiToken == "" {
+		var err error
+		apiToken, err = cli.LoadSavedToken(baseUrl)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if apiToken == "" {
+		return cwgClient, nil
+	}
+	return cwgClient.WithToken(apiToken), nil
 }
 
 func Execute() error {
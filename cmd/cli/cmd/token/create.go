@@ -0,0 +1,52 @@
+package token
+
+import (
+	apitokentypes "github.com/mcoot/crosswordgame-go/internal/apitoken/types"
+	"github.com/mcoot/crosswordgame-go/internal/cli"
+	"github.com/mcoot/crosswordgame-go/internal/client"
+	"github.com/spf13/cobra"
+)
+
+type CreateTokenCommand struct {
+	Name   string
+	Scopes []string
+}
+
+func (c *CreateTokenCommand) Run(cmd *cobra.Command, args []string) error {
+	cwg := client.GetClient(cmd.Context())
+
+	scopes := make([]apitokentypes.Scope, 0, len(c.Scopes))
+	for _, scope := range c.Scopes {
+		scopes = append(scopes, apitokentypes.Scope(scope))
+	}
+
+	resp, err := cwg.CreateToken(c.Name, scopes)
+	if err != nil {
+		return err
+	}
+
+	return cli.WriteOutput(resp)
+}
+
+func (c *CreateTokenCommand) Mount(parent *cobra.Command) {
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create an API token",
+		Long:  "Create an API token for the account, e.g. for a bot, which is only shown this once",
+		RunE:  c.Run,
+	}
+
+	createCmd.Flags().StringVarP(&c.Name, "name", "n", "", "Name to tell the token apart by")
+	err := createCmd.MarkFlagRequired("name")
+	if err != nil {
+		panic(err)
+	}
+	createCmd.Flags().StringSliceVar(
+		&c.Scopes,
+		"scope",
+		nil,
+		"Scope to give the token, may be repeated (default: all of play, lobby, webhooks, account)",
+	)
+
+	parent.AddCommand(createCmd)
+}
@@ -0,0 +1,31 @@
+package token
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/cli"
+	"github.com/mcoot/crosswordgame-go/internal/client"
+	"github.com/spf13/cobra"
+)
+
+type ListTokensCommand struct{}
+
+func (c *ListTokensCommand) Run(cmd *cobra.Command, args []string) error {
+	cwg := client.GetClient(cmd.Context())
+
+	resp, err := cwg.ListTokens()
+	if err != nil {
+		return err
+	}
+
+	return cli.WriteOutput(resp)
+}
+
+func (c *ListTokensCommand) Mount(parent *cobra.Command) {
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List API tokens",
+		Long:  "List the account's API tokens, without their secrets",
+		RunE:  c.Run,
+	}
+
+	parent.AddCommand(listCmd)
+}
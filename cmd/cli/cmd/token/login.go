@@ -0,0 +1,64 @@
+package token
+
+import (
+	"fmt"
+	"github.com/mcoot/crosswordgame-go/internal/cli"
+	"github.com/mcoot/crosswordgame-go/internal/client"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"github.com/spf13/cobra"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+)
+
+type LoginCommand struct {
+	Username string
+	Password string
+	Name     string
+}
+
+func (c *LoginCommand) Run(cmd *cobra.Command, args []string) error {
+	// Logging in sets a session cookie, which the token is then issued with
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return err
+	}
+	cwg := client.NewClient(&http.Client{Jar: jar}, cli.FlagServer)
+
+	account, err := cwg.Login(playertypes.PlayerId(c.Username), c.Password)
+	if err != nil {
+		return err
+	}
+	resp, err := cwg.CreateToken(c.Name, nil)
+	if err != nil {
+		return err
+	}
+
+	err = cli.SaveToken(cli.FlagServer, resp.BearerToken)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Logged in to %s as %s\n", cli.FlagServer, account.PlayerId)
+	return nil
+}
+
+func (c *LoginCommand) Mount(parent *cobra.Command) {
+	loginCmd := &cobra.Command{
+		Use:   "login",
+		Short: "Log in to an account",
+		Long:  "Log in to an account with its password, saving a personal API token which later commands act with",
+		RunE:  c.Run,
+	}
+
+	loginCmd.Flags().StringVarP(&c.Username, "username", "u", "", "Username")
+	err := loginCmd.MarkFlagRequired("username")
+	if err != nil {
+		panic(err)
+	}
+	loginCmd.Flags().
+		StringVar(&c.Password, "password", os.Getenv("CWG_PASSWORD"), "Password (default: $CWG_PASSWORD)")
+	loginCmd.Flags().StringVarP(&c.Name, "name", "n", "cli", "Name for the saved token")
+
+	parent.AddCommand(loginCmd)
+}
@@ -0,0 +1,49 @@
+package token
+
+import (
+	"fmt"
+	apitokentypes "github.com/mcoot/crosswordgame-go/internal/apitoken/types"
+	"github.com/mcoot/crosswordgame-go/internal/cli"
+	"github.com/mcoot/crosswordgame-go/internal/client"
+	"github.com/spf13/cobra"
+)
+
+type LogoutCommand struct{}
+
+func (c *LogoutCommand) Run(cmd *cobra.Command, args []string) error {
+	saved, err := cli.LoadSavedToken(cli.FlagServer)
+	if err != nil {
+		return err
+	}
+	if saved == "" {
+		return fmt.Errorf("not logged in to %s", cli.FlagServer)
+	}
+
+	// Revoke the token as well as forgetting it, so a copy of it can't be used either
+	tokenId, _, ok := apitokentypes.ParseBearerToken(saved)
+	if ok {
+		_, err = client.GetClient(cmd.Context()).WithToken(saved).RevokeToken(tokenId)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = cli.DeleteSavedToken(cli.FlagServer)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Logged out of %s\n", cli.FlagServer)
+	return nil
+}
+
+func (c *LogoutCommand) Mount(parent *cobra.Command) {
+	logoutCmd := &cobra.Command{
+		Use:   "logout",
+		Short: "Log out of an account",
+		Long:  "Revoke and forget the API token saved by logging in",
+		RunE:  c.Run,
+	}
+
+	parent.AddCommand(logoutCmd)
+}
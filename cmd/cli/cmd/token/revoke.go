@@ -0,0 +1,40 @@
+package token
+
+import (
+	apitokentypes "github.com/mcoot/crosswordgame-go/internal/apitoken/types"
+	"github.com/mcoot/crosswordgame-go/internal/cli"
+	"github.com/mcoot/crosswordgame-go/internal/client"
+	"github.com/spf13/cobra"
+)
+
+type RevokeTokenCommand struct {
+	TokenID string
+}
+
+func (c *RevokeTokenCommand) Run(cmd *cobra.Command, args []string) error {
+	cwg := client.GetClient(cmd.Context())
+
+	resp, err := cwg.RevokeToken(apitokentypes.TokenId(c.TokenID))
+	if err != nil {
+		return err
+	}
+
+	return cli.WriteOutput(resp)
+}
+
+func (c *RevokeTokenCommand) Mount(parent *cobra.Command) {
+	revokeCmd := &cobra.Command{
+		Use:   "revoke",
+		Short: "Revoke an API token",
+		Long:  "Revoke one of the account's API tokens, which stops working immediately",
+		RunE:  c.Run,
+	}
+
+	revokeCmd.Flags().StringVarP(&c.TokenID, "id", "i", "", "Token ID")
+	err := revokeCmd.MarkFlagRequired("id")
+	if err != nil {
+		panic(err)
+	}
+
+	parent.AddCommand(revokeCmd)
+}
@@ -0,0 +1,21 @@
+package token
+
+import "github.com/spf13/cobra"
+
+type TokenCommand struct{}
+
+func (c *TokenCommand) Mount(parent *cobra.Command) {
+	tokenCmd := &cobra.Command{
+		Use:   "token",
+		Short: "API token commands",
+		Long:  "Commands for logging in to an account with an API token, and managing its tokens",
+	}
+
+	(&LoginCommand{}).Mount(tokenCmd)
+	(&LogoutCommand{}).Mount(tokenCmd)
+	(&CreateTokenCommand{}).Mount(tokenCmd)
+	(&ListTokensCommand{}).Mount(tokenCmd)
+	(&RevokeTokenCommand{}).Mount(tokenCmd)
+
+	parent.AddCommand(tokenCmd)
+}
@@ -0,0 +1,38 @@
+package webhook
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/cli"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	webhooktypes "github.com/mcoot/crosswordgame-go/internal/webhook/types"
+	"github.com/spf13/cobra"
+)
+
+type DeleteWebhookCommand struct {
+	LobbyID   string
+	WebhookID string
+}
+
+func (c *DeleteWebhookCommand) Run(cmd *cobra.Command, args []string) error {
+	cwg := getClient(cmd.Context())
+
+	resp, err := cwg.DeleteWebhook(lobbytypes.LobbyId(c.LobbyID), webhooktypes.WebhookId(c.WebhookID))
+	if err != nil {
+		return err
+	}
+
+	return cli.WriteOutput(resp)
+}
+
+func (c *DeleteWebhookCommand) Mount(parent *cobra.Command) {
+	deleteCmd := &cobra.Command{
+		Use:   "delete",
+		Short: "Delete a webhook",
+		Long:  "Delete a webhook along with its delivery log",
+		RunE:  c.Run,
+	}
+
+	cli.WebhookLobbyIdFlag(deleteCmd, &c.LobbyID)
+	cli.WebhookIdFlag(deleteCmd, &c.WebhookID)
+
+	parent.AddCommand(deleteCmd)
+}
@@ -0,0 +1,49 @@
+package webhook
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/cli"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	webhooktypes "github.com/mcoot/crosswordgame-go/internal/webhook/types"
+	"github.com/spf13/cobra"
+)
+
+type GetWebhookDeliveriesCommand struct {
+	LobbyID   string
+	WebhookID string
+	Status    string
+}
+
+func (c *GetWebhookDeliveriesCommand) Run(cmd *cobra.Command, args []string) error {
+	cwg := getClient(cmd.Context())
+
+	resp, err := cwg.GetWebhookDeliveries(
+		lobbytypes.LobbyId(c.LobbyID),
+		webhooktypes.WebhookId(c.WebhookID),
+		webhooktypes.DeliveryStatus(c.Status),
+	)
+	if err != nil {
+		return err
+	}
+
+	return cli.WriteOutput(resp)
+}
+
+func (c *GetWebhookDeliveriesCommand) Mount(parent *cobra.Command) {
+	deliveriesCmd := &cobra.Command{
+		Use:   "deliveries",
+		Short: "Show a webhook's delivery log",
+		Long:  "Show a webhook's recent deliveries and every attempt made for each",
+		RunE:  c.Run,
+	}
+
+	cli.WebhookLobbyIdFlag(deliveriesCmd, &c.LobbyID)
+	cli.WebhookIdFlag(deliveriesCmd, &c.WebhookID)
+	deliveriesCmd.Flags().StringVar(
+		&c.Status,
+		"status",
+		"",
+		"Only show deliveries with this status (allowed: pending, delivered, dead_letter)",
+	)
+
+	parent.AddCommand(deliveriesCmd)
+}
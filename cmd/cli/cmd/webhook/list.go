@@ -0,0 +1,35 @@
+package webhook
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/cli"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	"github.com/spf13/cobra"
+)
+
+type ListWebhooksCommand struct {
+	LobbyID string
+}
+
+func (c *ListWebhooksCommand) Run(cmd *cobra.Command, args []string) error {
+	cwg := getClient(cmd.Context())
+
+	resp, err := cwg.ListWebhooks(lobbytypes.LobbyId(c.LobbyID))
+	if err != nil {
+		return err
+	}
+
+	return cli.WriteOutput(resp)
+}
+
+func (c *ListWebhooksCommand) Mount(parent *cobra.Command) {
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List webhooks",
+		Long:  "List a lobby's webhooks, or every webhook on the server",
+		RunE:  c.Run,
+	}
+
+	cli.WebhookLobbyIdFlag(listCmd, &c.LobbyID)
+
+	parent.AddCommand(listCmd)
+}
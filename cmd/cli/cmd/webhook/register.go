@@ -0,0 +1,55 @@
+package webhook
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/cli"
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	"github.com/spf13/cobra"
+)
+
+type RegisterWebhookCommand struct {
+	LobbyID string
+	Url     string
+	Events  []string
+}
+
+func (c *RegisterWebhookCommand) Run(cmd *cobra.Command, args []string) error {
+	cwg := getClient(cmd.Context())
+
+	eventKinds := make([]events.Kind, 0, len(c.Events))
+	for _, kind := range c.Events {
+		eventKinds = append(eventKinds, events.Kind(kind))
+	}
+
+	resp, err := cwg.RegisterWebhook(lobbytypes.LobbyId(c.LobbyID), c.Url, eventKinds)
+	if err != nil {
+		return err
+	}
+
+	return cli.WriteOutput(resp)
+}
+
+func (c *RegisterWebhookCommand) Mount(parent *cobra.Command) {
+	registerCmd := &cobra.Command{
+		Use:   "register",
+		Short: "Register a webhook",
+		Long:  "Register a URL to be sent signed JSON payloads for game and lobby events",
+		RunE:  c.Run,
+	}
+
+	cli.WebhookLobbyIdFlag(registerCmd, &c.LobbyID)
+	registerCmd.Flags().StringVarP(&c.Url, "url", "u", "", "URL to deliver events to")
+	err := registerCmd.MarkFlagRequired("url")
+	if err != nil {
+		panic(err)
+	}
+	registerCmd.Flags().StringSliceVarP(
+		&c.Events,
+		"event",
+		"e",
+		nil,
+		"Event to deliver, may be repeated (default: lobby.game_attached, game.turn_completed, game.finished)",
+	)
+
+	parent.AddCommand(registerCmd)
+}
@@ -0,0 +1,31 @@
+package webhook
+
+import (
+	"context"
+	"github.com/mcoot/crosswordgame-go/internal/cli"
+	"github.com/mcoot/crosswordgame-go/internal/client"
+	"github.com/spf13/cobra"
+)
+
+type WebhookCommand struct{}
+
+func (c *WebhookCommand) Mount(parent *cobra.Command) {
+	webhookCmd := &cobra.Command{
+		Use:   "webhook",
+		Short: "Webhook commands",
+		Long:  "Commands for managing the webhooks of a lobby, or of the whole server with the admin token",
+	}
+
+	cli.GlobalFlagAdminToken(webhookCmd)
+
+	(&RegisterWebhookCommand{}).Mount(webhookCmd)
+	(&ListWebhooksCommand{}).Mount(webhookCmd)
+	(&DeleteWebhookCommand{}).Mount(webhookCmd)
+	(&GetWebhookDeliveriesCommand{}).Mount(webhookCmd)
+
+	parent.AddCommand(webhookCmd)
+}
+
+func getClient(ctx context.Context) *client.Client {
+	return client.GetClient(ctx).WithAdminToken(cli.FlagAdminToken)
+}
@@ -1,48 +1,172 @@
 package main
 
 import (
-	"github.com/gorilla/sessions"
+	"context"
+	"fmt"
 	"github.com/mcoot/crosswordgame-go/internal/api"
+	"github.com/mcoot/crosswordgame-go/internal/broker"
+	"github.com/mcoot/crosswordgame-go/internal/config"
 	"github.com/mcoot/crosswordgame-go/internal/logging"
+	"github.com/mcoot/crosswordgame-go/internal/metrics"
+	"github.com/mcoot/crosswordgame-go/internal/ratelimit"
 	"github.com/mcoot/crosswordgame-go/internal/store"
-	"log"
+	"github.com/spf13/cobra"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	_ "net/http/pprof"
 )
 
+var flagPrintConfig bool
+
+var rootCmd = &cobra.Command{
+	Use:   "crossword-game",
+	Short: "Crossword Game server",
+	Long: "Serves the Crossword Game web UI and JSON API\n\n" +
+		"Settings are read from, in increasing precedence: the defaults, a YAML config file,\n" +
+		"environment variables and flags",
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cmd.Flags(), os.Getenv)
+		if err != nil {
+			return err
+		}
+
+		if flagPrintConfig {
+			out, err := cfg.Masked().YAML()
+			if err != nil {
+				return err
+			}
+			_, err = cmd.OutOrStdout().Write(out)
+			return err
+		}
+
+		return run(cfg)
+	},
+}
+
+func init() {
+	config.RegisterFlags(rootCmd.Flags())
+	rootCmd.Flags().BoolVar(&flagPrintConfig, "print-config", false, "print the config, with secrets masked, and exit")
+}
+
 func main() {
-	if os.Getenv("PROFILE") == "true" {
-		go func() {
-			log.Print(http.ListenAndServe(":1234", nil))
-		}()
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
+}
 
-	logger, err := logging.NewLogger(true)
+func run(cfg *config.Config) error {
+	logger, err := logging.NewLogger(cfg.Log.Debug)
 	if err != nil {
-		log.Fatalf("error creating logger: %v", err)
+		return fmt.Errorf("error creating logger: %w", err)
 	}
 
 	logger.Infow("Initialising crossword-game")
 
-	// TODO: Replace the key
-	sessionStore := sessions.NewCookieStore([]byte("replace-me-key"))
-	logger.Infow("Initialising datastore connection")
+	if cfg.Server.ProfilingAddr != "" {
+		go func() {
+			logger.Warnw("profiling server stopped", "error", http.ListenAndServe(cfg.Server.ProfilingAddr, nil))
+		}()
+	}
+
+	// Metrics have a listener of their own, so they aren't public, and scrapes skip the API's sessions and access log
+	appMetrics := metrics.NewMetrics()
+	if cfg.Server.MetricsAddr != "" {
+		go func() {
+			logger.Warnw("metrics server stopped", "error", http.ListenAndServe(cfg.Server.MetricsAddr, api.NewMetricsHandler(appMetrics)))
+		}()
+	}
+
+	// Live connections close as soon as shutdown begins, while background work carries on until requests drain
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	connectionsCtx, closeConnections := context.WithCancel(backgroundCtx)
+	defer closeConnections()
+	lifetime := api.Lifetime{
+		Connections: connectionsCtx,
+		Background:  backgroundCtx,
+	}
+
+	generatedSessionKey, err := cfg.EnsureSessionKey()
+	if err != nil {
+		return err
+	}
+	if generatedSessionKey {
+		logger.Warnw("no session key configured, so logins are signed with a random key and end when the server restarts")
+	}
+	if cfg.Session.EncryptionKey == "" {
+		logger.Warnw("no session encryption key configured, so session cookies are signed but readable")
+	}
+	sessionStore := api.NewSessionStore(cfg)
+
+	logger.Infow("Initialising datastore connection", "backend", cfg.Store.Backend)
+	// The config only allows backends known here
 	db := store.NewInMemoryStore()
-	handler, err := api.SetupAPI(
-		logger,
-		db,
-		sessionStore,
-		"./schema/openapi.yaml",
-		"./data/words.txt",
-	)
+
+	// Replicas share events through Redis if it is configured, so each can update pages served by the others
+	var eventBroker broker.Broker = broker.NewInProcessBroker()
+	if cfg.Broker.RedisURL != "" {
+		logger.Infow("Connecting to Redis event broker")
+		eventBroker, err = broker.NewRedisBrokerFromURL(cfg.Broker.RedisURL)
+		if err != nil {
+			return fmt.Errorf("error connecting to Redis: %w", err)
+		}
+	}
+	defer eventBroker.Close()
+
+	handler, err := api.SetupAPI(lifetime, logger, cfg, api.Dependencies{
+		Store:        db,
+		WebhookStore: db,
+		TokenStore:   db,
+		SessionStore: sessionStore,
+		Broker:       eventBroker,
+		// Each replica limits the requests it serves, so limits are effectively multiplied by the number of replicas
+		RateLimiter: ratelimit.NewInMemoryLimiter(),
+		Metrics:     appMetrics,
+	})
 	if err != nil {
-		logger.Fatalf("error setting up API: %v", err)
+		return fmt.Errorf("error setting up API: %w", err)
 	}
 
-	logger.Infow("starting server", "port", 8080)
-	if err := http.ListenAndServe(":8080", handler); err != nil {
-		logger.Fatalf("error serving: %v", err)
+	listener, err := net.Listen("tcp", cfg.Server.Addr)
+	if err != nil {
+		return fmt.Errorf("error listening: %w", err)
+	}
+
+	// Rolling deploys stop the old server with SIGTERM
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+
+	logger.Infow("starting server", "addr", cfg.Server.Addr)
+	// A failed server still flushes the datastore, then exits non-zero so supervisors don't take it for a clean stop
+	serveErr := api.Serve(signalCtx, logger, listener, handler, cfg.Server, closeConnections)
+	if serveErr != nil {
+		logger.Errorw("error serving", "error", serveErr)
+	}
+
+	stopBackground()
+	var flushErr error
+	if flusher, ok := any(db).(store.Flusher); ok {
+		logger.Infow("flushing datastore")
+		flushErr = flusher.Flush()
+		if flushErr != nil {
+			logger.Errorw("error flushing datastore", "error", flushErr)
+		}
+	}
+	logger.Infow("server stopped")
+
+	if serveErr != nil {
+		return fmt.Errorf("error serving: %w", serveErr)
+	}
+	if flushErr != nil {
+		return fmt.Errorf("error flushing datastore: %w", flushErr)
 	}
+	return nil
 }
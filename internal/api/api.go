@@ -6,44 +6,135 @@ import (
 	"github.com/mcoot/crosswordgame-go/internal/api/jsonapi"
 	"github.com/mcoot/crosswordgame-go/internal/api/utils"
 	"github.com/mcoot/crosswordgame-go/internal/api/webapi"
+	"github.com/mcoot/crosswordgame-go/internal/apitoken"
+	"github.com/mcoot/crosswordgame-go/internal/backup"
+	"github.com/mcoot/crosswordgame-go/internal/broker"
+	"github.com/mcoot/crosswordgame-go/internal/config"
+	"github.com/mcoot/crosswordgame-go/internal/events"
 	"github.com/mcoot/crosswordgame-go/internal/game"
 	"github.com/mcoot/crosswordgame-go/internal/game/scoring"
 	"github.com/mcoot/crosswordgame-go/internal/game/scoring/matching"
 	"github.com/mcoot/crosswordgame-go/internal/lobby"
+	"github.com/mcoot/crosswordgame-go/internal/metrics"
 	"github.com/mcoot/crosswordgame-go/internal/player"
+	"github.com/mcoot/crosswordgame-go/internal/presence"
+	"github.com/mcoot/crosswordgame-go/internal/ratelimit"
+	"github.com/mcoot/crosswordgame-go/internal/sso"
 	"github.com/mcoot/crosswordgame-go/internal/store"
+	"github.com/mcoot/crosswordgame-go/internal/webhook"
 	"github.com/tomarrell/wrapcheck/v2/wrapcheck/testdata/ignore_pkg_errors/src/github.com/pkg/errors"
 	"go.uber.org/zap"
 	"net/http"
+	"time"
 )
 
+// jsonAPIPrefix is where the JSON API is served, with the web UI everywhere else
+const jsonAPIPrefix = "/api/v1"
+
+// Dependencies are the API's connections to the world outside it, which the binary builds from its config
+type Dependencies struct {
+	Store        store.Store
+	WebhookStore store.WebhookStore
+	TokenStore   store.TokenStore
+	SessionStore sessions.Store
+	// Broker shares events between replicas
+	Broker broker.Broker
+	// RateLimiter keeps the buckets for rate limits, if they are enabled
+	RateLimiter ratelimit.Limiter
+	// Metrics records what the API does, and is served apart from it on the metrics address
+	Metrics *metrics.Metrics
+}
+
+// SetupAPI builds the handler for the whole API, with background work and live connections bound by the lifetime
 func SetupAPI(
+	lifetime Lifetime,
 	logger *zap.SugaredLogger,
-	db store.Store,
-	sessionStore sessions.Store,
-	schemaPath string,
-	dictPath string,
+	cfg *config.Config,
+	deps Dependencies,
 ) (http.Handler, error) {
+	appMetrics := deps.Metrics
+	db := store.NewInstrumentedStore(deps.Store, appMetrics.ObserveStoreOperation)
 	router := mux.NewRouter()
 
-	apiRouter := router.PathPrefix("/api/v1").Subrouter()
+	apiRouter := router.PathPrefix(jsonAPIPrefix).Subrouter()
 
-	sessionManager := utils.NewSessionManager(sessionStore)
+	sessionManager := utils.NewSessionManager(deps.SessionStore, utils.SessionTimeouts{
+		MaxAge:      cfg.Session.MaxAge,
+		IdleTimeout: cfg.Session.IdleTimeout,
+	})
 
 	logger.Infow("Loading dictionary")
-	wordList, err := matching.LoadDictionary(50000, dictPath)
+	dictionaryLoadStart := time.Now()
+	wordList, err := matching.LoadDictionary(50000, cfg.Dictionary.Path)
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating building dictionary matcher")
 	}
 
 	logger.Infow("Building word matcher")
 	scoringMatcher := matching.NewSuffixArrayMatcher(wordList)
+	appMetrics.SetDictionaryLoadDuration(time.Since(dictionaryLoadStart))
 
 	logger.Infow("Building game logic components")
+	eventBus := events.NewEventBus()
 	gameScorer := scoring.NewTxtDictScorer(scoringMatcher)
-	gameManager := game.NewGameManager(db, gameScorer)
-	lobbyManager := lobby.NewLobbyManager(db)
-	playerManager := player.NewPlayerManager(db)
+	gameManager := game.NewGameManager(db, gameScorer, eventBus).WithMetrics(appMetrics)
+	appMetrics.ObserveActiveGames(gameManager.CountActiveGames)
+	lobbyManager := lobby.NewLobbyManager(db, eventBus)
+	playerManager := player.NewPlayerManager(db, eventBus)
+
+	webhookManager := webhook.NewWebhookManager(deps.WebhookStore, db, cfg.Webhooks.AllowPrivateAddresses)
+	tokenManager := apitoken.NewTokenManager(deps.TokenStore, db)
+	presenceTracker := presence.NewTracker(eventBus, presence.Config{
+		IdleAfter:       cfg.Presence.IdleAfter,
+		DisconnectGrace: cfg.Presence.DisconnectGrace,
+	})
+
+	// Live connections follow the events of every replica, relayed through the broker
+	fanoutBus := events.NewEventBus()
+	eventCodec := events.NewCodec()
+	game.RegisterEventTypes(eventCodec)
+	lobby.RegisterEventTypes(eventCodec)
+	player.RegisterEventTypes(eventCodec)
+	presence.RegisterEventTypes(eventCodec)
+	err = broker.NewEventRelay(deps.Broker, eventCodec, logger.Named("relay")).
+		Start(lifetime.Background, eventBus, fanoutBus)
+	if err != nil {
+		return nil, errors.Wrap(err, "error relaying events through broker")
+	}
+
+	go events.NewEventConsumer(eventBus, events.AnyKind).
+		Run(lifetime.Background, events.NewLoggingHandler(logger.Named("events")))
+	dispatcherConfig := webhook.DefaultDispatcherConfig
+	dispatcherConfig.AllowPrivateAddresses = cfg.Webhooks.AllowPrivateAddresses
+	webhookDispatcher := webhook.NewDispatcher(deps.WebhookStore, db, logger.Named("webhooks"), dispatcherConfig)
+	go webhookDispatcher.Run(lifetime.Background, eventBus)
+
+	var ssoProvider *sso.Provider
+	if cfg.OIDC.IssuerURL != "" {
+		logger.Infow("Discovering OIDC provider", "issuer_url", cfg.OIDC.IssuerURL)
+		ssoProvider, err = sso.NewProvider(lifetime.Background, sso.Config{
+			IssuerURL:    cfg.OIDC.IssuerURL,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+			Name:         cfg.OIDC.ProviderName,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "error setting up OIDC sign-in")
+		}
+	}
+
+	var rateLimiter ratelimit.Limiter = ratelimit.Unlimited{}
+	if cfg.RateLimit.Enabled {
+		rateLimiter = deps.RateLimiter
+	}
+	rateLimits := ratelimit.NewGuard(rateLimiter, map[ratelimit.Action]ratelimit.Limit{
+		ratelimit.ActionLogin:       toLimit(cfg.RateLimit.Login),
+		ratelimit.ActionJoinLobby:   toLimit(cfg.RateLimit.JoinLobby),
+		ratelimit.ActionCreateLobby: toLimit(cfg.RateLimit.CreateLobby),
+		ratelimit.ActionCreateGame:  toLimit(cfg.RateLimit.CreateGame),
+		ratelimit.ActionMove:        toLimit(cfg.RateLimit.Move),
+	}, cfg.RateLimit.ClientIPHeader)
 
 	logger.Infow("Initialising APIs")
 	staticAssetsHandler := webapi.NewStaticAssets()
@@ -51,18 +142,54 @@ func SetupAPI(
 	if err != nil {
 		return nil, errors.Wrap(err, "error attaching static assets to router")
 	}
-	jsonApi := jsonapi.NewCrosswordGameAPI(gameManager, lobbyManager, playerManager)
-	err = jsonApi.AttachToRouter(apiRouter, logger, schemaPath)
+	jsonApi := jsonapi.NewCrosswordGameAPI(
+		db,
+		backup.Stores{State: db, Webhooks: deps.WebhookStore, Tokens: deps.TokenStore},
+		cfg.Admin.Token,
+		sessionManager,
+		eventBus,
+		fanoutBus,
+		gameManager,
+		lobbyManager,
+		playerManager,
+		webhookManager,
+		tokenManager,
+		presenceTracker,
+		rateLimits,
+	)
+	err = jsonApi.AttachToRouter(lifetime.Connections, apiRouter, logger, cfg.SchemaPath)
 	if err != nil {
 		return nil, errors.Wrap(err, "error attaching JSON API to router")
 	}
-	webApi := webapi.NewCrosswordGameWebAPI(sessionManager, gameManager, lobbyManager, playerManager)
-	err = webApi.AttachToRouter(router)
+	webApi := webapi.NewCrosswordGameWebAPI(
+		sessionManager,
+		db,
+		eventBus,
+		fanoutBus,
+		gameManager,
+		lobbyManager,
+		playerManager,
+		tokenManager,
+		presenceTracker,
+		ssoProvider,
+		rateLimits,
+		appMetrics,
+	)
+	err = webApi.AttachToRouter(lifetime.Connections, router)
 	if err != nil {
 		return nil, errors.Wrap(err, "error attaching web API to router")
 	}
 
-	handler := SetupGlobalMiddleware(router, logger)
+	return SetupGlobalMiddleware(router, logger, appMetrics), nil
+}
+
+// NewMetricsHandler serves GET /metrics, for the metrics address rather than alongside the API
+func NewMetricsHandler(appMetrics *metrics.Metrics) http.Handler {
+	handler := http.NewServeMux()
+	handler.Handle("GET /metrics", appMetrics.Handler())
+	return handler
+}
 
-	return handler, nil
+func toLimit(limit config.RateLimit) ratelimit.Limit {
+	return ratelimit.Limit{Burst: limit.Burst, Interval: limit.Interval}
 }
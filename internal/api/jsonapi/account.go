@@ -0,0 +1,309 @@
+package jsonapi
+
+import (
+	"encoding/json"
+	"github.com/mcoot/crosswordgame-go/internal/api/jsonapi/utils"
+	commonutils "github.com/mcoot/crosswordgame-go/internal/api/utils"
+	apitokentypes "github.com/mcoot/crosswordgame-go/internal/apitoken/types"
+	"github.com/mcoot/crosswordgame-go/internal/apitypes"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+	"github.com/mcoot/crosswordgame-go/internal/game"
+	"github.com/mcoot/crosswordgame-go/internal/lobby"
+	"github.com/mcoot/crosswordgame-go/internal/logging"
+	"github.com/mcoot/crosswordgame-go/internal/player"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"net/http"
+)
+
+func (c *CrosswordGameAPI) Signup(w http.ResponseWriter, r *http.Request) {
+	logger := logging.GetLogger(r.Context())
+
+	var req apitypes.SignupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	if err := c.requireLoggedOut(r, "signup"); err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	var playerId playertypes.PlayerId
+	err := c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		var err error
+		playerId, err = pm.Register(req.Username, req.DisplayName, req.Password)
+		return err
+	})
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	c.sendLoggedInAccount(w, r, playerId, 201)
+}
+
+func (c *CrosswordGameAPI) Login(w http.ResponseWriter, r *http.Request) {
+	logger := logging.GetLogger(r.Context())
+
+	var req apitypes.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	if err := c.requireLoggedOut(r, "login"); err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	var playerId playertypes.PlayerId
+	err := c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		var err error
+		playerId, err = pm.LoginWithPassword(req.Username, req.Password)
+		return err
+	})
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	c.sendLoggedInAccount(w, r, playerId, 200)
+}
+
+func (c *CrosswordGameAPI) Logout(w http.ResponseWriter, r *http.Request) {
+	logger := logging.GetLogger(r.Context())
+
+	if _, err := c.getLoggedInSession(r); err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	err := c.sessionManager.ClearLoggedInPlayer(w, r)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	utils.SendResponse(logger, w, &apitypes.LogoutResponse{}, 200)
+}
+
+// LogoutEverywhere ends every session the account has logged in to, including the caller's if they used one
+func (c *CrosswordGameAPI) LogoutEverywhere(w http.ResponseWriter, r *http.Request) {
+	logger := logging.GetLogger(r.Context())
+
+	playerId, err := requireAccountCaller(r)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		return pm.RevokeSessions(playerId)
+	})
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	logger.Infow("player logged out everywhere")
+
+	utils.SendResponse(logger, w, &apitypes.LogoutResponse{}, 200)
+}
+
+func (c *CrosswordGameAPI) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	logger := logging.GetLogger(r.Context())
+
+	var req apitypes.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	session, err := c.getLoggedInSession(r)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	playerId := session.Player.Username
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		return pm.ChangePassword(playerId, req.CurrentPassword, req.NewPassword)
+	})
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	// Changing the password ends every other login, along with the player's API tokens
+	err = c.tokenManager.RevokeAllTokens(playerId)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+	err = c.saveLoggedInPlayer(w, r, playerId)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	logger.Infow("player changed password")
+	utils.SendResponse(logger, w, &apitypes.ChangePasswordResponse{}, 200)
+}
+
+func (c *CrosswordGameAPI) CreateToken(w http.ResponseWriter, r *http.Request) {
+	logger := logging.GetLogger(r.Context())
+
+	var req apitypes.CreateTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	playerId, err := requireAccountCaller(r)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	token, bearerToken, err := c.tokenManager.IssueToken(playerId, req.Name, req.Scopes)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	logger.Infow("API token issued", "token", token.Id, "scopes", token.Scopes)
+
+	utils.SendResponse(logger, w, &apitypes.CreateTokenResponse{
+		Token:       apitypes.ToToken(token),
+		BearerToken: bearerToken,
+	}, 201)
+}
+
+func (c *CrosswordGameAPI) ListTokens(w http.ResponseWriter, r *http.Request) {
+	logger := logging.GetLogger(r.Context())
+
+	playerId, err := requireAccountCaller(r)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	tokens, err := c.tokenManager.ListTokens(playerId)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	resp := &apitypes.ListTokensResponse{
+		Tokens: make([]apitypes.Token, 0, len(tokens)),
+	}
+	for _, token := range tokens {
+		resp.Tokens = append(resp.Tokens, apitypes.ToToken(token))
+	}
+	utils.SendResponse(logger, w, resp, 200)
+}
+
+func (c *CrosswordGameAPI) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	logger := logging.GetLogger(r.Context())
+	tokenId := commonutils.GetTokenIdPathParam(r)
+
+	playerId, err := requireAccountCaller(r)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	err = c.tokenManager.RevokeToken(playerId, tokenId)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	logger.Infow("API token revoked", "token", tokenId)
+
+	utils.SendResponse(logger, w, &apitypes.RevokeTokenResponse{}, 200)
+}
+
+// requireAccountCaller returns the player whose account the request manages, which the admin token has none of
+func requireAccountCaller(r *http.Request) (playertypes.PlayerId, error) {
+	caller, err := requireCaller(r, apitokentypes.ScopeAccount)
+	if err != nil {
+		return "", err
+	}
+	if caller.admin {
+		return "", &errors.InvalidActionError{
+			Action: "manage_account",
+			Reason: "the admin token does not belong to an account",
+		}
+	}
+	return caller.playerId, nil
+}
+
+// getLoggedInSession returns the caller's session, which is shared with the web UI
+func (c *CrosswordGameAPI) getLoggedInSession(r *http.Request) (*commonutils.Session, error) {
+	session, err := c.sessionManager.GetSession(r, c.playerManager)
+	if err != nil {
+		return nil, err
+	}
+	if !session.IsLoggedIn() {
+		return nil, &errors.UnauthorizedError{Reason: "not logged in"}
+	}
+	return session, nil
+}
+
+func (c *CrosswordGameAPI) requireLoggedOut(r *http.Request, action string) error {
+	session, err := c.sessionManager.GetSession(r, c.playerManager)
+	if err != nil {
+		return err
+	}
+	if session.IsLoggedIn() {
+		return &errors.InvalidActionError{
+			Action: action,
+			Reason: "already logged in",
+		}
+	}
+	return nil
+}
+
+// sendLoggedInAccount saves the player to the caller's session cookie and responds with their account
+func (c *CrosswordGameAPI) sendLoggedInAccount(w http.ResponseWriter, r *http.Request, playerId playertypes.PlayerId, code int) {
+	logger := logging.GetLogger(r.Context())
+
+	p, err := c.playerManager.LookupPlayer(playerId)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	err = c.saveLoggedInPlayer(w, r, playerId)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	utils.SendResponse(logger, w, &apitypes.AccountResponse{
+		PlayerId:    p.Username,
+		DisplayName: p.DisplayName,
+	}, code)
+}
+
+// saveLoggedInPlayer logs the player in to the caller's session cookie
+// The account's next requests by cookie need the session's CSRF token, which logging in replaces, so it is sent back
+func (c *CrosswordGameAPI) saveLoggedInPlayer(w http.ResponseWriter, r *http.Request, playerId playertypes.PlayerId) error {
+	err := c.sessionManager.SaveLoggedInPlayer(w, r, playerId)
+	if err != nil {
+		return err
+	}
+
+	session, err := c.sessionManager.GetSession(r, c.playerManager)
+	if err != nil {
+		return err
+	}
+	token, err := c.sessionManager.IssueCSRFToken(w, r, session)
+	if err != nil {
+		return err
+	}
+	w.Header().Set(apitypes.CSRFHeader, token)
+	return nil
+}
@@ -1,65 +1,154 @@
 package jsonapi
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/mcoot/crosswordgame-go/internal/api/jsonapi/utils"
 	commonutils "github.com/mcoot/crosswordgame-go/internal/api/utils"
+	"github.com/mcoot/crosswordgame-go/internal/apitoken"
+	apitokentypes "github.com/mcoot/crosswordgame-go/internal/apitoken/types"
 	"github.com/mcoot/crosswordgame-go/internal/apitypes"
+	"github.com/mcoot/crosswordgame-go/internal/backup"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+	"github.com/mcoot/crosswordgame-go/internal/events"
 	"github.com/mcoot/crosswordgame-go/internal/game"
+	gametypes "github.com/mcoot/crosswordgame-go/internal/game/types"
 	"github.com/mcoot/crosswordgame-go/internal/lobby"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
 	"github.com/mcoot/crosswordgame-go/internal/logging"
 	"github.com/mcoot/crosswordgame-go/internal/player"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"github.com/mcoot/crosswordgame-go/internal/presence"
+	"github.com/mcoot/crosswordgame-go/internal/ratelimit"
+	"github.com/mcoot/crosswordgame-go/internal/store"
+	"github.com/mcoot/crosswordgame-go/internal/webhook"
 	"go.uber.org/zap"
 	"net/http"
+	"slices"
 	"time"
 )
 
 type CrosswordGameAPI struct {
-	startTime     time.Time
-	gameManager   *game.Manager
-	lobbyManager  *lobby.Manager
-	playerManager *player.Manager
+	startTime time.Time
+	db        store.Store
+	// backupStores are those exported and imported by admins, which include webhooks and tokens as well as db
+	backupStores backup.Stores
+	adminToken   string
+	// sessionManager keeps accounts logged in by cookie, as in the web UI
+	sessionManager *commonutils.SessionManager
+	// transactions runs flows against a single store transaction, publishing their events once it commits
+	transactions *commonutils.Transactions
+	// fanoutBus carries the events of every replica, for streaming to clients
+	fanoutBus      *events.EventBus
+	gameManager    *game.Manager
+	lobbyManager   *lobby.Manager
+	playerManager  *player.Manager
+	webhookManager *webhook.Manager
+	tokenManager   *apitoken.Manager
+	presence       *presence.Tracker
+	rateLimits     *ratelimit.Guard
+	// closing is closed once the server starts shutting down, ending event streams
+	closing <-chan struct{}
 }
 
+// NewCrosswordGameAPI creates the JSON API
+// The admin endpoints are only served if adminToken is non-empty, and require it as a bearer token
+// The admin token also lets its holder act as any player
 func NewCrosswordGameAPI(
+	db store.Store,
+	backupStores backup.Stores,
+	adminToken string,
+	sessionManager *commonutils.SessionManager,
+	eventBus *events.EventBus,
+	fanoutBus *events.EventBus,
 	gameManager *game.Manager,
 	lobbyManager *lobby.Manager,
 	playerManager *player.Manager,
+	webhookManager *webhook.Manager,
+	tokenManager *apitoken.Manager,
+	presenceTracker *presence.Tracker,
+	rateLimits *ratelimit.Guard,
 ) *CrosswordGameAPI {
 	return &CrosswordGameAPI{
-		startTime:     time.Now(),
-		gameManager:   gameManager,
-		lobbyManager:  lobbyManager,
-		playerManager: playerManager,
+		startTime:      time.Now(),
+		db:             db,
+		backupStores:   backupStores,
+		adminToken:     adminToken,
+		sessionManager: sessionManager,
+		transactions:   commonutils.NewTransactions(db, eventBus, gameManager, lobbyManager, playerManager),
+		fanoutBus:      fanoutBus,
+		gameManager:    gameManager,
+		lobbyManager:   lobbyManager,
+		playerManager:  playerManager,
+		webhookManager: webhookManager,
+		tokenManager:   tokenManager,
+		presence:       presenceTracker,
+		rateLimits:     rateLimits,
 	}
 }
 
-func (c *CrosswordGameAPI) AttachToRouter(router *mux.Router, baseLogger *zap.SugaredLogger, schemaPath string) error {
+// AttachToRouter serves the JSON API on the router, with event streams open until ctx is done
+func (c *CrosswordGameAPI) AttachToRouter(ctx context.Context, router *mux.Router, baseLogger *zap.SugaredLogger, schemaPath string) error {
+	c.closing = ctx.Done()
+
 	err := setupMiddleware(router, baseLogger, schemaPath)
 	if err != nil {
 		return err
 	}
 
+	router.Use(c.authMiddleware)
+
 	router.HandleFunc("/health", c.Healthcheck).Methods("GET")
 
-	router.HandleFunc("/game", c.CreateGame).Methods("POST")
+	router.Handle("/account/signup", c.limitPerIP(ratelimit.ActionLogin, c.Signup)).Methods("POST")
+	router.Handle("/account/login", c.limitPerIP(ratelimit.ActionLogin, c.Login)).Methods("POST")
+	router.HandleFunc("/account/logout", c.Logout).Methods("POST")
+	router.HandleFunc("/account/logout-everywhere", c.LogoutEverywhere).Methods("POST")
+	router.HandleFunc("/account/password", c.ChangePassword).Methods("POST")
+	router.HandleFunc("/account/tokens", c.CreateToken).Methods("POST")
+	router.HandleFunc("/account/tokens", c.ListTokens).Methods("GET")
+	router.HandleFunc("/account/tokens/{tokenId}", c.RevokeToken).Methods("DELETE")
+
+	router.Handle("/game", c.limitPerCaller(ratelimit.ActionCreateGame, c.CreateGame)).Methods("POST")
 	router.HandleFunc("/game/{gameId}", c.GetGameState).Methods("GET")
+	router.HandleFunc("/game/{gameId}/events", c.StreamGameEvents).Methods("GET")
 	router.HandleFunc("/game/{gameId}/player/{playerId}", c.GetPlayerState).Methods("GET")
-	router.HandleFunc("/game/{gameId}/player/{playerId}/announce", c.SubmitAnnouncement).Methods("POST")
-	router.HandleFunc("/game/{gameId}/player/{playerId}/place", c.SubmitPlacement).Methods("POST")
+	router.Handle("/game/{gameId}/player/{playerId}/announce", c.limitPerCaller(ratelimit.ActionMove, c.SubmitAnnouncement)).Methods("POST")
+	router.Handle("/game/{gameId}/player/{playerId}/place", c.limitPerCaller(ratelimit.ActionMove, c.SubmitPlacement)).Methods("POST")
 	router.HandleFunc("/game/{gameId}/player/{playerId}/score", c.GetPlayerScore).Methods("GET")
 
-	router.HandleFunc("/lobby", c.CreateLobby).Methods("POST")
+	router.Handle("/lobby", c.limitPerCaller(ratelimit.ActionCreateLobby, c.CreateLobby)).Methods("POST")
+	router.HandleFunc("/lobby", c.ListPublicLobbies).Methods("GET")
 	router.HandleFunc("/lobby/{lobbyId}", c.GetLobbyState).Methods("GET")
-	router.HandleFunc("/lobby/{lobbyId}/join", c.JoinPlayerToLobby).Methods("POST")
+	router.HandleFunc("/lobby/{lobbyId}/events", c.StreamLobbyEvents).Methods("GET")
+	router.Handle("/lobby/{lobbyId}/join", c.limitPerIP(ratelimit.ActionJoinLobby, c.JoinPlayerToLobby)).Methods("POST")
 	router.HandleFunc("/lobby/{lobbyId}/remove", c.RemovePlayerFromLobby).Methods("POST")
+	router.HandleFunc("/lobby/{lobbyId}/host", c.TransferLobbyHost).Methods("POST")
+	router.HandleFunc("/lobby/{lobbyId}/lock", c.SetLobbyLocked).Methods("POST")
+	router.HandleFunc("/lobby/{lobbyId}/settings", c.UpdateLobbySettings).Methods("POST")
 	router.HandleFunc("/lobby/{lobbyId}/attach", c.AttachGameToLobby).Methods("POST")
 	router.HandleFunc("/lobby/{lobbyId}/detach", c.DetachGameFromLobby).Methods("POST")
+	router.HandleFunc("/lobby/{lobbyId}/webhooks", c.RegisterLobbyWebhook).Methods("POST")
+	router.HandleFunc("/lobby/{lobbyId}/webhooks", c.ListLobbyWebhooks).Methods("GET")
+	router.HandleFunc("/lobby/{lobbyId}/webhooks/{webhookId}", c.DeleteLobbyWebhook).Methods("DELETE")
+	router.HandleFunc("/lobby/{lobbyId}/webhooks/{webhookId}/deliveries", c.GetLobbyWebhookDeliveries).Methods("GET")
 
 	// TODO: The CLI will have to be reworked to add proper player management here (e.g. session support)
 	router.HandleFunc("/player/{playerId}/lobby", c.GetLobbyForPlayer).Methods("GET")
 
+	if c.adminToken != "" {
+		adminRouter := router.PathPrefix("/admin").Subrouter()
+		adminRouter.Use(adminAuthMiddleware(c.adminToken))
+		adminRouter.HandleFunc("/export", c.ExportState).Methods("GET")
+		adminRouter.HandleFunc("/import", c.ImportState).Methods("POST")
+		adminRouter.HandleFunc("/webhooks", c.RegisterServerWebhook).Methods("POST")
+		adminRouter.HandleFunc("/webhooks", c.ListServerWebhooks).Methods("GET")
+		adminRouter.HandleFunc("/webhooks/{webhookId}", c.DeleteServerWebhook).Methods("DELETE")
+		adminRouter.HandleFunc("/webhooks/{webhookId}/deliveries", c.GetServerWebhookDeliveries).Methods("GET")
+	}
+
 	return nil
 }
 
@@ -79,12 +168,32 @@ func (c *CrosswordGameAPI) CreateGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	boardDimension := 5
+	caller, err := requireCaller(r, apitokentypes.ScopePlay)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+	if !caller.admin && !slices.Contains(req.Players, caller.playerId) {
+		utils.SendError(logger, w, &errors.ForbiddenError{Reason: "can only create games you play in"})
+		return
+	}
+
+	boardDimension := lobbytypes.DefaultBoardSize
 	if req.BoardDimension != nil {
 		boardDimension = *req.BoardDimension
 	}
+	err = lobbytypes.ValidateBoardSize(boardDimension)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
 
-	gameId, err := c.gameManager.CreateGame(req.Players, boardDimension)
+	var gameId gametypes.GameId
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		var err error
+		gameId, err = gm.CreateGame(req.Players, boardDimension)
+		return err
+	})
 	if err != nil {
 		utils.SendError(logger, w, err)
 		return
@@ -121,6 +230,22 @@ func (c *CrosswordGameAPI) GetPlayerState(w http.ResponseWriter, r *http.Request
 	gameId := commonutils.GetGameIdPathParam(r)
 	playerId := commonutils.GetPlayerIdPathParam(r)
 
+	// Boards show where players placed, which only the game's players may see
+	caller, err := requireCaller(r, apitokentypes.ScopePlay)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+	gameState, err := c.gameManager.GetGameState(gameId)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+	if !caller.admin && !slices.Contains(gameState.Players, caller.playerId) {
+		utils.SendError(logger, w, &errors.ForbiddenError{Reason: "can only see boards in games you play in"})
+		return
+	}
+
 	playerState, err := c.gameManager.GetPlayerBoard(gameId, playerId)
 	if err != nil {
 		utils.SendError(logger, w, err)
@@ -145,7 +270,15 @@ func (c *CrosswordGameAPI) SubmitAnnouncement(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	err := c.gameManager.SubmitAnnouncement(gameId, playerId, req.Letter)
+	err := requireActingAs(r, apitokentypes.ScopePlay, playerId)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		return gm.SubmitAnnouncement(gameId, playerId, req.Letter)
+	})
 	if err != nil {
 		utils.SendError(logger, w, err)
 		return
@@ -165,7 +298,15 @@ func (c *CrosswordGameAPI) SubmitPlacement(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err := c.gameManager.SubmitPlacement(gameId, playerId, req.Row, req.Column)
+	err := requireActingAs(r, apitokentypes.ScopePlay, playerId)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		return gm.SubmitPlacement(gameId, playerId, req.Row, req.Column)
+	})
 	if err != nil {
 		utils.SendError(logger, w, err)
 		return
@@ -202,7 +343,19 @@ func (c *CrosswordGameAPI) CreateLobby(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	lobbyId, err := c.lobbyManager.CreateLobby(req.Name)
+	// The caller hosts the lobby, though they only play in it if they join it too
+	caller, err := requireCaller(r, apitokentypes.ScopeLobby)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	var lobbyId lobbytypes.LobbyId
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		var err error
+		lobbyId, err = lm.CreateLobby(req.Name, caller.playerId)
+		return err
+	})
 	if err != nil {
 		utils.SendError(logger, w, err)
 		return
@@ -222,12 +375,10 @@ func (c *CrosswordGameAPI) GetLobbyState(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	resp := apitypes.GetLobbyStateResponse{
-		Name:    lobbyState.Name,
-		Players: lobbyState.Players,
-	}
-	if lobbyState.HasRunningGame() {
-		resp.GameID = lobbyState.RunningGame.GameId
+	resp, err := c.toLobbyStateResponse(lobbyState)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
 	}
 
 	utils.SendResponse(logger, w, resp, 200)
@@ -243,7 +394,15 @@ func (c *CrosswordGameAPI) JoinPlayerToLobby(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err := c.lobbyManager.JoinPlayerToLobby(lobbyId, req.PlayerId)
+	err := requireActingAs(r, apitokentypes.ScopeLobby, req.PlayerId)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		return lm.JoinPlayerToLobby(lobbyId, req.PlayerId, req.Password)
+	})
 	if err != nil {
 		utils.SendError(logger, w, err)
 		return
@@ -262,7 +421,21 @@ func (c *CrosswordGameAPI) RemovePlayerFromLobby(w http.ResponseWriter, r *http.
 		return
 	}
 
-	err := c.lobbyManager.RemovePlayerFromLobby(lobbyId, req.PlayerId)
+	// Players may leave by themselves, while the host may kick anyone else
+	err := requireActingAs(r, apitokentypes.ScopeLobby, req.PlayerId)
+	if err == nil {
+		err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+			return lm.RemovePlayerFromLobby(lobbyId, req.PlayerId)
+		})
+	} else if errors.IsForbiddenError(err) {
+		var host playertypes.PlayerId
+		host, err = c.requireLobbyHost(r, apitokentypes.ScopeLobby, lobbyId)
+		if err == nil {
+			err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+				return lm.KickPlayer(lobbyId, host, req.PlayerId)
+			})
+		}
+	}
 	if err != nil {
 		utils.SendError(logger, w, err)
 		return
@@ -281,7 +454,37 @@ func (c *CrosswordGameAPI) AttachGameToLobby(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err := c.lobbyManager.AttachGameToLobby(lobbyId, req.GameId)
+	caller, err := requireCaller(r, apitokentypes.ScopeLobby)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		_, err := caller.actAsHost(lm, lobbyId)
+		if err != nil {
+			return err
+		}
+
+		lobbyState, err := lm.GetLobbyState(lobbyId)
+		if err != nil {
+			return err
+		}
+		gameState, err := gm.GetGameState(req.GameId)
+		if err != nil {
+			return err
+		}
+		for _, playerId := range lobbyState.Players {
+			if !slices.Contains(gameState.Players, playerId) {
+				return &errors.InvalidActionError{
+					Action: "attach_game_to_lobby",
+					Reason: fmt.Sprintf("player %s is in lobby %s but not game %s", playerId, lobbyId, req.GameId),
+				}
+			}
+		}
+
+		return lm.AttachGameToLobby(lobbyId, req.GameId)
+	})
 	if err != nil {
 		utils.SendError(logger, w, err)
 		return
@@ -294,7 +497,19 @@ func (c *CrosswordGameAPI) DetachGameFromLobby(w http.ResponseWriter, r *http.Re
 	logger := logging.GetLogger(r.Context())
 	lobbyId := commonutils.GetLobbyIdPathParam(r)
 
-	err := c.lobbyManager.DetachGameFromLobby(lobbyId)
+	caller, err := requireCaller(r, apitokentypes.ScopeLobby)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		_, err := caller.actAsHost(lm, lobbyId)
+		if err != nil {
+			return err
+		}
+		return lm.DetachGameFromLobby(lobbyId)
+	})
 	if err != nil {
 		utils.SendError(logger, w, err)
 		return
@@ -303,6 +518,124 @@ func (c *CrosswordGameAPI) DetachGameFromLobby(w http.ResponseWriter, r *http.Re
 	utils.SendResponse(logger, w, nil, 200)
 }
 
+func (c *CrosswordGameAPI) TransferLobbyHost(w http.ResponseWriter, r *http.Request) {
+	logger := logging.GetLogger(r.Context())
+	lobbyId := commonutils.GetLobbyIdPathParam(r)
+
+	var req apitypes.TransferLobbyHostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	host, err := c.requireLobbyHost(r, apitokentypes.ScopeLobby, lobbyId)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		return lm.TransferHost(lobbyId, host, req.PlayerId)
+	})
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	utils.SendResponse(logger, w, apitypes.TransferLobbyHostResponse{}, 200)
+}
+
+func (c *CrosswordGameAPI) SetLobbyLocked(w http.ResponseWriter, r *http.Request) {
+	logger := logging.GetLogger(r.Context())
+	lobbyId := commonutils.GetLobbyIdPathParam(r)
+
+	var req apitypes.SetLobbyLockedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	host, err := c.requireLobbyHost(r, apitokentypes.ScopeLobby, lobbyId)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		return lm.SetLocked(lobbyId, host, req.Locked)
+	})
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	utils.SendResponse(logger, w, apitypes.SetLobbyLockedResponse{}, 200)
+}
+
+func (c *CrosswordGameAPI) UpdateLobbySettings(w http.ResponseWriter, r *http.Request) {
+	logger := logging.GetLogger(r.Context())
+	lobbyId := commonutils.GetLobbyIdPathParam(r)
+
+	var req apitypes.UpdateLobbySettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	host, err := c.requireLobbyHost(r, apitokentypes.ScopeLobby, lobbyId)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		return lm.UpdateSettings(lobbyId, host, lobby.SettingsUpdate{
+			MaxPlayers:   req.MaxPlayers,
+			Visibility:   req.Visibility,
+			Password:     req.Password,
+			GameDefaults: req.GameDefaults,
+		})
+	})
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	lobbyState, err := c.lobbyManager.GetLobbyState(lobbyId)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	utils.SendResponse(logger, w, apitypes.UpdateLobbySettingsResponse{
+		Settings: apitypes.ToLobbySettings(lobbyState.Settings),
+	}, 200)
+}
+
+func (c *CrosswordGameAPI) ListPublicLobbies(w http.ResponseWriter, r *http.Request) {
+	logger := logging.GetLogger(r.Context())
+
+	lobbies, err := c.lobbyManager.ListPublicLobbies()
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	resp := apitypes.ListLobbiesResponse{Lobbies: make([]apitypes.LobbySummary, len(lobbies))}
+	for i, lobbyState := range lobbies {
+		resp.Lobbies[i] = apitypes.LobbySummary{
+			LobbyId:     lobbyState.Id,
+			Name:        lobbyState.Name,
+			Host:        lobbyState.Host,
+			PlayerCount: len(lobbyState.Players),
+			Locked:      lobbyState.Locked,
+			Settings:    apitypes.ToLobbySettings(lobbyState.Settings),
+		}
+	}
+
+	utils.SendResponse(logger, w, resp, 200)
+}
+
 func (c *CrosswordGameAPI) GetLobbyForPlayer(w http.ResponseWriter, r *http.Request) {
 	logger := logging.GetLogger(r.Context())
 	playerId := commonutils.GetPlayerIdPathParam(r)
@@ -313,13 +646,91 @@ func (c *CrosswordGameAPI) GetLobbyForPlayer(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	resp := apitypes.GetLobbyStateResponse{
-		Name:    lobbyState.Name,
-		Players: lobbyState.Players,
+	resp, err := c.toLobbyStateResponse(lobbyState)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	utils.SendResponse(logger, w, resp, 200)
+}
+
+// toLobbyStateResponse describes the lobby with the presence of its players, and who its game is waiting on
+func (c *CrosswordGameAPI) toLobbyStateResponse(lobbyState *lobbytypes.Lobby) (*apitypes.GetLobbyStateResponse, error) {
+	resp := &apitypes.GetLobbyStateResponse{
+		Name:     lobbyState.Name,
+		Players:  lobbyState.Players,
+		Host:     lobbyState.Host,
+		Locked:   lobbyState.Locked,
+		Settings: apitypes.ToLobbySettings(lobbyState.Settings),
+		Presence: c.presence.GetAll(lobbyState.Id, lobbyState.Players),
 	}
 	if lobbyState.HasRunningGame() {
 		resp.GameID = lobbyState.RunningGame.GameId
+
+		gameState, err := c.gameManager.GetGameState(lobbyState.RunningGame.GameId)
+		if err != nil {
+			return nil, err
+		}
+		resp.WaitingOn, err = gameState.WaitingOnPlayers()
+		if err != nil {
+			return nil, err
+		}
 	}
+	return resp, nil
+}
 
-	utils.SendResponse(logger, w, resp, 200)
+func (c *CrosswordGameAPI) ExportState(w http.ResponseWriter, r *http.Request) {
+	logger := logging.GetLogger(r.Context())
+
+	w.Header().Set("Content-Type", backup.ContentType)
+	w.Header().Set(
+		"Content-Disposition",
+		fmt.Sprintf("attachment; filename=\"crosswordgame-%s.jsonl\"", time.Now().UTC().Format("20060102T150405Z")),
+	)
+	w.WriteHeader(200)
+
+	summary, err := backup.Export(c.backupStores, w)
+	if err != nil {
+		// The response is already partly written, so all we can do is log and cut the stream short
+		logger.Errorw("error exporting state", "error", err)
+		return
+	}
+
+	logger.Infow("state exported",
+		"players", summary.Players,
+		"lobbies", summary.Lobbies,
+		"games", summary.Games,
+		"webhooks", summary.Webhooks,
+		"deliveries", summary.Deliveries,
+		"tokens", summary.Tokens,
+	)
+}
+
+func (c *CrosswordGameAPI) ImportState(w http.ResponseWriter, r *http.Request) {
+	logger := logging.GetLogger(r.Context())
+
+	summary, err := backup.Import(c.backupStores, r.Body)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	logger.Infow("state imported",
+		"players", summary.Players,
+		"lobbies", summary.Lobbies,
+		"games", summary.Games,
+		"webhooks", summary.Webhooks,
+		"deliveries", summary.Deliveries,
+		"tokens", summary.Tokens,
+	)
+
+	utils.SendResponse(logger, w, &apitypes.ImportStateResponse{
+		Players:    summary.Players,
+		Lobbies:    summary.Lobbies,
+		Games:      summary.Games,
+		Webhooks:   summary.Webhooks,
+		Deliveries: summary.Deliveries,
+		Tokens:     summary.Tokens,
+	}, 200)
 }
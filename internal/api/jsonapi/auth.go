@@ -0,0 +1,168 @@
+package jsonapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"github.com/mcoot/crosswordgame-go/internal/api/jsonapi/utils"
+	commonutils "github.com/mcoot/crosswordgame-go/internal/api/utils"
+	apitokentypes "github.com/mcoot/crosswordgame-go/internal/apitoken/types"
+	"github.com/mcoot/crosswordgame-go/internal/apitypes"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+	"github.com/mcoot/crosswordgame-go/internal/lobby"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	"github.com/mcoot/crosswordgame-go/internal/logging"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	internalutils "github.com/mcoot/crosswordgame-go/internal/utils"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const contextKeyCaller = internalutils.ContextKey("caller")
+
+// caller is who made a request, from its bearer token or the session cookie shared with the web UI
+type caller struct {
+	playerId playertypes.PlayerId
+	scopes   []apitokentypes.Scope
+	// admin callers hold the server's admin token, and may act as any player
+	admin bool
+}
+
+func (c *caller) hasScope(scope apitokentypes.Scope) bool {
+	return c.admin || slices.Contains(c.scopes, scope)
+}
+
+func (c *caller) canActAs(playerId playertypes.PlayerId) bool {
+	return c.admin || c.playerId == playerId
+}
+
+// authMiddleware identifies the caller for handlers to authorise against
+// Requests without credentials carry on anonymously, as reads are public, but bad credentials are rejected outright
+func (c *CrosswordGameAPI) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller, err := c.authenticate(w, r)
+		if err != nil {
+			utils.SendError(logging.GetLogger(r.Context()), w, err)
+			return
+		}
+		if caller == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		if caller.admin {
+			logging.GetAccessLogFields(ctx).Add("admin", true)
+		} else {
+			logging.GetAccessLogFields(ctx).Add("caller_id", caller.playerId)
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, contextKeyCaller, caller)))
+	})
+}
+
+func (c *CrosswordGameAPI) authenticate(w http.ResponseWriter, r *http.Request) (*caller, error) {
+	authorization := r.Header.Get("Authorization")
+	if authorization != "" {
+		bearerToken, ok := strings.CutPrefix(authorization, "Bearer ")
+		if !ok {
+			return nil, &errors.UnauthorizedError{Reason: "the Authorization header must be a bearer token"}
+		}
+		if c.adminToken != "" && subtle.ConstantTimeCompare([]byte(bearerToken), []byte(c.adminToken)) == 1 {
+			return &caller{admin: true}, nil
+		}
+		token, err := c.tokenManager.Authenticate(bearerToken)
+		if err != nil {
+			return nil, err
+		}
+		return &caller{playerId: token.PlayerId, scopes: token.Scopes}, nil
+	}
+
+	session, err := c.sessionManager.GetSession(r, c.playerManager)
+	if err != nil {
+		return nil, err
+	}
+	if !session.IsLoggedIn() {
+		return nil, nil
+	}
+	if err := c.checkCSRFToken(w, r, session); err != nil {
+		return nil, err
+	}
+	return &caller{playerId: session.Player.Username, scopes: apitokentypes.AllScopes}, nil
+}
+
+// checkCSRFToken rejects requests changing something with the session cookie alone, which other sites can make
+// The session's CSRF token is sent back on every response, for clients to send on their next request
+func (c *CrosswordGameAPI) checkCSRFToken(w http.ResponseWriter, r *http.Request, session *commonutils.Session) error {
+	token, err := c.sessionManager.IssueCSRFToken(w, r, session)
+	if err != nil {
+		return err
+	}
+	w.Header().Set(apitypes.CSRFHeader, token)
+
+	if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+		return nil
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(apitypes.CSRFHeader)), []byte(token)) != 1 {
+		return &errors.ForbiddenError{
+			Reason: fmt.Sprintf("requests logged in by cookie must send the %s header from an earlier response, or use an API token", apitypes.CSRFHeader),
+		}
+	}
+	return nil
+}
+
+// requireCaller returns who made the request, checking they are allowed actions in the scope
+func requireCaller(r *http.Request, scope apitokentypes.Scope) (*caller, error) {
+	caller, ok := r.Context().Value(contextKeyCaller).(*caller)
+	if !ok {
+		return nil, &errors.UnauthorizedError{Reason: "log in, or send an API token as a bearer token"}
+	}
+	if !caller.hasScope(scope) {
+		return nil, &errors.ForbiddenError{Reason: fmt.Sprintf("the API token does not have the %q scope", scope)}
+	}
+	return caller, nil
+}
+
+// requireActingAs checks the request was made by the given player
+func requireActingAs(r *http.Request, scope apitokentypes.Scope, playerId playertypes.PlayerId) error {
+	caller, err := requireCaller(r, scope)
+	if err != nil {
+		return err
+	}
+	if !caller.canActAs(playerId) {
+		return &errors.ForbiddenError{Reason: fmt.Sprintf("cannot act as player %s", playerId)}
+	}
+	return nil
+}
+
+// requireLobbyHost checks the request was made by whoever runs the lobby, returning who to act as its host
+func (c *CrosswordGameAPI) requireLobbyHost(
+	r *http.Request,
+	scope apitokentypes.Scope,
+	lobbyId lobbytypes.LobbyId,
+) (playertypes.PlayerId, error) {
+	caller, err := requireCaller(r, scope)
+	if err != nil {
+		return "", err
+	}
+	return caller.actAsHost(c.lobbyManager, lobbyId)
+}
+
+// actAsHost checks the caller runs the lobby, returning who to act as its host
+// Admin callers act as the lobby's host, or as its longest-present player if it has none
+func (c *caller) actAsHost(lm *lobby.Manager, lobbyId lobbytypes.LobbyId) (playertypes.PlayerId, error) {
+	lobbyState, err := lm.GetLobbyState(lobbyId)
+	if err != nil {
+		return "", err
+	}
+	if c.admin {
+		if !lobbyState.HasHost() && len(lobbyState.Players) > 0 {
+			return lobbyState.Players[0], nil
+		}
+		return lobbyState.Host, nil
+	}
+	if lobbyState.IsRunBy(c.playerId) {
+		return c.playerId, nil
+	}
+	return "", &errors.ForbiddenError{Reason: fmt.Sprintf("only the host of lobby %s can do this", lobbyId)}
+}
@@ -0,0 +1,98 @@
+package jsonapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mcoot/crosswordgame-go/internal/api/jsonapi/utils"
+	commonutils "github.com/mcoot/crosswordgame-go/internal/api/utils"
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	"github.com/mcoot/crosswordgame-go/internal/events/public"
+	"github.com/mcoot/crosswordgame-go/internal/logging"
+	"net/http"
+)
+
+func (c *CrosswordGameAPI) StreamGameEvents(w http.ResponseWriter, r *http.Request) {
+	logger := logging.GetLogger(r.Context())
+	gameId := commonutils.GetGameIdPathParam(r)
+
+	_, err := c.gameManager.GetGameState(gameId)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	c.streamEvents(w, r, func(e public.Event) bool {
+		return e.GameId == gameId
+	})
+}
+
+// StreamLobbyEvents streams the lobby's own events, along with those of whichever game it is running
+func (c *CrosswordGameAPI) StreamLobbyEvents(w http.ResponseWriter, r *http.Request) {
+	logger := logging.GetLogger(r.Context())
+	lobbyId := commonutils.GetLobbyIdPathParam(r)
+
+	_, err := c.lobbyManager.GetLobbyState(lobbyId)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	c.streamEvents(w, r, func(e public.Event) bool {
+		if e.LobbyId != "" || e.GameId == "" {
+			return e.LobbyId == lobbyId
+		}
+		lobbyState, err := c.lobbyManager.GetLobbyForGame(e.GameId)
+		return err == nil && lobbyState.Id == lobbyId
+	})
+}
+
+// streamEvents writes each streamed event matching the filter as a Server-Sent Event, until the client goes away
+// or the server shuts down
+// Each event is named after its kind, with its payload as JSON data
+func (c *CrosswordGameAPI) streamEvents(w http.ResponseWriter, r *http.Request, filter func(e public.Event) bool) {
+	logger := logging.GetLogger(r.Context())
+
+	// Subscribe before responding, so clients see every event from the moment the stream opens
+	sub := c.fanoutBus.Subscribe(events.AnyKind)
+	defer c.fanoutBus.Unsubscribe(sub)
+
+	rc := commonutils.StartEventStream(w)
+	w.WriteHeader(200)
+	if err := rc.Flush(); err != nil {
+		logger.Errorw("event stream not supported by response writer", "error", err)
+		return
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-c.closing:
+			commonutils.EndEventStreamForShutdown(w, rc)
+			return
+		case e, ok := <-sub.Events():
+			if !ok {
+				// The bus dropped this subscriber for falling behind; the client can reconnect
+				logger.Warnw("event stream disconnected by event bus")
+				return
+			}
+			streamed, ok := public.FromEvent(e)
+			if !ok || !filter(streamed) {
+				continue
+			}
+
+			data, err := json.Marshal(streamed.Data)
+			if err != nil {
+				logger.Errorw("error serialising streamed event", "event", e.Kind(), "error", err)
+				continue
+			}
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Kind(), data)
+			if err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
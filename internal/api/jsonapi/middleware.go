@@ -2,11 +2,19 @@ package jsonapi
 
 import (
 	"context"
+	"crypto/subtle"
 	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
 	"github.com/gorilla/mux"
+	"github.com/mcoot/crosswordgame-go/internal/api/jsonapi/utils"
+	"github.com/mcoot/crosswordgame-go/internal/backup"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+	"github.com/mcoot/crosswordgame-go/internal/logging"
+	"github.com/mcoot/crosswordgame-go/internal/ratelimit"
 	nethttpmiddleware "github.com/oapi-codegen/nethttp-middleware"
 	"go.uber.org/zap"
 	"net/http"
+	"strings"
 )
 
 func setupMiddleware(router *mux.Router, baseLogger *zap.SugaredLogger, schemaPath string) error {
@@ -39,6 +47,9 @@ func buildOpenApiMiddleware(
 		return nil, err
 	}
 
+	// State dumps are validated only as opaque strings; the importer checks their contents
+	openapi3filter.RegisterBodyDecoder(backup.ContentType, openapi3filter.FileBodyDecoder)
+
 	return nethttpmiddleware.OapiRequestValidatorWithOptions(
 		doc,
 		&nethttpmiddleware.Options{
@@ -53,3 +64,43 @@ func buildOpenApiMiddleware(
 		},
 	), nil
 }
+
+func adminAuthMiddleware(adminToken string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+				utils.SendError(logging.GetLogger(r.Context()), w, &errors.UnauthorizedError{
+					Reason: "a valid admin token is required",
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// limitPerIP rate limits the handler by client IP, for requests made before there is a player to limit
+func (c *CrosswordGameAPI) limitPerIP(action ratelimit.Action, handler http.HandlerFunc) http.Handler {
+	return c.rateLimits.Middleware(action, nil, sendRateLimitError)(handler)
+}
+
+// limitPerCaller rate limits the handler by who made the request, or by client IP for anonymous requests
+func (c *CrosswordGameAPI) limitPerCaller(action ratelimit.Action, handler http.HandlerFunc) http.Handler {
+	return c.rateLimits.Middleware(action, callerRateLimitKey, sendRateLimitError)(handler)
+}
+
+func callerRateLimitKey(r *http.Request) string {
+	caller, ok := r.Context().Value(contextKeyCaller).(*caller)
+	if !ok {
+		return ""
+	}
+	if caller.admin {
+		return "admin"
+	}
+	return ratelimit.PlayerKey(caller.playerId)
+}
+
+func sendRateLimitError(w http.ResponseWriter, r *http.Request, err error) {
+	utils.SendError(logging.GetLogger(r.Context()), w, err)
+}
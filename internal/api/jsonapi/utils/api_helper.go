@@ -3,6 +3,7 @@ package utils
 import (
 	"encoding/json"
 	"github.com/mcoot/crosswordgame-go/internal/apitypes"
+	"github.com/mcoot/crosswordgame-go/internal/logging"
 	"go.uber.org/zap"
 	"net/http"
 )
@@ -18,6 +19,8 @@ func SendResponse(logger *zap.SugaredLogger, w http.ResponseWriter, resp interfa
 
 func SendError(logger *zap.SugaredLogger, w http.ResponseWriter, err error) {
 	resp := apitypes.ToErrorResponse(err)
+	// The request ID middleware sets the header before any handler runs
+	resp.RequestId = w.Header().Get(logging.RequestIdHeader)
 	logger.Warnw(
 		"error handling api request",
 		"message", resp.Message,
@@ -0,0 +1,169 @@
+package jsonapi
+
+import (
+	"encoding/json"
+	"github.com/mcoot/crosswordgame-go/internal/api/jsonapi/utils"
+	commonutils "github.com/mcoot/crosswordgame-go/internal/api/utils"
+	apitokentypes "github.com/mcoot/crosswordgame-go/internal/apitoken/types"
+	"github.com/mcoot/crosswordgame-go/internal/apitypes"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	"github.com/mcoot/crosswordgame-go/internal/logging"
+	webhooktypes "github.com/mcoot/crosswordgame-go/internal/webhook/types"
+	"net/http"
+)
+
+// Lobby webhooks are managed under the lobby by its host, while the admin routes manage server-wide webhooks
+// and can see every webhook on the server
+
+func (c *CrosswordGameAPI) RegisterLobbyWebhook(w http.ResponseWriter, r *http.Request) {
+	lobbyId := commonutils.GetLobbyIdPathParam(r)
+	if _, err := c.requireLobbyHost(r, apitokentypes.ScopeWebhooks, lobbyId); err != nil {
+		utils.SendError(logging.GetLogger(r.Context()), w, err)
+		return
+	}
+
+	c.registerWebhook(w, r, lobbyId)
+}
+
+func (c *CrosswordGameAPI) RegisterServerWebhook(w http.ResponseWriter, r *http.Request) {
+	c.registerWebhook(w, r, "")
+}
+
+func (c *CrosswordGameAPI) registerWebhook(w http.ResponseWriter, r *http.Request, lobbyId lobbytypes.LobbyId) {
+	logger := logging.GetLogger(r.Context())
+
+	var req apitypes.RegisterWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	webhook, err := c.webhookManager.RegisterWebhook(req.Url, lobbyId, req.Events)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	logger.Infow("webhook registered", "webhook", webhook.Id, "lobby", lobbyId, "events", webhook.Events)
+
+	utils.SendResponse(logger, w, &apitypes.RegisterWebhookResponse{
+		Webhook: apitypes.ToWebhook(webhook),
+		Secret:  webhook.Secret,
+	}, 201)
+}
+
+func (c *CrosswordGameAPI) ListLobbyWebhooks(w http.ResponseWriter, r *http.Request) {
+	logger := logging.GetLogger(r.Context())
+	lobbyId := commonutils.GetLobbyIdPathParam(r)
+
+	_, err := c.requireLobbyHost(r, apitokentypes.ScopeWebhooks, lobbyId)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	webhooks, err := c.webhookManager.ListLobbyWebhooks(lobbyId)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	utils.SendResponse(logger, w, toListWebhooksResponse(webhooks), 200)
+}
+
+func (c *CrosswordGameAPI) ListServerWebhooks(w http.ResponseWriter, r *http.Request) {
+	logger := logging.GetLogger(r.Context())
+
+	webhooks, err := c.webhookManager.ListWebhooks()
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	utils.SendResponse(logger, w, toListWebhooksResponse(webhooks), 200)
+}
+
+func (c *CrosswordGameAPI) DeleteLobbyWebhook(w http.ResponseWriter, r *http.Request) {
+	logger := logging.GetLogger(r.Context())
+	lobbyId := commonutils.GetLobbyIdPathParam(r)
+
+	_, err := c.requireLobbyHost(r, apitokentypes.ScopeWebhooks, lobbyId)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	_, err = c.webhookManager.GetLobbyWebhook(lobbyId, commonutils.GetWebhookIdPathParam(r))
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	c.deleteWebhook(w, r)
+}
+
+func (c *CrosswordGameAPI) DeleteServerWebhook(w http.ResponseWriter, r *http.Request) {
+	c.deleteWebhook(w, r)
+}
+
+func (c *CrosswordGameAPI) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	logger := logging.GetLogger(r.Context())
+	webhookId := commonutils.GetWebhookIdPathParam(r)
+
+	err := c.webhookManager.DeleteWebhook(webhookId)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	logger.Infow("webhook deleted", "webhook", webhookId)
+
+	utils.SendResponse(logger, w, &apitypes.DeleteWebhookResponse{}, 200)
+}
+
+func (c *CrosswordGameAPI) GetLobbyWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	logger := logging.GetLogger(r.Context())
+	lobbyId := commonutils.GetLobbyIdPathParam(r)
+
+	_, err := c.requireLobbyHost(r, apitokentypes.ScopeWebhooks, lobbyId)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	_, err = c.webhookManager.GetLobbyWebhook(lobbyId, commonutils.GetWebhookIdPathParam(r))
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	c.getWebhookDeliveries(w, r)
+}
+
+func (c *CrosswordGameAPI) GetServerWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	c.getWebhookDeliveries(w, r)
+}
+
+func (c *CrosswordGameAPI) getWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	logger := logging.GetLogger(r.Context())
+	webhookId := commonutils.GetWebhookIdPathParam(r)
+	status := webhooktypes.DeliveryStatus(r.URL.Query().Get("status"))
+
+	deliveries, err := c.webhookManager.GetDeliveries(webhookId, status)
+	if err != nil {
+		utils.SendError(logger, w, err)
+		return
+	}
+
+	utils.SendResponse(logger, w, &apitypes.ListWebhookDeliveriesResponse{Deliveries: deliveries}, 200)
+}
+
+func toListWebhooksResponse(webhooks []*webhooktypes.Webhook) *apitypes.ListWebhooksResponse {
+	resp := &apitypes.ListWebhooksResponse{
+		Webhooks: make([]apitypes.Webhook, 0, len(webhooks)),
+	}
+	for _, webhook := range webhooks {
+		resp.Webhooks = append(resp.Webhooks, apitypes.ToWebhook(webhook))
+	}
+	return resp
+}
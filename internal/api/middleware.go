@@ -1,34 +1,57 @@
 package api
 
 import (
+	"bufio"
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/go-uuid"
+	jsonutils "github.com/mcoot/crosswordgame-go/internal/api/jsonapi/utils"
+	webutils "github.com/mcoot/crosswordgame-go/internal/api/webapi/utils"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
 	"github.com/mcoot/crosswordgame-go/internal/logging"
+	"github.com/mcoot/crosswordgame-go/internal/metrics"
 	"go.uber.org/zap"
+	"net"
 	"net/http"
+	"runtime/debug"
 	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func SetupGlobalMiddleware(h http.Handler, baseLogger *zap.SugaredLogger) http.Handler {
+func SetupGlobalMiddleware(router *mux.Router, baseLogger *zap.SugaredLogger, appMetrics *metrics.Metrics) http.Handler {
 	middlewares := []func(next http.Handler) http.Handler{
+		metricsMiddleware(router, appMetrics),
 		loggerInContextMiddleware(baseLogger),
 		requestLoggerMiddleware,
+		recoverMiddleware,
 	}
 	slices.Reverse(middlewares)
 
+	var h http.Handler = router
 	for _, middleware := range middlewares {
 		h = middleware(h)
 	}
 	return h
 }
 
+// loggerInContextMiddleware gives the request an ID and a logger tagged with it
 func loggerInContextMiddleware(baseLogger *zap.SugaredLogger) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestId := r.Header.Get(logging.RequestIdHeader)
+			if !isValidRequestId(requestId) {
+				requestId = newRequestId()
+			}
+			w.Header().Set(logging.RequestIdHeader, requestId)
+
 			logger := baseLogger.
 				Named("api").
-				With("path", r.URL.Path)
+				With("path", r.URL.Path, "request_id", requestId)
 			reqCtx := r.Context()
 
 			ctxWithLogger := logging.AddLoggerToContext(reqCtx, logger)
+			ctxWithLogger = logging.AddRequestIdToContext(ctxWithLogger, requestId)
 
 			r = r.WithContext(ctxWithLogger)
 			next.ServeHTTP(w, r)
@@ -36,10 +59,161 @@ func loggerInContextMiddleware(baseLogger *zap.SugaredLogger) func(next http.Han
 	}
 }
 
+// maxRequestIdLength bounds the IDs taken from requests, which end up in every log line for them
+const maxRequestIdLength = 128
+
+// isValidRequestId accepts IDs given by clients and proxies only if they are safe to log and echo back
+func isValidRequestId(requestId string) bool {
+	if requestId == "" || len(requestId) > maxRequestIdLength {
+		return false
+	}
+	for _, c := range requestId {
+		isAlphanumeric := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !isAlphanumeric && !strings.ContainsRune("-_.:", c) {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestId() string {
+	requestId, err := uuid.GenerateUUID()
+	if err != nil {
+		// Only possible if the system's randomness fails, when an ID that is merely unique enough will do
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return requestId
+}
+
+// requestLoggerMiddleware logs each request once it has been handled, with the response and how long it took
+// Handlers may add fields to the line through logging.GetAccessLogFields, e.g. who made the request
 func requestLoggerMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logger := logging.GetLogger(r.Context()).Named("access_log")
-		logger.Infow("access log", "method", r.Method, "url", r.URL)
-		next.ServeHTTP(w, r)
+		ctx, fields := logging.AddAccessLogFieldsToContext(r.Context())
+		logger := logging.GetLogger(ctx).Named("access_log")
+
+		start := time.Now()
+		recorder := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		keysAndValues := []any{
+			"method", r.Method,
+			"url", r.URL,
+			"status", recorder.Status(),
+			"size", recorder.size,
+			"latency", time.Since(start),
+		}
+		logger.Infow("access log", append(keysAndValues, fields.Fields()...)...)
 	})
 }
+
+// recoverMiddleware turns a panic in a handler into an internal error, sent in the form the caller expects
+// It is inside the request logger, so the panicked request is still logged with its response
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &responseRecorder{ResponseWriter: w}
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				// Handlers panic with this deliberately to abort the response, which the server handles quietly
+				panic(recovered)
+			}
+
+			logging.GetLogger(r.Context()).Errorw(
+				"panic handling request",
+				"panic", recovered,
+				"stack", string(debug.Stack()),
+			)
+			if recorder.status != 0 {
+				// Part of the response is already sent, so an error can't be
+				return
+			}
+			sendError(r, recorder, &errors.InternalError{ErrMessage: "the server hit an unexpected problem"})
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+// sendError responds with the error as the router serving the request would, so both share one classification
+func sendError(r *http.Request, w http.ResponseWriter, err error) {
+	if r.URL.Path == jsonAPIPrefix || strings.HasPrefix(r.URL.Path, jsonAPIPrefix+"/") {
+		jsonutils.SendError(logging.GetLogger(r.Context()), w, err)
+		return
+	}
+	webutils.SendError(r, w, err)
+}
+
+// metricsMiddleware counts and times requests by the template of the route they match, e.g. /lobby/{lobbyId}
+func metricsMiddleware(router *mux.Router, appMetrics *metrics.Metrics) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := metrics.RouteUnmatched
+			var match mux.RouteMatch
+			if router.Match(r, &match) && match.Route != nil {
+				if template, err := match.Route.GetPathTemplate(); err == nil {
+					route = template
+				}
+			}
+
+			start := time.Now()
+			recorder := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r)
+			appMetrics.ObserveHTTPRequest(route, r.Method, recorder.Status(), time.Since(start))
+		})
+	}
+}
+
+// responseRecorder remembers the status code and size of the response
+// It passes flushes and hijacks through, so event streams and WebSockets still work behind it
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+// Status is the status code written, which is 200 if the handler wrote nothing
+func (w *responseRecorder) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *responseRecorder) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to set deadlines
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/mcoot/crosswordgame-go/internal/apitypes"
+	"github.com/mcoot/crosswordgame-go/internal/logging"
+	"github.com/mcoot/crosswordgame-go/internal/metrics"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type MiddlewareSuite struct {
+	suite.Suite
+	logs   *observer.ObservedLogs
+	router *mux.Router
+	server *httptest.Server
+}
+
+func TestMiddlewareSuite(t *testing.T) {
+	suite.Run(t, new(MiddlewareSuite))
+}
+
+func (s *MiddlewareSuite) SetupTest() {
+	core, logs := observer.New(zap.InfoLevel)
+	s.logs = logs
+	s.router = mux.NewRouter()
+	s.server = httptest.NewServer(SetupGlobalMiddleware(s.router, zap.New(core).Sugar(), metrics.NewMetrics()))
+	s.T().Cleanup(s.server.Close)
+}
+
+func (s *MiddlewareSuite) get(path string, requestId string) *http.Response {
+	req, err := http.NewRequest("GET", s.server.URL+path, nil)
+	s.Require().NoError(err)
+	if requestId != "" {
+		req.Header.Set(logging.RequestIdHeader, requestId)
+	}
+	return s.do(req)
+}
+
+func (s *MiddlewareSuite) do(req *http.Request) *http.Response {
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	s.T().Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
+
+func (s *MiddlewareSuite) accessLog() map[string]interface{} {
+	entries := s.logs.FilterMessage("access log").AllUntimed()
+	s.Require().Len(entries, 1)
+	return entries[0].ContextMap()
+}
+
+func (s *MiddlewareSuite) TestAccessLogRecordsResponse() {
+	s.router.HandleFunc("/teapot", func(w http.ResponseWriter, r *http.Request) {
+		logging.GetAccessLogFields(r.Context()).Add("player_id", "player0")
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = w.Write([]byte("short and stout"))
+	})
+
+	resp := s.get("/teapot", "")
+	s.Equal(http.StatusTeapot, resp.StatusCode)
+	requestId := resp.Header.Get(logging.RequestIdHeader)
+	s.NotEmpty(requestId)
+
+	fields := s.accessLog()
+	s.EqualValues(http.StatusTeapot, fields["status"])
+	s.EqualValues(len("short and stout"), fields["size"])
+	s.Contains(fields, "latency")
+	s.Equal("player0", fields["player_id"])
+	s.Equal(requestId, fields["request_id"])
+}
+
+func (s *MiddlewareSuite) TestPropagatesValidRequestIds() {
+	s.router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(logging.GetRequestId(r.Context())))
+	})
+
+	resp := s.get("/", "upstream-id.1")
+	s.Equal("upstream-id.1", resp.Header.Get(logging.RequestIdHeader))
+
+	// IDs which aren't safe to log are replaced
+	resp = s.get("/", "<script>alert(1)</script>")
+	s.NotEqual("<script>alert(1)</script>", resp.Header.Get(logging.RequestIdHeader))
+	s.NotEmpty(resp.Header.Get(logging.RequestIdHeader))
+}
+
+func (s *MiddlewareSuite) TestLiveConnectionsWorkThroughMiddleware() {
+	s.router.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		_, isFlusher := w.(http.Flusher)
+		_, isHijacker := w.(http.Hijacker)
+		s.True(isFlusher)
+		s.True(isHijacker)
+
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		s.Require().NoError(err)
+		defer conn.Close()
+		_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: close\r\n\r\n")
+		_ = rw.Flush()
+	})
+
+	resp := s.get("/stream", "")
+	s.Equal(http.StatusSwitchingProtocols, resp.StatusCode)
+	_, _ = bufio.NewReader(resp.Body).ReadString('\n')
+	s.EqualValues(http.StatusSwitchingProtocols, s.accessLog()["status"])
+}
+
+func (s *MiddlewareSuite) panicAt(path string) {
+	s.router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		var players []string
+		_ = players[0]
+	})
+}
+
+func (s *MiddlewareSuite) TestRecoversPanicsAsJSONForTheAPI() {
+	s.panicAt("/api/v1/game")
+
+	resp := s.get("/api/v1/game", "panic-id")
+	s.Equal(http.StatusInternalServerError, resp.StatusCode)
+	s.Equal("application/json", resp.Header.Get("Content-Type"))
+	var apiErr apitypes.ErrorResponse
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&apiErr))
+	s.Equal("internal_error", apiErr.Kind)
+	s.Equal("panic-id", apiErr.RequestId)
+	// The panic's details are for the logs only
+	s.NotContains(apiErr.Message, "index out of range")
+
+	panics := s.logs.FilterMessage("panic handling request").AllUntimed()
+	s.Require().Len(panics, 1)
+	s.Equal("panic-id", panics[0].ContextMap()["request_id"])
+	s.Contains(panics[0].ContextMap()["stack"], "panicAt")
+	s.EqualValues(http.StatusInternalServerError, s.accessLog()["status"])
+}
+
+func (s *MiddlewareSuite) TestRecoversPanicsAsPagesForTheWebUI() {
+	s.panicAt("/lobby/{lobbyId}/start")
+
+	resp := s.get("/lobby/lobby0/start", "")
+	s.Equal(http.StatusInternalServerError, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	s.Require().NoError(err)
+	s.Contains(string(body), "cwg-error-block")
+	s.Contains(string(body), resp.Header.Get(logging.RequestIdHeader))
+
+	// htmx requests for part of the page get the error inline
+	req, err := http.NewRequest("POST", s.server.URL+"/lobby/lobby0/start", nil)
+	s.Require().NoError(err)
+	req.Header.Set("HX-Request", "true")
+	req.Header.Set("HX-Target", "game-status")
+	resp = s.do(req)
+	s.Equal(http.StatusInternalServerError, resp.StatusCode)
+	body, err = io.ReadAll(resp.Body)
+	s.Require().NoError(err)
+	s.Contains(string(body), "cwg-error-inline")
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/mcoot/crosswordgame-go/internal/config"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+)
+
+// Lifetime bounds what the API runs beyond individual requests
+type Lifetime struct {
+	// Connections is done once the server starts shutting down, closing live connections (SSE, WebSockets
+	// and event streams) so their clients reconnect to another replica
+	Connections context.Context
+	// Background is done once in-flight requests have drained, stopping background work such as webhook delivery
+	Background context.Context
+}
+
+// Serve runs the handler on the listener until ctx is done, then shuts down gracefully: it stops accepting
+// connections, calls closeConnections to end live connections, and waits for in-flight requests to finish
+// Returns nil once every request has finished, or an error if serving fails or requests outlast ShutdownTimeout
+func Serve(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	listener net.Listener,
+	handler http.Handler,
+	serverConfig config.ServerConfig,
+	closeConnections func(),
+) error {
+	server := &http.Server{
+		Handler:      handler,
+		ReadTimeout:  serverConfig.ReadTimeout,
+		WriteTimeout: serverConfig.WriteTimeout,
+		IdleTimeout:  serverConfig.IdleTimeout,
+	}
+	// Live connections never finish by themselves, so they must be told to close for requests to drain
+	server.RegisterOnShutdown(closeConnections)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Infow("shutting down server", "timeout", serverConfig.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serverConfig.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
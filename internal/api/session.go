@@ -0,0 +1,19 @@
+package api
+
+import (
+	"github.com/gorilla/sessions"
+	"github.com/mcoot/crosswordgame-go/internal/config"
+	"net/http"
+)
+
+// NewSessionStore keeps web sessions in cookies signed, and optionally encrypted, with the configured keys
+func NewSessionStore(cfg *config.Config) *sessions.CookieStore {
+	store := sessions.NewCookieStore(cfg.SessionKeyPairs()...)
+	// The cookie itself outlives an idle login, which the session manager ends from the times it records
+	store.MaxAge(int(cfg.Session.MaxAge.Seconds()))
+	store.Options.HttpOnly = true
+	store.Options.Secure = cfg.Session.SecureCookies
+	// Lax still sends the cookie when an OIDC provider redirects back, but not on cross-site form posts
+	store.Options.SameSite = http.SameSiteLaxMode
+	return store
+}
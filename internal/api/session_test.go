@@ -0,0 +1,74 @@
+package api
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/config"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type SessionStoreSuite struct {
+	suite.Suite
+}
+
+func TestSessionStoreSuite(t *testing.T) {
+	suite.Run(t, new(SessionStoreSuite))
+}
+
+// saveSession makes a session cookie with the store built from the config
+func (s *SessionStoreSuite) saveSession(cfg *config.Config) *http.Cookie {
+	store := NewSessionStore(cfg)
+	r := httptest.NewRequest("GET", "/", nil)
+	session, err := store.Get(r, "session")
+	s.Require().NoError(err)
+	session.Values["player_id"] = "alice"
+	w := httptest.NewRecorder()
+	s.Require().NoError(store.Save(r, w, session))
+	s.Require().Len(w.Result().Cookies(), 1)
+	return w.Result().Cookies()[0]
+}
+
+// readSession returns the player in a session cookie, as read by the store built from the config
+func (s *SessionStoreSuite) readSession(cfg *config.Config, cookie *http.Cookie) (any, error) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(cookie)
+	session, err := NewSessionStore(cfg).Get(r, "session")
+	return session.Values["player_id"], err
+}
+
+func (s *SessionStoreSuite) TestCookieOptions() {
+	cfg := config.Default()
+	cfg.Session.Key = "0123456789abcdef0123456789abcdef"
+	cookie := s.saveSession(&cfg)
+	s.True(cookie.Secure)
+	s.True(cookie.HttpOnly)
+	s.Equal(http.SameSiteLaxMode, cookie.SameSite)
+	s.Equal(int(cfg.Session.MaxAge.Seconds()), cookie.MaxAge)
+}
+
+func (s *SessionStoreSuite) TestKeyRotation() {
+	before := config.Default()
+	before.Session.Key = "0123456789abcdef0123456789abcdef"
+	before.Session.EncryptionKey = "0123456789abcdef"
+	cookie := s.saveSession(&before)
+
+	after := before
+	after.Session.Key = "fedcba9876543210fedcba9876543210"
+	after.Session.EncryptionKey = "fedcba9876543210"
+	after.Session.PreviousKey = before.Session.Key
+	after.Session.PreviousEncryptionKey = before.Session.EncryptionKey
+
+	// Cookies made before the rotation still work, while new ones are made with the new keys
+	playerId, err := s.readSession(&after, cookie)
+	s.Require().NoError(err)
+	s.Equal("alice", playerId)
+	_, err = s.readSession(&before, s.saveSession(&after))
+	s.Error(err)
+
+	// Once the previous keys are dropped, the old cookies no longer work
+	after.Session.PreviousKey = ""
+	after.Session.PreviousEncryptionKey = ""
+	_, err = s.readSession(&after, cookie)
+	s.Error(err)
+}
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ShutdownReconnectDelay is how soon event stream clients should reconnect when the server closes their stream
+// to shut down, so they are promptly picked up by another replica
+const ShutdownReconnectDelay = time.Second
+
+// StartEventStream lifts the server's write timeout for a long-lived event stream, and sends its headers
+func StartEventStream(w http.ResponseWriter) *http.ResponseController {
+	rc := http.NewResponseController(w)
+	// Not every response writer supports deadlines (e.g. in tests), in which case there is none to lift
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	return rc
+}
+
+// EndEventStreamForShutdown tells the client when to reconnect, before the stream is closed
+func EndEventStreamForShutdown(w http.ResponseWriter, rc *http.ResponseController) {
+	_, err := fmt.Fprintf(w, "retry: %d\n\n", ShutdownReconnectDelay.Milliseconds())
+	if err == nil {
+		_ = rc.Flush()
+	}
+}
@@ -2,9 +2,11 @@ package utils
 
 import (
 	"github.com/gorilla/mux"
+	apitokentypes "github.com/mcoot/crosswordgame-go/internal/apitoken/types"
 	gametypes "github.com/mcoot/crosswordgame-go/internal/game/types"
 	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
 	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	webhooktypes "github.com/mcoot/crosswordgame-go/internal/webhook/types"
 	"net/http"
 )
 
@@ -31,3 +33,19 @@ func GetLobbyIdPathParam(r *http.Request) lobbytypes.LobbyId {
 	}
 	return lobbytypes.LobbyId(lobbyId)
 }
+
+func GetWebhookIdPathParam(r *http.Request) webhooktypes.WebhookId {
+	webhookId, ok := mux.Vars(r)["webhookId"]
+	if !ok {
+		return ""
+	}
+	return webhooktypes.WebhookId(webhookId)
+}
+
+func GetTokenIdPathParam(r *http.Request) apitokentypes.TokenId {
+	tokenId, ok := mux.Vars(r)["tokenId"]
+	if !ok {
+		return ""
+	}
+	return apitokentypes.TokenId(tokenId)
+}
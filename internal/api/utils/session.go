@@ -2,7 +2,11 @@ package utils
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/json"
+	goerrors "errors"
 	"fmt"
+	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 	"github.com/mcoot/crosswordgame-go/internal/errors"
 	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
@@ -10,12 +14,27 @@ import (
 	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
 	"github.com/mcoot/crosswordgame-go/internal/utils"
 	"net/http"
+	"time"
 )
 
 const (
 	ContextKeySession utils.ContextKey = "session"
 )
 
+const (
+	sessionName = "session"
+
+	valuePlayerId    = "player_id"
+	valueLoggedInAt  = "logged_in_at"
+	valueLastSeenAt  = "last_seen_at"
+	valueLoginFlow   = "login_flow"
+	valueCSRFToken   = "csrf_token"
+	valueJoinRefusal = "join_refusal"
+
+	// touchInterval is how stale the last request recorded in a session may get, so every request needn't re-save it
+	touchInterval = time.Minute
+)
+
 // Session is the baseSession enriched with lookups from the database
 type Session struct {
 	*sessions.Session
@@ -23,8 +42,18 @@ type Session struct {
 	Lobby  *lobbytypes.Lobby
 }
 
+// SessionTimeouts bound how long a login lasts
+type SessionTimeouts struct {
+	// MaxAge is how long after logging in the login ends, however active the player is
+	MaxAge time.Duration
+	// IdleTimeout ends the login once the player has made no requests for this long
+	IdleTimeout time.Duration
+}
+
 type SessionManager struct {
 	sessionStore sessions.Store
+	timeouts     SessionTimeouts
+	now          func() time.Time
 }
 
 func (s *Session) IsLoggedIn() bool {
@@ -35,26 +64,47 @@ func (s *Session) IsInLobby() bool {
 	return s.Lobby != nil
 }
 
-func NewSessionManager(sessionStore sessions.Store) *SessionManager {
+// CSRFToken is the secret the session's forms are posted with, or "" if none has been issued
+func (s *Session) CSRFToken() string {
+	token, _ := s.Values[valueCSRFToken].(string)
+	return token
+}
+
+func NewSessionManager(sessionStore sessions.Store, timeouts SessionTimeouts) *SessionManager {
 	return &SessionManager{
 		sessionStore: sessionStore,
+		timeouts:     timeouts,
+		now:          time.Now,
+	}
+}
+
+// getRawSession returns the session cookie's contents, starting afresh if the cookie can't be read,
+// e.g. because it was made with keys that have since been rotated out
+func (sm *SessionManager) getRawSession(r *http.Request) (*sessions.Session, error) {
+	session, err := sm.sessionStore.Get(r, sessionName)
+	var cookieErr securecookie.Error
+	if err != nil && goerrors.As(err, &cookieErr) && cookieErr.IsDecode() {
+		// The store still returns a new session, with the usual cookie options, alongside the error
+		return session, nil
 	}
+	return session, err
 }
 
 func (sm *SessionManager) GetSession(r *http.Request, playerManager *player.Manager) (*Session, error) {
-	session, err := sm.sessionStore.Get(r, "session")
+	session, err := sm.getRawSession(r)
 	if err != nil {
 		return nil, err
 	}
+	loggedOut := &Session{
+		Session: session,
+		Player:  nil,
+		Lobby:   nil,
+	}
 
-	rawPlayerId, ok := session.Values["player_id"]
+	rawPlayerId, ok := session.Values[valuePlayerId]
 	if !ok {
 		// If session is missing player_id, we just aren't logged in
-		return &Session{
-			Session: session,
-			Player:  nil,
-			Lobby:   nil,
-		}, nil
+		return loggedOut, nil
 	}
 	strPlayerId, ok := rawPlayerId.(string)
 	if !ok {
@@ -62,19 +112,23 @@ func (sm *SessionManager) GetSession(r *http.Request, playerManager *player.Mana
 	}
 	playerId := playertypes.PlayerId(strPlayerId)
 
+	loggedInAt, ok := sm.sessionTime(session, valueLoggedInAt)
+	if !ok || sm.hasExpired(session, loggedInAt) {
+		return loggedOut, nil
+	}
+
 	p, err := playerManager.LookupPlayer(playerId)
 	if err != nil {
 		// If the session has an invalid player_id, treat it as just not being logged in
 		if errors.IsNotFoundError(err) {
-			return &Session{
-				Session: session,
-				Player:  nil,
-				Lobby:   nil,
-			}, nil
+			return loggedOut, nil
 		} else {
 			return nil, err
 		}
 	}
+	if loggedInAt.Before(p.SessionsRevokedAt) {
+		return loggedOut, nil
+	}
 
 	lobby, err := playerManager.GetLobbyForPlayer(playerId)
 	if err != nil {
@@ -96,30 +150,163 @@ func (sm *SessionManager) GetSession(r *http.Request, playerManager *player.Mana
 	}, nil
 }
 
+// hasExpired checks whether a login has gone past its age limit, or been idle too long
+// Logins from before sessions recorded their times count as expired
+func (sm *SessionManager) hasExpired(session *sessions.Session, loggedInAt time.Time) bool {
+	lastSeenAt, ok := sm.sessionTime(session, valueLastSeenAt)
+	now := sm.now()
+	return !ok || now.Sub(loggedInAt) > sm.timeouts.MaxAge || now.Sub(lastSeenAt) > sm.timeouts.IdleTimeout
+}
+
+func (sm *SessionManager) sessionTime(session *sessions.Session, key string) (time.Time, bool) {
+	nanos, ok := session.Values[key].(int64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos), true
+}
+
+// Touch records a request by the session's player, which keeps their login from going idle
+func (sm *SessionManager) Touch(w http.ResponseWriter, r *http.Request, session *Session) error {
+	if !session.IsLoggedIn() {
+		return nil
+	}
+	lastSeenAt, _ := sm.sessionTime(session.Session, valueLastSeenAt)
+	now := sm.now()
+	if now.Sub(lastSeenAt) < touchInterval {
+		return nil
+	}
+	session.Values[valueLastSeenAt] = now.UnixNano()
+
+	return sm.sessionStore.Save(r, w, session.Session)
+}
+
+// IssueCSRFToken returns the session's CSRF token, issuing one if it has none
+// The token is replaced whenever someone logs in or out of the session, so one learnt beforehand is no use after
+func (sm *SessionManager) IssueCSRFToken(w http.ResponseWriter, r *http.Request, session *Session) (string, error) {
+	if token := session.CSRFToken(); token != "" {
+		return token, nil
+	}
+	token := newCSRFToken(session.Session)
+
+	return token, sm.sessionStore.Save(r, w, session.Session)
+}
+
+func newCSRFToken(session *sessions.Session) string {
+	token := rand.Text()
+	session.Values[valueCSRFToken] = token
+	return token
+}
+
 func (sm *SessionManager) SaveLoggedInPlayer(
 	w http.ResponseWriter,
 	r *http.Request,
 	playerId playertypes.PlayerId,
 ) error {
-	session, err := sm.sessionStore.Get(r, "session")
+	session, err := sm.getRawSession(r)
 	if err != nil {
 		return err
 	}
-	session.Values["player_id"] = string(playerId)
+	now := sm.now().UnixNano()
+	session.Values[valuePlayerId] = string(playerId)
+	session.Values[valueLoggedInAt] = now
+	session.Values[valueLastSeenAt] = now
+	newCSRFToken(session)
 
 	return sm.sessionStore.Save(r, w, session)
 }
 
 func (sm *SessionManager) ClearLoggedInPlayer(w http.ResponseWriter, r *http.Request) error {
-	session, err := sm.sessionStore.Get(r, "session")
+	session, err := sm.getRawSession(r)
 	if err != nil {
 		return err
 	}
-	delete(session.Values, "player_id")
+	delete(session.Values, valuePlayerId)
+	delete(session.Values, valueLoggedInAt)
+	delete(session.Values, valueLastSeenAt)
+	delete(session.Values, valueJoinRefusal)
+	newCSRFToken(session)
 
 	return sm.sessionStore.Save(r, w, session)
 }
 
+// SaveJoinRefusal remembers why a player who just logged in couldn't join the lobby they were invited to,
+// for the page they are sent on to to tell them
+func (sm *SessionManager) SaveJoinRefusal(w http.ResponseWriter, r *http.Request, reason string) error {
+	session, err := sm.getRawSession(r)
+	if err != nil {
+		return err
+	}
+	session.Values[valueJoinRefusal] = reason
+
+	return sm.sessionStore.Save(r, w, session)
+}
+
+// TakeJoinRefusal returns why the player couldn't join the lobby they were invited to and forgets it, so it is
+// only shown once
+// It returns "" if there is none
+func (sm *SessionManager) TakeJoinRefusal(w http.ResponseWriter, r *http.Request) (string, error) {
+	session, err := sm.getRawSession(r)
+	if err != nil {
+		return "", err
+	}
+	reason, ok := session.Values[valueJoinRefusal].(string)
+	if !ok {
+		return "", nil
+	}
+	delete(session.Values, valueJoinRefusal)
+
+	return reason, sm.sessionStore.Save(r, w, session)
+}
+
+// LoginFlow is a sign-in with an external provider in progress, kept in the session until the provider redirects back
+type LoginFlow struct {
+	State        string             `json:"state"`
+	Nonce        string             `json:"nonce"`
+	CodeVerifier string             `json:"code_verifier"`
+	JoinLobby    lobbytypes.LobbyId `json:"join_lobby,omitempty"`
+}
+
+// SaveLoginFlow remembers a sign-in until the provider redirects back, replacing any the player abandoned
+func (sm *SessionManager) SaveLoginFlow(w http.ResponseWriter, r *http.Request, flow *LoginFlow) error {
+	session, err := sm.getRawSession(r)
+	if err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(flow)
+	if err != nil {
+		return err
+	}
+	session.Values[valueLoginFlow] = string(encoded)
+
+	return sm.sessionStore.Save(r, w, session)
+}
+
+// TakeLoginFlow returns the sign-in in progress and forgets it, so it can only be completed once
+// It returns nil if there is none
+func (sm *SessionManager) TakeLoginFlow(w http.ResponseWriter, r *http.Request) (*LoginFlow, error) {
+	session, err := sm.getRawSession(r)
+	if err != nil {
+		return nil, err
+	}
+	encoded, ok := session.Values[valueLoginFlow].(string)
+	if !ok {
+		return nil, nil
+	}
+	delete(session.Values, valueLoginFlow)
+	err = sm.sessionStore.Save(r, w, session)
+	if err != nil {
+		return nil, err
+	}
+
+	var flow LoginFlow
+	err = json.Unmarshal([]byte(encoded), &flow)
+	if err != nil {
+		return nil, fmt.Errorf("malformed session: %w", err)
+	}
+	return &flow, nil
+}
+
 func AddSessionToContext(ctx context.Context, session *Session) context.Context {
 	return context.WithValue(ctx, ContextKeySession, session)
 }
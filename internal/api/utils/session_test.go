@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"github.com/gorilla/sessions"
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	"github.com/mcoot/crosswordgame-go/internal/player"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"github.com/mcoot/crosswordgame-go/internal/store"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testSessionKey = "0123456789abcdef0123456789abcdef"
+
+type SessionManagerSuite struct {
+	suite.Suite
+	now     time.Time
+	players *player.Manager
+	manager *SessionManager
+	// cookie is the session cookie as a browser would keep it between requests
+	cookie *http.Cookie
+	alice  playertypes.PlayerId
+}
+
+func TestSessionManagerSuite(t *testing.T) {
+	suite.Run(t, new(SessionManagerSuite))
+}
+
+func (s *SessionManagerSuite) SetupTest() {
+	s.now = time.Now()
+	s.players = player.NewPlayerManager(store.NewInMemoryStore(), events.NewEventBus())
+	s.manager = NewSessionManager(sessions.NewCookieStore([]byte(testSessionKey)), SessionTimeouts{
+		MaxAge:      24 * time.Hour,
+		IdleTimeout: time.Hour,
+	})
+	s.manager.now = func() time.Time { return s.now }
+	s.cookie = nil
+
+	var err error
+	s.alice, err = s.players.Register("alice", "", "alice-password")
+	s.Require().NoError(err)
+}
+
+// do serves a request with the session cookie, keeping any cookie set in response
+func (s *SessionManagerSuite) do(handle func(w http.ResponseWriter, r *http.Request)) {
+	r := httptest.NewRequest("GET", "/", nil)
+	if s.cookie != nil {
+		r.AddCookie(s.cookie)
+	}
+	w := httptest.NewRecorder()
+	handle(w, r)
+	for _, cookie := range w.Result().Cookies() {
+		s.cookie = cookie
+	}
+}
+
+func (s *SessionManagerSuite) login(playerId playertypes.PlayerId) {
+	s.do(func(w http.ResponseWriter, r *http.Request) {
+		s.Require().NoError(s.manager.SaveLoggedInPlayer(w, r, playerId))
+	})
+}
+
+// loggedInAs makes a request as the web UI's middleware does, returning who it was made by if anyone
+func (s *SessionManagerSuite) loggedInAs() playertypes.PlayerId {
+	var playerId playertypes.PlayerId
+	s.do(func(w http.ResponseWriter, r *http.Request) {
+		session, err := s.manager.GetSession(r, s.players)
+		s.Require().NoError(err)
+		s.Require().NoError(s.manager.Touch(w, r, session))
+		if session.IsLoggedIn() {
+			playerId = session.Player.Username
+		}
+	})
+	return playerId
+}
+
+func (s *SessionManagerSuite) TestRequestsKeepLoginsFromGoingIdle() {
+	s.login(s.alice)
+	s.now = s.now.Add(50 * time.Minute)
+	s.Equal(s.alice, s.loggedInAs())
+	s.now = s.now.Add(50 * time.Minute)
+	s.Equal(s.alice, s.loggedInAs())
+
+	s.now = s.now.Add(61 * time.Minute)
+	s.Empty(s.loggedInAs())
+}
+
+func (s *SessionManagerSuite) TestLoginsEndAtTheirMaxAge() {
+	s.login(s.alice)
+	for elapsed := time.Duration(0); elapsed < 23*time.Hour; elapsed += 30 * time.Minute {
+		s.now = s.now.Add(30 * time.Minute)
+		s.Require().Equal(s.alice, s.loggedInAs())
+	}
+
+	s.now = s.now.Add(90 * time.Minute)
+	s.Empty(s.loggedInAs())
+
+	// Logging in again starts a new login
+	s.login(s.alice)
+	s.Equal(s.alice, s.loggedInAs())
+}
+
+func (s *SessionManagerSuite) TestRevokedSessionsAreLoggedOut() {
+	s.login(s.alice)
+	s.Require().NoError(s.players.RevokeSessions(s.alice))
+	s.Empty(s.loggedInAs())
+
+	s.now = time.Now()
+	s.login(s.alice)
+	s.Equal(s.alice, s.loggedInAs())
+}
+
+func (s *SessionManagerSuite) TestUnreadableCookiesAreLoggedOut() {
+	s.login(s.alice)
+	s.manager.sessionStore = sessions.NewCookieStore([]byte("fedcba9876543210fedcba9876543210"))
+	s.Empty(s.loggedInAs())
+
+	s.login(s.alice)
+	s.Equal(s.alice, s.loggedInAs())
+}
+
+// csrfToken returns the session's CSRF token as a page would, issuing one if need be
+func (s *SessionManagerSuite) csrfToken() string {
+	var token string
+	s.do(func(w http.ResponseWriter, r *http.Request) {
+		session, err := s.manager.GetSession(r, s.players)
+		s.Require().NoError(err)
+		token, err = s.manager.IssueCSRFToken(w, r, session)
+		s.Require().NoError(err)
+	})
+	return token
+}
+
+func (s *SessionManagerSuite) TestCSRFTokenIsReplacedWhenThePlayerChanges() {
+	loggedOutToken := s.csrfToken()
+	s.Require().NotEmpty(loggedOutToken)
+	s.Equal(loggedOutToken, s.csrfToken())
+
+	// A token planted before logging in is no use afterwards
+	s.login(s.alice)
+	aliceToken := s.csrfToken()
+	s.NotEqual(loggedOutToken, aliceToken)
+	s.Equal(aliceToken, s.csrfToken())
+
+	bob, err := s.players.Register("bob", "", "bob-password")
+	s.Require().NoError(err)
+	s.login(bob)
+	bobToken := s.csrfToken()
+	s.NotEqual(aliceToken, bobToken)
+
+	s.do(func(w http.ResponseWriter, r *http.Request) {
+		s.Require().NoError(s.manager.ClearLoggedInPlayer(w, r))
+	})
+	s.NotEqual(bobToken, s.csrfToken())
+}
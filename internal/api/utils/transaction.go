@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	"github.com/mcoot/crosswordgame-go/internal/game"
+	"github.com/mcoot/crosswordgame-go/internal/lobby"
+	"github.com/mcoot/crosswordgame-go/internal/player"
+	"github.com/mcoot/crosswordgame-go/internal/store"
+)
+
+// Transactions runs flows touching several entities against a single store transaction, for both APIs
+type Transactions struct {
+	transactor store.Transactor
+	// publisher is where events are published to once the transaction making them commits
+	publisher     events.Publisher
+	gameManager   *game.Manager
+	lobbyManager  *lobby.Manager
+	playerManager *player.Manager
+}
+
+func NewTransactions(
+	transactor store.Transactor,
+	publisher events.Publisher,
+	gameManager *game.Manager,
+	lobbyManager *lobby.Manager,
+	playerManager *player.Manager,
+) *Transactions {
+	return &Transactions{
+		transactor:    transactor,
+		publisher:     publisher,
+		gameManager:   gameManager,
+		lobbyManager:  lobbyManager,
+		playerManager: playerManager,
+	}
+}
+
+// Run runs f with managers bound to a single store transaction, so a flow either applies in full or not at all,
+// and no other request's writes land between what f reads and what it writes
+// Events and game metrics from the managers are only published and recorded once the transaction commits
+func (t *Transactions) Run(f func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error) error {
+	pendingEvents := events.NewEventBuffer()
+	pendingMetrics := game.NewMetricsBuffer()
+	err := t.transactor.Transact(func(tx store.Store) error {
+		return f(
+			t.gameManager.WithStore(tx).WithPublisher(pendingEvents).WithMetrics(pendingMetrics),
+			t.lobbyManager.WithStore(tx).WithPublisher(pendingEvents),
+			t.playerManager.WithStore(tx).WithPublisher(pendingEvents),
+		)
+	})
+	if err != nil {
+		return err
+	}
+
+	pendingEvents.PublishTo(t.publisher)
+	pendingMetrics.RecordTo(t.gameManager.Metrics())
+	return nil
+}
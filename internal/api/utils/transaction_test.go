@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"fmt"
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	"github.com/mcoot/crosswordgame-go/internal/game"
+	"github.com/mcoot/crosswordgame-go/internal/game/scoring"
+	"github.com/mcoot/crosswordgame-go/internal/lobby"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	"github.com/mcoot/crosswordgame-go/internal/player"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"github.com/mcoot/crosswordgame-go/internal/store"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+// countingMetrics counts the games recorded as created
+type countingMetrics struct {
+	game.NoopMetrics
+	created int
+}
+
+func (m *countingMetrics) GameCreated(int) {
+	m.created++
+}
+
+type TransactionSuite struct {
+	suite.Suite
+	db           *store.InMemoryStore
+	sub          *events.Subscription
+	metrics      *countingMetrics
+	lobbies      *lobby.Manager
+	transactions *Transactions
+}
+
+func TestTransactionSuite(t *testing.T) {
+	suite.Run(t, new(TransactionSuite))
+}
+
+func (s *TransactionSuite) SetupTest() {
+	s.db = store.NewInMemoryStore()
+	eventBus := events.NewEventBus()
+	s.sub = eventBus.Subscribe(events.AnyKind)
+	s.metrics = &countingMetrics{}
+	s.lobbies = lobby.NewLobbyManager(s.db, eventBus)
+	s.transactions = NewTransactions(
+		s.db,
+		eventBus,
+		game.NewGameManager(s.db, scoring.NewTxtDictScorer(nil), eventBus).WithMetrics(s.metrics),
+		s.lobbies,
+		player.NewPlayerManager(s.db, eventBus),
+	)
+}
+
+func (s *TransactionSuite) receivedKinds() []events.Kind {
+	var kinds []events.Kind
+	for {
+		select {
+		case event := <-s.sub.Events():
+			kinds = append(kinds, event.Kind())
+		default:
+			return kinds
+		}
+	}
+}
+
+// startGame does what starting a game from the lobby page does, failing at the end if fail is set
+func (s *TransactionSuite) startGame(lobbyId lobbytypes.LobbyId, fail bool) error {
+	return s.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		gameId, err := gm.CreateGame([]playertypes.PlayerId{"host"}, 2)
+		if err != nil {
+			return err
+		}
+		err = lm.AttachGameToLobby(lobbyId, gameId)
+		if err != nil {
+			return err
+		}
+		if fail {
+			return fmt.Errorf("failed after attaching the game")
+		}
+		return nil
+	})
+}
+
+func (s *TransactionSuite) TestCommittedTransactionPublishesItsEvents() {
+	lobbyId, err := s.lobbies.CreateLobby("lobby", "host")
+	s.Require().NoError(err)
+	s.receivedKinds()
+
+	s.Require().NoError(s.startGame(lobbyId, false))
+
+	s.Equal([]events.Kind{game.EventGameCreated, lobby.EventGameAttached}, s.receivedKinds())
+	s.Equal(1, s.metrics.created)
+	lobbyState, err := s.lobbies.GetLobbyState(lobbyId)
+	s.Require().NoError(err)
+	s.True(lobbyState.HasRunningGame())
+}
+
+func (s *TransactionSuite) TestRolledBackTransactionPublishesNothing() {
+	lobbyId, err := s.lobbies.CreateLobby("lobby", "host")
+	s.Require().NoError(err)
+	s.receivedKinds()
+
+	s.Error(s.startGame(lobbyId, true))
+
+	s.Empty(s.receivedKinds())
+	s.Zero(s.metrics.created)
+	lobbyState, err := s.lobbies.GetLobbyState(lobbyId)
+	s.Require().NoError(err)
+	s.False(lobbyState.HasRunningGame())
+	games, err := s.db.RetrieveAllGames()
+	s.Require().NoError(err)
+	s.Empty(games)
+}
@@ -0,0 +1,348 @@
+package webapi
+
+import (
+	goerrors "errors"
+	"fmt"
+	commonutils "github.com/mcoot/crosswordgame-go/internal/api/utils"
+	"github.com/mcoot/crosswordgame-go/internal/api/webapi/template/pages"
+	"github.com/mcoot/crosswordgame-go/internal/api/webapi/utils"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+	"github.com/mcoot/crosswordgame-go/internal/game"
+	"github.com/mcoot/crosswordgame-go/internal/lobby"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	"github.com/mcoot/crosswordgame-go/internal/logging"
+	"github.com/mcoot/crosswordgame-go/internal/player"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"net/http"
+)
+
+func (c *CrosswordGameWebAPI) AccountPage(w http.ResponseWriter, r *http.Request) {
+	session, err := getLoggedInSession(r)
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+	if !session.Player.IsRegistered() {
+		utils.SendError(r, w, &errors.InvalidActionError{
+			Action: "view_account",
+			Reason: "only registered players have an account",
+		})
+		return
+	}
+
+	passwordChanged := r.URL.Query().Get("password_changed") == "true"
+	utils.PushUrl(w, "/account")
+	utils.SendResponse(r, w, pages.Account(session.Player, passwordChanged, c.ssoProviderName()), 200)
+}
+
+func (c *CrosswordGameWebAPI) Signup(w http.ResponseWriter, r *http.Request) {
+	lobbyToJoin, err := c.parseLoginRequest(r, "signup")
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	username := r.PostForm.Get("username")
+	if username == "" {
+		utils.SendError(r, w, fmt.Errorf("username is required"))
+		return
+	}
+
+	var playerId playertypes.PlayerId
+	var invite inviteOutcome
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		var err error
+		playerId, err = pm.Register(
+			playertypes.PlayerId(username),
+			r.PostForm.Get("display_name"),
+			r.PostForm.Get("password"),
+		)
+		if err != nil {
+			return err
+		}
+		invite, err = joinInvitedLobby(lm, pm, playerId, lobbyToJoin, r.PostForm.Get("lobby_password"))
+		return err
+	})
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	logging.GetLogger(r.Context()).Infow("player signed up", "player_id", playerId)
+	c.completeLogin(w, r, playerId, invite)
+}
+
+func (c *CrosswordGameWebAPI) AccountLogin(w http.ResponseWriter, r *http.Request) {
+	lobbyToJoin, err := c.parseLoginRequest(r, "login")
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	var playerId playertypes.PlayerId
+	var invite inviteOutcome
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		var err error
+		playerId, err = pm.LoginWithPassword(
+			playertypes.PlayerId(r.PostForm.Get("username")),
+			r.PostForm.Get("password"),
+		)
+		if err != nil {
+			return err
+		}
+		invite, err = joinInvitedLobby(lm, pm, playerId, lobbyToJoin, r.PostForm.Get("lobby_password"))
+		return err
+	})
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	logging.GetLogger(r.Context()).Infow("player logged in with password", "player_id", playerId)
+	c.completeLogin(w, r, playerId, invite)
+}
+
+func (c *CrosswordGameWebAPI) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	session, err := getLoggedInSession(r)
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	playerId := session.Player.Username
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		return pm.ChangePassword(
+			playerId,
+			r.PostForm.Get("current_password"),
+			r.PostForm.Get("new_password"),
+		)
+	})
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	// Changing the password ends every other login, along with the player's API tokens
+	err = c.tokenManager.RevokeAllTokens(playerId)
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+	err = c.sessionManager.SaveLoggedInPlayer(w, r, playerId)
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	logging.GetLogger(r.Context()).Infow("player changed password")
+	utils.Redirect(w, r, "/account?password_changed=true", 303)
+}
+
+// LogoutEverywhere logs a registered player out of every session, including this one
+func (c *CrosswordGameWebAPI) LogoutEverywhere(w http.ResponseWriter, r *http.Request) {
+	session, err := getLoggedInSession(r)
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		return pm.RevokeSessions(session.Player.Username)
+	})
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+	err = c.sessionManager.ClearLoggedInPlayer(w, r)
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	logging.GetLogger(r.Context()).Infow("player logged out everywhere")
+	utils.Redirect(w, r, "/index", 303)
+}
+
+// UpgradeAccount registers the logged-in ephemeral player, moving their lobby and games over to the new account
+func (c *CrosswordGameWebAPI) UpgradeAccount(w http.ResponseWriter, r *http.Request) {
+	session, err := getLoggedInSession(r)
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+	if session.Player.IsRegistered() {
+		utils.SendError(r, w, &errors.InvalidActionError{
+			Action: "upgrade_account",
+			Reason: "already registered",
+		})
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	username := r.PostForm.Get("username")
+	if username == "" {
+		utils.SendError(r, w, fmt.Errorf("username is required"))
+		return
+	}
+
+	ephemeralId := session.Player.Username
+	var playerId playertypes.PlayerId
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		var err error
+		playerId, err = pm.UpgradeToRegistered(ephemeralId, playertypes.PlayerId(username), r.PostForm.Get("password"))
+		if err != nil {
+			return err
+		}
+
+		// Re-read the lobby within the transaction, in case the player has left or joined one since
+		lobbyState, err := pm.GetLobbyForPlayer(ephemeralId)
+		if err == nil {
+			err = lm.RenamePlayer(lobbyState.Id, ephemeralId, playerId)
+		}
+		if err != nil && !errors.IsNotFoundError(err) {
+			return err
+		}
+
+		return gm.RenamePlayer(ephemeralId, playerId)
+	})
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	err = c.sessionManager.SaveLoggedInPlayer(w, r, playerId)
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	logging.GetLogger(r.Context()).Infow("player registered their account", "registered_player_id", playerId)
+	utils.Redirect(w, r, "/account", 303)
+}
+
+// parseLoginRequest checks a request to log in is from someone logged out, with a form and any lobby to join
+func (c *CrosswordGameWebAPI) parseLoginRequest(r *http.Request, action string) (lobbytypes.LobbyId, error) {
+	session, err := commonutils.GetSessionFromContext(r.Context())
+	if err != nil {
+		return "", err
+	}
+	if session.IsLoggedIn() {
+		return "", &errors.InvalidActionError{
+			Action: action,
+			Reason: "already logged in",
+		}
+	}
+
+	lobbyToJoin, err := c.parseLobbyToJoin(r)
+	if err != nil {
+		return "", err
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		return "", err
+	}
+	return lobbyToJoin, nil
+}
+
+// parseLobbyToJoin returns the lobby someone was invited to before logging in, if any, checking it exists
+func (c *CrosswordGameWebAPI) parseLobbyToJoin(r *http.Request) (lobbytypes.LobbyId, error) {
+	lobbyToJoin := lobbytypes.LobbyId(r.URL.Query().Get("join_lobby"))
+	if lobbyToJoin != "" {
+		_, err := c.lobbyManager.GetLobbyState(lobbyToJoin)
+		if err != nil {
+			return "", err
+		}
+	}
+	return lobbyToJoin, nil
+}
+
+// inviteOutcome is what came of a player who just logged in being invited to a lobby
+type inviteOutcome struct {
+	// joined is the lobby they joined, if any
+	joined lobbytypes.LobbyId
+	// refusal is why the lobby wouldn't let them in, if it didn't
+	refusal string
+}
+
+// joinInvitedLobby joins a player who just logged in to the lobby they were invited to, if any
+// They may still be in a lobby from before, which they go back to instead
+// The lobby turning them away, e.g. as it is full or the password is wrong, doesn't stop them logging in,
+// so the reason is returned for showing them rather than as an error
+func joinInvitedLobby(
+	lm *lobby.Manager,
+	pm *player.Manager,
+	playerId playertypes.PlayerId,
+	lobbyToJoin lobbytypes.LobbyId,
+	lobbyPassword string,
+) (inviteOutcome, error) {
+	if lobbyToJoin == "" {
+		return inviteOutcome{}, nil
+	}
+	_, err := pm.GetLobbyForPlayer(playerId)
+	if !errors.IsNotFoundError(err) {
+		return inviteOutcome{}, err
+	}
+
+	err = lm.JoinPlayerToLobby(lobbyToJoin, playerId, lobbyPassword)
+	if reason, refused := joinRefusal(err); refused {
+		return inviteOutcome{refusal: reason}, nil
+	}
+	if err != nil {
+		return inviteOutcome{}, err
+	}
+	return inviteOutcome{joined: lobbyToJoin}, nil
+}
+
+// joinRefusal returns why joining a lobby failed if the lobby turned the player away, rather than something going wrong
+// Lobbies refuse players before changing anything, so the rest of a transaction can go ahead without them joining
+func joinRefusal(err error) (string, bool) {
+	var invalidAction *errors.InvalidActionError
+	if goerrors.As(err, &invalidAction) {
+		return invalidAction.Reason, true
+	}
+	gameErr, ok := errors.AsGameError(err)
+	if ok && (gameErr.Kind() == errors.GameErrorForbidden || gameErr.Kind() == errors.GameErrorNotFound) {
+		return gameErr.Message(), true
+	}
+	return "", false
+}
+
+// completeLogin saves the player to the session, then sends them on to the lobby they joined if any
+// If they were turned away from the lobby they were invited to, the index page tells them why
+func (c *CrosswordGameWebAPI) completeLogin(
+	w http.ResponseWriter,
+	r *http.Request,
+	playerId playertypes.PlayerId,
+	invite inviteOutcome,
+) {
+	err := c.sessionManager.SaveLoggedInPlayer(w, r, playerId)
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	if invite.joined != "" {
+		utils.Redirect(w, r, fmt.Sprintf("/lobby/%s", invite.joined), 303)
+		return
+	}
+	if invite.refusal != "" {
+		err = c.sessionManager.SaveJoinRefusal(w, r, invite.refusal)
+		if err != nil {
+			utils.SendError(r, w, err)
+			return
+		}
+	}
+	utils.Redirect(w, r, "/index", 303)
+}
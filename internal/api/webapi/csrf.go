@@ -0,0 +1,59 @@
+package webapi
+
+import (
+	"crypto/subtle"
+	commonutils "github.com/mcoot/crosswordgame-go/internal/api/utils"
+	"github.com/mcoot/crosswordgame-go/internal/api/webapi/rendering"
+	"github.com/mcoot/crosswordgame-go/internal/api/webapi/utils"
+	"github.com/mcoot/crosswordgame-go/internal/apitypes"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+	"net/http"
+)
+
+// errInvalidCSRFToken is most likely from a page rendered before the session was replaced, so reloading fixes it
+var errInvalidCSRFToken = &errors.ForbiddenError{Reason: "the page has expired, so reload it and try again"}
+
+// issueCSRFTokenMiddleware gives the session a CSRF token for the page's forms to be posted with
+func (c *CrosswordGameWebAPI) issueCSRFTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, err := commonutils.GetSessionFromContext(r.Context())
+		if err != nil {
+			utils.SendError(r, w, err)
+			return
+		}
+
+		token, err := c.sessionManager.IssueCSRFToken(w, r, session)
+		if err != nil {
+			utils.SendError(r, w, err)
+			return
+		}
+		rendering.GetRenderContext(r.Context()).CSRFToken = token
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkCSRFTokenMiddleware rejects form posts without the session's CSRF token,
+// which other sites can't read, so they can't post forms as the player with their session cookie
+func (c *CrosswordGameWebAPI) checkCSRFTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, err := commonutils.GetSessionFromContext(r.Context())
+		if err != nil {
+			utils.SendError(r, w, err)
+			return
+		}
+
+		expected := session.CSRFToken()
+		got := r.Header.Get(apitypes.CSRFHeader)
+		if got == "" {
+			got = r.PostFormValue(rendering.CSRFFormField)
+		}
+		if expected == "" || subtle.ConstantTimeCompare([]byte(got), []byte(expected)) != 1 {
+			utils.SendError(r, w, errInvalidCSRFToken)
+			return
+		}
+		rendering.GetRenderContext(r.Context()).CSRFToken = expected
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,92 @@
+package webapi
+
+import (
+	"fmt"
+	"github.com/mcoot/crosswordgame-go/internal/api/webapi/template/pages"
+	"github.com/mcoot/crosswordgame-go/internal/api/webapi/utils"
+	"github.com/mcoot/crosswordgame-go/internal/game"
+	"github.com/mcoot/crosswordgame-go/internal/lobby"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	"github.com/mcoot/crosswordgame-go/internal/player"
+	"net/http"
+	"strconv"
+)
+
+// LobbySettingsPage lets the host change who can join the lobby and how its games are set up
+func (c *CrosswordGameWebAPI) LobbySettingsPage(w http.ResponseWriter, r *http.Request) {
+	session, err := getLoggedInSessionInLobby(r)
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	err = c.lobbyManager.CheckHost(session.Lobby.Id, session.Player.Username)
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	utils.PushUrl(w, fmt.Sprintf("/lobby/%s/settings", session.Lobby.Id))
+	utils.SendResponse(r, w, pages.LobbySettings(session.Lobby), 200)
+}
+
+func (c *CrosswordGameWebAPI) UpdateLobbySettings(w http.ResponseWriter, r *http.Request) {
+	session, err := getLoggedInSessionInLobby(r)
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	update, err := parseLobbySettingsForm(r)
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		return lm.UpdateSettings(session.Lobby.Id, session.Player.Username, update)
+	})
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	utils.Redirect(w, r, fmt.Sprintf("/lobby/%s", session.Lobby.Id), 303)
+}
+
+// parseLobbySettingsForm reads every setting from the settings page, except the password if it was left blank
+func parseLobbySettingsForm(r *http.Request) (lobby.SettingsUpdate, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return lobby.SettingsUpdate{}, err
+	}
+
+	maxPlayers := 0
+	if raw := r.PostForm.Get("max_players"); raw != "" {
+		maxPlayers, err = strconv.Atoi(raw)
+		if err != nil {
+			return lobby.SettingsUpdate{}, fmt.Errorf("max_players must be a number")
+		}
+	}
+
+	boardSize, err := strconv.Atoi(r.PostForm.Get("board_size"))
+	if err != nil {
+		return lobby.SettingsUpdate{}, fmt.Errorf("board_size must be a number")
+	}
+
+	visibility := lobbytypes.Visibility(r.PostForm.Get("visibility"))
+	update := lobby.SettingsUpdate{
+		MaxPlayers:   &maxPlayers,
+		Visibility:   &visibility,
+		GameDefaults: &lobbytypes.GameOptions{BoardSize: boardSize},
+	}
+
+	password := r.PostForm.Get("lobby_password")
+	if r.PostForm.Get("remove_password") == "true" {
+		password = ""
+		update.Password = &password
+	} else if password != "" {
+		update.Password = &password
+	}
+	return update, nil
+}
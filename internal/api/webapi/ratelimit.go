@@ -0,0 +1,30 @@
+package webapi
+
+import (
+	commonutils "github.com/mcoot/crosswordgame-go/internal/api/utils"
+	"github.com/mcoot/crosswordgame-go/internal/api/webapi/utils"
+	"github.com/mcoot/crosswordgame-go/internal/ratelimit"
+	"net/http"
+)
+
+// limitPerIP rate limits the handler by client IP, for requests which log in or create a player
+func (c *CrosswordGameWebAPI) limitPerIP(action ratelimit.Action, handler http.HandlerFunc) http.Handler {
+	return c.rateLimits.Middleware(action, nil, sendRateLimitError)(handler)
+}
+
+// limitPerPlayer rate limits the handler by the logged-in player, or by client IP if nobody is logged in
+func (c *CrosswordGameWebAPI) limitPerPlayer(action ratelimit.Action, handler http.HandlerFunc) http.Handler {
+	return c.rateLimits.Middleware(action, sessionRateLimitKey, sendRateLimitError)(handler)
+}
+
+func sessionRateLimitKey(r *http.Request) string {
+	session, err := commonutils.GetSessionFromContext(r.Context())
+	if err != nil || !session.IsLoggedIn() {
+		return ""
+	}
+	return ratelimit.PlayerKey(session.Player.Username)
+}
+
+func sendRateLimitError(w http.ResponseWriter, r *http.Request, err error) {
+	utils.SendError(r, w, err)
+}
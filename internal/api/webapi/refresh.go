@@ -0,0 +1,207 @@
+package webapi
+
+import (
+	"bytes"
+	"context"
+	"github.com/a-h/templ"
+	"github.com/mcoot/crosswordgame-go/internal/api/webapi/rendering"
+	"github.com/mcoot/crosswordgame-go/internal/api/webapi/template/common"
+	"github.com/mcoot/crosswordgame-go/internal/api/webapi/template/pages"
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	"github.com/mcoot/crosswordgame-go/internal/game"
+	gametypes "github.com/mcoot/crosswordgame-go/internal/game/types"
+	"github.com/mcoot/crosswordgame-go/internal/lobby"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"github.com/mcoot/crosswordgame-go/internal/presence"
+)
+
+// refreshEventKinds are the domain events which change what players in a lobby should be seeing
+// Turn completion and game end always follow a placement, so the placement's update covers them
+var refreshEventKinds = []events.Kind{
+	lobby.EventPlayerJoinedLobby,
+	lobby.EventPlayerLeftLobby,
+	lobby.EventGameAttached,
+	lobby.EventGameDetached,
+	lobby.EventPlayerRenamed,
+	lobby.EventHostChanged,
+	lobby.EventLockChanged,
+	lobby.EventSettingsChanged,
+	game.EventLetterAnnounced,
+	game.EventLetterPlaced,
+	presence.EventPresenceChanged,
+}
+
+// fragment is a part of the lobby page to push to a player
+type fragment struct {
+	id      rendering.FragmentId
+	content templ.Component
+}
+
+// refreshOnDomainEvent updates the pages of players in the lobby an event relates to
+// Changes within a game or to the players in the lobby are pushed as fragments, while anything else refreshes the page
+// The player who caused the event (if known) is skipped, as their own request already re-renders their page
+func (c *CrosswordGameWebAPI) refreshOnDomainEvent(e events.Event) bool {
+	switch evt := e.(type) {
+	case events.TypedEvent[lobby.PlayerJoinedLobby]:
+		c.sendLobbyPlayerListFragments(evt.Data.LobbyId, evt.Data.PlayerId)
+	case events.TypedEvent[lobby.PlayerLeftLobby]:
+		if evt.Data.KickedBy != "" {
+			// The kicked player's page is refreshed too, which takes them out of the lobby
+			c.sseServer.SendRefresh(evt.Data.LobbyId, evt.Data.KickedBy)
+			break
+		}
+		c.sendLobbyPlayerListFragments(evt.Data.LobbyId, evt.Data.PlayerId)
+	case events.TypedEvent[lobby.GameAttached]:
+		c.sseServer.SendRefresh(evt.Data.LobbyId, "")
+	case events.TypedEvent[lobby.GameDetached]:
+		c.sseServer.SendRefresh(evt.Data.LobbyId, "")
+	case events.TypedEvent[lobby.PlayerRenamed]:
+		// Connections opened before the rename are still under the player's old ID, so nobody is skipped
+		c.sseServer.SendRefresh(evt.Data.LobbyId, "")
+	case events.TypedEvent[lobby.HostChanged]:
+		// Which controls each player sees depends on who hosts the lobby
+		c.sseServer.SendRefresh(evt.Data.LobbyId, "")
+	case events.TypedEvent[lobby.LockChanged]:
+		c.sseServer.SendRefresh(evt.Data.LobbyId, "")
+	case events.TypedEvent[lobby.SettingsChanged]:
+		c.sseServer.SendRefresh(evt.Data.LobbyId, "")
+	case events.TypedEvent[game.LetterAnnounced]:
+		c.sendGameFragments(evt.Data.GameId, evt.Data.PlayerId)
+	case events.TypedEvent[game.LetterPlaced]:
+		c.sendGameFragments(evt.Data.GameId, evt.Data.PlayerId)
+	case events.TypedEvent[presence.PresenceChanged]:
+		c.sendPresenceFragments(evt.Data.LobbyId)
+	}
+	return true
+}
+
+func (c *CrosswordGameWebAPI) sendLobbyPlayerListFragments(lobbyId lobbytypes.LobbyId, initiatingPlayer playertypes.PlayerId) {
+	lobbyState, err := c.lobbyManager.GetLobbyState(lobbyId)
+	if err != nil {
+		c.sseServer.SendRefresh(lobbyId, initiatingPlayer)
+		return
+	}
+	lobbyPlayers, err := c.lookupLobbyPlayers(lobbyState)
+	if err != nil {
+		c.sseServer.SendRefresh(lobbyId, initiatingPlayer)
+		return
+	}
+	presences := c.presence.GetAll(lobbyId, lobbyState.Players)
+
+	c.sendFragmentsToEachViewer(lobbyState, initiatingPlayer, func(viewer *playertypes.Player) ([]fragment, error) {
+		return []fragment{
+			{id: rendering.FragmentLobbyPlayerList, content: pages.LobbyPlayerList(lobbyState, lobbyPlayers, viewer, presences)},
+		}, nil
+	})
+}
+
+// sendPresenceFragments pushes the lobby's player list, and its game's status which shows who the game is waiting on
+// Nobody initiates a presence change, so everyone connected to the lobby is sent the fragments
+func (c *CrosswordGameWebAPI) sendPresenceFragments(lobbyId lobbytypes.LobbyId) {
+	lobbyState, err := c.lobbyManager.GetLobbyState(lobbyId)
+	if err != nil {
+		// The lobby may have gone away while a player was disconnecting from it
+		return
+	}
+	lobbyPlayers, err := c.lookupLobbyPlayers(lobbyState)
+	if err != nil {
+		c.sseServer.SendRefresh(lobbyId, "")
+		return
+	}
+	presences := c.presence.GetAll(lobbyId, lobbyState.Players)
+
+	c.sendFragmentsToEachViewer(lobbyState, "", func(viewer *playertypes.Player) ([]fragment, error) {
+		fragments := []fragment{
+			{id: rendering.FragmentLobbyPlayerList, content: pages.LobbyPlayerList(lobbyState, lobbyPlayers, viewer, presences)},
+		}
+		if lobbyState.HasRunningGame() {
+			view, err := c.buildLobbyGameView(viewer, lobbyState)
+			if err != nil {
+				return nil, err
+			}
+			fragments = append(fragments, fragment{id: rendering.FragmentGameStatus, content: view.status})
+		}
+		return fragments, nil
+	})
+}
+
+// sendGameFragments pushes the game's status and each viewer's play area to the lobby running the game
+// Once the game has finished, the page changes beyond those fragments, so it is refreshed instead
+func (c *CrosswordGameWebAPI) sendGameFragments(gameId gametypes.GameId, initiatingPlayer playertypes.PlayerId) {
+	lobbyState, err := c.lobbyManager.GetLobbyForGame(gameId)
+	if err != nil {
+		// Games created through the JSON API need not belong to any lobby
+		return
+	}
+	gameState, err := c.gameManager.GetGameState(gameId)
+	if err != nil || gameState.Status == gametypes.StatusFinished {
+		c.sseServer.SendRefresh(lobbyState.Id, initiatingPlayer)
+		return
+	}
+
+	c.sendFragmentsToEachViewer(lobbyState, initiatingPlayer, func(viewer *playertypes.Player) ([]fragment, error) {
+		view, err := c.buildLobbyGameView(viewer, lobbyState)
+		if err != nil {
+			return nil, err
+		}
+		return []fragment{
+			{id: rendering.FragmentGameStatus, content: view.status},
+			{id: rendering.FragmentGamePlayArea, content: view.playArea},
+		}, nil
+	})
+}
+
+// sendFragmentsToEachViewer renders fragments for each player connected to the lobby, as they would see them
+// A viewer whose fragments can't be rendered is sent a full refresh instead
+func (c *CrosswordGameWebAPI) sendFragmentsToEachViewer(
+	lobbyState *lobbytypes.Lobby,
+	initiatingPlayer playertypes.PlayerId,
+	build func(viewer *playertypes.Player) ([]fragment, error),
+) {
+	refresh, err := refreshEvent{LobbyId: lobbyState.Id, InitiatingPlayer: initiatingPlayer}.ToSSE()
+	if err != nil {
+		return
+	}
+
+	perViewer := make(map[playertypes.PlayerId][]sseEvent)
+	for _, viewerId := range c.sseServer.ConnectedPlayers(lobbyState.Id) {
+		if viewerId == initiatingPlayer {
+			continue
+		}
+
+		evts, err := c.renderViewerFragments(viewerId, build)
+		if err != nil {
+			perViewer[viewerId] = []sseEvent{refresh}
+			continue
+		}
+		perViewer[viewerId] = evts
+	}
+	c.sseServer.SendToPlayers(lobbyState.Id, initiatingPlayer, perViewer)
+}
+
+// renderViewerFragments renders each fragment as an out-of-band swap, in an SSE event named after it
+func (c *CrosswordGameWebAPI) renderViewerFragments(
+	viewerId playertypes.PlayerId,
+	build func(viewer *playertypes.Player) ([]fragment, error),
+) ([]sseEvent, error) {
+	viewer, err := c.playerManager.LookupPlayer(viewerId)
+	if err != nil {
+		return nil, err
+	}
+	fragments, err := build(viewer)
+	if err != nil {
+		return nil, err
+	}
+
+	evts := make([]sseEvent, len(fragments))
+	for i, f := range fragments {
+		var buf bytes.Buffer
+		err := common.OutOfBandFragment(f.id, f.content).Render(context.Background(), &buf)
+		if err != nil {
+			return nil, err
+		}
+		evts[i] = sseEvent{Event: string(f.id), Data: buf.String()}
+	}
+	return evts, nil
+}
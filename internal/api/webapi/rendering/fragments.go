@@ -0,0 +1,28 @@
+package rendering
+
+import "strings"
+
+// FragmentId is the element id of a part of the lobby page which is updated in place over SSE
+// Each fragment is pushed as an SSE event of the same name, holding an out-of-band swap for the element
+type FragmentId string
+
+const (
+	FragmentLobbyPlayerList FragmentId = "lobby-playerlist"
+	FragmentGameStatus      FragmentId = "game-status"
+	FragmentGamePlayArea    FragmentId = "game-playarea"
+)
+
+var fragmentIds = []FragmentId{
+	FragmentLobbyPlayerList,
+	FragmentGameStatus,
+	FragmentGamePlayArea,
+}
+
+// FragmentSSEEvents lists the SSE events carrying fragments, as for an sse-swap attribute
+func FragmentSSEEvents() string {
+	names := make([]string, len(fragmentIds))
+	for i, id := range fragmentIds {
+		names[i] = string(id)
+	}
+	return strings.Join(names, ",")
+}
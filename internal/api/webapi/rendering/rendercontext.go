@@ -2,15 +2,22 @@ package rendering
 
 import (
 	"context"
+	"encoding/json"
+	"github.com/mcoot/crosswordgame-go/internal/apitypes"
 	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
 	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
 	"github.com/mcoot/crosswordgame-go/internal/utils"
 )
 
+// CSRFFormField carries the session's CSRF token in forms, for when they are posted without htmx
+const CSRFFormField = "csrf_token"
+
 type RenderContext struct {
 	Target             RenderTarget
 	LoggedInPlayer     *playertypes.Player
 	CurrentPlayerLobby *lobbytypes.Lobby
+	// CSRFToken is the session's CSRF token, which is "" when rendering outside a request, e.g. fragments pushed by SSE
+	CSRFToken string
 }
 
 func WithRenderContext(ctx context.Context, renderCtx *RenderContext) context.Context {
@@ -33,6 +40,20 @@ func GetCurrentPlayerLobby(ctx context.Context) *lobbytypes.Lobby {
 	return GetRenderContext(ctx).CurrentPlayerLobby
 }
 
+func GetCSRFToken(ctx context.Context) string {
+	return GetRenderContext(ctx).CSRFToken
+}
+
+// CSRFHeaders is the hx-headers attribute sending the session's CSRF token on every htmx request from the page,
+// including from fragments rendered without it
+func CSRFHeaders(ctx context.Context) string {
+	headers, err := json.Marshal(map[string]string{apitypes.CSRFHeader: GetCSRFToken(ctx)})
+	if err != nil {
+		return "{}"
+	}
+	return string(headers)
+}
+
 func defaultRenderContext() *RenderContext {
 	return &RenderContext{
 		Target: RenderTarget{
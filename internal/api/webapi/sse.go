@@ -1,26 +1,57 @@
 package webapi
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	commonutils "github.com/mcoot/crosswordgame-go/internal/api/utils"
 	"github.com/mcoot/crosswordgame-go/internal/api/webapi/utils"
 	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
 	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"github.com/mcoot/crosswordgame-go/internal/presence"
+	"github.com/prometheus/client_golang/prometheus"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+)
+
+const (
+	// sseConnectionBufferSize is how many events may be waiting for a connection before further ones are dropped
+	sseConnectionBufferSize = 32
+	// sseReplayBufferSize is how many of each lobby's latest updates are kept for clients reconnecting
+	sseReplayBufferSize = 64
+	// sseHeartbeatInterval is how often connections are sent a comment, so proxies don't close them as idle
+	sseHeartbeatInterval = 15 * time.Second
 )
 
 type sseEvent struct {
+	Id    uint64
 	Event string
-	Data  interface{}
+	Data  string
 }
 
-func (e sseEvent) Build() (string, error) {
-	str, err := json.Marshal(e.Data)
+func newJSONSSEEvent(event string, data interface{}) (sseEvent, error) {
+	str, err := json.Marshal(data)
 	if err != nil {
-		return "", err
+		return sseEvent{}, err
+	}
+	return sseEvent{Event: event, Data: string(str)}, nil
+}
+
+// Build formats the event for the stream, with a data field for each line of its data
+func (e sseEvent) Build() string {
+	var sb strings.Builder
+	if e.Id != 0 {
+		fmt.Fprintf(&sb, "id: %d\r\n", e.Id)
+	}
+	fmt.Fprintf(&sb, "event: %s\r\n", e.Event)
+	for _, line := range strings.Split(e.Data, "\n") {
+		fmt.Fprintf(&sb, "data: %s\r\n", strings.TrimSuffix(line, "\r"))
 	}
-	return fmt.Sprintf("event: %s\r\ndata: %s\r\n\r\n", e.Event, str), nil
+	sb.WriteString("\r\n")
+	return sb.String()
 }
 
 type refreshEvent struct {
@@ -28,25 +59,62 @@ type refreshEvent struct {
 	InitiatingPlayer playertypes.PlayerId
 }
 
-func (e refreshEvent) ToSSE() sseEvent {
-	return sseEvent{
-		Event: "refresh",
-		Data:  e,
+func (e refreshEvent) ToSSE() (sseEvent, error) {
+	return newJSONSSEEvent("refresh", e)
+}
+
+// lobbyUpdate is one change sent to the players in a lobby, kept so it can be replayed to them
+// It is either the same event for everyone, or events rendered for each player connected at the time
+type lobbyUpdate struct {
+	id        uint64
+	initiator playertypes.PlayerId
+	broadcast *sseEvent
+	perPlayer map[playertypes.PlayerId][]sseEvent
+}
+
+// eventsFor returns what the update sent to the player, or false if they were not sent it because they weren't connected
+func (u *lobbyUpdate) eventsFor(playerId playertypes.PlayerId) ([]sseEvent, bool) {
+	if playerId == u.initiator {
+		return nil, true
+	}
+	if u.broadcast != nil {
+		return []sseEvent{*u.broadcast}, true
 	}
+	evts, ok := u.perPlayer[playerId]
+	return evts, ok
+}
+
+// lobbyStream holds the connections to a lobby and its recent updates
+type lobbyStream struct {
+	connections map[playertypes.PlayerId][]chan sseEvent
+	lastId      uint64
+	// updates is the replay buffer, oldest first
+	updates []*lobbyUpdate
 }
 
 type sseServer struct {
-	running           bool
+	// presence is told as players connect and disconnect, as an open lobby page shows they are around
+	presence *presence.Tracker
+	// connections counts the open connections, for monitoring
+	connections       prometheus.Gauge
+	heartbeatInterval time.Duration
 	refreshInput      chan refreshEvent
-	activeConnections map[lobbytypes.LobbyId]map[playertypes.PlayerId][]chan refreshEvent
+	lobbies           map[lobbytypes.LobbyId]*lobbyStream
 	mutex             sync.RWMutex
+	startOnce         sync.Once
+	// done is closed once the server's context ends, which closes every connection
+	done chan struct{}
 }
 
-func newSSEServer() *sseServer {
+func newSSEServer(presenceTracker *presence.Tracker, connections prometheus.Gauge) *sseServer {
 	return &sseServer{
+		presence:          presenceTracker,
+		connections:       connections,
+		heartbeatInterval: sseHeartbeatInterval,
 		refreshInput:      make(chan refreshEvent),
-		activeConnections: make(map[lobbytypes.LobbyId]map[playertypes.PlayerId][]chan refreshEvent),
+		lobbies:           make(map[lobbytypes.LobbyId]*lobbyStream),
 		mutex:             sync.RWMutex{},
+		done:              make(chan struct{}),
 	}
 }
 
@@ -57,28 +125,49 @@ func (s *sseServer) HandleRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Set http headers required for SSE
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
+	rc := commonutils.StartEventStream(w)
 
 	// You may need this locally for CORS requests
 	//w.Header().Set("Access-Control-Allow-Origin", "*")
 
-	eventChan := s.newConnection(session.Lobby.Id, session.Player.Username)
+	lastEventId, hasLastEventId := parseLastEventId(r)
+	eventChan, replay := s.newConnection(session.Lobby.Id, session.Player.Username, lastEventId, hasLastEventId)
+	defer s.dropConnection(session.Lobby.Id, session.Player.Username, eventChan)
+	s.connections.Inc()
+	defer s.connections.Dec()
+	s.presence.Connected(session.Lobby.Id, session.Player.Username)
+	defer s.presence.Disconnected(session.Lobby.Id, session.Player.Username)
 
-	rc := http.NewResponseController(w)
+	// Respond straight away, so the client knows it will receive every event from here on
+	for _, evt := range replay {
+		if _, err := w.Write([]byte(evt.Build())); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(s.heartbeatInterval)
+	defer heartbeat.Stop()
 	for {
 		select {
 		case <-r.Context().Done():
-			s.dropConnection(session.Lobby.Id, session.Player.Username, eventChan)
 			return
-		case <-eventChan:
-			evt, err := refreshEvent{}.ToSSE().Build()
+		case <-s.done:
+			commonutils.EndEventStreamForShutdown(w, rc)
+			return
+		case <-heartbeat.C:
+			_, err = w.Write([]byte(": heartbeat\r\n\r\n"))
+			if err != nil {
+				return
+			}
+			err = rc.Flush()
 			if err != nil {
 				return
 			}
-			_, err = w.Write([]byte(evt))
+		case evt := <-eventChan:
+			_, err = w.Write([]byte(evt.Build()))
 			if err != nil {
 				return
 			}
@@ -88,65 +177,111 @@ func (s *sseServer) HandleRequest(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 	}
-
 }
 
-func (s *sseServer) Start() {
-	if s.running {
-		return
+// parseLastEventId reads the id of the last event a reconnecting client saw, if any
+func parseLastEventId(r *http.Request) (uint64, bool) {
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		return 0, false
 	}
-	s.running = true
-	defer func() {
-		s.running = false
-	}()
-	// TODO: context for graceful shutdown
-	go func() {
-		for e := range s.refreshInput {
-			s.broadcastRefreshExceptToInitiator(e.LobbyId, e.InitiatingPlayer)
-		}
-	}()
+	id, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		// Treat an id we never issued like one too old to replay from
+		return 0, true
+	}
+	return id, true
+}
+
+// Start runs the broadcaster until ctx is done, at which point every open connection is closed too
+func (s *sseServer) Start(ctx context.Context) {
+	s.startOnce.Do(func() {
+		go func() {
+			defer close(s.done)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case e := <-s.refreshInput:
+					s.broadcastRefreshExceptToInitiator(e.LobbyId, e.InitiatingPlayer)
+				}
+			}
+		}()
+	})
 }
 
 func (s *sseServer) SendRefresh(lobbyId lobbytypes.LobbyId, initiatingPlayer playertypes.PlayerId) {
-	s.refreshInput <- refreshEvent{
+	select {
+	case s.refreshInput <- refreshEvent{
 		LobbyId:          lobbyId,
 		InitiatingPlayer: initiatingPlayer,
+	}:
+	case <-s.done:
 	}
 }
 
-func (s *sseServer) newConnection(lobbyId lobbytypes.LobbyId, playerId playertypes.PlayerId) chan refreshEvent {
-	channel := make(chan refreshEvent)
+// newConnection registers a connection to the lobby, returning the events to replay to it first
+// Without a last event id the client is new and needs no replay; if its missed updates can't be replayed, it is refreshed
+func (s *sseServer) newConnection(
+	lobbyId lobbytypes.LobbyId,
+	playerId playertypes.PlayerId,
+	lastEventId uint64,
+	hasLastEventId bool,
+) (chan sseEvent, []sseEvent) {
+	channel := make(chan sseEvent, sseConnectionBufferSize)
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	channelsForLobby, ok := s.activeConnections[lobbyId]
-	if !ok {
-		channelsForLobby = make(map[playertypes.PlayerId][]chan refreshEvent)
+
+	stream := s.lobbyStream(lobbyId)
+	stream.connections[playerId] = append(stream.connections[playerId], channel)
+
+	if !hasLastEventId || lastEventId == stream.lastId {
+		return channel, nil
 	}
+	return channel, stream.replay(lobbyId, playerId, lastEventId)
+}
 
-	channelsForPlayer, ok := channelsForLobby[playerId]
-	if !ok {
-		channelsForPlayer = make([]chan refreshEvent, 0)
+// replay returns the events the player missed since lastEventId
+func (l *lobbyStream) replay(lobbyId lobbytypes.LobbyId, playerId playertypes.PlayerId, lastEventId uint64) []sseEvent {
+	refresh, err := refreshEvent{LobbyId: lobbyId}.ToSSE()
+	if err != nil {
+		return nil
 	}
-	channelsForPlayer = append(channelsForPlayer, channel)
-	channelsForLobby[playerId] = channelsForPlayer
-	s.activeConnections[lobbyId] = channelsForLobby
-	return channel
+	refresh.Id = l.lastId
+
+	// The id is from before the oldest update we still have, or from before the server restarted
+	if lastEventId > l.lastId || len(l.updates) == 0 || lastEventId+1 < l.updates[0].id {
+		return []sseEvent{refresh}
+	}
+
+	var replay []sseEvent
+	for _, update := range l.updates {
+		if update.id <= lastEventId {
+			continue
+		}
+		evts, ok := update.eventsFor(playerId)
+		if !ok {
+			return []sseEvent{refresh}
+		}
+		replay = append(replay, evts...)
+	}
+	return replay
 }
 
 func (s *sseServer) dropConnection(
 	lobbyId lobbytypes.LobbyId,
 	playerId playertypes.PlayerId,
-	channel chan refreshEvent,
+	channel chan sseEvent,
 ) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	channelsForLobby, ok := s.activeConnections[lobbyId]
+	stream, ok := s.lobbies[lobbyId]
 	if !ok {
 		return
 	}
 
-	channelsForPlayer, ok := channelsForLobby[playerId]
+	channelsForPlayer, ok := stream.connections[playerId]
 	if !ok {
 		return
 	}
@@ -157,27 +292,107 @@ func (s *sseServer) dropConnection(
 			break
 		}
 	}
-	channelsForLobby[playerId] = channelsForPlayer
-	s.activeConnections[lobbyId] = channelsForLobby
+	if len(channelsForPlayer) == 0 {
+		delete(stream.connections, playerId)
+	} else {
+		stream.connections[playerId] = channelsForPlayer
+	}
 }
 
 func (s *sseServer) broadcastRefreshExceptToInitiator(lobbyId lobbytypes.LobbyId, initiator playertypes.PlayerId) {
+	evt, err := refreshEvent{LobbyId: lobbyId, InitiatingPlayer: initiator}.ToSSE()
+	if err != nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stream := s.lobbyStream(lobbyId)
+	update := stream.nextUpdate(initiator)
+	evt.Id = update.id
+	update.broadcast = &evt
+
+	for playerId, channels := range stream.connections {
+		if playerId != initiator {
+			for _, c := range channels {
+				trySend(c, evt)
+			}
+		}
+	}
+}
+
+// ConnectedPlayers lists the players in the lobby with at least one open connection
+func (s *sseServer) ConnectedPlayers(lobbyId lobbytypes.LobbyId) []playertypes.PlayerId {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	channelsForLobby, ok := s.activeConnections[lobbyId]
+	stream, ok := s.lobbies[lobbyId]
 	if !ok {
-		return
+		return nil
 	}
+	var players []playertypes.PlayerId
+	for playerId := range stream.connections {
+		players = append(players, playerId)
+	}
+	return players
+}
 
-	for playerId, channels := range channelsForLobby {
-		if playerId != initiator {
-			for _, c := range channels {
-				c <- refreshEvent{
-					LobbyId:          lobbyId,
-					InitiatingPlayer: initiator,
-				}
+// SendToPlayers sends each player's events to their connections to the lobby, as one update
+// Players connecting later who missed the update are refreshed on reconnect, as it was not rendered for them
+func (s *sseServer) SendToPlayers(
+	lobbyId lobbytypes.LobbyId,
+	initiator playertypes.PlayerId,
+	perPlayer map[playertypes.PlayerId][]sseEvent,
+) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stream := s.lobbyStream(lobbyId)
+	update := stream.nextUpdate(initiator)
+	update.perPlayer = make(map[playertypes.PlayerId][]sseEvent, len(perPlayer))
+
+	for playerId, evts := range perPlayer {
+		withIds := make([]sseEvent, len(evts))
+		for i, evt := range evts {
+			evt.Id = update.id
+			withIds[i] = evt
+		}
+		update.perPlayer[playerId] = withIds
+
+		for _, c := range stream.connections[playerId] {
+			for _, evt := range withIds {
+				trySend(c, evt)
 			}
 		}
 	}
 }
+
+// lobbyStream returns the lobby's stream, creating it if needed; the caller must hold the write lock
+func (s *sseServer) lobbyStream(lobbyId lobbytypes.LobbyId) *lobbyStream {
+	stream, ok := s.lobbies[lobbyId]
+	if !ok {
+		stream = &lobbyStream{connections: make(map[playertypes.PlayerId][]chan sseEvent)}
+		s.lobbies[lobbyId] = stream
+	}
+	return stream
+}
+
+// nextUpdate adds an update with the lobby's next id to the replay buffer, dropping the oldest if it is full
+func (l *lobbyStream) nextUpdate(initiator playertypes.PlayerId) *lobbyUpdate {
+	l.lastId++
+	update := &lobbyUpdate{id: l.lastId, initiator: initiator}
+	l.updates = append(l.updates, update)
+	if len(l.updates) > sseReplayBufferSize {
+		l.updates = l.updates[len(l.updates)-sseReplayBufferSize:]
+	}
+	return update
+}
+
+// trySend queues the event for a connection, dropping it if the connection is too far behind
+func trySend(c chan sseEvent, evt sseEvent) {
+	select {
+	case c <- evt:
+	default:
+	}
+}
@@ -0,0 +1,219 @@
+package webapi
+
+import (
+	"bufio"
+	"context"
+	commonutils "github.com/mcoot/crosswordgame-go/internal/api/utils"
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	"github.com/mcoot/crosswordgame-go/internal/metrics"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"github.com/mcoot/crosswordgame-go/internal/presence"
+	"github.com/stretchr/testify/suite"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testLobbyId lobbytypes.LobbyId = "lobby0"
+
+type SSEServerSuite struct {
+	suite.Suite
+	server *sseServer
+	cancel context.CancelFunc
+}
+
+func TestSSEServerSuite(t *testing.T) {
+	suite.Run(t, new(SSEServerSuite))
+}
+
+func (s *SSEServerSuite) SetupTest() {
+	var ctx context.Context
+	ctx, s.cancel = context.WithCancel(context.Background())
+	s.server = newSSEServer(
+		presence.NewTracker(events.NewEventBus(), presence.DefaultConfig),
+		metrics.NewMetrics().SSEConnections(),
+	)
+	s.server.Start(ctx)
+}
+
+func (s *SSEServerSuite) TearDownTest() {
+	s.cancel()
+}
+
+// serve runs the SSE server over HTTP, with every request logged in as the player in the test lobby
+func (s *SSEServerSuite) serve(playerId playertypes.PlayerId) *httptest.Server {
+	session := &commonutils.Session{
+		Player: &playertypes.Player{Username: playerId},
+		Lobby:  &lobbytypes.Lobby{Id: testLobbyId},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.server.HandleRequest(w, r.WithContext(commonutils.AddSessionToContext(r.Context(), session)))
+	}))
+	s.T().Cleanup(server.Close)
+	return server
+}
+
+func (s *SSEServerSuite) connect(server *httptest.Server, lastEventId string) *bufio.Reader {
+	req, err := http.NewRequest("GET", server.URL, nil)
+	s.Require().NoError(err)
+	if lastEventId != "" {
+		req.Header.Set("Last-Event-ID", lastEventId)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	s.T().Cleanup(func() { _ = resp.Body.Close() })
+	return bufio.NewReader(resp.Body)
+}
+
+// readEvent reads up to the end of the next event or comment, returning its lines
+func (s *SSEServerSuite) readEvent(reader *bufio.Reader) []string {
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		s.Require().NoError(err)
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+// broadcast sends a refresh to the lobby, returning the id it was given
+func (s *SSEServerSuite) broadcast(initiator playertypes.PlayerId) uint64 {
+	s.server.broadcastRefreshExceptToInitiator(testLobbyId, initiator)
+	return s.lastId()
+}
+
+func (s *SSEServerSuite) lastId() uint64 {
+	s.server.mutex.RLock()
+	defer s.server.mutex.RUnlock()
+	return s.server.lobbies[testLobbyId].lastId
+}
+
+func (s *SSEServerSuite) replayFor(playerId playertypes.PlayerId, lastEventId uint64) []sseEvent {
+	c, replay := s.server.newConnection(testLobbyId, playerId, lastEventId, true)
+	s.server.dropConnection(testLobbyId, playerId, c)
+	return replay
+}
+
+func (s *SSEServerSuite) TestBuildSplitsMultilineData() {
+	evt := sseEvent{Id: 7, Event: "game-status", Data: "<div>\n<p>hi</p>\n</div>"}
+	s.Equal("id: 7\r\nevent: game-status\r\ndata: <div>\r\ndata: <p>hi</p>\r\ndata: </div>\r\n\r\n", evt.Build())
+}
+
+func (s *SSEServerSuite) TestEventIdsIncreasePerLobby() {
+	first := s.broadcast("")
+	s.Equal(first+1, s.broadcast(""))
+
+	s.server.SendToPlayers(testLobbyId, "", map[playertypes.PlayerId][]sseEvent{"player0": {{Event: "game-status"}}})
+	s.Equal(first+2, s.lastId())
+
+	// Other lobbies count separately
+	s.server.broadcastRefreshExceptToInitiator("lobby1", "")
+	s.Equal(first+2, s.lastId())
+}
+
+func (s *SSEServerSuite) TestReplaysMissedUpdates() {
+	lastSeen := s.broadcast("")
+	s.broadcast("player0")
+	s.server.SendToPlayers(testLobbyId, "", map[playertypes.PlayerId][]sseEvent{
+		"player0": {{Event: "game-status", Data: "for player0"}},
+		"player1": {{Event: "game-status", Data: "for player1"}},
+	})
+
+	// The player's own update is skipped, and they get the fragments rendered for them
+	replay := s.replayFor("player0", lastSeen)
+	s.Require().Len(replay, 1)
+	s.Equal("for player0", replay[0].Data)
+	s.Equal(lastSeen+2, replay[0].Id)
+
+	replay = s.replayFor("player1", lastSeen)
+	s.Require().Len(replay, 2)
+	s.Equal("refresh", replay[0].Event)
+	s.Equal(lastSeen+1, replay[0].Id)
+	s.Equal("for player1", replay[1].Data)
+
+	s.Empty(s.replayFor("player1", s.lastId()))
+}
+
+func (s *SSEServerSuite) TestRefreshesWhenUpdatesCannotBeReplayed() {
+	lastSeen := s.broadcast("")
+
+	// An update rendered only for the players connected at the time
+	s.server.SendToPlayers(testLobbyId, "", map[playertypes.PlayerId][]sseEvent{"player0": {{Event: "game-status"}}})
+	replay := s.replayFor("player1", lastSeen)
+	s.Require().Len(replay, 1)
+	s.Equal("refresh", replay[0].Event)
+	s.Equal(s.lastId(), replay[0].Id)
+
+	// An id newer than any issued, e.g. from before a restart
+	replay = s.replayFor("player1", s.lastId()+10)
+	s.Require().Len(replay, 1)
+	s.Equal("refresh", replay[0].Event)
+
+	// An id older than the replay buffer
+	for i := 0; i < sseReplayBufferSize; i++ {
+		s.broadcast("")
+	}
+	replay = s.replayFor("player1", lastSeen)
+	s.Require().Len(replay, 1)
+	s.Equal("refresh", replay[0].Event)
+}
+
+func (s *SSEServerSuite) TestReconnectingClientReceivesReplayOverHTTP() {
+	server := s.serve("player1")
+	lastSeen := s.broadcast("")
+	s.broadcast("player0")
+
+	reader := s.connect(server, strconv.FormatUint(lastSeen, 10))
+	lines := s.readEvent(reader)
+	s.Equal("id: "+strconv.FormatUint(lastSeen+1, 10), lines[0])
+	s.Equal("event: refresh", lines[1])
+}
+
+func (s *SSEServerSuite) TestSendsHeartbeats() {
+	s.server.heartbeatInterval = 10 * time.Millisecond
+	reader := s.connect(s.serve("player0"), "")
+
+	s.Equal([]string{": heartbeat"}, s.readEvent(reader))
+}
+
+func (s *SSEServerSuite) TestShutdownClosesConnections() {
+	reader := s.connect(s.serve("player0"), "")
+
+	s.cancel()
+	type result struct {
+		lines []string
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var r result
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				r.err = err
+				done <- r
+				return
+			}
+			r.lines = append(r.lines, strings.TrimRight(line, "\r\n"))
+		}
+	}()
+	select {
+	case r := <-done:
+		// The client is told to reconnect promptly before the stream ends
+		s.Equal([]string{"retry: 1000", ""}, r.lines)
+		s.ErrorIs(r.err, io.EOF)
+	case <-time.After(5 * time.Second):
+		s.FailNow("connection not closed on shutdown")
+	}
+
+	// Refreshes no longer block once the broadcaster has stopped
+	s.server.SendRefresh(testLobbyId, "")
+}
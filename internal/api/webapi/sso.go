@@ -0,0 +1,134 @@
+package webapi
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	commonutils "github.com/mcoot/crosswordgame-go/internal/api/utils"
+	"github.com/mcoot/crosswordgame-go/internal/api/webapi/utils"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+	"github.com/mcoot/crosswordgame-go/internal/game"
+	"github.com/mcoot/crosswordgame-go/internal/lobby"
+	"github.com/mcoot/crosswordgame-go/internal/logging"
+	"github.com/mcoot/crosswordgame-go/internal/player"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"github.com/mcoot/crosswordgame-go/internal/sso"
+	"net/http"
+)
+
+// ssoProviderName is what the OIDC provider is shown as, or "" if signing in with one is disabled
+func (c *CrosswordGameWebAPI) ssoProviderName() string {
+	if c.ssoProvider == nil {
+		return ""
+	}
+	return c.ssoProvider.Name()
+}
+
+// OIDCLogin sends the player to the OIDC provider to sign in
+// Players who are logged out sign in with the account linked to their identity, and registered players link one
+func (c *CrosswordGameWebAPI) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	session, err := commonutils.GetSessionFromContext(r.Context())
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+	if session.IsLoggedIn() && !session.Player.IsRegistered() {
+		utils.SendError(r, w, &errors.InvalidActionError{
+			Action: "oidc_login",
+			Reason: "guests must log out or create an account first",
+		})
+		return
+	}
+
+	flow := &commonutils.LoginFlow{
+		State:        rand.Text(),
+		Nonce:        rand.Text(),
+		CodeVerifier: sso.NewCodeVerifier(),
+	}
+	if !session.IsLoggedIn() {
+		flow.JoinLobby, err = c.parseLobbyToJoin(r)
+		if err != nil {
+			utils.SendError(r, w, err)
+			return
+		}
+	}
+	err = c.sessionManager.SaveLoginFlow(w, r, flow)
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	http.Redirect(w, r, c.ssoProvider.AuthCodeURL(flow.State, flow.Nonce, flow.CodeVerifier), http.StatusFound)
+}
+
+// OIDCCallback finishes signing in once the OIDC provider sends the player back
+func (c *CrosswordGameWebAPI) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	session, err := commonutils.GetSessionFromContext(r.Context())
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+	flow, err := c.sessionManager.TakeLoginFlow(w, r)
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	// The state ties the callback to a sign-in started in this session, so nobody can log someone else in as themselves
+	query := r.URL.Query()
+	if flow == nil || subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(flow.State)) != 1 {
+		utils.SendError(r, w, &errors.UnauthorizedError{Reason: "sign-in was not started in this session, or has already finished"})
+		return
+	}
+	if providerError := query.Get("error"); providerError != "" {
+		utils.SendError(r, w, &errors.UnauthorizedError{
+			Reason: fmt.Sprintf("%s sign-in failed: %s", c.ssoProvider.Name(), providerError),
+		})
+		return
+	}
+
+	logger := logging.GetLogger(r.Context())
+	identity, err := c.ssoProvider.Exchange(r.Context(), query.Get("code"), flow.CodeVerifier, flow.Nonce)
+	if err != nil {
+		// The details are for the logs, since they may say more about the provider than players should see
+		logger.Warnw("error completing OIDC sign-in", "error", err)
+		utils.SendError(r, w, &errors.UnauthorizedError{
+			Reason: fmt.Sprintf("%s sign-in failed", c.ssoProvider.Name()),
+		})
+		return
+	}
+	externalIdentity := playertypes.ExternalIdentity{Issuer: identity.Issuer, Subject: identity.Subject}
+
+	if session.IsLoggedIn() {
+		err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+			return pm.LinkExternalIdentity(session.Player.Username, externalIdentity)
+		})
+		if err != nil {
+			utils.SendError(r, w, err)
+			return
+		}
+		logger.Infow("player linked an external identity", "issuer", identity.Issuer)
+		utils.Redirect(w, r, "/account", 303)
+		return
+	}
+
+	var playerId playertypes.PlayerId
+	var invite inviteOutcome
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		var err error
+		playerId, err = pm.LoginWithExternalIdentity(externalIdentity, identity.SuggestedUsername(), identity.Name)
+		if err != nil {
+			return err
+		}
+		// There is nowhere to give a lobby's password, so players invited to one with a password join from the index page
+		invite, err = joinInvitedLobby(lm, pm, playerId, flow.JoinLobby, "")
+		return err
+	})
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	logger.Infow("player logged in with an external identity", "player_id", playerId, "issuer", identity.Issuer)
+	c.completeLogin(w, r, playerId, invite)
+}
@@ -45,6 +45,7 @@ func SendError(
 	logger := logging.GetLogger(r.Context())
 
 	resp := apitypes.ToErrorResponse(err)
+	resp.RequestId = logging.GetRequestId(r.Context())
 	logger.Warnw(
 		"error handling web request",
 		"message", resp.Message,
@@ -54,7 +55,9 @@ func SendError(
 
 	component := pages.Error(resp)
 	// If the request is targeting a specific element that isn't the main page content, it should be displayed inline
-	if !rendering.GetRenderContext(r.Context()).Target.IsPageOrContentRefresh() {
+	// The target comes from the request itself, as errors may be sent before the render context is set up
+	target := rendering.RenderTarget{RefreshTarget: rendering.GetHTMXProperties(r).DetermineRefreshTarget()}
+	if !target.IsPageOrContentRefresh() {
 		component = common.ErrorInline(resp)
 	}
 
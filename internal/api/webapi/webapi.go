@@ -1,74 +1,137 @@
 package webapi
 
 import (
+	"context"
 	"fmt"
 	"github.com/a-h/templ"
 	"github.com/gorilla/mux"
 	commonutils "github.com/mcoot/crosswordgame-go/internal/api/utils"
 	"github.com/mcoot/crosswordgame-go/internal/api/webapi/rendering"
+	"github.com/mcoot/crosswordgame-go/internal/api/webapi/template/common"
 	gametemplates "github.com/mcoot/crosswordgame-go/internal/api/webapi/template/game"
 	"github.com/mcoot/crosswordgame-go/internal/api/webapi/template/pages"
 	"github.com/mcoot/crosswordgame-go/internal/api/webapi/utils"
+	"github.com/mcoot/crosswordgame-go/internal/apitoken"
 	"github.com/mcoot/crosswordgame-go/internal/apitypes"
 	"github.com/mcoot/crosswordgame-go/internal/errors"
+	"github.com/mcoot/crosswordgame-go/internal/events"
 	"github.com/mcoot/crosswordgame-go/internal/game"
 	gametypes "github.com/mcoot/crosswordgame-go/internal/game/types"
 	"github.com/mcoot/crosswordgame-go/internal/lobby"
 	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
 	"github.com/mcoot/crosswordgame-go/internal/logging"
+	"github.com/mcoot/crosswordgame-go/internal/metrics"
 	"github.com/mcoot/crosswordgame-go/internal/player"
 	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"github.com/mcoot/crosswordgame-go/internal/presence"
+	"github.com/mcoot/crosswordgame-go/internal/ratelimit"
+	"github.com/mcoot/crosswordgame-go/internal/sso"
+	"github.com/mcoot/crosswordgame-go/internal/store"
 	"golang.org/x/tools/godoc/redirect"
 	"net/http"
+	"slices"
 	"strconv"
 )
 
 type CrosswordGameWebAPI struct {
 	sessionManager *commonutils.SessionManager
-	gameManager    *game.Manager
-	lobbyManager   *lobby.Manager
-	playerManager  *player.Manager
-	sseServer      *sseServer
+	// transactions runs flows against a single store transaction, publishing their events once it commits
+	transactions *commonutils.Transactions
+	// fanoutBus carries the events of every replica, so pages are updated whichever replica serves them
+	fanoutBus     *events.EventBus
+	gameManager   *game.Manager
+	lobbyManager  *lobby.Manager
+	playerManager *player.Manager
+	// tokenManager authenticates the API tokens that clients other than browsers connect to WebSockets with
+	tokenManager *apitoken.Manager
+	presence     *presence.Tracker
+	// ssoProvider signs players in with an OIDC provider, and is nil if that is disabled
+	ssoProvider *sso.Provider
+	rateLimits  *ratelimit.Guard
+	sseServer   *sseServer
+	// closing is closed once the server starts shutting down, ending WebSockets
+	closing <-chan struct{}
 }
 
 func NewCrosswordGameWebAPI(
 	sessionManager *commonutils.SessionManager,
+	transactor store.Transactor,
+	eventBus *events.EventBus,
+	fanoutBus *events.EventBus,
 	gameManager *game.Manager,
 	lobbyManager *lobby.Manager,
 	playerManager *player.Manager,
+	tokenManager *apitoken.Manager,
+	presenceTracker *presence.Tracker,
+	ssoProvider *sso.Provider,
+	rateLimits *ratelimit.Guard,
+	appMetrics *metrics.Metrics,
 ) *CrosswordGameWebAPI {
 	return &CrosswordGameWebAPI{
 		sessionManager: sessionManager,
+		transactions:   commonutils.NewTransactions(transactor, eventBus, gameManager, lobbyManager, playerManager),
+		fanoutBus:      fanoutBus,
 		gameManager:    gameManager,
 		lobbyManager:   lobbyManager,
 		playerManager:  playerManager,
-		sseServer:      newSSEServer(),
+		tokenManager:   tokenManager,
+		presence:       presenceTracker,
+		ssoProvider:    ssoProvider,
+		rateLimits:     rateLimits,
+		sseServer:      newSSEServer(presenceTracker, appMetrics.SSEConnections()),
 	}
 }
 
-func (c *CrosswordGameWebAPI) AttachToRouter(router *mux.Router) error {
+// AttachToRouter serves the web UI on the router, pushing updates to open pages until ctx is done
+func (c *CrosswordGameWebAPI) AttachToRouter(ctx context.Context, router *mux.Router) error {
+	c.closing = ctx.Done()
+
 	router.NotFoundHandler = router.NewRoute().BuildOnly().Handler(NotFoundHandler()).GetHandler()
 
 	router.Use(c.sessionContextMiddleware)
 	router.Use(renderContextMiddleware)
 
-	router.Handle("/", redirect.Handler("/index")).Methods("GET")
-	router.Handle("/index.html", redirect.Handler("/index")).Methods("GET")
-	router.HandleFunc("/index", c.Index).Methods("GET")
-	router.HandleFunc("/about", c.About).Methods("GET")
-	router.HandleFunc("/login", c.Login).Methods("POST")
-	router.HandleFunc("/logout", c.Logout).Methods("POST")
-	router.HandleFunc("/host", c.StartLobbyAsHost).Methods("POST")
-	router.HandleFunc("/join", c.JoinLobby).Methods("POST")
-
-	router.HandleFunc("/lobby/{lobbyId}", c.LobbyPage).Methods("GET")
-	router.HandleFunc("/lobby/{lobbyId}/leave", c.LeaveLobby).Methods("POST")
-	router.HandleFunc("/lobby/{lobbyId}/start", c.StartNewGame).Methods("POST")
-	router.HandleFunc("/lobby/{lobbyId}/abandon", c.AbandonGame).Methods("POST")
-	router.HandleFunc("/lobby/{lobbyId}/announce", c.AnnounceLetter).Methods("POST")
-	router.HandleFunc("/lobby/{lobbyId}/place", c.PlaceLetter).Methods("POST")
-
-	c.sseServer.Start()
+	// Pages issue the session a CSRF token, which every form post must then carry
+	pages := router.Methods("GET").Subrouter()
+	pages.Use(c.issueCSRFTokenMiddleware)
+	forms := router.Methods("POST").Subrouter()
+	forms.Use(c.checkCSRFTokenMiddleware)
+
+	pages.Handle("/", redirect.Handler("/index"))
+	pages.Handle("/index.html", redirect.Handler("/index"))
+	pages.HandleFunc("/index", c.Index)
+	pages.HandleFunc("/about", c.About)
+	forms.Handle("/login", c.limitPerIP(ratelimit.ActionLogin, c.Login))
+	forms.HandleFunc("/logout", c.Logout)
+	pages.HandleFunc("/account", c.AccountPage)
+	forms.Handle("/account/signup", c.limitPerIP(ratelimit.ActionLogin, c.Signup))
+	forms.Handle("/account/login", c.limitPerIP(ratelimit.ActionLogin, c.AccountLogin))
+	forms.HandleFunc("/account/password", c.ChangePassword)
+	forms.HandleFunc("/account/logout-everywhere", c.LogoutEverywhere)
+	forms.Handle("/account/upgrade", c.limitPerIP(ratelimit.ActionLogin, c.UpgradeAccount))
+	if c.ssoProvider != nil {
+		pages.HandleFunc("/login/oidc", c.OIDCLogin)
+		pages.Handle("/login/oidc/callback", c.limitPerIP(ratelimit.ActionLogin, c.OIDCCallback))
+	}
+	forms.Handle("/host", c.limitPerPlayer(ratelimit.ActionCreateLobby, c.StartLobbyAsHost))
+	forms.Handle("/join", c.limitPerIP(ratelimit.ActionJoinLobby, c.JoinLobby))
+
+	pages.HandleFunc("/lobby/{lobbyId}", c.LobbyPage)
+	forms.HandleFunc("/lobby/{lobbyId}/leave", c.LeaveLobby)
+	forms.Handle("/lobby/{lobbyId}/start", c.limitPerPlayer(ratelimit.ActionCreateGame, c.StartNewGame))
+	forms.HandleFunc("/lobby/{lobbyId}/abandon", c.AbandonGame)
+	forms.HandleFunc("/lobby/{lobbyId}/kick", c.KickPlayer)
+	forms.HandleFunc("/lobby/{lobbyId}/host", c.TransferHost)
+	forms.HandleFunc("/lobby/{lobbyId}/lock", c.SetLobbyLocked)
+	pages.HandleFunc("/lobby/{lobbyId}/settings", c.LobbySettingsPage)
+	forms.HandleFunc("/lobby/{lobbyId}/settings", c.UpdateLobbySettings)
+	forms.Handle("/lobby/{lobbyId}/announce", c.limitPerPlayer(ratelimit.ActionMove, c.AnnounceLetter))
+	forms.Handle("/lobby/{lobbyId}/place", c.limitPerPlayer(ratelimit.ActionMove, c.PlaceLetter))
+	router.HandleFunc("/lobby/{lobbyId}/ws", c.HandleWebSocket).Methods("GET")
+
+	c.sseServer.Start(ctx)
+	go events.NewEventConsumer(c.fanoutBus, refreshEventKinds...).
+		Run(ctx, c.refreshOnDomainEvent)
 	router.HandleFunc("/lobby/{lobbyId}/sse/refresh", c.sseServer.HandleRequest).
 		Methods("GET")
 
@@ -76,16 +139,25 @@ func (c *CrosswordGameWebAPI) AttachToRouter(router *mux.Router) error {
 }
 
 func (c *CrosswordGameWebAPI) Index(w http.ResponseWriter, r *http.Request) {
-	lobbyToJoin := lobbytypes.LobbyId(r.URL.Query().Get("join_lobby"))
-	if lobbyToJoin != "" {
-		_, err := c.lobbyManager.GetLobbyState(lobbyToJoin)
-		if err != nil {
-			utils.SendError(r, w, err)
-			return
-		}
+	lobbyToJoin, err := c.parseLobbyToJoin(r)
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	publicLobbies, err := c.lobbyManager.ListPublicLobbies()
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	joinRefusal, err := c.sessionManager.TakeJoinRefusal(w, r)
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
 	}
 
-	indexComponent := pages.Index(lobbyToJoin)
+	indexComponent := pages.Index(lobbyToJoin, joinRefusal, c.ssoProviderName(), publicLobbies)
 	utils.PushUrl(w, "/index")
 	utils.SendResponse(r, w, indexComponent, 200)
 }
@@ -95,31 +167,9 @@ func (c *CrosswordGameWebAPI) About(w http.ResponseWriter, r *http.Request) {
 	utils.SendResponse(r, w, pages.About(), 200)
 }
 
+// Login logs in as a new ephemeral player, who only lasts as long as their session
 func (c *CrosswordGameWebAPI) Login(w http.ResponseWriter, r *http.Request) {
-	logger := logging.GetLogger(r.Context())
-	session, err := commonutils.GetSessionFromContext(r.Context())
-	if err != nil {
-		utils.SendError(r, w, err)
-		return
-	}
-	if session.IsLoggedIn() {
-		utils.SendError(r, w, &errors.InvalidActionError{
-			Action: "login",
-			Reason: "already logged in",
-		})
-		return
-	}
-
-	lobbyToJoin := lobbytypes.LobbyId(r.URL.Query().Get("join_lobby"))
-	if lobbyToJoin != "" {
-		_, err := c.lobbyManager.GetLobbyState(lobbyToJoin)
-		if err != nil {
-			utils.SendError(r, w, err)
-			return
-		}
-	}
-
-	err = r.ParseForm()
+	lobbyToJoin, err := c.parseLoginRequest(r, "login")
 	if err != nil {
 		utils.SendError(r, w, err)
 		return
@@ -131,33 +181,24 @@ func (c *CrosswordGameWebAPI) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	playerId, err := c.playerManager.LoginAsEphemeral(displayName)
-	if err != nil {
-		utils.SendError(r, w, err)
-		return
-	}
-
-	err = c.sessionManager.SaveLoggedInPlayer(w, r, playerId)
-	if err != nil {
-		utils.SendError(r, w, err)
-		return
-	}
-
-	logger.Infow("player logged in", "player_id", playerId, "display_name", displayName)
-
-	if lobbyToJoin != "" {
-		err = c.lobbyManager.JoinPlayerToLobby(lobbyToJoin, playerId)
+	var playerId playertypes.PlayerId
+	var invite inviteOutcome
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		var err error
+		playerId, err = pm.LoginAsEphemeral(displayName)
 		if err != nil {
-			utils.SendError(r, w, err)
-			return
+			return err
 		}
-		logger.Infow("player joined lobby", "lobby_id", lobbyToJoin, "player", playerId)
-		c.sseServer.SendRefresh(lobbyToJoin, playerId)
-		utils.Redirect(w, r, fmt.Sprintf("/lobby/%s", lobbyToJoin), 303)
+		invite, err = joinInvitedLobby(lm, pm, playerId, lobbyToJoin, r.PostForm.Get("lobby_password"))
+		return err
+	})
+	if err != nil {
+		utils.SendError(r, w, err)
 		return
 	}
 
-	utils.Redirect(w, r, "/index", 303)
+	logging.GetLogger(r.Context()).Infow("player logged in", "player_id", playerId, "display_name", displayName)
+	c.completeLogin(w, r, playerId, invite)
 }
 
 func (c *CrosswordGameWebAPI) Logout(w http.ResponseWriter, r *http.Request) {
@@ -182,13 +223,13 @@ func (c *CrosswordGameWebAPI) Logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	logger.Infow("player logged out", "player_id", session.Player.Username)
+	// The logger is already tagged with the player
+	logger.Infow("player logged out")
 
 	utils.Redirect(w, r, "/index", 303)
 }
 
 func (c *CrosswordGameWebAPI) StartLobbyAsHost(w http.ResponseWriter, r *http.Request) {
-	logger := logging.GetLogger(r.Context())
 	session, err := getLoggedInSession(r)
 	if err != nil {
 		utils.SendError(r, w, err)
@@ -215,31 +256,25 @@ func (c *CrosswordGameWebAPI) StartLobbyAsHost(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	lobbyId, err := c.lobbyManager.CreateLobby(lobbyName)
-	if err != nil {
-		utils.SendError(r, w, err)
-		return
-	}
-
-	err = c.lobbyManager.JoinPlayerToLobby(lobbyId, session.Player.Username)
+	var lobbyId lobbytypes.LobbyId
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		var err error
+		lobbyId, err = lm.CreateLobby(lobbyName, session.Player.Username)
+		if err != nil {
+			return err
+		}
+		// If the host can't join, the lobby is never committed
+		return lm.JoinPlayerToLobby(lobbyId, session.Player.Username, "")
+	})
 	if err != nil {
-		// TODO: Scrap the lobby?
 		utils.SendError(r, w, err)
 		return
 	}
 
-	logger.Infow(
-		"lobby started",
-		"lobby_id", lobbyId,
-		"lobby_name", lobbyName,
-		"hosting_player", session.Player.Username,
-	)
-
 	utils.Redirect(w, r, fmt.Sprintf("/lobby/%s", lobbyId), 303)
 }
 
 func (c *CrosswordGameWebAPI) JoinLobby(w http.ResponseWriter, r *http.Request) {
-	logger := logging.GetLogger(r.Context())
 	session, err := getLoggedInSession(r)
 	if err != nil {
 		utils.SendError(r, w, err)
@@ -268,54 +303,51 @@ func (c *CrosswordGameWebAPI) JoinLobby(w http.ResponseWriter, r *http.Request)
 
 	lobbyId := lobbytypes.LobbyId(rawLobbyId)
 
-	err = c.lobbyManager.JoinPlayerToLobby(lobbyId, session.Player.Username)
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		return lm.JoinPlayerToLobby(lobbyId, session.Player.Username, r.PostForm.Get("lobby_password"))
+	})
 	if err != nil {
 		utils.SendError(r, w, err)
 		return
 	}
 
-	logger.Infow("player joined lobby", "lobby_id", lobbyId, "player", session.Player.Username)
-
-	c.sseServer.SendRefresh(lobbyId, session.Player.Username)
 	utils.Redirect(w, r, fmt.Sprintf("/lobby/%s", lobbyId), 303)
 }
 
 func (c *CrosswordGameWebAPI) LeaveLobby(w http.ResponseWriter, r *http.Request) {
-	logger := logging.GetLogger(r.Context())
 	session, err := getLoggedInSessionInLobby(r)
 	if err != nil {
 		utils.SendError(r, w, err)
 		return
 	}
 
-	err = c.lobbyManager.RemovePlayerFromLobby(session.Lobby.Id, session.Player.Username)
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		return lm.RemovePlayerFromLobby(session.Lobby.Id, session.Player.Username)
+	})
 	if err != nil {
 		utils.SendError(r, w, err)
 		return
 	}
 
-	logger.Infow("player left lobby", "lobby_id", session.Lobby.Id, "player", session.Player.Username)
-
-	c.sseServer.SendRefresh(session.Lobby.Id, session.Player.Username)
 	utils.Redirect(w, r, "/index", 303)
 }
 
 func (c *CrosswordGameWebAPI) LobbyPage(w http.ResponseWriter, r *http.Request) {
-	session, err := getLoggedInSessionInLobby(r)
+	session, err := getLoggedInSession(r)
 	if err != nil {
 		utils.SendError(r, w, err)
 		return
 	}
+	if !session.IsInLobby() {
+		// The player may have been kicked while they had the page open
+		utils.Redirect(w, r, "/index", 303)
+		return
+	}
 
-	lobbyPlayers := make([]*playertypes.Player, len(session.Lobby.Players))
-	for i, playerId := range session.Lobby.Players {
-		p, err := c.playerManager.LookupPlayer(playerId)
-		if err != nil {
-			utils.SendError(r, w, err)
-			return
-		}
-
-		lobbyPlayers[i] = p
+	lobbyPlayers, err := c.lookupLobbyPlayers(session.Lobby)
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
 	}
 
 	var gameComponent templ.Component
@@ -327,25 +359,85 @@ func (c *CrosswordGameWebAPI) LobbyPage(w http.ResponseWriter, r *http.Request)
 			return
 		}
 	} else {
-		gameComponent = pages.GameStartForm(session.Lobby.Id)
+		gameComponent = pages.GameStartForm(session.Lobby, session.Player)
 	}
 
-	component := pages.Lobby(session.Lobby, lobbyPlayers, session.Player, gameComponent)
+	presences := c.presence.GetAll(session.Lobby.Id, session.Lobby.Players)
+	component := pages.Lobby(session.Lobby, lobbyPlayers, session.Player, presences, gameComponent)
 	utils.PushUrl(w, fmt.Sprintf("/lobby/%s", session.Lobby.Id))
 	utils.SendResponse(r, w, component, 200)
 }
 
+func (c *CrosswordGameWebAPI) lookupLobbyPlayers(lobbyState *lobbytypes.Lobby) ([]*playertypes.Player, error) {
+	lobbyPlayers := make([]*playertypes.Player, len(lobbyState.Players))
+	for i, playerId := range lobbyState.Players {
+		p, err := c.playerManager.LookupPlayer(playerId)
+		if err != nil {
+			return nil, err
+		}
+
+		lobbyPlayers[i] = p
+	}
+	return lobbyPlayers, nil
+}
+
+// lobbyGameView is the running game's part of the lobby page, as seen by one player
+type lobbyGameView struct {
+	gameState   *gametypes.Game
+	gamePlayers []*playertypes.Player
+	// status and playArea are the fragments of the view which are updated in place as the game goes on
+	status   templ.Component
+	playArea templ.Component
+}
+
 func (c *CrosswordGameWebAPI) buildLobbyGameComponent(
 	player *playertypes.Player,
 	lobbyState *lobbytypes.Lobby,
 ) (templ.Component, error) {
+	view, err := c.buildLobbyGameView(player, lobbyState)
+	if err != nil {
+		return nil, err
+	}
+
+	isGameFinished := view.gameState.Status == gametypes.StatusFinished
+
+	var components []templ.Component
+	components = append(components, common.Fragment(rendering.FragmentGamePlayArea, view.playArea))
+	if isGameFinished {
+		components = append(
+			components,
+			gametemplates.GameScores(view.gamePlayers, player, view.gameState.PlayerScores),
+			pages.GameStartForm(lobbyState, player),
+		)
+	}
+	components = append(components, pages.GameAbandonForm(lobbyState, player, isGameFinished))
+
+	return gametemplates.GameView(
+		view.gameState,
+		view.gamePlayers,
+		player,
+		view.status,
+		templ.Join(components...),
+	), nil
+}
+
+func (c *CrosswordGameWebAPI) buildLobbyGameView(
+	player *playertypes.Player,
+	lobbyState *lobbytypes.Lobby,
+) (*lobbyGameView, error) {
 	gameState, err := c.gameManager.GetGameState(lobbyState.RunningGame.GameId)
 	if err != nil {
 		return nil, err
 	}
 
+	waitingOnIds, err := gameState.WaitingOnPlayers()
+	if err != nil {
+		return nil, err
+	}
+
 	gamePlayers := make([]*playertypes.Player, len(gameState.Players))
 	var currentAnnouncingPlayer *playertypes.Player
+	var waitingOnPlayers []*playertypes.Player
 	for i, playerId := range gameState.Players {
 		p, err := c.playerManager.LookupPlayer(playerId)
 		if err != nil {
@@ -356,6 +448,9 @@ func (c *CrosswordGameWebAPI) buildLobbyGameComponent(
 		if playerId == gameState.CurrentAnnouncingPlayer {
 			currentAnnouncingPlayer = p
 		}
+		if slices.Contains(waitingOnIds, playerId) {
+			waitingOnPlayers = append(waitingOnPlayers, p)
+		}
 	}
 
 	isPlayerInGame := false
@@ -368,7 +463,15 @@ func (c *CrosswordGameWebAPI) buildLobbyGameComponent(
 
 	isGameFinished := gameState.Status == gametypes.StatusFinished
 
-	gameStatusComponent := gametemplates.GameStatus(gameState, gamePlayers, currentAnnouncingPlayer, player, isPlayerInGame)
+	gameStatusComponent := gametemplates.GameStatus(
+		gameState,
+		gamePlayers,
+		currentAnnouncingPlayer,
+		player,
+		isPlayerInGame,
+		waitingOnPlayers,
+		c.presence.GetAll(lobbyState.Id, waitingOnIds),
+	)
 
 	var ingameComponent templ.Component
 	if isPlayerInGame && !isGameFinished {
@@ -383,18 +486,12 @@ func (c *CrosswordGameWebAPI) buildLobbyGameComponent(
 		}
 	}
 
-	var components []templ.Component
-	components = append(components, ingameComponent)
-	if isGameFinished {
-		components = append(
-			components,
-			gametemplates.GameScores(gamePlayers, player, gameState.PlayerScores),
-			pages.GameStartForm(lobbyState.Id),
-		)
-	}
-	components = append(components, pages.GameAbandonForm(lobbyState.Id, isGameFinished))
-
-	return gametemplates.GameView(gameState, gamePlayers, player, gameStatusComponent, templ.Join(components...)), nil
+	return &lobbyGameView{
+		gameState:   gameState,
+		gamePlayers: gamePlayers,
+		status:      gameStatusComponent,
+		playArea:    ingameComponent,
+	}, nil
 }
 
 func (c *CrosswordGameWebAPI) buildLobbyGamePlayerComponent(
@@ -452,101 +549,194 @@ func (c *CrosswordGameWebAPI) buildLobbyGameSpectatorComponent(
 }
 
 func (c *CrosswordGameWebAPI) StartNewGame(w http.ResponseWriter, r *http.Request) {
-	logger := logging.GetLogger(r.Context())
 	session, err := getLoggedInSessionInLobby(r)
 	if err != nil {
 		utils.SendError(r, w, err)
 		return
 	}
 
-	if session.Lobby.HasRunningGame() {
-		err = c.lobbyManager.DetachGameFromLobby(session.Lobby.Id)
+	err = r.ParseForm()
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	// Without a board size, the game is played on the lobby's default one
+	boardSize := 0
+	if boardSizeRaw := r.PostForm.Get("board_size"); boardSizeRaw != "" {
+		boardSize, err = strconv.Atoi(boardSizeRaw)
 		if err != nil {
-			if errors.IsNotFoundError(err) {
-				// The game was already detached, so we can just continue
-			} else {
-				utils.SendError(r, w, err)
-				return
+			utils.SendError(r, w, fmt.Errorf("board_size must be a number"))
+			return
+		}
+
+		err = lobbytypes.ValidateBoardSize(boardSize)
+		if err != nil {
+			utils.SendError(r, w, err)
+			return
+		}
+	}
+
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		err := lm.CheckHost(session.Lobby.Id, session.Player.Username)
+		if err != nil {
+			return err
+		}
+
+		// Re-read the lobby within the transaction, so we act on its latest players and game
+		lobbyState, err := lm.GetLobbyState(session.Lobby.Id)
+		if err != nil {
+			return err
+		}
+
+		if lobbyState.HasRunningGame() {
+			err = lm.DetachGameFromLobby(lobbyState.Id)
+			if err != nil {
+				return err
 			}
 		}
+
+		if boardSize == 0 {
+			boardSize = lobbyState.Settings.WithDefaults().GameDefaults.BoardSize
+		}
+		gameId, err := gm.CreateGame(lobbyState.Players, boardSize)
+		if err != nil {
+			return err
+		}
+
+		return lm.AttachGameToLobby(lobbyState.Id, gameId)
+	})
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
 	}
 
-	err = r.ParseForm()
+	utils.Redirect(w, r, fmt.Sprintf("/lobby/%s", session.Lobby.Id), 303)
+}
+
+func (c *CrosswordGameWebAPI) AbandonGame(w http.ResponseWriter, r *http.Request) {
+	session, err := getLoggedInSessionInLobby(r)
 	if err != nil {
 		utils.SendError(r, w, err)
 		return
 	}
 
-	boardSizeRaw := r.PostForm.Get("board_size")
-	if boardSizeRaw == "" {
-		utils.SendError(r, w, fmt.Errorf("announced_letter is required"))
+	if !session.Lobby.HasRunningGame() {
+		utils.SendError(r, w, &errors.InvalidActionError{
+			Action: "abandon_game",
+			Reason: "the lobby has no running game",
+		})
+		return
+	}
+
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		err := lm.CheckHost(session.Lobby.Id, session.Player.Username)
+		if err != nil {
+			return err
+		}
+		return lm.DetachGameFromLobby(session.Lobby.Id)
+	})
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	utils.Redirect(w, r, fmt.Sprintf("/lobby/%s", session.Lobby.Id), 303)
+}
+
+func (c *CrosswordGameWebAPI) KickPlayer(w http.ResponseWriter, r *http.Request) {
+	session, err := getLoggedInSessionInLobby(r)
+	if err != nil {
+		utils.SendError(r, w, err)
 		return
 	}
 
-	boardSize, err := strconv.Atoi(boardSizeRaw)
+	playerId, err := parsePlayerIdForm(r)
 	if err != nil {
 		utils.SendError(r, w, err)
 		return
 	}
 
-	if boardSize < 2 || boardSize > 10 {
-		utils.SendError(r, w, fmt.Errorf("board_size must be between 2 and 10"))
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		return lm.KickPlayer(session.Lobby.Id, session.Player.Username, playerId)
+	})
+	if err != nil {
+		utils.SendError(r, w, err)
 		return
 	}
 
-	gameId, err := c.gameManager.CreateGame(session.Lobby.Players, boardSize)
+	utils.Redirect(w, r, fmt.Sprintf("/lobby/%s", session.Lobby.Id), 303)
+}
+
+func (c *CrosswordGameWebAPI) TransferHost(w http.ResponseWriter, r *http.Request) {
+	session, err := getLoggedInSessionInLobby(r)
 	if err != nil {
 		utils.SendError(r, w, err)
 		return
 	}
 
-	err = c.lobbyManager.AttachGameToLobby(session.Lobby.Id, gameId)
+	playerId, err := parsePlayerIdForm(r)
 	if err != nil {
 		utils.SendError(r, w, err)
 		return
 	}
 
-	logger.Infow(
-		"game started",
-		"game_id", gameId,
-		"lobby_id", session.Lobby.Id,
-		"board_size", boardSize,
-	)
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		return lm.TransferHost(session.Lobby.Id, session.Player.Username, playerId)
+	})
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
 
-	c.sseServer.SendRefresh(session.Lobby.Id, session.Player.Username)
 	utils.Redirect(w, r, fmt.Sprintf("/lobby/%s", session.Lobby.Id), 303)
 }
 
-func (c *CrosswordGameWebAPI) AbandonGame(w http.ResponseWriter, r *http.Request) {
-	logger := logging.GetLogger(r.Context())
+func (c *CrosswordGameWebAPI) SetLobbyLocked(w http.ResponseWriter, r *http.Request) {
 	session, err := getLoggedInSessionInLobby(r)
 	if err != nil {
 		utils.SendError(r, w, err)
 		return
 	}
 
-	if !session.Lobby.HasRunningGame() {
-		utils.SendError(r, w, &errors.InvalidActionError{
-			Action: "abandon_game",
-			Reason: "the lobby has no running game",
-		})
+	err = r.ParseForm()
+	if err != nil {
+		utils.SendError(r, w, err)
 		return
 	}
 
-	err = c.lobbyManager.DetachGameFromLobby(session.Lobby.Id)
+	locked, err := strconv.ParseBool(r.PostForm.Get("locked"))
 	if err != nil {
-		utils.SendError(r, w, err)
+		utils.SendError(r, w, fmt.Errorf("locked must be true or false"))
 		return
 	}
 
-	logger.Infow("game cleared from lobby", "lobby_id", session.Lobby.Id)
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		return lm.SetLocked(session.Lobby.Id, session.Player.Username, locked)
+	})
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
 
-	c.sseServer.SendRefresh(session.Lobby.Id, session.Player.Username)
 	utils.Redirect(w, r, fmt.Sprintf("/lobby/%s", session.Lobby.Id), 303)
 }
 
+// parsePlayerIdForm reads the player a host is acting on from a posted form
+func parsePlayerIdForm(r *http.Request) (playertypes.PlayerId, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return "", err
+	}
+
+	playerId := r.PostForm.Get("player_id")
+	if playerId == "" {
+		return "", fmt.Errorf("player_id is required")
+	}
+	return playertypes.PlayerId(playerId), nil
+}
+
 func (c *CrosswordGameWebAPI) AnnounceLetter(w http.ResponseWriter, r *http.Request) {
-	logger := logging.GetLogger(r.Context())
 	session, err := getLoggedInSessionInLobby(r)
 	if err != nil {
 		utils.SendError(r, w, err)
@@ -573,25 +763,18 @@ func (c *CrosswordGameWebAPI) AnnounceLetter(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err = c.gameManager.SubmitAnnouncement(session.Lobby.RunningGame.GameId, session.Player.Username, letter)
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		return gm.SubmitAnnouncement(session.Lobby.RunningGame.GameId, session.Player.Username, letter)
+	})
 	if err != nil {
 		utils.SendError(r, w, err)
 		return
 	}
 
-	logger.Infow(
-		"letter announced",
-		"lobby_id", session.Lobby.Id,
-		"player", session.Player.Username,
-		"letter", letter,
-	)
-
-	c.sseServer.SendRefresh(session.Lobby.Id, session.Player.Username)
 	utils.Redirect(w, r, fmt.Sprintf("/lobby/%s", session.Lobby.Id), 303)
 }
 
 func (c *CrosswordGameWebAPI) PlaceLetter(w http.ResponseWriter, r *http.Request) {
-	logger := logging.GetLogger(r.Context())
 	session, err := getLoggedInSessionInLobby(r)
 	if err != nil {
 		utils.SendError(r, w, err)
@@ -634,21 +817,14 @@ func (c *CrosswordGameWebAPI) PlaceLetter(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = c.gameManager.SubmitPlacement(session.Lobby.RunningGame.GameId, session.Player.Username, row, column)
+	err = c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+		return gm.SubmitPlacement(session.Lobby.RunningGame.GameId, session.Player.Username, row, column)
+	})
 	if err != nil {
 		utils.SendError(r, w, err)
 		return
 	}
 
-	logger.Infow(
-		"letter placed",
-		"lobby_id", session.Lobby.Id,
-		"player", session.Player.Username,
-		"row", row,
-		"column", column,
-	)
-
-	c.sseServer.SendRefresh(session.Lobby.Id, session.Player.Username)
 	utils.Redirect(w, r, fmt.Sprintf("/lobby/%s", session.Lobby.Id), 303)
 }
 
@@ -703,12 +879,32 @@ func (c *CrosswordGameWebAPI) sessionContextMiddleware(next http.Handler) http.H
 			utils.SendError(r, w, err)
 			return
 		}
+		err = c.sessionManager.Touch(w, r, session)
+		if err != nil {
+			utils.SendError(r, w, err)
+			return
+		}
 
-		ctx := commonutils.AddSessionToContext(r.Context(), session)
+		ctx := r.Context()
+		if session.IsLoggedIn() {
+			ctx = withSessionLogFields(ctx, "player_id", session.Player.Username)
+		}
+		if session.IsLoggedIn() && session.IsInLobby() {
+			c.presence.Seen(session.Lobby.Id, session.Player.Username)
+			ctx = withSessionLogFields(ctx, "lobby_id", session.Lobby.Id)
+		}
+
+		ctx = commonutils.AddSessionToContext(ctx, session)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// withSessionLogFields tags the request's access log line and logger with who made it
+func withSessionLogFields(ctx context.Context, keysAndValues ...any) context.Context {
+	logging.GetAccessLogFields(ctx).Add(keysAndValues...)
+	return logging.AddLoggerToContext(ctx, logging.GetLogger(ctx).With(keysAndValues...))
+}
+
 func renderContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		session, err := commonutils.GetSessionFromContext(r.Context())
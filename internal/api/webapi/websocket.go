@@ -0,0 +1,334 @@
+package webapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	commonutils "github.com/mcoot/crosswordgame-go/internal/api/utils"
+	"github.com/mcoot/crosswordgame-go/internal/api/webapi/utils"
+	apitokentypes "github.com/mcoot/crosswordgame-go/internal/apitoken/types"
+	"github.com/mcoot/crosswordgame-go/internal/apitypes"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	"github.com/mcoot/crosswordgame-go/internal/events/public"
+	"github.com/mcoot/crosswordgame-go/internal/game"
+	"github.com/mcoot/crosswordgame-go/internal/lobby"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	"github.com/mcoot/crosswordgame-go/internal/logging"
+	"github.com/mcoot/crosswordgame-go/internal/player"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"github.com/mcoot/crosswordgame-go/internal/ratelimit"
+	"go.uber.org/zap"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	wsWriteTimeout   = 10 * time.Second
+	wsPongTimeout    = 60 * time.Second
+	wsPingInterval   = 50 * time.Second
+	wsMaxMessageSize = 4096
+)
+
+// The upgrader's default origin check only accepts same-host requests, as the session cookie authenticates the player
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// wsConnection is a player's WebSocket connection to their lobby
+type wsConnection struct {
+	conn     *websocket.Conn
+	logger   *zap.SugaredLogger
+	lobbyId  lobbytypes.LobbyId
+	playerId playertypes.PlayerId
+	outgoing chan apitypes.WebSocketMessage
+	// readerDone and writerDone are closed as the reading and writing halves of the connection stop
+	readerDone chan struct{}
+	writerDone chan struct{}
+}
+
+// HandleWebSocket lets a player announce and place over a WebSocket, using the messages in schema/websocket.yaml
+// The player receives an ack or error for each command, and the events of their lobby and its running game as they happen
+func (c *CrosswordGameWebAPI) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	logger := logging.GetLogger(r.Context())
+	lobbyId := commonutils.GetLobbyIdPathParam(r)
+	playerId, err := c.webSocketPlayer(r, lobbyId)
+	if err != nil {
+		utils.SendError(r, w, err)
+		return
+	}
+
+	// Subscribe before upgrading, so the player sees every event from the moment they connect
+	sub := c.fanoutBus.Subscribe(events.AnyKind)
+	defer c.fanoutBus.Unsubscribe(sub)
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already responded with the error
+		logger.Warnw("error upgrading to websocket", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	ws := &wsConnection{
+		conn:       conn,
+		logger:     logger,
+		lobbyId:    lobbyId,
+		playerId:   playerId,
+		outgoing:   make(chan apitypes.WebSocketMessage, 16),
+		readerDone: make(chan struct{}),
+		writerDone: make(chan struct{}),
+	}
+
+	c.presence.Connected(lobbyId, ws.playerId)
+	defer c.presence.Disconnected(lobbyId, ws.playerId)
+
+	go c.writeWebSocket(ws, sub)
+	c.readWebSocket(ws)
+	close(ws.readerDone)
+	<-ws.writerDone
+}
+
+// webSocketPlayer is who is connecting to the lobby, from an API token with the play scope if one is sent,
+// otherwise from the session cookie
+func (c *CrosswordGameWebAPI) webSocketPlayer(r *http.Request, lobbyId lobbytypes.LobbyId) (playertypes.PlayerId, error) {
+	authorization := r.Header.Get("Authorization")
+	if authorization == "" {
+		session, err := getLoggedInSessionInLobby(r)
+		if err != nil {
+			return "", err
+		}
+		if session.Lobby.Id != lobbyId {
+			return "", &errors.ForbiddenError{Reason: "not in this lobby"}
+		}
+		return session.Player.Username, nil
+	}
+
+	bearerToken, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok {
+		return "", &errors.UnauthorizedError{Reason: "the Authorization header must be a bearer token"}
+	}
+	token, err := c.tokenManager.Authenticate(bearerToken)
+	if err != nil {
+		return "", err
+	}
+	if !token.HasScope(apitokentypes.ScopePlay) {
+		return "", &errors.ForbiddenError{Reason: fmt.Sprintf("the API token does not have the %q scope", apitokentypes.ScopePlay)}
+	}
+	lobbyState, err := c.lobbyManager.GetLobbyState(lobbyId)
+	if err != nil {
+		return "", err
+	}
+	if !slices.Contains(lobbyState.Players, token.PlayerId) {
+		return "", &errors.ForbiddenError{Reason: "not in this lobby"}
+	}
+	return token.PlayerId, nil
+}
+
+// readWebSocket handles commands from the player until the connection closes
+func (c *CrosswordGameWebAPI) readWebSocket(ws *wsConnection) {
+	ws.conn.SetReadLimit(wsMaxMessageSize)
+	_ = ws.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	ws.conn.SetPongHandler(func(string) error {
+		return ws.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	for {
+		_, data, err := ws.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				ws.logger.Warnw("websocket closed unexpectedly", "error", err)
+			}
+			return
+		}
+
+		c.presence.Seen(ws.lobbyId, ws.playerId)
+
+		var cmd apitypes.WebSocketCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			ws.send(errorMessage("", &errors.InvalidInputError{ErrMessage: "malformed command: " + err.Error()}))
+			continue
+		}
+
+		if err := c.runWebSocketCommand(ws, cmd); err != nil {
+			ws.send(errorMessage(cmd.Id, err))
+			continue
+		}
+		ws.send(apitypes.WebSocketMessage{
+			Version: apitypes.WebSocketProtocolVersion,
+			Type:    apitypes.WebSocketMessageAck,
+			Id:      cmd.Id,
+		})
+	}
+}
+
+// runWebSocketCommand submits the command to the game the lobby is running at the time
+func (c *CrosswordGameWebAPI) runWebSocketCommand(ws *wsConnection, cmd apitypes.WebSocketCommand) error {
+	if cmd.Version != apitypes.WebSocketProtocolVersion {
+		return apitypes.ErrorResponse{
+			HTTPCode: 400,
+			Kind:     "unsupported_version",
+			Message:  "only protocol version 1 is supported",
+		}
+	}
+	// Every command is a move, so they share the player's limit with the web UI's moves
+	ctx := logging.AddLoggerToContext(context.Background(), ws.logger)
+	err := c.rateLimits.Allow(ctx, ratelimit.ActionMove, ratelimit.PlayerKey(ws.playerId))
+	if err != nil {
+		return err
+	}
+
+	// The lobby may have changed since the connection opened, so re-read it for every command
+	lobbyState, err := c.lobbyManager.GetLobbyState(ws.lobbyId)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(lobbyState.Players, ws.playerId) {
+		return &errors.InvalidActionError{
+			Action: string(cmd.Type),
+			Reason: "no longer in the lobby",
+		}
+	}
+	if !lobbyState.HasRunningGame() {
+		return &errors.InvalidActionError{
+			Action: string(cmd.Type),
+			Reason: "the lobby has no running game",
+		}
+	}
+	gameId := lobbyState.RunningGame.GameId
+
+	switch cmd.Type {
+	case apitypes.WebSocketCommandAnnounce:
+		if cmd.Letter == "" {
+			return &errors.InvalidInputError{ErrMessage: "letter is required"}
+		}
+		return c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+			return gm.SubmitAnnouncement(gameId, ws.playerId, cmd.Letter)
+		})
+	case apitypes.WebSocketCommandPlace:
+		if cmd.Row == nil || cmd.Column == nil {
+			return &errors.InvalidInputError{ErrMessage: "row and column are required"}
+		}
+		return c.transactions.Run(func(gm *game.Manager, lm *lobby.Manager, pm *player.Manager) error {
+			return gm.SubmitPlacement(gameId, ws.playerId, *cmd.Row, *cmd.Column)
+		})
+	default:
+		return &errors.InvalidInputError{ErrMessage: "unknown command type: " + string(cmd.Type)}
+	}
+}
+
+// writeWebSocket is the connection's only writer, sending command replies, lobby events and keepalive pings
+// until the connection ends or the server shuts down
+func (c *CrosswordGameWebAPI) writeWebSocket(ws *wsConnection, sub *events.Subscription) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	defer close(ws.writerDone)
+	// Once writing fails, closing the connection also stops the reader
+	defer ws.conn.Close()
+
+	for {
+		select {
+		case <-ws.readerDone:
+			return
+		case <-c.closing:
+			// The client should reconnect, and will reach another replica while this one shuts down
+			_ = ws.conn.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server shutting down"),
+				time.Now().Add(wsWriteTimeout),
+			)
+			return
+		case msg := <-ws.outgoing:
+			if err := ws.write(msg); err != nil {
+				return
+			}
+		case e, ok := <-sub.Events():
+			if !ok {
+				// The bus dropped this subscriber for falling behind; the client can reconnect
+				ws.logger.Warnw("websocket disconnected by event bus")
+				_ = ws.conn.WriteControl(
+					websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "fell behind on events"),
+					time.Now().Add(wsWriteTimeout),
+				)
+				return
+			}
+			msg, ok := c.toWebSocketEvent(ws, e)
+			if !ok {
+				continue
+			}
+			if err := ws.write(msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			_ = ws.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := ws.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// toWebSocketEvent converts an event for the player if it concerns their lobby or its running game
+// The player's own placements are sent in full, while everyone else's are redacted as on the event streams
+func (c *CrosswordGameWebAPI) toWebSocketEvent(ws *wsConnection, e events.Event) (apitypes.WebSocketMessage, bool) {
+	streamed, ok := public.FromEvent(e)
+	if !ok {
+		return apitypes.WebSocketMessage{}, false
+	}
+
+	if streamed.LobbyId != "" || streamed.GameId == "" {
+		if streamed.LobbyId != ws.lobbyId {
+			return apitypes.WebSocketMessage{}, false
+		}
+	} else {
+		lobbyState, err := c.lobbyManager.GetLobbyForGame(streamed.GameId)
+		if err != nil || lobbyState.Id != ws.lobbyId {
+			return apitypes.WebSocketMessage{}, false
+		}
+	}
+
+	if placed, ok := e.(events.TypedEvent[game.LetterPlaced]); ok && placed.Data.PlayerId == ws.playerId {
+		streamed.Data = placed.Data
+	}
+
+	data, err := json.Marshal(streamed.Data)
+	if err != nil {
+		ws.logger.Errorw("error serialising websocket event", "event", e.Kind(), "error", err)
+		return apitypes.WebSocketMessage{}, false
+	}
+
+	return apitypes.WebSocketMessage{
+		Version: apitypes.WebSocketProtocolVersion,
+		Type:    apitypes.WebSocketMessageEvent,
+		Event:   e.Kind(),
+		Data:    data,
+	}, true
+}
+
+// send queues a message for the writer, unless the writer has stopped
+func (ws *wsConnection) send(msg apitypes.WebSocketMessage) {
+	select {
+	case ws.outgoing <- msg:
+	case <-ws.writerDone:
+	}
+}
+
+func (ws *wsConnection) write(msg apitypes.WebSocketMessage) error {
+	_ = ws.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return ws.conn.WriteJSON(msg)
+}
+
+func errorMessage(commandId string, err error) apitypes.WebSocketMessage {
+	resp := apitypes.ToErrorResponse(err)
+	return apitypes.WebSocketMessage{
+		Version: apitypes.WebSocketProtocolVersion,
+		Type:    apitypes.WebSocketMessageError,
+		Id:      commandId,
+		Error:   &resp,
+	}
+}
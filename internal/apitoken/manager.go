@@ -0,0 +1,112 @@
+package apitoken
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/apitoken/types"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"github.com/mcoot/crosswordgame-go/internal/store"
+	"slices"
+)
+
+// errInvalidToken is the same whether the token doesn't exist or its secret is wrong
+var errInvalidToken = &errors.UnauthorizedError{Reason: "invalid API token"}
+
+type Manager struct {
+	store       store.TokenStore
+	playerStore store.PlayerStore
+}
+
+func NewTokenManager(store store.TokenStore, playerStore store.PlayerStore) *Manager {
+	return &Manager{
+		store:       store,
+		playerStore: playerStore,
+	}
+}
+
+// IssueToken creates a token for a registered player, returning the bearer token which is only ever shown here
+// Tokens without scopes are personal tokens with every scope, while bots are given only the scopes they need
+func (m *Manager) IssueToken(playerId playertypes.PlayerId, name string, scopes []types.Scope) (*types.Token, string, error) {
+	player, err := m.playerStore.RetrievePlayer(playerId)
+	if err != nil {
+		return nil, "", err
+	}
+	if !player.IsRegistered() {
+		return nil, "", &errors.InvalidActionError{
+			Action: "issue_token",
+			Reason: "only registered players can have API tokens",
+		}
+	}
+
+	if len(scopes) == 0 {
+		scopes = types.AllScopes
+	}
+	token, bearerToken, err := types.NewToken(playerId, name, scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	err = m.store.StoreToken(token)
+	if err != nil {
+		return nil, "", err
+	}
+	return token, bearerToken, nil
+}
+
+func (m *Manager) ListTokens(playerId playertypes.PlayerId) ([]*types.Token, error) {
+	tokens, err := m.store.RetrieveTokensForPlayer(playerId)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(tokens, func(a, b *types.Token) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return tokens, nil
+}
+
+// RevokeToken deletes one of the player's tokens, treating other players' tokens as not found
+func (m *Manager) RevokeToken(playerId playertypes.PlayerId, tokenId types.TokenId) error {
+	token, err := m.store.RetrieveToken(tokenId)
+	if err != nil {
+		return err
+	}
+	if token.PlayerId != playerId {
+		return &errors.NotFoundError{
+			ObjectKind: "token",
+			ObjectID:   tokenId,
+		}
+	}
+	return m.store.DeleteToken(tokenId)
+}
+
+// RevokeAllTokens deletes every one of the player's tokens, e.g. as their password has changed
+func (m *Manager) RevokeAllTokens(playerId playertypes.PlayerId) error {
+	tokens, err := m.store.RetrieveTokensForPlayer(playerId)
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		err = m.store.DeleteToken(token.Id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Authenticate returns the token a bearer token refers to, if its secret is right
+func (m *Manager) Authenticate(bearerToken string) (*types.Token, error) {
+	tokenId, secret, ok := types.ParseBearerToken(bearerToken)
+	if !ok {
+		return nil, errInvalidToken
+	}
+	token, err := m.store.RetrieveToken(tokenId)
+	if errors.IsNotFoundError(err) {
+		return nil, errInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !token.CheckSecret(secret) {
+		return nil, errInvalidToken
+	}
+	return token, nil
+}
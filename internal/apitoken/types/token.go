@@ -0,0 +1,121 @@
+package types
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"slices"
+	"strings"
+	"time"
+)
+
+type TokenId string
+
+// Scope is a group of JSON API actions a token may take on behalf of its player
+type Scope string
+
+const (
+	// ScopePlay covers creating games and announcing and placing letters in them
+	ScopePlay Scope = "play"
+	// ScopeLobby covers creating, joining and leaving lobbies, and running games in them
+	ScopeLobby Scope = "lobby"
+	// ScopeWebhooks covers managing the webhooks of lobbies the player hosts
+	ScopeWebhooks Scope = "webhooks"
+	// ScopeAccount covers managing the player's API tokens
+	ScopeAccount Scope = "account"
+)
+
+// AllScopes are given to personal tokens, which can do anything the player can
+var AllScopes = []Scope{ScopePlay, ScopeLobby, ScopeWebhooks, ScopeAccount}
+
+// maxNameLength bounds token names, which are only for players to tell their tokens apart
+const maxNameLength = 64
+
+// Token is an API token for a registered player, presented as a bearer token of the form "<id>.<secret>"
+type Token struct {
+	Id       TokenId              `json:"id"`
+	PlayerId playertypes.PlayerId `json:"player_id"`
+	Name     string               `json:"name"`
+	Scopes   []Scope              `json:"scopes"`
+	// SecretHash is the SHA-256 of the secret, which is random enough that it needs no salt or slow hash
+	SecretHash string    `json:"secret_hash"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// NewToken creates a token, returning it along with the bearer token string which is never stored
+func NewToken(playerId playertypes.PlayerId, name string, scopes []Scope) (*Token, string, error) {
+	if name == "" || len(name) > maxNameLength {
+		return nil, "", &errors.InvalidInputError{
+			ErrMessage: fmt.Sprintf("token name must be 1 to %d characters", maxNameLength),
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, "", &errors.InvalidInputError{ErrMessage: "a token needs at least one scope"}
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(AllScopes, scope) {
+			return nil, "", &errors.InvalidInputError{
+				ErrMessage: fmt.Sprintf("unknown token scope %q", scope),
+			}
+		}
+	}
+
+	rawId, err := randomHex(16)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	token := &Token{
+		Id:         TokenId(rawId),
+		PlayerId:   playerId,
+		Name:       name,
+		Scopes:     slices.Compact(slices.Sorted(slices.Values(scopes))),
+		SecretHash: hashSecret(secret),
+		CreatedAt:  time.Now().UTC(),
+	}
+	return token, rawId + "." + secret, nil
+}
+
+// ParseBearerToken splits a bearer token into the ID of the token to look up and the secret to check against it
+func ParseBearerToken(bearerToken string) (TokenId, string, bool) {
+	id, secret, ok := strings.Cut(bearerToken, ".")
+	if !ok || id == "" || secret == "" {
+		return "", "", false
+	}
+	return TokenId(id), secret, true
+}
+
+func (t *Token) CheckSecret(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(t.SecretHash)) == 1
+}
+
+func (t *Token) HasScope(scope Scope) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+func (t *Token) Clone() *Token {
+	clone := *t
+	clone.Scopes = slices.Clone(t.Scopes)
+	return &clone
+}
+
+func hashSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
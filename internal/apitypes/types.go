@@ -1,21 +1,36 @@
 package apitypes
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	apitokentypes "github.com/mcoot/crosswordgame-go/internal/apitoken/types"
 	gameerrors "github.com/mcoot/crosswordgame-go/internal/errors"
+	"github.com/mcoot/crosswordgame-go/internal/events"
 	gametypes "github.com/mcoot/crosswordgame-go/internal/game/types"
 	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
 	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"github.com/mcoot/crosswordgame-go/internal/presence"
+	webhooktypes "github.com/mcoot/crosswordgame-go/internal/webhook/types"
+	"time"
 )
 
+// CSRFHeader carries the session's CSRF token on requests which change something, and on JSON API responses
+// Only requests logged in by the session cookie need it, as other sites can't send bearer tokens
+const CSRFHeader = "X-CSRF-Token"
+
 type ErrorResponse struct {
 	HTTPCode int    `json:"http_code"`
 	Kind     string `json:"kind"`
 	Message  string `json:"message"`
+	// RequestId identifies the request which failed, to quote when reporting a problem
+	RequestId string `json:"request_id,omitempty"`
 }
 
 func (e ErrorResponse) Error() string {
+	if e.RequestId != "" {
+		return fmt.Sprintf("%d (%s): %s (request ID %s)", e.HTTPCode, e.Kind, e.Message, e.RequestId)
+	}
 	return fmt.Errorf("%d (%s): %s", e.HTTPCode, e.Kind, e.Message).Error()
 }
 
@@ -33,7 +48,7 @@ func ToErrorResponse(err error) ErrorResponse {
 		}
 	} else {
 		resp = ErrorResponse{
-			Kind:     "internal_error",
+			Kind:     string(gameerrors.GameErrorInternal),
 			Message:  err.Error(),
 			HTTPCode: 500,
 		}
@@ -47,6 +62,67 @@ type HealthcheckResponse struct {
 	StartTime string `json:"start_time"`
 }
 
+type SignupRequest struct {
+	Username    playertypes.PlayerId `json:"username"`
+	DisplayName string               `json:"display_name,omitempty"`
+	Password    string               `json:"password"`
+}
+
+type LoginRequest struct {
+	Username playertypes.PlayerId `json:"username"`
+	Password string               `json:"password"`
+}
+
+// AccountResponse is the registered player now logged in by the session cookie set on the response
+type AccountResponse struct {
+	PlayerId    playertypes.PlayerId `json:"player_id"`
+	DisplayName string               `json:"display_name"`
+}
+
+type LogoutResponse struct{}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ChangePasswordResponse struct{}
+
+type CreateTokenRequest struct {
+	Name string `json:"name"`
+	// Scopes limit what a bot can do with the token, while personal tokens leave them out to get every scope
+	Scopes []apitokentypes.Scope `json:"scopes,omitempty"`
+}
+
+type Token struct {
+	Id        apitokentypes.TokenId `json:"id"`
+	Name      string                `json:"name"`
+	Scopes    []apitokentypes.Scope `json:"scopes"`
+	CreatedAt time.Time             `json:"created_at"`
+}
+
+// ToToken converts a stored token for the API, leaving out its secret's hash
+func ToToken(token *apitokentypes.Token) Token {
+	return Token{
+		Id:        token.Id,
+		Name:      token.Name,
+		Scopes:    token.Scopes,
+		CreatedAt: token.CreatedAt,
+	}
+}
+
+// CreateTokenResponse is the only time the bearer token is returned
+type CreateTokenResponse struct {
+	Token
+	BearerToken string `json:"bearer_token"`
+}
+
+type ListTokensResponse struct {
+	Tokens []Token `json:"tokens"`
+}
+
+type RevokeTokenResponse struct{}
+
 type CreateGameRequest struct {
 	Players        []playertypes.PlayerId `json:"players"`
 	BoardDimension *int                   `json:"board_dimension,omitempty"`
@@ -95,13 +171,21 @@ type CreateLobbyResponse struct {
 }
 
 type GetLobbyStateResponse struct {
-	Name    string                 `json:"name"`
-	Players []playertypes.PlayerId `json:"players"`
-	GameID  gametypes.GameId       `json:"game_id,omitempty"`
+	Name     string                                     `json:"name"`
+	Players  []playertypes.PlayerId                     `json:"players"`
+	Host     playertypes.PlayerId                       `json:"host,omitempty"`
+	Locked   bool                                       `json:"locked"`
+	Settings LobbySettings                              `json:"settings"`
+	GameID   gametypes.GameId                           `json:"game_id,omitempty"`
+	Presence map[playertypes.PlayerId]presence.Presence `json:"presence"`
+	// WaitingOn is who the running game is waiting on this turn
+	WaitingOn []playertypes.PlayerId `json:"waiting_on,omitempty"`
 }
 
 type JoinLobbyRequest struct {
 	PlayerId playertypes.PlayerId `json:"player_id"`
+	// Password is needed to join lobbies which have one
+	Password string `json:"password,omitempty"`
 }
 
 type JoinLobbyResponse struct{}
@@ -112,6 +196,63 @@ type RemovePlayerFromLobbyRequest struct {
 
 type RemovePlayerFromLobbyResponse struct{}
 
+type TransferLobbyHostRequest struct {
+	PlayerId playertypes.PlayerId `json:"player_id"`
+}
+
+type TransferLobbyHostResponse struct{}
+
+type SetLobbyLockedRequest struct {
+	Locked bool `json:"locked"`
+}
+
+type SetLobbyLockedResponse struct{}
+
+// LobbySettings are a lobby's settings as the API shows them, without its password
+type LobbySettings struct {
+	MaxPlayers   int                    `json:"max_players"`
+	Visibility   lobbytypes.Visibility  `json:"visibility"`
+	HasPassword  bool                   `json:"has_password"`
+	GameDefaults lobbytypes.GameOptions `json:"game_defaults"`
+}
+
+func ToLobbySettings(settings lobbytypes.Settings) LobbySettings {
+	settings = settings.WithDefaults()
+	return LobbySettings{
+		MaxPlayers:   settings.MaxPlayers,
+		Visibility:   settings.Visibility,
+		HasPassword:  settings.HasPassword(),
+		GameDefaults: settings.GameDefaults,
+	}
+}
+
+// UpdateLobbySettingsRequest changes the settings which are given, leaving the rest as they are
+type UpdateLobbySettingsRequest struct {
+	MaxPlayers *int                   `json:"max_players,omitempty"`
+	Visibility *lobbytypes.Visibility `json:"visibility,omitempty"`
+	// Password replaces the join password, with "" removing it
+	Password     *string                 `json:"password,omitempty"`
+	GameDefaults *lobbytypes.GameOptions `json:"game_defaults,omitempty"`
+}
+
+type UpdateLobbySettingsResponse struct {
+	Settings LobbySettings `json:"settings"`
+}
+
+// LobbySummary is a lobby as listed for players looking for one to join
+type LobbySummary struct {
+	LobbyId     lobbytypes.LobbyId   `json:"lobby_id"`
+	Name        string               `json:"name"`
+	Host        playertypes.PlayerId `json:"host,omitempty"`
+	PlayerCount int                  `json:"player_count"`
+	Locked      bool                 `json:"locked"`
+	Settings    LobbySettings        `json:"settings"`
+}
+
+type ListLobbiesResponse struct {
+	Lobbies []LobbySummary `json:"lobbies"`
+}
+
 type AttachGameToLobbyRequest struct {
 	GameId gametypes.GameId `json:"game_id"`
 }
@@ -121,3 +262,59 @@ type AttachGameToLobbyResponse struct{}
 type DetachGameFromLobbyRequest struct{}
 
 type DetachGameFromLobbyResponse struct{}
+
+type ImportStateResponse struct {
+	Players    int `json:"players"`
+	Lobbies    int `json:"lobbies"`
+	Games      int `json:"games"`
+	Webhooks   int `json:"webhooks"`
+	Deliveries int `json:"deliveries"`
+	Tokens     int `json:"tokens"`
+}
+
+type RegisterWebhookRequest struct {
+	Url    string        `json:"url"`
+	Events []events.Kind `json:"events,omitempty"`
+}
+
+type Webhook struct {
+	Id        webhooktypes.WebhookId `json:"id"`
+	Url       string                 `json:"url"`
+	LobbyId   lobbytypes.LobbyId     `json:"lobby_id,omitempty"`
+	Events    []events.Kind          `json:"events"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// ToWebhook converts a stored webhook for the API, leaving out its secret
+func ToWebhook(webhook *webhooktypes.Webhook) Webhook {
+	return Webhook{
+		Id:        webhook.Id,
+		Url:       webhook.Url,
+		LobbyId:   webhook.LobbyId,
+		Events:    webhook.Events,
+		CreatedAt: webhook.CreatedAt,
+	}
+}
+
+// RegisterWebhookResponse is the only time the webhook's secret is returned
+type RegisterWebhookResponse struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+type ListWebhooksResponse struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+type DeleteWebhookResponse struct{}
+
+type ListWebhookDeliveriesResponse struct {
+	Deliveries []*webhooktypes.Delivery `json:"deliveries"`
+}
+
+// StreamEvent is one event read from a game or lobby event stream
+// Data is the JSON payload for the event's kind, e.g. a game.LetterAnnounced for game.letter_announced
+type StreamEvent struct {
+	Event events.Kind     `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
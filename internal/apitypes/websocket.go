@@ -0,0 +1,47 @@
+package apitypes
+
+import (
+	"encoding/json"
+	"github.com/mcoot/crosswordgame-go/internal/events"
+)
+
+// WebSocketProtocolVersion is the version of the WebSocket message schema in schema/websocket.yaml
+// Every message carries it, and the server rejects commands for any other version
+const WebSocketProtocolVersion = 1
+
+type WebSocketCommandType string
+
+const (
+	WebSocketCommandAnnounce WebSocketCommandType = "announce"
+	WebSocketCommandPlace    WebSocketCommandType = "place"
+)
+
+// WebSocketCommand is a message from the client asking to act in the lobby's running game
+// Id is chosen by the client, and echoed back on the ack or error for the command
+type WebSocketCommand struct {
+	Version int                  `json:"version"`
+	Id      string               `json:"id,omitempty"`
+	Type    WebSocketCommandType `json:"type"`
+	Letter  string               `json:"letter,omitempty"`
+	Row     *int                 `json:"row,omitempty"`
+	Column  *int                 `json:"column,omitempty"`
+}
+
+type WebSocketMessageType string
+
+const (
+	WebSocketMessageAck   WebSocketMessageType = "ack"
+	WebSocketMessageError WebSocketMessageType = "error"
+	WebSocketMessageEvent WebSocketMessageType = "event"
+)
+
+// WebSocketMessage is a message from the server
+// Acks and errors answer the command with the same Id, while events carry a state change as on the event streams
+type WebSocketMessage struct {
+	Version int                  `json:"version"`
+	Type    WebSocketMessageType `json:"type"`
+	Id      string               `json:"id,omitempty"`
+	Error   *ErrorResponse       `json:"error,omitempty"`
+	Event   events.Kind          `json:"event,omitempty"`
+	Data    json.RawMessage      `json:"data,omitempty"`
+}
@@ -0,0 +1,370 @@
+package backup
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	apitokentypes "github.com/mcoot/crosswordgame-go/internal/apitoken/types"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+	gametypes "github.com/mcoot/crosswordgame-go/internal/game/types"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"github.com/mcoot/crosswordgame-go/internal/store"
+	webhooktypes "github.com/mcoot/crosswordgame-go/internal/webhook/types"
+	"io"
+	"slices"
+	"time"
+)
+
+// A dump is a stream of JSON Lines: a header record, followed by one record per stored object
+// Bump FormatVersion whenever a record kind changes shape incompatibly
+const (
+	// FormatVersion 2 added webhooks, their deliveries and API tokens, so version 1 dumps have none of them
+	FormatVersion = 2
+	ContentType   = "application/x-ndjson"
+
+	// maxRecordSize bounds a single line of the dump, which must hold the largest game
+	maxRecordSize = 16 * 1024 * 1024
+)
+
+type RecordKind string
+
+const (
+	RecordKindHeader RecordKind = "header"
+	RecordKindPlayer RecordKind = "player"
+	RecordKindLobby  RecordKind = "lobby"
+	RecordKindGame   RecordKind = "game"
+	// RecordKindWebhook records come before the deliveries of each webhook, which are logged against it
+	RecordKindWebhook  RecordKind = "webhook"
+	RecordKindDelivery RecordKind = "webhook_delivery"
+	RecordKindToken    RecordKind = "token"
+)
+
+type record struct {
+	Kind RecordKind      `json:"kind"`
+	Data json.RawMessage `json:"data"`
+}
+
+type Header struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+}
+
+// Summary counts the objects written or read in a dump
+type Summary struct {
+	Players    int `json:"players"`
+	Lobbies    int `json:"lobbies"`
+	Games      int `json:"games"`
+	Webhooks   int `json:"webhooks"`
+	Deliveries int `json:"deliveries"`
+	Tokens     int `json:"tokens"`
+}
+
+// Stores are where the state in a dump is exported from and imported to
+type Stores struct {
+	State    store.Store
+	Webhooks store.WebhookStore
+	Tokens   store.TokenStore
+}
+
+// Export writes every player, lobby, game, webhook and its delivery log, and API token in the stores to w
+// Objects are sorted by ID within each kind, so dumps of the same state are identical
+func Export(stores Stores, w io.Writer) (*Summary, error) {
+	s := stores.State
+	enc := json.NewEncoder(w)
+	summary := &Summary{}
+
+	err := writeRecord(enc, RecordKindHeader, Header{
+		Version:    FormatVersion,
+		ExportedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	players, err := s.RetrieveAllPlayers()
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(players, func(a, b *playertypes.Player) int {
+		return cmp.Compare(a.Username, b.Username)
+	})
+	for _, p := range players {
+		if err := writeRecord(enc, RecordKindPlayer, p); err != nil {
+			return nil, err
+		}
+		summary.Players++
+	}
+
+	lobbies, err := s.RetrieveAllLobbies()
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(lobbies, func(a, b *lobbytypes.Lobby) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+	for _, l := range lobbies {
+		if err := writeRecord(enc, RecordKindLobby, l); err != nil {
+			return nil, err
+		}
+		summary.Lobbies++
+	}
+
+	games, err := s.RetrieveAllGames()
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(games, func(a, b *gametypes.Game) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+	for _, g := range games {
+		if err := writeRecord(enc, RecordKindGame, g); err != nil {
+			return nil, err
+		}
+		summary.Games++
+	}
+
+	err = exportWebhooks(stores.Webhooks, enc, summary)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := stores.Tokens.RetrieveAllTokens()
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(tokens, func(a, b *apitokentypes.Token) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+	for _, t := range tokens {
+		if err := writeRecord(enc, RecordKindToken, t); err != nil {
+			return nil, err
+		}
+		summary.Tokens++
+	}
+
+	return summary, nil
+}
+
+// exportWebhooks writes each webhook followed by its delivery log, which is kept in the order it was written
+func exportWebhooks(webhookStore store.WebhookStore, enc *json.Encoder, summary *Summary) error {
+	webhooks, err := webhookStore.RetrieveAllWebhooks()
+	if err != nil {
+		return err
+	}
+	slices.SortFunc(webhooks, func(a, b *webhooktypes.Webhook) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+	for _, wh := range webhooks {
+		if err := writeRecord(enc, RecordKindWebhook, wh); err != nil {
+			return err
+		}
+		summary.Webhooks++
+
+		deliveries, err := webhookStore.RetrieveDeliveriesForWebhook(wh.Id)
+		if err != nil {
+			return err
+		}
+		for _, d := range deliveries {
+			if err := writeRecord(enc, RecordKindDelivery, d); err != nil {
+				return err
+			}
+			summary.Deliveries++
+		}
+	}
+	return nil
+}
+
+// Import loads a dump produced by Export into the stores, overwriting any objects with the same IDs
+// Players, lobbies and games are imported in a single transaction, so a malformed dump leaves them untouched;
+// webhooks and tokens aren't transactional, so they are only written once that transaction has committed
+// Tokens are restored as they were exported, including any revoked since
+func Import(stores Stores, r io.Reader) (*Summary, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+
+	summary := &Summary{}
+	pending := &pendingRecords{}
+	err := stores.State.Transact(func(tx store.Store) error {
+		line := 0
+		for scanner.Scan() {
+			line++
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+
+			var rec record
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				return invalidDumpError(line, err.Error())
+			}
+
+			if line == 1 {
+				if err := checkHeader(rec); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := importRecord(tx, pending, rec, summary); err != nil {
+				return invalidDumpError(line, err.Error())
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		if line == 0 {
+			return invalidDumpError(0, "dump is empty")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = pending.store(stores)
+	if err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// pendingRecords are the objects read from a dump which are kept outside the transactional store
+type pendingRecords struct {
+	webhooks   []*webhooktypes.Webhook
+	deliveries []*webhooktypes.Delivery
+	tokens     []*apitokentypes.Token
+}
+
+func (p *pendingRecords) store(stores Stores) error {
+	for _, wh := range p.webhooks {
+		if err := stores.Webhooks.StoreWebhook(wh); err != nil {
+			return err
+		}
+	}
+	for _, d := range p.deliveries {
+		if err := stores.Webhooks.StoreDelivery(d); err != nil {
+			return err
+		}
+	}
+	for _, t := range p.tokens {
+		if err := stores.Tokens.StoreToken(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeRecord(enc *json.Encoder, kind RecordKind, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return enc.Encode(record{
+		Kind: kind,
+		Data: raw,
+	})
+}
+
+func checkHeader(rec record) error {
+	if rec.Kind != RecordKindHeader {
+		return invalidDumpError(1, fmt.Sprintf("expected a %s record, got %s", RecordKindHeader, rec.Kind))
+	}
+
+	var header Header
+	if err := json.Unmarshal(rec.Data, &header); err != nil {
+		return invalidDumpError(1, err.Error())
+	}
+	if header.Version < 1 || header.Version > FormatVersion {
+		return invalidDumpError(1, fmt.Sprintf("unsupported dump version %d", header.Version))
+	}
+	return nil
+}
+
+func importRecord(tx store.Store, pending *pendingRecords, rec record, summary *Summary) error {
+	switch rec.Kind {
+	case RecordKindPlayer:
+		var p playertypes.Player
+		if err := json.Unmarshal(rec.Data, &p); err != nil {
+			return err
+		}
+		if p.Username == "" {
+			return fmt.Errorf("player is missing a username")
+		}
+		summary.Players++
+		return tx.StorePlayer(&p)
+	case RecordKindLobby:
+		var l lobbytypes.Lobby
+		if err := json.Unmarshal(rec.Data, &l); err != nil {
+			return err
+		}
+		if l.Id == "" {
+			return fmt.Errorf("lobby is missing an ID")
+		}
+		if l.Players == nil {
+			l.Players = make([]playertypes.PlayerId, 0)
+		}
+		summary.Lobbies++
+		return tx.StoreLobby(&l)
+	case RecordKindGame:
+		var g gametypes.Game
+		if err := json.Unmarshal(rec.Data, &g); err != nil {
+			return err
+		}
+		if g.Id == "" {
+			return fmt.Errorf("game is missing an ID")
+		}
+		if g.PlayerScores == nil {
+			g.PlayerScores = make(map[playertypes.PlayerId]*gametypes.ScoreResult)
+		}
+		summary.Games++
+		return tx.StoreGame(&g)
+	case RecordKindWebhook:
+		var wh webhooktypes.Webhook
+		if err := json.Unmarshal(rec.Data, &wh); err != nil {
+			return err
+		}
+		if wh.Id == "" {
+			return fmt.Errorf("webhook is missing an ID")
+		}
+		summary.Webhooks++
+		pending.webhooks = append(pending.webhooks, &wh)
+		return nil
+	case RecordKindDelivery:
+		var d webhooktypes.Delivery
+		if err := json.Unmarshal(rec.Data, &d); err != nil {
+			return err
+		}
+		if d.Id == "" {
+			return fmt.Errorf("webhook delivery is missing an ID")
+		}
+		if !slices.ContainsFunc(pending.webhooks, func(wh *webhooktypes.Webhook) bool {
+			return wh.Id == d.WebhookId
+		}) {
+			return fmt.Errorf("webhook delivery %s comes before its webhook %s", d.Id, d.WebhookId)
+		}
+		summary.Deliveries++
+		pending.deliveries = append(pending.deliveries, &d)
+		return nil
+	case RecordKindToken:
+		var t apitokentypes.Token
+		if err := json.Unmarshal(rec.Data, &t); err != nil {
+			return err
+		}
+		if t.Id == "" || t.SecretHash == "" {
+			return fmt.Errorf("token is missing an ID or secret hash")
+		}
+		summary.Tokens++
+		pending.tokens = append(pending.tokens, &t)
+		return nil
+	default:
+		return fmt.Errorf("unknown record kind %q", rec.Kind)
+	}
+}
+
+func invalidDumpError(line int, reason string) error {
+	return &errors.InvalidInputError{
+		ErrMessage: fmt.Sprintf("invalid dump at line %d: %s", line, reason),
+	}
+}
@@ -0,0 +1,183 @@
+package backup
+
+import (
+	"bytes"
+	apitokentypes "github.com/mcoot/crosswordgame-go/internal/apitoken/types"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	gametypes "github.com/mcoot/crosswordgame-go/internal/game/types"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"github.com/mcoot/crosswordgame-go/internal/store"
+	webhooktypes "github.com/mcoot/crosswordgame-go/internal/webhook/types"
+	"github.com/stretchr/testify/suite"
+	"strings"
+	"testing"
+)
+
+type BackupSuite struct {
+	suite.Suite
+}
+
+func TestBackupSuite(t *testing.T) {
+	suite.Run(t, new(BackupSuite))
+}
+
+func storesOf(db *store.InMemoryStore) Stores {
+	return Stores{State: db, Webhooks: db, Tokens: db}
+}
+
+func (s *BackupSuite) populatedStore() (*store.InMemoryStore, *gametypes.Game, *lobbytypes.Lobby, *playertypes.Player) {
+	db := store.NewInMemoryStore()
+
+	player, err := playertypes.NewEphemeralPlayer("Alice")
+	s.NoError(err)
+	s.NoError(db.StorePlayer(player))
+
+	game, err := gametypes.NewGame([]playertypes.PlayerId{player.Username}, 2)
+	s.NoError(err)
+	game.PlayerBoards[player.Username].Data[0][1] = "A"
+	game.Status = gametypes.StatusAwaitingPlacement
+	game.CurrentAnnouncedLetter = "B"
+	s.NoError(db.StoreGame(game))
+
+	lobby, err := lobbytypes.NewLobby("lobby")
+	s.NoError(err)
+	lobby.Players = append(lobby.Players, player.Username)
+	lobby.RunningGame = &lobbytypes.RunningGame{GameId: game.Id}
+	s.NoError(db.StoreLobby(lobby))
+
+	webhook, err := webhooktypes.NewWebhook("https://example.com/hook", lobby.Id, []events.Kind{"lobby.player_joined"})
+	s.NoError(err)
+	s.NoError(db.StoreWebhook(webhook))
+	delivery, err := webhooktypes.NewDelivery(webhook.Id, "lobby.player_joined", []byte(`{"lobby_id":"lobby"}`))
+	s.NoError(err)
+	delivery.Status = webhooktypes.DeliveryStatusDeadLetter
+	s.NoError(db.StoreDelivery(delivery))
+
+	token, _, err := apitokentypes.NewToken(player.Username, "bot", []apitokentypes.Scope{apitokentypes.ScopePlay})
+	s.NoError(err)
+	s.NoError(db.StoreToken(token))
+
+	return db, game, lobby, player
+}
+
+func (s *BackupSuite) TestRoundTrip() {
+	source, game, lobby, player := s.populatedStore()
+
+	var dump bytes.Buffer
+	exported, err := Export(storesOf(source), &dump)
+	s.NoError(err)
+	s.Equal(&Summary{Players: 1, Lobbies: 1, Games: 1, Webhooks: 1, Deliveries: 1, Tokens: 1}, exported)
+
+	lines := strings.Split(strings.TrimSpace(dump.String()), "\n")
+	s.Len(lines, 7)
+	s.Contains(lines[0], `"kind":"header"`)
+
+	target := store.NewInMemoryStore()
+	imported, err := Import(storesOf(target), &dump)
+	s.NoError(err)
+	s.Equal(exported, imported)
+
+	importedPlayer, err := target.RetrievePlayer(player.Username)
+	s.NoError(err)
+	s.Equal(player.DisplayName, importedPlayer.DisplayName)
+	s.True(player.LastLogin.Equal(importedPlayer.LastLogin))
+
+	importedLobby, err := target.RetrieveLobby(lobby.Id)
+	s.NoError(err)
+	s.Equal(lobby, importedLobby)
+
+	importedGame, err := target.RetrieveGame(game.Id)
+	s.NoError(err)
+	s.Equal(game, importedGame)
+
+	// Integrations keep working after moving to the new store, with the dead letters still to look into
+	webhooks, err := source.RetrieveAllWebhooks()
+	s.NoError(err)
+	importedWebhook, err := target.RetrieveWebhook(webhooks[0].Id)
+	s.NoError(err)
+	s.Equal(webhooks[0].Secret, importedWebhook.Secret)
+	s.True(webhooks[0].CreatedAt.Equal(importedWebhook.CreatedAt))
+	importedDeliveries, err := target.RetrieveDeliveriesForWebhook(importedWebhook.Id)
+	s.NoError(err)
+	s.Require().Len(importedDeliveries, 1)
+	s.Equal(webhooktypes.DeliveryStatusDeadLetter, importedDeliveries[0].Status)
+
+	tokens, err := source.RetrieveAllTokens()
+	s.NoError(err)
+	importedToken, err := target.RetrieveToken(tokens[0].Id)
+	s.NoError(err)
+	s.Equal(tokens[0].SecretHash, importedToken.SecretHash)
+	s.Equal(player.Username, importedToken.PlayerId)
+}
+
+func (s *BackupSuite) TestExportIsDeterministic() {
+	source, _, _, _ := s.populatedStore()
+	extraLobby, err := lobbytypes.NewLobby("another")
+	s.NoError(err)
+	s.NoError(source.StoreLobby(extraLobby))
+
+	var first, second bytes.Buffer
+	_, err = Export(storesOf(source), &first)
+	s.NoError(err)
+	_, err = Export(storesOf(source), &second)
+	s.NoError(err)
+
+	// Only the header's timestamp may differ
+	firstLines := strings.SplitN(first.String(), "\n", 2)
+	secondLines := strings.SplitN(second.String(), "\n", 2)
+	s.Equal(firstLines[1], secondLines[1])
+}
+
+func (s *BackupSuite) TestMalformedDumpLeavesStoreUntouched() {
+	dump := `{"kind":"header","data":{"version":1,"exported_at":"2024-01-01T00:00:00Z"}}
+{"kind":"lobby","data":{"id":"lobby0","name":"lobby","players":[]}}
+{"kind":"widget","data":{}}
+`
+	target := store.NewInMemoryStore()
+	_, err := Import(storesOf(target), strings.NewReader(dump))
+	s.Error(err)
+	s.Contains(err.Error(), "line 3")
+
+	_, err = target.RetrieveLobby("lobby0")
+	s.True(errors.IsNotFoundError(err))
+}
+
+func (s *BackupSuite) TestMalformedDumpStoresNoWebhooks() {
+	dump := `{"kind":"header","data":{"version":2,"exported_at":"2024-01-01T00:00:00Z"}}
+{"kind":"webhook","data":{"id":"webhook0","url":"https://example.com/hook","secret":"s","events":[]}}
+{"kind":"webhook_delivery","data":{"id":"delivery0","webhook_id":"webhook1","status":"pending","attempts":[]}}
+`
+	target := store.NewInMemoryStore()
+	_, err := Import(storesOf(target), strings.NewReader(dump))
+	s.Error(err)
+	s.Contains(err.Error(), "line 3")
+
+	_, err = target.RetrieveWebhook("webhook0")
+	s.True(errors.IsNotFoundError(err))
+}
+
+func (s *BackupSuite) TestImportsVersion1Dumps() {
+	dump := `{"kind":"header","data":{"version":1,"exported_at":"2024-01-01T00:00:00Z"}}
+{"kind":"lobby","data":{"id":"lobby0","name":"lobby","players":[]}}
+`
+	imported, err := Import(storesOf(store.NewInMemoryStore()), strings.NewReader(dump))
+	s.NoError(err)
+	s.Equal(&Summary{Lobbies: 1}, imported)
+}
+
+func (s *BackupSuite) TestRejectsUnsupportedVersion() {
+	dump := `{"kind":"header","data":{"version":99,"exported_at":"2024-01-01T00:00:00Z"}}
+`
+	_, err := Import(storesOf(store.NewInMemoryStore()), strings.NewReader(dump))
+	s.Error(err)
+	s.Contains(err.Error(), "unsupported dump version 99")
+}
+
+func (s *BackupSuite) TestRejectsMissingHeader() {
+	dump := `{"kind":"lobby","data":{"id":"lobby0","name":"lobby","players":[]}}
+`
+	_, err := Import(storesOf(store.NewInMemoryStore()), strings.NewReader(dump))
+	s.Error(err)
+}
@@ -0,0 +1,24 @@
+package broker
+
+import (
+	"context"
+)
+
+// Broker fans messages out to every subscriber of a topic, across all the server replicas sharing it
+// Delivery is at most once: subscribers only receive messages published while they are subscribed,
+// and may miss some if they fall behind
+type Broker interface {
+	Publish(ctx context.Context, topic string, payload []byte) error
+	// Subscribe returns once the subscription is in place, so it receives everything published afterwards
+	Subscribe(ctx context.Context, topic string) (Subscription, error)
+	Close() error
+}
+
+type Subscription interface {
+	// Messages is closed once the subscription ends
+	Messages() <-chan []byte
+	Close() error
+}
+
+// subscriptionQueueSize is the number of messages buffered for each subscription
+const subscriptionQueueSize = 256
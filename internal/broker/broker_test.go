@@ -0,0 +1,133 @@
+package broker
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+// BrokerSuite checks the behaviour every broker shares
+type BrokerSuite struct {
+	suite.Suite
+	// connect sets up a broker for a test, returning a function giving each replica its connection to it
+	connect   func(t *testing.T) func() Broker
+	newBroker func() Broker
+}
+
+func TestInProcessBrokerSuite(t *testing.T) {
+	suite.Run(t, &BrokerSuite{connect: func(t *testing.T) func() Broker {
+		// An in-process broker only shares messages within itself, so replicas in a test share one
+		shared := NewInProcessBroker()
+		t.Cleanup(func() { _ = shared.Close() })
+		return func() Broker { return shared }
+	}})
+}
+
+func TestRedisBrokerSuite(t *testing.T) {
+	suite.Run(t, &BrokerSuite{connect: func(t *testing.T) func() Broker {
+		server := miniredis.RunT(t)
+		return func() Broker {
+			b := NewRedisBroker(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+			t.Cleanup(func() { _ = b.Close() })
+			return b
+		}
+	}})
+}
+
+func (s *BrokerSuite) SetupTest() {
+	s.newBroker = s.connect(s.T())
+}
+
+func (s *BrokerSuite) receive(sub Subscription) []byte {
+	select {
+	case msg, ok := <-sub.Messages():
+		s.Require().True(ok, "subscription ended")
+		return msg
+	case <-time.After(5 * time.Second):
+		s.FailNow("no message received")
+		return nil
+	}
+}
+
+func (s *BrokerSuite) TestSubscribersOnEveryReplicaReceiveMessages() {
+	publisher := s.newBroker()
+	subscriber := s.newBroker()
+
+	local, err := publisher.Subscribe(context.Background(), "topic")
+	s.Require().NoError(err)
+	remote, err := subscriber.Subscribe(context.Background(), "topic")
+	s.Require().NoError(err)
+	other, err := subscriber.Subscribe(context.Background(), "other")
+	s.Require().NoError(err)
+
+	s.Require().NoError(publisher.Publish(context.Background(), "topic", []byte("first")))
+	s.Require().NoError(publisher.Publish(context.Background(), "topic", []byte("second")))
+
+	s.Equal("first", string(s.receive(local)))
+	s.Equal("second", string(s.receive(local)))
+	s.Equal("first", string(s.receive(remote)))
+	s.Equal("second", string(s.receive(remote)))
+	s.Empty(other.Messages())
+}
+
+func (s *BrokerSuite) TestClosingSubscriptionEndsIt() {
+	b := s.newBroker()
+	sub, err := b.Subscribe(context.Background(), "topic")
+	s.Require().NoError(err)
+
+	s.Require().NoError(sub.Close())
+	s.NoError(sub.Close())
+	s.Require().NoError(b.Publish(context.Background(), "topic", []byte("ignored")))
+
+	select {
+	case _, ok := <-sub.Messages():
+		s.False(ok)
+	case <-time.After(5 * time.Second):
+		s.FailNow("subscription not closed")
+	}
+}
+
+func (s *BrokerSuite) TestRelaySharesEventsBetweenReplicas() {
+	const kind events.Kind = "test.event"
+	codec := events.NewCodec()
+	events.Register[string](codec, kind)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type replica struct {
+		local  *events.EventBus
+		fanout *events.EventBus
+	}
+	startReplica := func() replica {
+		r := replica{local: events.NewEventBus(), fanout: events.NewEventBus()}
+		relay := NewEventRelay(s.newBroker(), codec, zap.NewNop().Sugar())
+		s.Require().NoError(relay.Start(ctx, r.local, r.fanout))
+		return r
+	}
+	a := startReplica()
+	b := startReplica()
+
+	aLocal := a.local.Subscribe(kind)
+	bLocal := b.local.Subscribe(kind)
+	aFanout := a.fanout.Subscribe(kind)
+	bFanout := b.fanout.Subscribe(kind)
+
+	a.local.Publish(events.NewTypedEvent(kind, "from a"))
+
+	for _, sub := range []*events.Subscription{aLocal, aFanout, bFanout} {
+		select {
+		case e := <-sub.Events():
+			s.Equal(events.NewTypedEvent(kind, "from a"), e)
+		case <-time.After(5 * time.Second):
+			s.FailNow("event not relayed")
+		}
+	}
+	// Each event is only published locally on the replica it came from
+	s.Empty(bLocal.Events())
+}
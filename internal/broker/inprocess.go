@@ -0,0 +1,99 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+)
+
+var ErrClosed = errors.New("broker closed")
+
+// InProcessBroker fans messages out within a single process, for running a single replica
+type InProcessBroker struct {
+	mutex         sync.Mutex
+	subscriptions map[string][]*inProcessSubscription
+	closed        bool
+}
+
+func NewInProcessBroker() *InProcessBroker {
+	return &InProcessBroker{
+		subscriptions: make(map[string][]*inProcessSubscription),
+	}
+}
+
+type inProcessSubscription struct {
+	broker   *InProcessBroker
+	topic    string
+	messages chan []byte
+}
+
+func (b *InProcessBroker) Publish(_ context.Context, topic string, payload []byte) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		return ErrClosed
+	}
+
+	for _, sub := range b.subscriptions[topic] {
+		// Drop the message for a subscriber that has fallen behind, rather than hold up everyone else
+		select {
+		case sub.messages <- payload:
+		default:
+		}
+	}
+	return nil
+}
+
+func (b *InProcessBroker) Subscribe(_ context.Context, topic string) (Subscription, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	sub := &inProcessSubscription{
+		broker:   b,
+		topic:    topic,
+		messages: make(chan []byte, subscriptionQueueSize),
+	}
+	b.subscriptions[topic] = append(b.subscriptions[topic], sub)
+	return sub, nil
+}
+
+// Close ends every subscription
+func (b *InProcessBroker) Close() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		return nil
+	}
+
+	b.closed = true
+	for _, subs := range b.subscriptions {
+		for _, sub := range subs {
+			close(sub.messages)
+		}
+	}
+	b.subscriptions = nil
+	return nil
+}
+
+func (s *inProcessSubscription) Messages() <-chan []byte {
+	return s.messages
+}
+
+// Close is safe to call more than once, including after the broker has closed
+func (s *inProcessSubscription) Close() error {
+	s.broker.mutex.Lock()
+	defer s.broker.mutex.Unlock()
+
+	subs := s.broker.subscriptions[s.topic]
+	i := slices.Index(subs, s)
+	if i < 0 {
+		return nil
+	}
+	s.broker.subscriptions[s.topic] = slices.Delete(subs, i, i+1)
+	close(s.messages)
+	return nil
+}
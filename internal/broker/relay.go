@@ -0,0 +1,89 @@
+package broker
+
+import (
+	"context"
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	"go.uber.org/zap"
+)
+
+// EventsTopic is the broker topic domain events are shared on
+const EventsTopic = "crosswordgame.events"
+
+// EventRelay shares domain events between replicas through a broker
+// Events published on this replica's local bus are sent to the broker, and every event received from it,
+// including this replica's own, is published to the fan-out bus
+// Live connections subscribe to the fan-out bus so they see events from every replica, while anything
+// which should happen once per event (e.g. webhooks) stays on the local bus
+type EventRelay struct {
+	broker Broker
+	codec  *events.Codec
+	logger *zap.SugaredLogger
+}
+
+func NewEventRelay(broker Broker, codec *events.Codec, logger *zap.SugaredLogger) *EventRelay {
+	return &EventRelay{
+		broker: broker,
+		codec:  codec,
+		logger: logger,
+	}
+}
+
+// Start subscribes to the broker and the local bus, relaying events in the background until ctx is done
+// Returns an error if the broker subscription can't be made, e.g. as the broker is unreachable
+func (r *EventRelay) Start(ctx context.Context, local *events.EventBus, fanout *events.EventBus) error {
+	remote, err := r.broker.Subscribe(ctx, EventsTopic)
+	if err != nil {
+		return err
+	}
+	sub := local.Subscribe(events.AnyKind)
+
+	go r.receive(ctx, remote, fanout)
+	go r.send(ctx, sub, local)
+	return nil
+}
+
+// send passes events from the local bus to the broker
+func (r *EventRelay) send(ctx context.Context, sub *events.Subscription, local *events.EventBus) {
+	defer local.Unsubscribe(sub)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-sub.Events():
+			if !ok {
+				r.logger.Errorw("event relay disconnected from local bus")
+				return
+			}
+			payload, err := r.codec.Encode(e)
+			if err != nil {
+				r.logger.Errorw("error encoding event for broker", "event", e.Kind(), "error", err)
+				continue
+			}
+			if err := r.broker.Publish(ctx, EventsTopic, payload); err != nil {
+				r.logger.Errorw("error publishing event to broker", "event", e.Kind(), "error", err)
+			}
+		}
+	}
+}
+
+// receive publishes events from the broker to the fan-out bus
+func (r *EventRelay) receive(ctx context.Context, remote Subscription, fanout *events.EventBus) {
+	defer remote.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case payload, ok := <-remote.Messages():
+			if !ok {
+				r.logger.Errorw("event relay subscription to broker ended")
+				return
+			}
+			e, err := r.codec.Decode(payload)
+			if err != nil {
+				r.logger.Errorw("error decoding event from broker", "error", err)
+				continue
+			}
+			fanout.Publish(e)
+		}
+	}
+}
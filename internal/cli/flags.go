@@ -4,12 +4,15 @@ import (
 	"fmt"
 	"github.com/mcoot/crosswordgame-go/internal/game/types"
 	"github.com/spf13/cobra"
+	"os"
 	"strings"
 )
 
 var (
 	FlagServer     string
 	FlagOutputMode OutputMode
+	FlagAdminToken string
+	FlagToken      string
 )
 
 func GlobalFlagServer(cmd *cobra.Command) {
@@ -22,6 +25,16 @@ func GlobalFlagOutputMode(cmd *cobra.Command) {
 		VarP(&FlagOutputMode, "output", "o", "Output mode (default: text, allowed: text, json, yaml)")
 }
 
+func GlobalFlagAdminToken(cmd *cobra.Command) {
+	cmd.PersistentFlags().
+		StringVar(&FlagAdminToken, "admin-token", os.Getenv("CWG_ADMIN_TOKEN"), "Server admin token (default: $CWG_ADMIN_TOKEN)")
+}
+
+func GlobalFlagToken(cmd *cobra.Command) {
+	cmd.PersistentFlags().
+		StringVar(&FlagToken, "token", os.Getenv("CWG_TOKEN"), "API token to act as (default: $CWG_TOKEN, or the token saved by logging in)")
+}
+
 func GameIdFlag(cmd *cobra.Command, v *string) {
 	cmd.Flags().
 		StringVarP(v, "game", "g", "", "Game ID")
@@ -49,6 +62,21 @@ func LobbyIdFlag(cmd *cobra.Command, v *string) {
 	}
 }
 
+func WebhookIdFlag(cmd *cobra.Command, v *string) {
+	cmd.Flags().
+		StringVarP(v, "webhook", "w", "", "Webhook ID")
+	err := cmd.MarkFlagRequired("webhook")
+	if err != nil {
+		panic(err)
+	}
+}
+
+// WebhookLobbyIdFlag selects a lobby's webhooks; without it, commands act on server-wide webhooks as an admin
+func WebhookLobbyIdFlag(cmd *cobra.Command, v *string) {
+	cmd.Flags().
+		StringVarP(v, "lobby", "l", "", "Lobby ID (default: server-wide webhooks, which need the admin token)")
+}
+
 type LetterValue string
 
 func (l *LetterValue) Set(value string) error {
@@ -5,6 +5,7 @@ import (
 	"github.com/davecgh/go-spew/spew"
 	"github.com/mcoot/crosswordgame-go/internal/apitypes"
 	"strings"
+	"time"
 )
 
 func PrettyPrint(v interface{}) {
@@ -54,6 +55,24 @@ func apiPrettyPrint(v interface{}) bool {
 	case *apitypes.DetachGameFromLobbyResponse:
 		printDetachGameFromLobbyResponse(v)
 		return true
+	case *apitypes.ImportStateResponse:
+		printImportStateResponse(v)
+		return true
+	case *apitypes.RegisterWebhookResponse:
+		printRegisterWebhookResponse(v)
+		return true
+	case *apitypes.ListWebhooksResponse:
+		printListWebhooksResponse(v)
+		return true
+	case *apitypes.DeleteWebhookResponse:
+		printDeleteWebhookResponse(v)
+		return true
+	case *apitypes.ListWebhookDeliveriesResponse:
+		printListWebhookDeliveriesResponse(v)
+		return true
+	case *apitypes.StreamEvent:
+		printStreamEvent(v)
+		return true
 	case []interface{}:
 		spew.Dump(v)
 		return true
@@ -153,7 +172,13 @@ func printGetLobbyStateResponse(v *apitypes.GetLobbyStateResponse) {
   Players:
 `, v.Name, gameIdStr)
 	for _, player := range v.Players {
-		fmt.Printf("    %s\n", player)
+		fmt.Printf("    %s (%s)\n", player, v.Presence[player].Status)
+	}
+	if len(v.WaitingOn) > 0 {
+		fmt.Printf("  Waiting On:\n")
+		for _, player := range v.WaitingOn {
+			fmt.Printf("    %s\n", player)
+		}
 	}
 }
 
@@ -172,3 +197,71 @@ func printAttachGameToLobbyResponse(v *apitypes.AttachGameToLobbyResponse) {
 func printDetachGameFromLobbyResponse(v *apitypes.DetachGameFromLobbyResponse) {
 	fmt.Printf("Game detached from lobby\n")
 }
+
+func printImportStateResponse(v *apitypes.ImportStateResponse) {
+	fmt.Printf(`State imported:
+  Players: %d
+  Lobbies: %d
+  Games: %d
+  Webhooks: %d
+  Webhook deliveries: %d
+  API tokens: %d
+`, v.Players, v.Lobbies, v.Games, v.Webhooks, v.Deliveries, v.Tokens)
+}
+
+func printRegisterWebhookResponse(v *apitypes.RegisterWebhookResponse) {
+	fmt.Printf("Webhook registered:\n")
+	printWebhook(v.Webhook)
+	fmt.Printf(`  Secret: %s
+  (The secret is not shown again, keep it to verify delivery signatures)
+`, v.Secret)
+}
+
+func printListWebhooksResponse(v *apitypes.ListWebhooksResponse) {
+	fmt.Printf("Webhooks:\n")
+	for _, webhook := range v.Webhooks {
+		printWebhook(webhook)
+	}
+}
+
+func printWebhook(v apitypes.Webhook) {
+	lobbyStr := "<Server-wide>"
+	if v.LobbyId != "" {
+		lobbyStr = string(v.LobbyId)
+	}
+
+	fmt.Printf(`  Webhook ID: %s
+    URL: %s
+    Lobby: %s
+    Events:
+`, v.Id, v.Url, lobbyStr)
+	for _, kind := range v.Events {
+		fmt.Printf("      %s\n", kind)
+	}
+}
+
+func printDeleteWebhookResponse(v *apitypes.DeleteWebhookResponse) {
+	fmt.Printf("Webhook deleted\n")
+}
+
+func printListWebhookDeliveriesResponse(v *apitypes.ListWebhookDeliveriesResponse) {
+	fmt.Printf("Deliveries:\n")
+	for _, delivery := range v.Deliveries {
+		fmt.Printf(`  Delivery ID: %s
+    Event: %s
+    Status: %s
+    Attempts:
+`, delivery.Id, delivery.Event, delivery.Status)
+		for _, attempt := range delivery.Attempts {
+			result := "ok"
+			if attempt.Error != "" {
+				result = attempt.Error
+			}
+			fmt.Printf("      %s: %s\n", attempt.At.Format(time.RFC3339), result)
+		}
+	}
+}
+
+func printStreamEvent(v *apitypes.StreamEvent) {
+	fmt.Printf("%s: %s\n", v.Event, v.Data)
+}
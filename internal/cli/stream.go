@@ -0,0 +1,24 @@
+package cli
+
+import (
+	"errors"
+	"github.com/mcoot/crosswordgame-go/internal/client"
+	"io"
+)
+
+// WriteEventStream writes each event from the stream as it arrives, until the server ends the stream
+func WriteEventStream(stream *client.EventStream) error {
+	defer stream.Close()
+	for {
+		event, err := stream.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := WriteOutput(event); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// savedTokensPath is where the API tokens logged in with are kept, one for each server
+func savedTokensPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "crosswordgame", "tokens.json"), nil
+}
+
+func loadSavedTokens() (map[string]string, error) {
+	path, err := savedTokensPath()
+	if err != nil {
+		return nil, err
+	}
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := map[string]string{}
+	if err := json.Unmarshal(contents, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func writeSavedTokens(tokens map[string]string) error {
+	path, err := savedTokensPath()
+	if err != nil {
+		return err
+	}
+	contents, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	// The tokens act as the player, so only the user may read them
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, contents, 0o600)
+}
+
+// LoadSavedToken returns the token saved for the server, or "" if there is none
+func LoadSavedToken(server string) (string, error) {
+	tokens, err := loadSavedTokens()
+	if err != nil {
+		return "", err
+	}
+	return tokens[server], nil
+}
+
+func SaveToken(server string, token string) error {
+	tokens, err := loadSavedTokens()
+	if err != nil {
+		return err
+	}
+	tokens[server] = token
+	return writeSavedTokens(tokens)
+}
+
+func DeleteSavedToken(server string) error {
+	tokens, err := loadSavedTokens()
+	if err != nil {
+		return err
+	}
+	delete(tokens, server)
+	return writeSavedTokens(tokens)
+}
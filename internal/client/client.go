@@ -4,15 +4,25 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	apitokentypes "github.com/mcoot/crosswordgame-go/internal/apitoken/types"
 	"github.com/mcoot/crosswordgame-go/internal/apitypes"
+	"github.com/mcoot/crosswordgame-go/internal/backup"
+	"github.com/mcoot/crosswordgame-go/internal/events"
 	"github.com/mcoot/crosswordgame-go/internal/game/types"
 	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
 	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	webhooktypes "github.com/mcoot/crosswordgame-go/internal/webhook/types"
+	"io"
 	"net/http"
+	"sync"
 )
 
 const (
 	healthcheckPath        = "/api/v1/health"
+	loginPath              = "/api/v1/account/login"
+	logoutEverywherePath   = "/api/v1/account/logout-everywhere"
+	tokensPath             = "/api/v1/account/tokens"
+	tokenPath              = "/api/v1/account/tokens/%s"
 	createGamePath         = "/api/v1/game"
 	getGameStatePath       = "/api/v1/game/%s"
 	getPlayerStatePath     = "/api/v1/game/%s/player/%s"
@@ -21,27 +31,56 @@ const (
 	submitPlacementPath    = "/api/v1/game/%s/player/%s/place"
 
 	createLobbyPath         = "/api/v1/lobby"
+	listLobbiesPath         = "/api/v1/lobby"
 	getLobbyStatePath       = "/api/v1/lobby/%s"
 	joinLobbyPath           = "/api/v1/lobby/%s/join"
 	removeFromLobbyPath     = "/api/v1/lobby/%s/remove"
+	transferLobbyHostPath   = "/api/v1/lobby/%s/host"
+	setLobbyLockedPath      = "/api/v1/lobby/%s/lock"
+	lobbySettingsPath       = "/api/v1/lobby/%s/settings"
 	attachGameToLobbyPath   = "/api/v1/lobby/%s/attach"
 	detachGameFromLobbyPath = "/api/v1/lobby/%s/detach"
 
 	getLobbyForPlayerPath = "/api/v1/player/%s/lobby"
+
+	exportStatePath = "/api/v1/admin/export"
+	importStatePath = "/api/v1/admin/import"
+
+	lobbyWebhooksPath  = "/api/v1/lobby/%s/webhooks"
+	serverWebhooksPath = "/api/v1/admin/webhooks"
 )
 
 type Client struct {
-	client  *http.Client
-	baseUrl string
+	client     *http.Client
+	baseUrl    string
+	adminToken string
 }
 
 func NewClient(httpClient *http.Client, baseUrl string) *Client {
+	withCSRF := *httpClient
+	withCSRF.Transport = &csrfTransport{next: httpClient.Transport}
 	return &Client{
-		client:  httpClient,
+		client:  &withCSRF,
 		baseUrl: baseUrl,
 	}
 }
 
+// WithToken returns a copy of the client that acts as the player the API token belongs to
+func (c *Client) WithToken(token string) *Client {
+	clone := *c
+	httpClient := *c.client
+	httpClient.Transport = &bearerTransport{token: token, next: c.client.Transport}
+	clone.client = &httpClient
+	return &clone
+}
+
+// WithAdminToken returns a copy of the client that authenticates admin requests with the given token
+func (c *Client) WithAdminToken(adminToken string) *Client {
+	clone := *c
+	clone.adminToken = adminToken
+	return &clone
+}
+
 func (c *Client) Health() (*apitypes.HealthcheckResponse, error) {
 	resp, err := c.client.Get(c.url(healthcheckPath))
 	if err != nil {
@@ -60,6 +99,129 @@ func (c *Client) Health() (*apitypes.HealthcheckResponse, error) {
 	return &health, nil
 }
 
+// Login logs in to an account, which needs the client to have a cookie jar to keep the session in
+func (c *Client) Login(username playertypes.PlayerId, password string) (*apitypes.AccountResponse, error) {
+	body := apitypes.LoginRequest{
+		Username: username,
+		Password: password,
+	}
+	bodyJson, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.
+		Post(c.url(loginPath), "application/json", bytes.NewReader(bodyJson))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, c.parseError(resp)
+	}
+
+	var ret apitypes.AccountResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+// LogoutEverywhere ends every session the account has logged in to, leaving its API tokens working
+func (c *Client) LogoutEverywhere() (*apitypes.LogoutResponse, error) {
+	resp, err := c.client.Post(c.url(logoutEverywherePath), "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, c.parseError(resp)
+	}
+
+	var ret apitypes.LogoutResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+// CreateToken issues an API token for the account, with every scope if none are given
+func (c *Client) CreateToken(name string, scopes []apitokentypes.Scope) (*apitypes.CreateTokenResponse, error) {
+	body := apitypes.CreateTokenRequest{
+		Name:   name,
+		Scopes: scopes,
+	}
+	bodyJson, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.
+		Post(c.url(tokensPath), "application/json", bytes.NewReader(bodyJson))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 201 {
+		return nil, c.parseError(resp)
+	}
+
+	var ret apitypes.CreateTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+func (c *Client) ListTokens() (*apitypes.ListTokensResponse, error) {
+	resp, err := c.client.Get(c.url(tokensPath))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, c.parseError(resp)
+	}
+
+	var ret apitypes.ListTokensResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+func (c *Client) RevokeToken(tokenId apitokentypes.TokenId) (*apitypes.RevokeTokenResponse, error) {
+	req, err := http.NewRequest("DELETE", c.url(fmt.Sprintf(tokenPath, tokenId)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, c.parseError(resp)
+	}
+
+	var ret apitypes.RevokeTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
 func (c *Client) CreateGame(players []playertypes.PlayerId, boardDimension *int) (*apitypes.CreateGameResponse, error) {
 	body := apitypes.CreateGameRequest{
 		Players: players,
@@ -239,6 +401,26 @@ func (c *Client) CreateLobby(name string) (*apitypes.CreateLobbyResponse, error)
 	return &ret, nil
 }
 
+// ListLobbies lists the public lobbies
+func (c *Client) ListLobbies() (*apitypes.ListLobbiesResponse, error) {
+	resp, err := c.client.Get(c.url(listLobbiesPath))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, c.parseError(resp)
+	}
+
+	var ret apitypes.ListLobbiesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
 func (c *Client) GetLobbyState(lobbyId lobbytypes.LobbyId) (*apitypes.GetLobbyStateResponse, error) {
 	resp, err := c.client.Get(c.url(fmt.Sprintf(getLobbyStatePath, lobbyId)))
 	if err != nil {
@@ -258,9 +440,11 @@ func (c *Client) GetLobbyState(lobbyId lobbytypes.LobbyId) (*apitypes.GetLobbySt
 	return &ret, nil
 }
 
-func (c *Client) JoinLobby(lobbyId lobbytypes.LobbyId, playerId playertypes.PlayerId) (*apitypes.JoinLobbyResponse, error) {
+// JoinLobby joins the player to the lobby, with its password if it has one
+func (c *Client) JoinLobby(lobbyId lobbytypes.LobbyId, playerId playertypes.PlayerId, password string) (*apitypes.JoinLobbyResponse, error) {
 	body := apitypes.JoinLobbyRequest{
 		PlayerId: playerId,
+		Password: password,
 	}
 	bodyJson, err := json.Marshal(body)
 	if err != nil {
@@ -314,6 +498,90 @@ func (c *Client) RemovePlayerFromLobby(lobbyId lobbytypes.LobbyId, playerId play
 	return &ret, nil
 }
 
+func (c *Client) TransferLobbyHost(lobbyId lobbytypes.LobbyId, playerId playertypes.PlayerId) (*apitypes.TransferLobbyHostResponse, error) {
+	body := apitypes.TransferLobbyHostRequest{
+		PlayerId: playerId,
+	}
+	bodyJson, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.
+		Post(c.url(fmt.Sprintf(transferLobbyHostPath, lobbyId)), "application/json", bytes.NewReader(bodyJson))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, c.parseError(resp)
+	}
+
+	var ret apitypes.TransferLobbyHostResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+func (c *Client) SetLobbyLocked(lobbyId lobbytypes.LobbyId, locked bool) (*apitypes.SetLobbyLockedResponse, error) {
+	body := apitypes.SetLobbyLockedRequest{
+		Locked: locked,
+	}
+	bodyJson, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.
+		Post(c.url(fmt.Sprintf(setLobbyLockedPath, lobbyId)), "application/json", bytes.NewReader(bodyJson))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, c.parseError(resp)
+	}
+
+	var ret apitypes.SetLobbyLockedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+func (c *Client) UpdateLobbySettings(
+	lobbyId lobbytypes.LobbyId,
+	update apitypes.UpdateLobbySettingsRequest,
+) (*apitypes.UpdateLobbySettingsResponse, error) {
+	bodyJson, err := json.Marshal(update)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.
+		Post(c.url(fmt.Sprintf(lobbySettingsPath, lobbyId)), "application/json", bytes.NewReader(bodyJson))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, c.parseError(resp)
+	}
+
+	var ret apitypes.UpdateLobbySettingsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
 func (c *Client) AttachGameToLobby(lobbyId lobbytypes.LobbyId, gameId types.GameId) (*apitypes.AttachGameToLobbyResponse, error) {
 	body := apitypes.AttachGameToLobbyRequest{
 		GameId: gameId,
@@ -395,6 +663,245 @@ func (c *Client) GetLobbyForPlayer(playerId playertypes.PlayerId) (*apitypes.Get
 	return &ret, nil
 }
 
+// ExportState streams a dump of all server state into w
+func (c *Client) ExportState(w io.Writer) error {
+	req, err := http.NewRequest("GET", c.url(exportStatePath), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.adminToken)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return c.parseError(resp)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// ImportState uploads a dump produced by ExportState
+func (c *Client) ImportState(r io.Reader) (*apitypes.ImportStateResponse, error) {
+	req, err := http.NewRequest("POST", c.url(importStatePath), r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.adminToken)
+	req.Header.Set("Content-Type", backup.ContentType)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, c.parseError(resp)
+	}
+
+	var ret apitypes.ImportStateResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+// The webhook methods manage a lobby's webhooks, or server-wide webhooks through the admin API if lobbyId is empty
+
+func (c *Client) RegisterWebhook(
+	lobbyId lobbytypes.LobbyId,
+	url string,
+	eventKinds []events.Kind,
+) (*apitypes.RegisterWebhookResponse, error) {
+	body := apitypes.RegisterWebhookRequest{
+		Url:    url,
+		Events: eventKinds,
+	}
+	bodyJson, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := c.newWebhookRequest("POST", lobbyId, "", bytes.NewReader(bodyJson))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 201 {
+		return nil, c.parseError(resp)
+	}
+
+	var ret apitypes.RegisterWebhookResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+func (c *Client) ListWebhooks(lobbyId lobbytypes.LobbyId) (*apitypes.ListWebhooksResponse, error) {
+	req, err := c.newWebhookRequest("GET", lobbyId, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, c.parseError(resp)
+	}
+
+	var ret apitypes.ListWebhooksResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+func (c *Client) DeleteWebhook(
+	lobbyId lobbytypes.LobbyId,
+	webhookId webhooktypes.WebhookId,
+) (*apitypes.DeleteWebhookResponse, error) {
+	req, err := c.newWebhookRequest("DELETE", lobbyId, "/"+string(webhookId), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, c.parseError(resp)
+	}
+
+	var ret apitypes.DeleteWebhookResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+// GetWebhookDeliveries gets the webhook's delivery log, filtered to the given status if it is non-empty
+func (c *Client) GetWebhookDeliveries(
+	lobbyId lobbytypes.LobbyId,
+	webhookId webhooktypes.WebhookId,
+	status webhooktypes.DeliveryStatus,
+) (*apitypes.ListWebhookDeliveriesResponse, error) {
+	suffix := "/" + string(webhookId) + "/deliveries"
+	if status != "" {
+		suffix += "?status=" + string(status)
+	}
+	req, err := c.newWebhookRequest("GET", lobbyId, suffix, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, c.parseError(resp)
+	}
+
+	var ret apitypes.ListWebhookDeliveriesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+func (c *Client) newWebhookRequest(method string, lobbyId lobbytypes.LobbyId, suffix string, body io.Reader) (*http.Request, error) {
+	if lobbyId != "" {
+		return http.NewRequest(method, c.url(fmt.Sprintf(lobbyWebhooksPath, lobbyId)+suffix), body)
+	}
+
+	req, err := http.NewRequest(method, c.url(serverWebhooksPath+suffix), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.adminToken)
+	return req, nil
+}
+
+// bearerTransport authenticates requests with a token, unless they are already authenticated, e.g. as an admin
+type bearerTransport struct {
+	token string
+	next  http.RoundTripper
+}
+
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if req.Header.Get("Authorization") != "" {
+		return next.RoundTrip(req)
+	}
+	// RoundTrippers must not modify the request they are given
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return next.RoundTrip(req)
+}
+
+// csrfTransport sends back the session's CSRF token from the last response,
+// which the API needs on requests changing something when they are logged in by cookie
+type csrfTransport struct {
+	next  http.RoundTripper
+	mutex sync.Mutex
+	token string
+}
+
+func (t *csrfTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	t.mutex.Lock()
+	token := t.token
+	t.mutex.Unlock()
+	if token != "" && req.Header.Get(apitypes.CSRFHeader) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(apitypes.CSRFHeader, token)
+	}
+
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if token := resp.Header.Get(apitypes.CSRFHeader); token != "" {
+		t.mutex.Lock()
+		t.token = token
+		t.mutex.Unlock()
+	}
+	return resp, nil
+}
+
 func (c *Client) parseError(resp *http.Response) error {
 	var apiErr apitypes.ErrorResponse
 	if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil {
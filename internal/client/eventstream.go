@@ -0,0 +1,96 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/mcoot/crosswordgame-go/internal/apitypes"
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	"github.com/mcoot/crosswordgame-go/internal/game/types"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	gameEventsPath  = "/api/v1/game/%s/events"
+	lobbyEventsPath = "/api/v1/lobby/%s/events"
+)
+
+// EventStream reads events from a game or lobby event stream
+// The server is already sending events once the stream is open, so nothing that happens after is missed
+type EventStream struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+}
+
+func (c *Client) OpenGameEventStream(ctx context.Context, gameId types.GameId) (*EventStream, error) {
+	return c.openEventStream(ctx, fmt.Sprintf(gameEventsPath, gameId))
+}
+
+// OpenLobbyEventStream streams the lobby's events, along with those of the game it is running
+func (c *Client) OpenLobbyEventStream(ctx context.Context, lobbyId lobbytypes.LobbyId) (*EventStream, error) {
+	return c.openEventStream(ctx, fmt.Sprintf(lobbyEventsPath, lobbyId))
+}
+
+func (c *Client) openEventStream(ctx context.Context, path string) (*EventStream, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.url(path), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != 200 {
+		defer resp.Body.Close()
+		return nil, c.parseError(resp)
+	}
+
+	return &EventStream{
+		body:   resp.Body,
+		reader: bufio.NewReader(resp.Body),
+	}, nil
+}
+
+// Next blocks until the next event arrives
+// Returns io.EOF once the server ends the stream, or the context's error once it is cancelled
+func (s *EventStream) Next() (*apitypes.StreamEvent, error) {
+	var kind string
+	var data []string
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			// A blank line ends the event; anything without a kind was only a comment
+			if kind == "" {
+				continue
+			}
+			return &apitypes.StreamEvent{
+				Event: events.Kind(kind),
+				Data:  []byte(strings.Join(data, "\n")),
+			}, nil
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			kind = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+}
+
+func (s *EventStream) Close() error {
+	return s.body.Close()
+}
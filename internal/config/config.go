@@ -0,0 +1,306 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// Config is everything the server binary can be configured with
+type Config struct {
+	Server     ServerConfig     `yaml:"server"`
+	Log        LogConfig        `yaml:"log"`
+	Session    SessionConfig    `yaml:"session"`
+	Admin      AdminConfig      `yaml:"admin"`
+	Store      StoreConfig      `yaml:"store"`
+	Broker     BrokerConfig     `yaml:"broker"`
+	Dictionary DictionaryConfig `yaml:"dictionary"`
+	Presence   PresenceConfig   `yaml:"presence"`
+	OIDC       OIDCConfig       `yaml:"oidc"`
+	RateLimit  RateLimitConfig  `yaml:"rate_limit"`
+	Webhooks   WebhooksConfig   `yaml:"webhooks"`
+	// SchemaPath is the OpenAPI schema requests to the JSON API are validated against
+	SchemaPath string `yaml:"schema_path"`
+}
+
+type ServerConfig struct {
+	Addr string `yaml:"addr"`
+	// ReadTimeout bounds reading a whole request, including its body
+	ReadTimeout time.Duration `yaml:"read_timeout"`
+	// WriteTimeout bounds writing a response; live connections lift it for themselves
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// IdleTimeout is how long a keep-alive connection may wait for its next request
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// ShutdownTimeout is how long in-flight requests have to finish once shutdown begins
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// ProfilingAddr serves pprof if set, and should not be reachable publicly
+	ProfilingAddr string `yaml:"profiling_addr"`
+	// MetricsAddr serves Prometheus metrics at /metrics if set, and should only be reachable by the scraper
+	MetricsAddr string `yaml:"metrics_addr"`
+}
+
+type LogConfig struct {
+	// Debug logs human-readable development output, rather than JSON
+	Debug bool `yaml:"debug"`
+}
+
+type SessionConfig struct {
+	// Key signs the web session cookies, so must be shared by every replica and kept secret
+	Key string `yaml:"key"`
+	// EncryptionKey encrypts the session cookies with AES if set, so must be 16, 24 or 32 bytes
+	EncryptionKey string `yaml:"encryption_key"`
+	// PreviousKey and PreviousEncryptionKey are the keys before the last rotation,
+	// which still open older cookies while new ones are made with the current keys
+	PreviousKey           string `yaml:"previous_key"`
+	PreviousEncryptionKey string `yaml:"previous_encryption_key"`
+	// MaxAge is how long a login lasts after it is made, however active the player is
+	MaxAge time.Duration `yaml:"max_age"`
+	// IdleTimeout ends a login once the player has made no requests for this long
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// SecureCookies only sends the session cookie over HTTPS, which browsers also allow for http://localhost
+	SecureCookies bool `yaml:"secure_cookies"`
+}
+
+type AdminConfig struct {
+	// Token enables the admin endpoints (e.g. state export/import), which are disabled if it is empty
+	Token string `yaml:"token"`
+}
+
+const StoreBackendMemory = "memory"
+
+// StoreBackends lists the stores the server can keep its state in
+var StoreBackends = []string{StoreBackendMemory}
+
+type StoreConfig struct {
+	Backend string `yaml:"backend"`
+}
+
+type BrokerConfig struct {
+	// RedisURL shares events between replicas through Redis if set, otherwise they stay in process
+	RedisURL string `yaml:"redis_url"`
+}
+
+type DictionaryConfig struct {
+	// Path is the word list, one word per line, that boards are scored against
+	Path string `yaml:"path"`
+}
+
+type PresenceConfig struct {
+	// IdleAfter is how long a connected lobby member may do nothing before they are idle
+	IdleAfter time.Duration `yaml:"idle_after"`
+	// DisconnectGrace is how long a lobby member may be without a connection before they are disconnected
+	DisconnectGrace time.Duration `yaml:"disconnect_grace"`
+}
+
+type OIDCConfig struct {
+	// IssuerURL is the OpenID Connect provider players may sign in to the web UI with, which is disabled if it is empty
+	IssuerURL    string `yaml:"issuer_url"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	// RedirectURL is where the provider sends players back to, i.e. this server's /login/oidc/callback
+	RedirectURL string `yaml:"redirect_url"`
+	// ProviderName is shown on the button to sign in, e.g. "Sign in with Okta"
+	ProviderName string `yaml:"provider_name"`
+}
+
+type RateLimitConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// ClientIPHeader is where a trusted proxy in front of the server puts the client's IP, e.g. X-Forwarded-For
+	// If it is empty, clients are limited by the address they connect from
+	ClientIPHeader string `yaml:"client_ip_header"`
+	// Login covers logging in and creating players, by client IP
+	Login RateLimit `yaml:"login"`
+	// JoinLobby covers joining lobbies, which may need their passwords guessing, by client IP
+	JoinLobby RateLimit `yaml:"join_lobby"`
+	// CreateLobby, CreateGame and Move are by player
+	CreateLobby RateLimit `yaml:"create_lobby"`
+	CreateGame  RateLimit `yaml:"create_game"`
+	Move        RateLimit `yaml:"move"`
+}
+
+type WebhooksConfig struct {
+	// AllowPrivateAddresses lets webhooks post to this host and private networks, e.g. for a receiver run alongside in development
+	// Otherwise anyone able to register a webhook could use it to reach services not exposed publicly
+	AllowPrivateAddresses bool `yaml:"allow_private_addresses"`
+}
+
+// RateLimit lets Burst requests through at once, then one more every Interval
+type RateLimit struct {
+	Burst    int           `yaml:"burst"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// minSessionKeyLength is the shortest key accepted, as recommended for the cookie's HMAC
+const minSessionKeyLength = 32
+
+// encryptionKeyLengths are the key sizes for AES-128, AES-192 and AES-256
+var encryptionKeyLengths = []int{16, 24, 32}
+
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Addr:            ":8080",
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			IdleTimeout:     2 * time.Minute,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Log: LogConfig{
+			Debug: true,
+		},
+		Session: SessionConfig{
+			MaxAge:        30 * 24 * time.Hour,
+			IdleTimeout:   7 * 24 * time.Hour,
+			SecureCookies: true,
+		},
+		Store: StoreConfig{
+			Backend: StoreBackendMemory,
+		},
+		Dictionary: DictionaryConfig{
+			Path: "./data/words.txt",
+		},
+		Presence: PresenceConfig{
+			IdleAfter:       2 * time.Minute,
+			DisconnectGrace: 10 * time.Second,
+		},
+		OIDC: OIDCConfig{
+			ProviderName: "SSO",
+		},
+		// Logins and joins allow for a class of players behind one school or office IP
+		RateLimit: RateLimitConfig{
+			Enabled:     true,
+			Login:       RateLimit{Burst: 20, Interval: 10 * time.Second},
+			JoinLobby:   RateLimit{Burst: 30, Interval: 10 * time.Second},
+			CreateLobby: RateLimit{Burst: 5, Interval: time.Minute},
+			CreateGame:  RateLimit{Burst: 10, Interval: 30 * time.Second},
+			Move:        RateLimit{Burst: 20, Interval: 250 * time.Millisecond},
+		},
+		SchemaPath: "./schema/openapi.yaml",
+	}
+}
+
+// EnsureSessionKey signs sessions with a random key if none is configured, reporting whether it made one
+// Logins made with it end when the process does, and aren't shared with other replicas
+func (c *Config) EnsureSessionKey() (bool, error) {
+	if c.Session.Key != "" {
+		return false, nil
+	}
+	key := make([]byte, minSessionKeyLength)
+	if _, err := rand.Read(key); err != nil {
+		return false, fmt.Errorf("error generating session key: %w", err)
+	}
+	c.Session.Key = hex.EncodeToString(key)
+	return true, nil
+}
+
+// SessionKeyPairs returns the keys to sign and encrypt session cookies with, in pairs with the current keys first
+// Cookies are made with the first pair, and opened with whichever pair they were made with
+// An empty encryption key leaves cookies signed but unencrypted
+func (c *Config) SessionKeyPairs() [][]byte {
+	pairs := [][]byte{[]byte(c.Session.Key), optionalKey(c.Session.EncryptionKey)}
+	if c.Session.PreviousKey != "" {
+		pairs = append(pairs, []byte(c.Session.PreviousKey), optionalKey(c.Session.PreviousEncryptionKey))
+	}
+	return pairs
+}
+
+func optionalKey(key string) []byte {
+	if key == "" {
+		return nil
+	}
+	return []byte(key)
+}
+
+// Validate returns every problem with the config at once
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr is required"))
+	}
+	if c.Server.ReadTimeout < 0 || c.Server.WriteTimeout < 0 || c.Server.IdleTimeout < 0 {
+		errs = append(errs, errors.New("server timeouts must not be negative"))
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("server.shutdown_timeout must be positive"))
+	}
+
+	if c.Session.Key != "" && len(c.Session.Key) < minSessionKeyLength {
+		errs = append(errs, fmt.Errorf("session.key must be at least %d bytes", minSessionKeyLength))
+	}
+	if c.Session.PreviousKey != "" && len(c.Session.PreviousKey) < minSessionKeyLength {
+		errs = append(errs, fmt.Errorf("session.previous_key must be at least %d bytes", minSessionKeyLength))
+	}
+	if c.Session.PreviousKey == "" && c.Session.PreviousEncryptionKey != "" {
+		errs = append(errs, errors.New("session.previous_encryption_key needs session.previous_key"))
+	}
+	for name, key := range map[string]string{
+		"session.encryption_key":          c.Session.EncryptionKey,
+		"session.previous_encryption_key": c.Session.PreviousEncryptionKey,
+	} {
+		if key != "" && !slices.Contains(encryptionKeyLengths, len(key)) {
+			errs = append(errs, fmt.Errorf("%s must be 16, 24 or 32 bytes", name))
+		}
+	}
+	if c.Session.MaxAge <= 0 || c.Session.IdleTimeout <= 0 {
+		errs = append(errs, errors.New("session.max_age and session.idle_timeout must be positive"))
+	}
+
+	if !slices.Contains(StoreBackends, c.Store.Backend) {
+		errs = append(errs, fmt.Errorf("store.backend must be one of %v", StoreBackends))
+	}
+	if c.Broker.RedisURL != "" {
+		u, err := url.Parse(c.Broker.RedisURL)
+		if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") {
+			errs = append(errs, errors.New("broker.redis_url must be a redis:// or rediss:// URL"))
+		}
+	}
+	if c.Dictionary.Path == "" {
+		errs = append(errs, errors.New("dictionary.path is required"))
+	}
+	if c.SchemaPath == "" {
+		errs = append(errs, errors.New("schema_path is required"))
+	}
+	if c.Presence.IdleAfter <= 0 {
+		errs = append(errs, errors.New("presence.idle_after must be positive"))
+	}
+	if c.Presence.DisconnectGrace < 0 {
+		errs = append(errs, errors.New("presence.disconnect_grace must not be negative"))
+	}
+
+	if c.OIDC.IssuerURL != "" {
+		if !isHTTPURL(c.OIDC.IssuerURL) {
+			errs = append(errs, errors.New("oidc.issuer_url must be an http:// or https:// URL"))
+		}
+		if c.OIDC.ClientID == "" {
+			errs = append(errs, errors.New("oidc.client_id is required to sign in with OIDC"))
+		}
+		if !isHTTPURL(c.OIDC.RedirectURL) {
+			errs = append(errs, errors.New("oidc.redirect_url must be an http:// or https:// URL to sign in with OIDC"))
+		}
+	}
+
+	if c.RateLimit.Enabled {
+		for name, limit := range map[string]RateLimit{
+			"rate_limit.login":        c.RateLimit.Login,
+			"rate_limit.join_lobby":   c.RateLimit.JoinLobby,
+			"rate_limit.create_lobby": c.RateLimit.CreateLobby,
+			"rate_limit.create_game":  c.RateLimit.CreateGame,
+			"rate_limit.move":         c.RateLimit.Move,
+		} {
+			if limit.Burst <= 0 || limit.Interval <= 0 {
+				errs = append(errs, fmt.Errorf("%s burst and interval must be positive", name))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,258 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/pflag"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix starts the name of the environment variable for each setting, e.g. CWG_READ_TIMEOUT for --read-timeout
+const EnvPrefix = "CWG_"
+
+// FlagConfigFile names the optional YAML file to read, which may also be given as $CWG_CONFIG
+const FlagConfigFile = "config"
+
+// setting is a config value that can be given as a flag or environment variable, as well as in the YAML file
+type setting struct {
+	// name is the flag's name, from which the environment variable is derived
+	name  string
+	usage string
+	// field points to the setting's value, which must be a *string, *bool, *int or *time.Duration
+	field func(c *Config) any
+	// mask hides the value when the config is printed, if it is a secret
+	mask func(value string) string
+	// legacyEnv is an older environment variable still read, with lower precedence than the current one
+	legacyEnv string
+}
+
+var settings = []setting{
+	{name: "addr", usage: "address to serve on", field: func(c *Config) any { return &c.Server.Addr }},
+	{name: "read-timeout", usage: "limit on reading a request", field: func(c *Config) any { return &c.Server.ReadTimeout }},
+	{name: "write-timeout", usage: "limit on writing a response", field: func(c *Config) any { return &c.Server.WriteTimeout }},
+	{name: "idle-timeout", usage: "limit on keep-alive connections waiting for a request", field: func(c *Config) any { return &c.Server.IdleTimeout }},
+	{name: "shutdown-timeout", usage: "limit on draining requests when shutting down", field: func(c *Config) any { return &c.Server.ShutdownTimeout }},
+	{name: "profiling-addr", usage: "address to serve pprof on, if any", field: func(c *Config) any { return &c.Server.ProfilingAddr }},
+	{name: "metrics-addr", usage: "address to serve Prometheus metrics on, if any", field: func(c *Config) any { return &c.Server.MetricsAddr }},
+	{name: "debug", usage: "log for development rather than as JSON", field: func(c *Config) any { return &c.Log.Debug }},
+	{name: "session-key", usage: "key signing session cookies", field: func(c *Config) any { return &c.Session.Key }, mask: maskSecret},
+	{name: "session-encryption-key", usage: "key encrypting session cookies, if any", field: func(c *Config) any { return &c.Session.EncryptionKey }, mask: maskSecret},
+	{name: "session-previous-key", usage: "signing key before the last rotation, still accepted", field: func(c *Config) any { return &c.Session.PreviousKey }, mask: maskSecret},
+	{name: "session-previous-encryption-key", usage: "encryption key before the last rotation, still accepted", field: func(c *Config) any { return &c.Session.PreviousEncryptionKey }, mask: maskSecret},
+	{name: "session-max-age", usage: "limit on how long a login lasts", field: func(c *Config) any { return &c.Session.MaxAge }},
+	{name: "session-idle-timeout", usage: "inactivity after which a login ends", field: func(c *Config) any { return &c.Session.IdleTimeout }},
+	{name: "session-secure-cookies", usage: "only send the session cookie over HTTPS", field: func(c *Config) any { return &c.Session.SecureCookies }},
+	{name: "admin-token", usage: "token enabling the admin endpoints", field: func(c *Config) any { return &c.Admin.Token }, mask: maskSecret, legacyEnv: "ADMIN_TOKEN"},
+	{name: "store", usage: "store backend, one of " + strings.Join(StoreBackends, ", "), field: func(c *Config) any { return &c.Store.Backend }},
+	{name: "redis-url", usage: "Redis to share events between replicas through", field: func(c *Config) any { return &c.Broker.RedisURL }, mask: maskURLPassword},
+	{name: "dictionary", usage: "word list to score boards against", field: func(c *Config) any { return &c.Dictionary.Path }},
+	{name: "schema", usage: "OpenAPI schema for the JSON API", field: func(c *Config) any { return &c.SchemaPath }},
+	{name: "presence-idle-after", usage: "inactivity before a lobby member is idle", field: func(c *Config) any { return &c.Presence.IdleAfter }},
+	{name: "presence-disconnect-grace", usage: "time without a connection before a lobby member is disconnected", field: func(c *Config) any { return &c.Presence.DisconnectGrace }},
+	{name: "oidc-issuer-url", usage: "OpenID Connect provider to sign in to the web UI with, if any", field: func(c *Config) any { return &c.OIDC.IssuerURL }},
+	{name: "oidc-client-id", usage: "client ID registered with the OpenID Connect provider", field: func(c *Config) any { return &c.OIDC.ClientID }},
+	{name: "oidc-client-secret", usage: "client secret registered with the OpenID Connect provider", field: func(c *Config) any { return &c.OIDC.ClientSecret }, mask: maskSecret},
+	{name: "oidc-redirect-url", usage: "this server's /login/oidc/callback, as registered with the provider", field: func(c *Config) any { return &c.OIDC.RedirectURL }},
+	{name: "oidc-provider-name", usage: "name of the OpenID Connect provider shown to players", field: func(c *Config) any { return &c.OIDC.ProviderName }},
+	{name: "rate-limit", usage: "limit how often clients log in, join and create lobbies, create games and move", field: func(c *Config) any { return &c.RateLimit.Enabled }},
+	{name: "rate-limit-client-ip-header", usage: "header a trusted proxy puts the client's IP in, if any", field: func(c *Config) any { return &c.RateLimit.ClientIPHeader }},
+	{name: "rate-limit-login-burst", usage: "logins and signups allowed at once from an IP", field: func(c *Config) any { return &c.RateLimit.Login.Burst }},
+	{name: "rate-limit-login-interval", usage: "time for an IP to get another login", field: func(c *Config) any { return &c.RateLimit.Login.Interval }},
+	{name: "rate-limit-join-lobby-burst", usage: "lobby joins allowed at once from an IP", field: func(c *Config) any { return &c.RateLimit.JoinLobby.Burst }},
+	{name: "rate-limit-join-lobby-interval", usage: "time for an IP to get another lobby join", field: func(c *Config) any { return &c.RateLimit.JoinLobby.Interval }},
+	{name: "rate-limit-create-lobby-burst", usage: "lobbies a player may create at once", field: func(c *Config) any { return &c.RateLimit.CreateLobby.Burst }},
+	{name: "rate-limit-create-lobby-interval", usage: "time for a player to get another lobby", field: func(c *Config) any { return &c.RateLimit.CreateLobby.Interval }},
+	{name: "rate-limit-create-game-burst", usage: "games a player may create at once", field: func(c *Config) any { return &c.RateLimit.CreateGame.Burst }},
+	{name: "rate-limit-create-game-interval", usage: "time for a player to get another game", field: func(c *Config) any { return &c.RateLimit.CreateGame.Interval }},
+	{name: "rate-limit-move-burst", usage: "announcements and placements a player may make at once", field: func(c *Config) any { return &c.RateLimit.Move.Burst }},
+	{name: "rate-limit-move-interval", usage: "time for a player to get another move", field: func(c *Config) any { return &c.RateLimit.Move.Interval }},
+	{name: "webhook-allow-private-addresses", usage: "let webhooks post to this host and private networks", field: func(c *Config) any { return &c.Webhooks.AllowPrivateAddresses }},
+}
+
+func (s setting) envName() string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(s.name, "-", "_"))
+}
+
+func (s setting) get(c *Config) string {
+	switch v := s.field(c).(type) {
+	case *string:
+		return *v
+	case *bool:
+		return strconv.FormatBool(*v)
+	case *int:
+		return strconv.Itoa(*v)
+	case *time.Duration:
+		return v.String()
+	default:
+		panic(fmt.Sprintf("unsupported type %T for setting %s", v, s.name))
+	}
+}
+
+func (s setting) set(c *Config, raw string) error {
+	switch v := s.field(c).(type) {
+	case *string:
+		*v = raw
+	case *bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: must be true or false", s.name, raw)
+		}
+		*v = parsed
+	case *int:
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: must be a whole number", s.name, raw)
+		}
+		*v = parsed
+	case *time.Duration:
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: must be a duration such as 30s", s.name, raw)
+		}
+		*v = parsed
+	default:
+		panic(fmt.Sprintf("unsupported type %T for setting %s", v, s.name))
+	}
+	return nil
+}
+
+// flagValue holds a flag's raw value until the config is loaded, so flags can be applied last
+// It starts as the default, for the flag's help
+type flagValue struct {
+	raw string
+	typ string
+}
+
+func (v *flagValue) String() string {
+	return v.raw
+}
+
+func (v *flagValue) Set(raw string) error {
+	v.raw = raw
+	return nil
+}
+
+func (v *flagValue) Type() string {
+	return v.typ
+}
+
+// RegisterFlags adds a flag for every setting, along with --config for the YAML file
+func RegisterFlags(flags *pflag.FlagSet) {
+	defaults := Default()
+	flags.String(FlagConfigFile, "", "YAML config file (default: $"+EnvPrefix+"CONFIG)")
+	for _, s := range settings {
+		value := &flagValue{raw: s.get(&defaults)}
+		switch s.field(&defaults).(type) {
+		case *bool:
+			value.typ = "bool"
+		case *int:
+			value.typ = "int"
+		case *time.Duration:
+			value.typ = "duration"
+		default:
+			value.typ = "string"
+		}
+		usage := fmt.Sprintf("%s (env: %s)", s.usage, s.envName())
+		flags.Var(value, s.name, usage)
+
+		if value.typ == "bool" {
+			flags.Lookup(s.name).NoOptDefVal = "true"
+		}
+	}
+}
+
+// Load builds the config from, in increasing precedence: the defaults, the YAML file, environment variables
+// and flags registered with RegisterFlags, then validates it
+func Load(flags *pflag.FlagSet, getenv func(string) string) (*Config, error) {
+	c := Default()
+
+	path, err := flags.GetString(FlagConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		path = getenv(EnvPrefix + "CONFIG")
+	}
+	if path != "" {
+		if err := c.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		raw := getenv(s.envName())
+		if raw == "" && s.legacyEnv != "" {
+			raw = getenv(s.legacyEnv)
+		}
+		if raw == "" {
+			continue
+		}
+		if err := s.set(&c, raw); err != nil {
+			return nil, fmt.Errorf("from $%s: %w", s.envName(), err)
+		}
+	}
+
+	for _, s := range settings {
+		f := flags.Lookup(s.name)
+		if f == nil || !f.Changed {
+			continue
+		}
+		if err := s.set(&c, f.Value.String()); err != nil {
+			return nil, fmt.Errorf("from --%s: %w", s.name, err)
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config:\n%w", err)
+	}
+	return &c, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %w", err)
+	}
+	// Unknown keys are most likely typos, which would otherwise be silently ignored
+	err = yaml.NewDecoder(bytes.NewReader(data), yaml.DisallowUnknownField()).Decode(c)
+	if err != nil {
+		return fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Masked returns a copy of the config with its secrets hidden, e.g. to print it
+func (c *Config) Masked() Config {
+	masked := *c
+	for _, s := range settings {
+		if s.mask == nil {
+			continue
+		}
+		if value := s.get(&masked); value != "" {
+			_ = s.set(&masked, s.mask(value))
+		}
+	}
+	return masked
+}
+
+// YAML renders the config in the same form as the config file
+func (c Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+func maskSecret(string) string {
+	return "********"
+}
+
+func maskURLPassword(value string) string {
+	u, err := url.Parse(value)
+	if err != nil {
+		return maskSecret(value)
+	}
+	return u.Redacted()
+}
@@ -1,19 +1,51 @@
 package e2e
 
 import (
-	"github.com/gorilla/sessions"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/websocket"
 	"github.com/mcoot/crosswordgame-go/internal/api"
+	apitokentypes "github.com/mcoot/crosswordgame-go/internal/apitoken/types"
+	"github.com/mcoot/crosswordgame-go/internal/apitypes"
+	"github.com/mcoot/crosswordgame-go/internal/broker"
 	"github.com/mcoot/crosswordgame-go/internal/client"
+	"github.com/mcoot/crosswordgame-go/internal/config"
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	"github.com/mcoot/crosswordgame-go/internal/game"
 	"github.com/mcoot/crosswordgame-go/internal/game/types"
+	"github.com/mcoot/crosswordgame-go/internal/lobby"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
 	"github.com/mcoot/crosswordgame-go/internal/logging"
+	"github.com/mcoot/crosswordgame-go/internal/metrics"
 	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"github.com/mcoot/crosswordgame-go/internal/presence"
+	"github.com/mcoot/crosswordgame-go/internal/ratelimit"
+	"github.com/mcoot/crosswordgame-go/internal/sso/ssotest"
 	"github.com/mcoot/crosswordgame-go/internal/store"
+	"github.com/mcoot/crosswordgame-go/internal/webhook"
+	webhooktypes "github.com/mcoot/crosswordgame-go/internal/webhook/types"
 	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"io"
+	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
+const testAdminToken = "test-admin-token"
+
+// testSessionKey signs the test servers' session cookies, so replicas in a test share logins
+const testSessionKey = "0123456789abcdef0123456789abcdef"
+
 type CrosswordGameE2ESuite struct {
 	suite.Suite
 	server *httptest.Server
@@ -25,26 +57,72 @@ func TestCrosswordGameE2ESuite(t *testing.T) {
 }
 
 func (s *CrosswordGameE2ESuite) SetupSuite() {
+	db := store.NewInMemoryStore()
+	s.server = httptest.NewServer(newTestHandler(backgroundLifetime(), db, broker.NewInProcessBroker()))
+	// The admin token can act as any player, so tests can play every side of a game
+	s.client = client.NewClient(&http.Client{}, s.server.URL).WithToken(testAdminToken)
+}
+
+// backgroundLifetime keeps the API running for as long as the tests do
+func backgroundLifetime() api.Lifetime {
+	return api.Lifetime{Connections: context.Background(), Background: context.Background()}
+}
+
+// testConfig is the config every test server starts from, with paths relative to this package
+func testConfig() config.Config {
+	cfg := config.Default()
+	cfg.SchemaPath = "../../schema/openapi.yaml"
+	cfg.Dictionary.Path = "../../data/words.txt"
+	cfg.Admin.Token = testAdminToken
+	cfg.Session.Key = testSessionKey
+	// Test servers are plain HTTP, which the cookie jar won't send secure cookies over
+	cfg.Session.SecureCookies = false
+	// Every test client comes from the same IP, so limits are only turned on by the tests for them
+	cfg.RateLimit.Enabled = false
+	// Webhook receivers are test servers on this host
+	cfg.Webhooks.AllowPrivateAddresses = true
+	return cfg
+}
+
+// newTestHandler sets up the API as one replica sharing the given store and broker
+func newTestHandler(lifetime api.Lifetime, db *store.InMemoryStore, eventBroker broker.Broker) http.Handler {
+	cfg := testConfig()
+	return newTestHandlerWithConfig(lifetime, &cfg, db, eventBroker)
+}
+
+func newTestHandlerWithConfig(
+	lifetime api.Lifetime,
+	cfg *config.Config,
+	db *store.InMemoryStore,
+	eventBroker broker.Broker,
+) http.Handler {
+	return newTestHandlerWithMetrics(lifetime, cfg, db, eventBroker, metrics.NewMetrics())
+}
+
+func newTestHandlerWithMetrics(
+	lifetime api.Lifetime,
+	cfg *config.Config,
+	db *store.InMemoryStore,
+	eventBroker broker.Broker,
+	appMetrics *metrics.Metrics,
+) http.Handler {
 	logger, err := logging.NewLogger(true)
 	if err != nil {
 		panic(err)
 	}
-	sessionStore := sessions.NewCookieStore([]byte("test-key"))
-	db := store.NewInMemoryStore()
-	handler, err := api.SetupAPI(
-		logger,
-		db,
-		sessionStore,
-		"../../schema/openapi.yaml",
-		"../../data/words.txt",
-	)
+	handler, err := api.SetupAPI(lifetime, logger, cfg, api.Dependencies{
+		Store:        db,
+		WebhookStore: db,
+		TokenStore:   db,
+		SessionStore: api.NewSessionStore(cfg),
+		Broker:       eventBroker,
+		RateLimiter:  ratelimit.NewInMemoryLimiter(),
+		Metrics:      appMetrics,
+	})
 	if err != nil {
 		panic(err)
 	}
-
-	// Run the API as an httptest server
-	s.server = httptest.NewServer(handler)
-	s.client = client.NewClient(&http.Client{}, s.server.URL)
+	return handler
 }
 
 func (s *CrosswordGameE2ESuite) TearDownSuite() {
@@ -58,6 +136,32 @@ func (s *CrosswordGameE2ESuite) Test_Healthcheck() {
 	s.Equal("ok", resp.Status)
 }
 
+func (s *CrosswordGameE2ESuite) Test_RequestIds() {
+	// The JSON API quotes the request's ID in errors, taking it from the request if given
+	req, err := http.NewRequest("GET", s.server.URL+"/api/v1/game/no-such-game", nil)
+	s.Require().NoError(err)
+	req.Header.Set(logging.RequestIdHeader, "e2e-request-id")
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+	s.Equal(http.StatusNotFound, resp.StatusCode)
+	s.Equal("e2e-request-id", resp.Header.Get(logging.RequestIdHeader))
+	var apiErr apitypes.ErrorResponse
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&apiErr))
+	s.Equal("e2e-request-id", apiErr.RequestId)
+
+	// As does the web UI's error page, with an ID of its own otherwise
+	resp, err = http.Get(s.server.URL + "/index?join_lobby=no-such-lobby")
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+	s.Equal(http.StatusNotFound, resp.StatusCode)
+	requestId := resp.Header.Get(logging.RequestIdHeader)
+	s.NotEmpty(requestId)
+	body, err := io.ReadAll(resp.Body)
+	s.Require().NoError(err)
+	s.Contains(string(body), "Request ID: <code>"+requestId+"</code>")
+}
+
 func (s *CrosswordGameE2ESuite) Test_FullGame2x2() {
 	playerIds := []playertypes.PlayerId{
 		"player0",
@@ -267,7 +371,7 @@ func (s *CrosswordGameE2ESuite) Test_LobbyManipulation() {
 	s.NotContains(lobbyState.Players, playerIds[0])
 
 	// Attempting to add a player already in the lobby should fail
-	_, err := s.client.JoinLobby(lobbyId, playerIds[1])
+	_, err := s.client.JoinLobby(lobbyId, playerIds[1], "")
 	s.Error(err)
 
 	// Attempting to remove a player not in the lobby should fail
@@ -296,3 +400,1255 @@ func (s *CrosswordGameE2ESuite) Test_LobbyManipulation() {
 	_, err = s.client.DetachGameFromLobby(lobbyId)
 	s.Error(err)
 }
+
+func (s *CrosswordGameE2ESuite) Test_ConcurrentLobbyJoins() {
+	lobbyId := createLobby(s.T(), s.client, "racing-lobby")
+	joinLobby(s.T(), s.client, lobbyId, "racer-host")
+	maxPlayers := 5
+	_, err := s.client.UpdateLobbySettings(lobbyId, apitypes.UpdateLobbySettingsRequest{MaxPlayers: &maxPlayers})
+	s.Require().NoError(err)
+
+	// Many players race for the lobby's few remaining places
+	const racing = 20
+	joined := make(chan playertypes.PlayerId, racing)
+	var wg sync.WaitGroup
+	for i := range racing {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			playerId := playertypes.PlayerId(fmt.Sprintf("racer%d", i))
+			if _, err := s.client.JoinLobby(lobbyId, playerId, ""); err == nil {
+				joined <- playerId
+			}
+		}()
+	}
+	wg.Wait()
+	close(joined)
+
+	// Every player told they joined is in the lobby, and the lobby is no fuller than its limit
+	lobbyState := getLobbyState(s.T(), s.client, lobbyId)
+	s.Len(lobbyState.Players, maxPlayers)
+	for playerId := range joined {
+		s.Contains(lobbyState.Players, playerId)
+	}
+}
+
+func (s *CrosswordGameE2ESuite) Test_AdminExportImport() {
+	lobbyId := createLobby(s.T(), s.client, "exported-lobby")
+	joinLobby(s.T(), s.client, lobbyId, "exported-player")
+
+	// Admin endpoints require the admin token
+	var dump bytes.Buffer
+	err := s.client.ExportState(&dump)
+	s.Error(err)
+	err = s.client.WithAdminToken("wrong-token").ExportState(&dump)
+	s.Error(err)
+
+	adminClient := s.client.WithAdminToken(testAdminToken)
+	err = adminClient.ExportState(&dump)
+	s.NoError(err)
+	s.Contains(dump.String(), string(lobbyId))
+
+	// Change the lobby, then restore it from the dump
+	removePlayerFromLobby(s.T(), s.client, lobbyId, "exported-player")
+
+	resp, err := adminClient.ImportState(&dump)
+	s.NoError(err)
+	s.GreaterOrEqual(resp.Lobbies, 1)
+
+	lobbyState := getLobbyState(s.T(), s.client, lobbyId)
+	s.Equal([]playertypes.PlayerId{"exported-player"}, lobbyState.Players)
+
+	// A malformed dump is rejected
+	_, err = adminClient.ImportState(strings.NewReader("not a dump\n"))
+	s.Error(err)
+}
+
+func (s *CrosswordGameE2ESuite) Test_LobbyWebhooks() {
+	received := make(chan []byte, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+	}))
+	defer receiver.Close()
+
+	lobbyId := createLobby(s.T(), s.client, "webhook-lobby")
+	joinLobby(s.T(), s.client, lobbyId, "webhook-player")
+
+	registered, err := s.client.RegisterWebhook(lobbyId, receiver.URL, nil)
+	s.Require().NoError(err)
+	s.NotEmpty(registered.Secret)
+	s.Equal(lobbyId, registered.LobbyId)
+
+	listed, err := s.client.ListWebhooks(lobbyId)
+	s.Require().NoError(err)
+	s.Require().Len(listed.Webhooks, 1)
+	s.Equal(registered.Id, listed.Webhooks[0].Id)
+
+	// Server-wide webhooks need the admin token
+	_, err = s.client.ListWebhooks("")
+	s.Error(err)
+
+	// Starting a game in the lobby is delivered, signed with the webhook's secret
+	gameId := createGame(s.T(), s.client, []playertypes.PlayerId{"webhook-player"}, nil)
+	attachGameToLobby(s.T(), s.client, lobbyId, gameId)
+
+	var body []byte
+	select {
+	case body = <-received:
+	case <-time.After(5 * time.Second):
+		s.FailNow("webhook was not delivered")
+	}
+	var payload webhook.Payload
+	s.Require().NoError(json.Unmarshal(body, &payload))
+	s.Equal(lobby.EventGameAttached, payload.Event)
+
+	s.Eventually(func() bool {
+		deliveries, err := s.client.GetWebhookDeliveries(lobbyId, registered.Id, webhooktypes.DeliveryStatusDelivered)
+		return err == nil && len(deliveries.Deliveries) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Other lobbies cannot see or delete the webhook
+	otherLobbyId := createLobby(s.T(), s.client, "other-webhook-lobby")
+	_, err = s.client.DeleteWebhook(otherLobbyId, registered.Id)
+	s.Error(err)
+
+	_, err = s.client.DeleteWebhook(lobbyId, registered.Id)
+	s.NoError(err)
+	listed, err = s.client.ListWebhooks(lobbyId)
+	s.Require().NoError(err)
+	s.Empty(listed.Webhooks)
+}
+
+func (s *CrosswordGameE2ESuite) Test_EventStreams() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	lobbyId := createLobby(s.T(), s.client, "streamed-lobby")
+	lobbyStream, err := s.client.OpenLobbyEventStream(ctx, lobbyId)
+	s.Require().NoError(err)
+	defer lobbyStream.Close()
+
+	joinLobby(s.T(), s.client, lobbyId, "streamed-player0")
+	joinLobby(s.T(), s.client, lobbyId, "streamed-player1")
+	players := []playertypes.PlayerId{"streamed-player0", "streamed-player1"}
+	dimension := 2
+	gameId := createGame(s.T(), s.client, players, &dimension)
+
+	gameStream, err := s.client.OpenGameEventStream(ctx, gameId)
+	s.Require().NoError(err)
+	defer gameStream.Close()
+
+	attachGameToLobby(s.T(), s.client, lobbyId, gameId)
+	submitAnnouncement(s.T(), s.client, gameId, "streamed-player0", "A")
+	submitPlacement(s.T(), s.client, gameId, "streamed-player0", 0, 0)
+	submitPlacement(s.T(), s.client, gameId, "streamed-player1", 1, 1)
+
+	// The lobby stream sees the lobby's events, then those of its game once attached
+	expectedLobbyEvents := []events.Kind{
+		lobby.EventPlayerJoinedLobby,
+		lobby.EventPlayerJoinedLobby,
+		lobby.EventGameAttached,
+		game.EventLetterAnnounced,
+		game.EventLetterPlaced,
+		game.EventLetterPlaced,
+		game.EventTurnCompleted,
+	}
+	for _, kind := range expectedLobbyEvents {
+		event, err := lobbyStream.Next()
+		s.Require().NoError(err)
+		s.Equal(kind, event.Event)
+	}
+
+	// The game stream only sees the game's events
+	event, err := gameStream.Next()
+	s.Require().NoError(err)
+	s.Equal(game.EventLetterAnnounced, event.Event)
+	var announced game.LetterAnnounced
+	s.Require().NoError(json.Unmarshal(event.Data, &announced))
+	s.Equal("A", announced.Letter)
+	s.Equal(playertypes.PlayerId("streamed-player0"), announced.PlayerId)
+
+	// Placements say who placed, but not where
+	event, err = gameStream.Next()
+	s.Require().NoError(err)
+	s.Equal(game.EventLetterPlaced, event.Event)
+	s.JSONEq(`{"game_id": "`+string(gameId)+`", "player_id": "streamed-player0"}`, string(event.Data))
+
+	_, err = s.client.OpenGameEventStream(ctx, "missing-game")
+	s.Error(err)
+}
+
+func (s *CrosswordGameE2ESuite) Test_LobbyWebSocket() {
+	hostClient := webLogin(s.T(), s.server.URL, "ws-host", "")
+	lobbyId := webHostLobby(s.T(), hostClient, s.server.URL, "ws-lobby")
+	guestClient := webLogin(s.T(), s.server.URL, "ws-guest", lobbyId)
+
+	// Only logged-in players can connect, and only to their own lobby
+	_, resp, err := dialLobbyWebSocket(s.T(), &http.Client{}, s.server.URL, lobbyId)
+	s.Require().Error(err)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+	otherClient := webLogin(s.T(), s.server.URL, "ws-other", "")
+	otherLobbyId := webHostLobby(s.T(), otherClient, s.server.URL, "ws-other-lobby")
+	_, resp, err = dialLobbyWebSocket(s.T(), hostClient, s.server.URL, otherLobbyId)
+	s.Require().Error(err)
+	s.Equal(http.StatusForbidden, resp.StatusCode)
+
+	hostConn, _, err := dialLobbyWebSocket(s.T(), hostClient, s.server.URL, lobbyId)
+	s.Require().NoError(err)
+	defer hostConn.Close()
+	guestConn, _, err := dialLobbyWebSocket(s.T(), guestClient, s.server.URL, lobbyId)
+	s.Require().NoError(err)
+	defer guestConn.Close()
+
+	reply := hostConn.command(apitypes.WebSocketCommand{
+		Version: apitypes.WebSocketProtocolVersion, Id: "no-game", Type: apitypes.WebSocketCommandAnnounce, Letter: "A",
+	})
+	s.Equal(apitypes.WebSocketMessageError, reply.Type)
+	s.Equal("invalid_action", reply.Error.Kind)
+
+	webStartGame(s.T(), hostClient, s.server.URL, lobbyId, 2)
+	hostConn.awaitEvent(lobby.EventGameAttached)
+	guestConn.awaitEvent(lobby.EventGameAttached)
+	lobbyState := getLobbyState(s.T(), s.client, lobbyId)
+	hostId, guestId := lobbyState.Players[0], lobbyState.Players[1]
+
+	// Commands outside the schema are rejected without closing the connection
+	reply = hostConn.command(apitypes.WebSocketCommand{
+		Version: 2, Id: "future", Type: apitypes.WebSocketCommandAnnounce, Letter: "A",
+	})
+	s.Equal(apitypes.WebSocketMessageError, reply.Type)
+	s.Equal("unsupported_version", reply.Error.Kind)
+	reply = hostConn.command(apitypes.WebSocketCommand{
+		Version: apitypes.WebSocketProtocolVersion, Id: "no-row", Type: apitypes.WebSocketCommandPlace,
+	})
+	s.Equal(apitypes.WebSocketMessageError, reply.Type)
+
+	reply = hostConn.command(apitypes.WebSocketCommand{
+		Version: apitypes.WebSocketProtocolVersion, Id: "announce", Type: apitypes.WebSocketCommandAnnounce, Letter: "A",
+	})
+	s.Equal(apitypes.WebSocketMessageAck, reply.Type)
+	event := guestConn.awaitEvent(game.EventLetterAnnounced)
+	var announced game.LetterAnnounced
+	s.Require().NoError(json.Unmarshal(event.Data, &announced))
+	s.Equal("A", announced.Letter)
+	s.Equal(hostId, announced.PlayerId)
+
+	row, column := 0, 1
+	reply = hostConn.command(apitypes.WebSocketCommand{
+		Version: apitypes.WebSocketProtocolVersion, Id: "place", Type: apitypes.WebSocketCommandPlace, Row: &row, Column: &column,
+	})
+	s.Equal(apitypes.WebSocketMessageAck, reply.Type)
+
+	// Players see their own placements in full, but only who placed for everyone else
+	event = hostConn.awaitEvent(game.EventLetterPlaced)
+	var placed game.LetterPlaced
+	s.Require().NoError(json.Unmarshal(event.Data, &placed))
+	s.Equal(game.LetterPlaced{GameId: lobbyState.GameID, PlayerId: hostId, Letter: "A", Row: 0, Column: 1}, placed)
+	event = guestConn.awaitEvent(game.EventLetterPlaced)
+	s.JSONEq(`{"game_id": "`+string(lobbyState.GameID)+`", "player_id": "`+string(hostId)+`"}`, string(event.Data))
+
+	// Placing twice in a turn is refused by the game, as over HTTP
+	reply = hostConn.command(apitypes.WebSocketCommand{
+		Version: apitypes.WebSocketProtocolVersion, Id: "place-again", Type: apitypes.WebSocketCommandPlace, Row: &row, Column: &row,
+	})
+	s.Equal(apitypes.WebSocketMessageError, reply.Type)
+	s.Equal("invalid_action", reply.Error.Kind)
+
+	reply = guestConn.command(apitypes.WebSocketCommand{
+		Version: apitypes.WebSocketProtocolVersion, Id: "place", Type: apitypes.WebSocketCommandPlace, Row: &row, Column: &column,
+	})
+	s.Equal(apitypes.WebSocketMessageAck, reply.Type)
+	event = hostConn.awaitEvent(game.EventTurnCompleted)
+	var completed game.TurnCompleted
+	s.Require().NoError(json.Unmarshal(event.Data, &completed))
+	s.Equal(guestId, completed.CurrentAnnouncingPlayer)
+
+	gameState := getGameState(s.T(), s.client, lobbyState.GameID)
+	s.Equal(1, gameState.SquaresFilled)
+}
+
+func (s *CrosswordGameE2ESuite) Test_LobbyWebSocketWithToken() {
+	account := client.NewClient(webSignup(s.T(), s.server.URL, "ws-bot", "ws-bot-password"), s.server.URL)
+	lobbyToken, err := account.CreateToken("ws-bot-lobby", []apitokentypes.Scope{apitokentypes.ScopeLobby})
+	s.Require().NoError(err)
+	playToken, err := account.CreateToken("ws-bot-play", []apitokentypes.Scope{apitokentypes.ScopePlay})
+	s.Require().NoError(err)
+	bot := client.NewClient(&http.Client{}, s.server.URL).WithToken(lobbyToken.BearerToken)
+	lobbyId := createLobby(s.T(), bot, "ws-bot-lobby")
+
+	// Tokens need the play scope, and their player must be in the lobby
+	_, resp, err := dialLobbyWebSocketWithToken(s.T(), s.server.URL, lobbyId, "not-a-token")
+	s.Require().Error(err)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+	_, resp, err = dialLobbyWebSocketWithToken(s.T(), s.server.URL, lobbyId, playToken.BearerToken)
+	s.Require().Error(err)
+	s.Equal(http.StatusForbidden, resp.StatusCode)
+	joinLobby(s.T(), bot, lobbyId, "ws-bot")
+	_, resp, err = dialLobbyWebSocketWithToken(s.T(), s.server.URL, lobbyId, lobbyToken.BearerToken)
+	s.Require().Error(err)
+	s.Equal(http.StatusForbidden, resp.StatusCode)
+
+	conn, _, err := dialLobbyWebSocketWithToken(s.T(), s.server.URL, lobbyId, playToken.BearerToken)
+	s.Require().NoError(err)
+	defer conn.Close()
+	reply := conn.command(apitypes.WebSocketCommand{
+		Version: apitypes.WebSocketProtocolVersion, Id: "no-game", Type: apitypes.WebSocketCommandAnnounce, Letter: "A",
+	})
+	s.Equal(apitypes.WebSocketMessageError, reply.Type)
+	s.Equal("invalid_action", reply.Error.Kind)
+}
+
+func (s *CrosswordGameE2ESuite) Test_LobbyFragmentUpdates() {
+	hostClient := webLogin(s.T(), s.server.URL, "fragment-host", "")
+	lobbyId := webHostLobby(s.T(), hostClient, s.server.URL, "fragment-lobby")
+	guestClient := webLogin(s.T(), s.server.URL, "fragment-guest", lobbyId)
+
+	guestSSE, closeGuestSSE := openLobbySSE(s.T(), guestClient, s.server.URL, lobbyId)
+	defer closeGuestSSE()
+
+	// Players joining update the player list in place
+	webLogin(s.T(), s.server.URL, "fragment-latecomer", lobbyId)
+	// Presence changes also update the player list, so skip past any sent before the join
+	playerList := readSSEUntil(s.T(), guestSSE, "lobby-playerlist")
+	for !strings.Contains(playerList, "fragment-latecomer") {
+		playerList = readSSEUntil(s.T(), guestSSE, "lobby-playerlist")
+	}
+	s.Contains(playerList, `id="lobby-playerlist" hx-swap-oob="true"`)
+	s.Contains(playerList, "fragment-latecomer")
+	s.Contains(playerList, "<b>fragment-guest</b>")
+
+	// Starting a game changes the whole page, so is still a full refresh
+	webStartGame(s.T(), hostClient, s.server.URL, lobbyId, 2)
+	readSSEUntil(s.T(), guestSSE, "refresh")
+
+	resp, err := hostClient.PostForm(
+		s.server.URL+"/lobby/"+string(lobbyId)+"/announce",
+		url.Values{"announced_letter": {"Q"}},
+	)
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+
+	// The announcement updates the status line and enables the guest's own board
+	status := readSSEUntil(s.T(), guestSSE, "game-status")
+	s.Contains(status, `id="game-status" hx-swap-oob="true"`)
+	s.Contains(status, "<code>Q</code>")
+	playArea := readSSEUntil(s.T(), guestSSE, "game-playarea")
+	s.Contains(playArea, `id="game-playarea" hx-swap-oob="true"`)
+	s.Contains(playArea, "fragment-guest's board")
+	s.NotContains(playArea, "disabled")
+}
+
+func (s *CrosswordGameE2ESuite) Test_LobbyPresence() {
+	hostClient := webLogin(s.T(), s.server.URL, "presence-host", "")
+	lobbyId := webHostLobby(s.T(), hostClient, s.server.URL, "presence-lobby")
+	guestClient := webLogin(s.T(), s.server.URL, "presence-guest", lobbyId)
+
+	// Players are online while they have the lobby open
+	_, closeHostSSE := openLobbySSE(s.T(), hostClient, s.server.URL, lobbyId)
+	defer closeHostSSE()
+	guestSSE, closeGuestSSE := openLobbySSE(s.T(), guestClient, s.server.URL, lobbyId)
+	defer closeGuestSSE()
+
+	lobbyState := getLobbyState(s.T(), s.client, lobbyId)
+	s.Require().Len(lobbyState.Players, 2)
+	for _, playerId := range lobbyState.Players {
+		s.Equal(presence.StatusOnline, lobbyState.Presence[playerId].Status)
+		s.False(lobbyState.Presence[playerId].LastSeen.IsZero())
+	}
+	s.Empty(lobbyState.WaitingOn)
+
+	// The game waits on the announcing player, then on everyone to place
+	webStartGame(s.T(), hostClient, s.server.URL, lobbyId, 2)
+	readSSEUntil(s.T(), guestSSE, "refresh")
+	lobbyState = getLobbyState(s.T(), s.client, lobbyId)
+	gameState := getGameState(s.T(), s.client, lobbyState.GameID)
+	s.Equal([]playertypes.PlayerId{gameState.CurrentAnnouncingPlayer}, lobbyState.WaitingOn)
+
+	submitAnnouncement(s.T(), s.client, lobbyState.GameID, gameState.CurrentAnnouncingPlayer, "Q")
+	lobbyState = getLobbyState(s.T(), s.client, lobbyId)
+	s.ElementsMatch(gameState.Players, lobbyState.WaitingOn)
+
+	// The status pushed to the guest shows who the game is waiting on
+	status := readSSEUntil(s.T(), guestSSE, "game-status")
+	s.Contains(status, "Waiting on:")
+	s.Contains(status, "online")
+}
+
+func (s *CrosswordGameE2ESuite) Test_MultipleReplicas() {
+	redisServer := miniredis.RunT(s.T())
+	db := store.NewInMemoryStore()
+	newReplica := func() *httptest.Server {
+		eventBroker, err := broker.NewRedisBrokerFromURL("redis://" + redisServer.Addr())
+		s.Require().NoError(err)
+		server := httptest.NewServer(newTestHandler(backgroundLifetime(), db, eventBroker))
+		s.T().Cleanup(func() {
+			server.Close()
+			_ = eventBroker.Close()
+		})
+		return server
+	}
+	replicaA := newReplica()
+	replicaB := newReplica()
+
+	hostClient := webLogin(s.T(), replicaA.URL, "replica-host", "")
+	lobbyId := webHostLobby(s.T(), hostClient, replicaA.URL, "replica-lobby")
+	hostSSE, closeHostSSE := openLobbySSE(s.T(), hostClient, replicaA.URL, lobbyId)
+	defer closeHostSSE()
+
+	// A player joining through the other replica still updates the host's page
+	webLogin(s.T(), replicaB.URL, "replica-guest", lobbyId)
+	playerList := readSSEUntil(s.T(), hostSSE, "lobby-playerlist")
+	for !strings.Contains(playerList, "replica-guest") {
+		playerList = readSSEUntil(s.T(), hostSSE, "lobby-playerlist")
+	}
+
+	// As do games started there, as the session is shared between replicas
+	webStartGame(s.T(), hostClient, replicaB.URL, lobbyId, 2)
+	readSSEUntil(s.T(), hostSSE, "refresh")
+}
+
+func (s *CrosswordGameE2ESuite) Test_WebAccounts() {
+	webClient := webSignup(s.T(), s.server.URL, "Web-Account", "first-password")
+	lobbyId := webHostLobby(s.T(), webClient, s.server.URL, "account-lobby")
+
+	// Usernames are lower-cased, and can't be taken twice
+	body := webGet(s.T(), webClient, s.server.URL+"/account")
+	s.Contains(body, "Username: web-account")
+	resp, err := newWebClient(s.T()).PostForm(s.server.URL+"/account/signup", url.Values{
+		"username": {"web-account"},
+		"password": {"other-password"},
+	})
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	// Logging back in finds the player where they left off
+	resp, err = webClient.PostForm(s.server.URL+"/logout", nil)
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	resp, err = webClient.PostForm(s.server.URL+"/account/login", url.Values{
+		"username": {"web-account"},
+		"password": {"wrong-password"},
+	})
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+	resp, err = webClient.PostForm(s.server.URL+"/account/login", url.Values{
+		"username": {"Web-Account"},
+		"password": {"first-password"},
+	})
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Contains(webGet(s.T(), webClient, s.server.URL+"/index"), "/lobby/"+string(lobbyId))
+
+	otherDevice := newWebClient(s.T())
+	resp, err = otherDevice.PostForm(s.server.URL+"/account/login", url.Values{
+		"username": {"web-account"},
+		"password": {"first-password"},
+	})
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+	bot, err := client.NewClient(otherDevice, s.server.URL).CreateToken("web-account-bot", nil)
+	s.Require().NoError(err)
+
+	// Changing the password needs the current one
+	resp, err = webClient.PostForm(s.server.URL+"/account/password", url.Values{
+		"current_password": {"wrong-password"},
+		"new_password":     {"second-password"},
+	})
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+	resp, err = webClient.PostForm(s.server.URL+"/account/password", url.Values{
+		"current_password": {"first-password"},
+		"new_password":     {"second-password"},
+	})
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+	s.Equal(http.StatusOK, resp.StatusCode)
+	changedBody, err := io.ReadAll(resp.Body)
+	s.Require().NoError(err)
+	s.Contains(string(changedBody), "Password changed")
+
+	// It ends every other login and the account's API tokens, but not the session that changed it
+	s.Contains(webGet(s.T(), webClient, s.server.URL+"/index"), "Logged in as: web-account")
+	s.Contains(webGet(s.T(), otherDevice, s.server.URL+"/index"), "login-form")
+	_, err = client.NewClient(&http.Client{}, s.server.URL).WithToken(bot.BearerToken).ListTokens()
+	requireAPIError(s.T(), err, http.StatusUnauthorized)
+
+	resp, err = newWebClient(s.T()).PostForm(s.server.URL+"/account/login", url.Values{
+		"username": {"web-account"},
+		"password": {"first-password"},
+	})
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+}
+
+func (s *CrosswordGameE2ESuite) Test_JSONAccounts() {
+	apiClient := newWebClient(s.T())
+
+	resp := postJSON(s.T(), apiClient, s.server.URL, "/account/signup", apitypes.SignupRequest{
+		Username: "json-account", Password: "short",
+	}, nil)
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	var account apitypes.AccountResponse
+	resp = postJSON(s.T(), apiClient, s.server.URL, "/account/signup", apitypes.SignupRequest{
+		Username: "json-account", DisplayName: "JSON Account", Password: "first-password",
+	}, &account)
+	s.Require().Equal(http.StatusCreated, resp.StatusCode)
+	s.Equal(apitypes.AccountResponse{PlayerId: "json-account", DisplayName: "JSON Account"}, account)
+
+	// The session is shared with the web UI
+	s.Contains(webGet(s.T(), apiClient, s.server.URL+"/account"), "Display name: JSON Account")
+
+	resp = postJSON(s.T(), apiClient, s.server.URL, "/account/password", apitypes.ChangePasswordRequest{
+		CurrentPassword: "first-password", NewPassword: "second-password",
+	}, nil)
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Contains(webGet(s.T(), apiClient, s.server.URL+"/account"), "Display name: JSON Account")
+	resp = postJSON(s.T(), apiClient, s.server.URL, "/account/logout", struct{}{}, nil)
+	s.Equal(http.StatusOK, resp.StatusCode)
+	resp = postJSON(s.T(), apiClient, s.server.URL, "/account/password", apitypes.ChangePasswordRequest{
+		CurrentPassword: "second-password", NewPassword: "third-password",
+	}, nil)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+
+	resp = postJSON(s.T(), apiClient, s.server.URL, "/account/login", apitypes.LoginRequest{
+		Username: "json-account", Password: "first-password",
+	}, nil)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+	resp = postJSON(s.T(), apiClient, s.server.URL, "/account/login", apitypes.LoginRequest{
+		Username: "json-account", Password: "second-password",
+	}, &account)
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal(playertypes.PlayerId("json-account"), account.PlayerId)
+}
+
+func (s *CrosswordGameE2ESuite) Test_LogoutEverywhere() {
+	laptop := webSignup(s.T(), s.server.URL, "everywhere", "everywhere-password")
+	phone := newWebClient(s.T())
+	resp, err := phone.PostForm(s.server.URL+"/account/login", url.Values{
+		"username": {"everywhere"},
+		"password": {"everywhere-password"},
+	})
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+	bot, err := client.NewClient(phone, s.server.URL).CreateToken("everywhere-bot", nil)
+	s.Require().NoError(err)
+
+	// Logging out everywhere ends every session, but leaves API tokens working
+	s.Contains(webGet(s.T(), laptop, s.server.URL+"/account"), "Log out everywhere")
+	resp, err = laptop.PostForm(s.server.URL+"/account/logout-everywhere", nil)
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Contains(webGet(s.T(), laptop, s.server.URL+"/index"), "login-form")
+	s.Contains(webGet(s.T(), phone, s.server.URL+"/index"), "login-form")
+	botClient := client.NewClient(&http.Client{}, s.server.URL).WithToken(bot.BearerToken)
+	_, err = botClient.ListTokens()
+	s.NoError(err)
+
+	// Logins afterwards work as usual, and so can be ended over the JSON API too
+	resp, err = phone.PostForm(s.server.URL+"/account/login", url.Values{
+		"username": {"everywhere"},
+		"password": {"everywhere-password"},
+	})
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Contains(webGet(s.T(), phone, s.server.URL+"/index"), "Logged in as: everywhere")
+	_, err = botClient.LogoutEverywhere()
+	s.Require().NoError(err)
+	s.Contains(webGet(s.T(), phone, s.server.URL+"/index"), "login-form")
+
+	// Guests only have the one session
+	guest := webLogin(s.T(), s.server.URL, "everywhere-guest", "")
+	resp, err = guest.PostForm(s.server.URL+"/account/logout-everywhere", nil)
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
+func (s *CrosswordGameE2ESuite) Test_CSRFProtection() {
+	jar, err := cookiejar.New(nil)
+	s.Require().NoError(err)
+	// Without the CSRF-aware transport, this client posts forms the way another site could
+	forger := &http.Client{Jar: jar}
+	s.Contains(webGet(s.T(), forger, s.server.URL+"/index"), `name="csrf_token"`)
+
+	resp, err := forger.PostForm(s.server.URL+"/login", url.Values{"display_name": {"csrf-victim"}})
+	s.Require().NoError(err)
+	body, err := io.ReadAll(resp.Body)
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Equal(http.StatusForbidden, resp.StatusCode)
+	s.Contains(string(body), "reload it and try again")
+	s.Contains(webGet(s.T(), forger, s.server.URL+"/index"), "login-form")
+
+	// htmx requests get the error inline, in place of the element they target
+	req, err := http.NewRequest("POST", s.server.URL+"/login", strings.NewReader("display_name=csrf-victim"))
+	s.Require().NoError(err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("HX-Request", "true")
+	req.Header.Set("HX-Target", "login-form")
+	req.Header.Set("X-CSRF-Token", "not-the-token")
+	resp, err = forger.Do(req)
+	s.Require().NoError(err)
+	body, err = io.ReadAll(resp.Body)
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Equal(http.StatusForbidden, resp.StatusCode)
+	s.Contains(string(body), "cwg-error-inline")
+
+	// Logging in replaces the token, so one learnt beforehand, e.g. by planting the session cookie, is no use
+	match := csrfFieldPattern.FindStringSubmatch(webGet(s.T(), forger, s.server.URL+"/index"))
+	s.Require().NotNil(match)
+	loggedOutToken := match[1]
+	req, err = http.NewRequest("POST", s.server.URL+"/login", strings.NewReader("display_name=csrf-victim"))
+	s.Require().NoError(err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(apitypes.CSRFHeader, loggedOutToken)
+	resp, err = forger.Do(req)
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Equal(http.StatusOK, resp.StatusCode)
+	req, err = http.NewRequest("POST", s.server.URL+"/host", strings.NewReader("lobby_name=csrf-lobby"))
+	s.Require().NoError(err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(apitypes.CSRFHeader, loggedOutToken)
+	resp, err = forger.Do(req)
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Equal(http.StatusForbidden, resp.StatusCode)
+
+	// The JSON API needs the token too when the session cookie is all that logs the request in
+	webSignup(s.T(), s.server.URL, "csrf-player", "csrf-player-password")
+	jar, err = cookiejar.New(nil)
+	s.Require().NoError(err)
+	cookieClient := &http.Client{Jar: jar}
+	_, err = client.NewClient(cookieClient, s.server.URL).Login("csrf-player", "csrf-player-password")
+	s.Require().NoError(err)
+	createLobbyUrl := s.server.URL + "/api/v1/lobby"
+	resp, err = cookieClient.Post(createLobbyUrl, "application/json", strings.NewReader(`{"name": "csrf-lobby"}`))
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Equal(http.StatusForbidden, resp.StatusCode)
+
+	// Every response to the session carries its token
+	resp, err = cookieClient.Get(s.server.URL + "/api/v1/account/tokens")
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	token := resp.Header.Get(apitypes.CSRFHeader)
+	s.Require().NotEmpty(token)
+	req, err = http.NewRequest("POST", createLobbyUrl, strings.NewReader(`{"name": "csrf-lobby"}`))
+	s.Require().NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(apitypes.CSRFHeader, token)
+	resp, err = cookieClient.Do(req)
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Equal(http.StatusCreated, resp.StatusCode)
+
+	// The client sends it back by itself, having been given it when logging in
+	jar, err = cookiejar.New(nil)
+	s.Require().NoError(err)
+	cookieApiClient := client.NewClient(&http.Client{Jar: jar}, s.server.URL)
+	_, err = cookieApiClient.Login("csrf-player", "csrf-player-password")
+	s.Require().NoError(err)
+	_, err = cookieApiClient.CreateLobby("csrf-lobby")
+	s.NoError(err)
+}
+
+func (s *CrosswordGameE2ESuite) Test_RateLimiting() {
+	cfg := testConfig()
+	cfg.RateLimit.Enabled = true
+	cfg.RateLimit.Login = config.RateLimit{Burst: 2, Interval: time.Hour}
+	cfg.RateLimit.JoinLobby = config.RateLimit{Burst: 1, Interval: time.Hour}
+	cfg.RateLimit.CreateLobby = config.RateLimit{Burst: 1, Interval: time.Hour}
+	server := httptest.NewServer(newTestHandlerWithConfig(backgroundLifetime(), &cfg, store.NewInMemoryStore(), broker.NewInProcessBroker()))
+	defer server.Close()
+
+	// Logins are limited by IP, across the web UI and the JSON API, so a script can't fill the player store
+	alice := webLogin(s.T(), server.URL, "limited-alice", "")
+	bob := webLogin(s.T(), server.URL, "limited-bob", "")
+	_, err := client.NewClient(&http.Client{}, server.URL).Login("limited-alice", "guessed-password")
+	requireAPIError(s.T(), err, http.StatusTooManyRequests)
+
+	req, err := http.NewRequest("POST", server.URL+"/login", strings.NewReader("display_name=limited-mallory"))
+	s.Require().NoError(err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("HX-Request", "true")
+	req.Header.Set("HX-Target", "login-form")
+	resp, err := newWebClient(s.T()).Do(req)
+	s.Require().NoError(err)
+	body, err := io.ReadAll(resp.Body)
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Equal(http.StatusTooManyRequests, resp.StatusCode)
+	s.Equal("3600", resp.Header.Get("Retry-After"))
+	s.Contains(string(body), "cwg-error-inline")
+	s.Contains(string(body), "too many requests")
+
+	// Creating lobbies is limited by player
+	lobbyId := webHostLobby(s.T(), alice, server.URL, "limited-lobby")
+	_, err = client.NewClient(alice, server.URL).CreateLobby("another-limited-lobby")
+	requireAPIError(s.T(), err, http.StatusTooManyRequests)
+	_, err = client.NewClient(bob, server.URL).CreateLobby("bobs-limited-lobby")
+	s.NoError(err)
+
+	// Joining lobbies is limited by IP separately from logins, so lobby passwords can't be guessed quickly
+	s.NotEqual(http.StatusTooManyRequests, webPostForm(s.T(), bob, server.URL+"/join", url.Values{
+		"lobby_id":       {string(lobbyId)},
+		"lobby_password": {"guessed-password"},
+	}))
+	_, err = client.NewClient(bob, server.URL).JoinLobby(lobbyId, "limited-bob", "guessed-password")
+	requireAPIError(s.T(), err, http.StatusTooManyRequests)
+}
+
+func (s *CrosswordGameE2ESuite) Test_APITokens() {
+	anonymous := client.NewClient(&http.Client{}, s.server.URL)
+	_, err := anonymous.CreateLobby("anonymous-lobby")
+	requireAPIError(s.T(), err, http.StatusUnauthorized)
+	_, err = anonymous.WithToken("not-a.real-token").GetGameState("no-such-game")
+	requireAPIError(s.T(), err, http.StatusUnauthorized)
+
+	// Only registered players can have tokens
+	guestClient := webLogin(s.T(), s.server.URL, "token-guest", "")
+	_, err = client.NewClient(guestClient, s.server.URL).CreateToken("guest-token", nil)
+	requireAPIError(s.T(), err, http.StatusBadRequest)
+
+	// A personal token acts as its player, who hosts the lobbies they create
+	owner := issueToken(s.T(), s.server.URL, "token-owner", nil)
+	other := issueToken(s.T(), s.server.URL, "token-other", nil)
+	lobbyId := createLobby(s.T(), owner, "token-lobby")
+	s.Equal(playertypes.PlayerId("token-owner"), getLobbyState(s.T(), s.client, lobbyId).Host)
+	joinLobby(s.T(), owner, lobbyId, "token-owner")
+	_, err = owner.JoinLobby(lobbyId, "token-other", "")
+	requireAPIError(s.T(), err, http.StatusForbidden)
+	joinLobby(s.T(), other, lobbyId, "token-other")
+
+	_, err = owner.CreateGame([]playertypes.PlayerId{"someone", "else"}, nil)
+	requireAPIError(s.T(), err, http.StatusForbidden)
+	boardDim := 2
+	gameId := createGame(s.T(), owner, []playertypes.PlayerId{"token-owner", "token-other"}, &boardDim)
+
+	// Only the host runs the lobby, and only with games everyone in it plays in
+	_, err = other.AttachGameToLobby(lobbyId, gameId)
+	requireAPIError(s.T(), err, http.StatusForbidden)
+	_, err = owner.AttachGameToLobby(lobbyId, "no-such-game")
+	requireAPIError(s.T(), err, http.StatusNotFound)
+	soloGameId := createGame(s.T(), owner, []playertypes.PlayerId{"token-owner"}, &boardDim)
+	_, err = owner.AttachGameToLobby(lobbyId, soloGameId)
+	requireAPIError(s.T(), err, http.StatusBadRequest)
+	attachGameToLobby(s.T(), owner, lobbyId, gameId)
+	_, err = other.RegisterWebhook(lobbyId, "http://example.com/hook", nil)
+	requireAPIError(s.T(), err, http.StatusForbidden)
+
+	// Players only act as themselves
+	_, err = other.SubmitAnnouncement(gameId, "token-owner", "A")
+	requireAPIError(s.T(), err, http.StatusForbidden)
+	submitAnnouncement(s.T(), owner, gameId, "token-owner", "A")
+	_, err = owner.SubmitPlacement(gameId, "token-other", 0, 0)
+	requireAPIError(s.T(), err, http.StatusForbidden)
+	submitPlacement(s.T(), other, gameId, "token-other", 0, 0)
+
+	// Boards are only shown to the game's players
+	_, err = anonymous.GetPlayerState(gameId, "token-owner")
+	requireAPIError(s.T(), err, http.StatusUnauthorized)
+	s.Len(getPlayerState(s.T(), other, gameId, "token-owner").Board, boardDim)
+
+	// Bots are limited to their token's scopes
+	bot := issueToken(s.T(), s.server.URL, "token-bot", []apitokentypes.Scope{apitokentypes.ScopePlay})
+	_, err = bot.GetPlayerState(gameId, "token-owner")
+	requireAPIError(s.T(), err, http.StatusForbidden)
+	_, err = bot.CreateLobby("bot-lobby")
+	requireAPIError(s.T(), err, http.StatusForbidden)
+	_, err = bot.ListTokens()
+	requireAPIError(s.T(), err, http.StatusForbidden)
+	createGame(s.T(), bot, []playertypes.PlayerId{"token-bot"}, &boardDim)
+
+	// Games get the same board sizes over the API as in lobbies
+	botGameId := createGame(s.T(), bot, []playertypes.PlayerId{"token-bot"}, nil)
+	s.Len(getPlayerState(s.T(), bot, botGameId, "token-bot").Board, lobbytypes.DefaultBoardSize)
+	tooSmall := lobbytypes.MinBoardSize - 1
+	_, err = bot.CreateGame([]playertypes.PlayerId{"token-bot"}, &tooSmall)
+	s.ErrorContains(err, "unexpected status code 400")
+
+	// The host can remove anyone, and others only themselves
+	_, err = other.RemovePlayerFromLobby(lobbyId, "token-owner")
+	requireAPIError(s.T(), err, http.StatusForbidden)
+	removePlayerFromLobby(s.T(), owner, lobbyId, "token-other")
+
+	// Revoked tokens stop working
+	tokens, err := owner.ListTokens()
+	s.Require().NoError(err)
+	s.Require().Len(tokens.Tokens, 1)
+	s.ElementsMatch(apitokentypes.AllScopes, tokens.Tokens[0].Scopes)
+	_, err = owner.RevokeToken(tokens.Tokens[0].Id)
+	s.Require().NoError(err)
+	_, err = owner.CreateLobby("revoked-lobby")
+	requireAPIError(s.T(), err, http.StatusUnauthorized)
+}
+
+func (s *CrosswordGameE2ESuite) Test_LobbyHost() {
+	hostClient := webLogin(s.T(), s.server.URL, "Lobby Host", "")
+	lobbyId := webHostLobby(s.T(), hostClient, s.server.URL, "hosted-lobby")
+	memberClient := webLogin(s.T(), s.server.URL, "Lobby Member", lobbyId)
+	kickedClient := webLogin(s.T(), s.server.URL, "Kicked Member", lobbyId)
+	players := getLobbyState(s.T(), s.client, lobbyId).Players
+	s.Require().Len(players, 3)
+	host, member, kicked := players[0], players[1], players[2]
+	lobbyUrl := s.server.URL + "/lobby/" + string(lobbyId)
+
+	// Only the host can start and abandon games
+	hostPage := webGet(s.T(), hostClient, lobbyUrl)
+	s.Contains(hostPage, "Start game")
+	s.Contains(hostPage, `value="Kick"`)
+	memberPage := webGet(s.T(), memberClient, lobbyUrl)
+	s.Contains(memberPage, "Waiting for the host to start a game")
+	s.NotContains(memberPage, `value="Kick"`)
+	s.Equal(http.StatusForbidden, webPostForm(s.T(), memberClient, lobbyUrl+"/start", url.Values{"board_size": {"2"}}))
+	webStartGame(s.T(), hostClient, s.server.URL, lobbyId, 2)
+	s.Equal(http.StatusForbidden, webPostForm(s.T(), memberClient, lobbyUrl+"/abandon", nil))
+	s.Equal(http.StatusForbidden, webPostForm(s.T(), memberClient, lobbyUrl+"/kick", url.Values{"player_id": {string(host)}}))
+
+	// A kicked player's page is refreshed, which takes them back to the index
+	kickedSSE, closeKickedSSE := openLobbySSE(s.T(), kickedClient, s.server.URL, lobbyId)
+	defer closeKickedSSE()
+	s.Equal(http.StatusOK, webPostForm(s.T(), hostClient, lobbyUrl+"/kick", url.Values{"player_id": {string(kicked)}}))
+	readSSEUntil(s.T(), kickedSSE, "refresh")
+	s.Contains(webGet(s.T(), kickedClient, lobbyUrl), "Logged in as: Kicked Member")
+	s.NotContains(getLobbyState(s.T(), s.client, lobbyId).Players, kicked)
+
+	// Nobody can join a locked lobby
+	s.Equal(http.StatusOK, webPostForm(s.T(), hostClient, lobbyUrl+"/lock", url.Values{"locked": {"true"}}))
+	s.True(getLobbyState(s.T(), s.client, lobbyId).Locked)
+	s.Contains(webGet(s.T(), memberClient, lobbyUrl), "The lobby is locked")
+	s.Equal(http.StatusBadRequest, webPostForm(s.T(), kickedClient, s.server.URL+"/join", url.Values{"lobby_id": {string(lobbyId)}}))
+	s.Equal(http.StatusOK, webPostForm(s.T(), hostClient, lobbyUrl+"/lock", url.Values{"locked": {"false"}}))
+	s.Equal(http.StatusOK, webPostForm(s.T(), kickedClient, s.server.URL+"/join", url.Values{"lobby_id": {string(lobbyId)}}))
+
+	// Hosting can be handed over, after which the old host is an ordinary member
+	s.Equal(http.StatusOK, webPostForm(s.T(), hostClient, lobbyUrl+"/host", url.Values{"player_id": {string(member)}}))
+	s.Equal(member, getLobbyState(s.T(), s.client, lobbyId).Host)
+	s.Equal(http.StatusForbidden, webPostForm(s.T(), hostClient, lobbyUrl+"/abandon", nil))
+	s.Equal(http.StatusOK, webPostForm(s.T(), memberClient, lobbyUrl+"/abandon", nil))
+
+	// When the host leaves, hosting passes to whoever has been in the lobby longest
+	s.Equal(http.StatusOK, webPostForm(s.T(), memberClient, lobbyUrl+"/leave", nil))
+	lobbyState := getLobbyState(s.T(), s.client, lobbyId)
+	s.Equal([]playertypes.PlayerId{host, kicked}, lobbyState.Players)
+	s.Equal(host, lobbyState.Host)
+
+	// The JSON API has the same checks
+	owner := issueToken(s.T(), s.server.URL, "host-owner", nil)
+	other := issueToken(s.T(), s.server.URL, "host-other", nil)
+	latecomer := issueToken(s.T(), s.server.URL, "host-latecomer", nil)
+	apiLobbyId := createLobby(s.T(), owner, "hosted-api-lobby")
+	joinLobby(s.T(), owner, apiLobbyId, "host-owner")
+	joinLobby(s.T(), other, apiLobbyId, "host-other")
+
+	_, err := other.SetLobbyLocked(apiLobbyId, true)
+	requireAPIError(s.T(), err, http.StatusForbidden)
+	_, err = owner.SetLobbyLocked(apiLobbyId, true)
+	s.Require().NoError(err)
+	_, err = latecomer.JoinLobby(apiLobbyId, "host-latecomer", "")
+	requireAPIError(s.T(), err, http.StatusBadRequest)
+
+	_, err = other.TransferLobbyHost(apiLobbyId, "host-other")
+	requireAPIError(s.T(), err, http.StatusForbidden)
+	_, err = owner.TransferLobbyHost(apiLobbyId, "host-latecomer")
+	requireAPIError(s.T(), err, http.StatusBadRequest)
+	_, err = owner.TransferLobbyHost(apiLobbyId, "host-other")
+	s.Require().NoError(err)
+	s.Equal(playertypes.PlayerId("host-other"), getLobbyState(s.T(), s.client, apiLobbyId).Host)
+	removePlayerFromLobby(s.T(), other, apiLobbyId, "host-owner")
+}
+
+func (s *CrosswordGameE2ESuite) Test_LobbySettings() {
+	hostClient := webLogin(s.T(), s.server.URL, "Settings Host", "")
+	lobbyId := webHostLobby(s.T(), hostClient, s.server.URL, "settings-lobby")
+	lobbyUrl := s.server.URL + "/lobby/" + string(lobbyId)
+	memberClient := webLogin(s.T(), s.server.URL, "Settings Member", "")
+
+	// New lobbies are private, unlimited and have no password
+	settings := getLobbyState(s.T(), s.client, lobbyId).Settings
+	s.Equal(apitypes.LobbySettings{
+		Visibility:   lobbytypes.VisibilityPrivate,
+		GameDefaults: lobbytypes.GameOptions{BoardSize: lobbytypes.DefaultBoardSize},
+	}, settings)
+
+	// Only the host can see and change the settings
+	s.Contains(webGet(s.T(), hostClient, lobbyUrl), "lobby-settings-link")
+	s.Contains(webGet(s.T(), hostClient, lobbyUrl+"/settings"), "Save settings")
+	settingsForm := url.Values{
+		"max_players":    {"3"},
+		"visibility":     {"public"},
+		"lobby_password": {"let-me-in"},
+		"board_size":     {"3"},
+	}
+	s.Equal(http.StatusOK, webPostForm(s.T(), hostClient, lobbyUrl+"/settings", settingsForm))
+	settings = getLobbyState(s.T(), s.client, lobbyId).Settings
+	s.Equal(apitypes.LobbySettings{
+		MaxPlayers:   3,
+		Visibility:   lobbytypes.VisibilityPublic,
+		HasPassword:  true,
+		GameDefaults: lobbytypes.GameOptions{BoardSize: 3},
+	}, settings)
+	hostPage := webGet(s.T(), hostClient, lobbyUrl)
+	s.Contains(hostPage, "Public lobby, 1 of 3 players, password protected")
+	s.Contains(hostPage, `name="board_size" value="3"`)
+
+	// Games started without a board size are played on the lobby's default one
+	s.Equal(http.StatusOK, webPostForm(s.T(), hostClient, lobbyUrl+"/start", url.Values{}))
+	started := getLobbyState(s.T(), s.client, lobbyId)
+	s.Len(getPlayerState(s.T(), s.client, started.GameID, started.Host).Board, 3)
+
+	// Public lobbies are listed for players looking for one
+	s.Contains(webGet(s.T(), memberClient, s.server.URL+"/index"), "join-"+string(lobbyId)+"-form")
+	lobbies, err := s.client.ListLobbies()
+	s.Require().NoError(err)
+	s.Contains(lobbies.Lobbies, apitypes.LobbySummary{
+		LobbyId:     lobbyId,
+		Name:        "settings-lobby",
+		Host:        getLobbyState(s.T(), s.client, lobbyId).Host,
+		PlayerCount: 1,
+		Settings:    settings,
+	})
+
+	// Joining needs the password, and only while there is room
+	join := func(webClient *http.Client, password string) int {
+		return webPostForm(s.T(), webClient, s.server.URL+"/join", url.Values{
+			"lobby_id":       {string(lobbyId)},
+			"lobby_password": {password},
+		})
+	}
+	s.Equal(http.StatusForbidden, join(memberClient, ""))
+	s.Equal(http.StatusForbidden, join(memberClient, "not-it"))
+	s.Equal(http.StatusOK, join(memberClient, "let-me-in"))
+	s.Equal(http.StatusForbidden, webPostForm(s.T(), memberClient, lobbyUrl+"/settings", settingsForm))
+	resp, err := memberClient.Get(lobbyUrl + "/settings")
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Equal(http.StatusForbidden, resp.StatusCode)
+	// Invited players give the password as they log in, until the lobby is full
+	loginInvited := func(displayName string) int {
+		return webPostForm(s.T(), newWebClient(s.T()), s.server.URL+"/login?join_lobby="+string(lobbyId), url.Values{
+			"display_name":   {displayName},
+			"lobby_password": {"let-me-in"},
+		})
+	}
+	s.Equal(http.StatusOK, loginInvited("Settings Invitee"))
+	// Once it is full they are still logged in, and told why they couldn't join
+	latecomer := newWebClient(s.T())
+	resp, err = latecomer.PostForm(s.server.URL+"/login?join_lobby="+string(lobbyId), url.Values{
+		"display_name":   {"Settings Latecomer"},
+		"lobby_password": {"let-me-in"},
+	})
+	s.Require().NoError(err)
+	latecomerPage, err := io.ReadAll(resp.Body)
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal("/index", resp.Request.URL.Path)
+	s.Contains(string(latecomerPage), "Logged in as: Settings Latecomer")
+	s.Contains(string(latecomerPage), fmt.Sprintf("lobby %s is full", lobbyId))
+	s.NotContains(webGet(s.T(), latecomer, s.server.URL+"/index"), "join-refusal")
+
+	// The JSON API changes only the settings it is given
+	player := issueToken(s.T(), s.server.URL, "settings-player", nil)
+	host := issueToken(s.T(), s.server.URL, "settings-api-host", nil)
+	apiLobbyId := createLobby(s.T(), host, "settings-api-lobby")
+	joinLobby(s.T(), host, apiLobbyId, "settings-api-host")
+	_, err = player.UpdateLobbySettings(apiLobbyId, apitypes.UpdateLobbySettingsRequest{})
+	requireAPIError(s.T(), err, http.StatusForbidden)
+
+	public := lobbytypes.VisibilityPublic
+	password := "api-password"
+	updated, err := host.UpdateLobbySettings(apiLobbyId, apitypes.UpdateLobbySettingsRequest{
+		Visibility: &public,
+		Password:   &password,
+	})
+	s.Require().NoError(err)
+	s.Equal(apitypes.LobbySettings{
+		Visibility:   lobbytypes.VisibilityPublic,
+		HasPassword:  true,
+		GameDefaults: lobbytypes.GameOptions{BoardSize: lobbytypes.DefaultBoardSize},
+	}, updated.Settings)
+	_, err = player.JoinLobby(apiLobbyId, "settings-player", "wrong-password")
+	requireAPIError(s.T(), err, http.StatusForbidden)
+	_, err = player.JoinLobby(apiLobbyId, "settings-player", password)
+	s.Require().NoError(err)
+
+	tooFew := 1
+	_, err = host.UpdateLobbySettings(apiLobbyId, apitypes.UpdateLobbySettingsRequest{MaxPlayers: &tooFew})
+	requireAPIError(s.T(), err, http.StatusBadRequest)
+}
+
+func (s *CrosswordGameE2ESuite) Test_UpgradeEphemeralPlayer() {
+	hostClient := webLogin(s.T(), s.server.URL, "upgrade-host", "")
+	lobbyId := webHostLobby(s.T(), hostClient, s.server.URL, "upgrade-lobby")
+	webLogin(s.T(), s.server.URL, "upgrade-guest", lobbyId)
+	webStartGame(s.T(), hostClient, s.server.URL, lobbyId, 2)
+
+	lobbyState := getLobbyState(s.T(), s.client, lobbyId)
+	ephemeralId, guestId := lobbyState.Players[0], lobbyState.Players[1]
+	gameId := lobbyState.GameID
+	submitAnnouncement(s.T(), s.client, gameId, ephemeralId, "A")
+	submitPlacement(s.T(), s.client, gameId, ephemeralId, 0, 0)
+	submitPlacement(s.T(), s.client, gameId, guestId, 0, 0)
+	submitAnnouncement(s.T(), s.client, gameId, guestId, "B")
+	submitPlacement(s.T(), s.client, gameId, ephemeralId, 0, 1)
+
+	resp, err := hostClient.PostForm(s.server.URL+"/account/upgrade", url.Values{
+		"username": {"Upgraded-Host"},
+		"password": {"upgrade-password"},
+	})
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+
+	// The host keeps their display name, lobby and game under their new ID
+	s.Contains(webGet(s.T(), hostClient, s.server.URL+"/account"), "Display name: upgrade-host")
+	lobbyState = getLobbyState(s.T(), s.client, lobbyId)
+	s.Equal([]playertypes.PlayerId{"upgraded-host", guestId}, lobbyState.Players)
+	gameState := getGameState(s.T(), s.client, gameId)
+	s.Equal([]playertypes.PlayerId{"upgraded-host", guestId}, gameState.Players)
+	s.Equal(playertypes.PlayerId("upgraded-host"), gameState.CurrentAnnouncingPlayer)
+	s.Equal([][]string{{"A", "B"}, {"", ""}}, getPlayerState(s.T(), s.client, gameId, "upgraded-host").Board)
+	_, err = s.client.GetPlayerState(gameId, ephemeralId)
+	s.Error(err)
+
+	// The game carries on with the new ID
+	submitPlacement(s.T(), s.client, gameId, guestId, 1, 1)
+	submitAnnouncement(s.T(), s.client, gameId, "upgraded-host", "C")
+	gameState = getGameState(s.T(), s.client, gameId)
+	s.Equal(2, gameState.SquaresFilled)
+	s.Equal(guestId, gameState.CurrentAnnouncingPlayer)
+
+	// And the account can be logged back in to
+	resp, err = hostClient.PostForm(s.server.URL+"/logout", nil)
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	resp, err = hostClient.PostForm(s.server.URL+"/account/login", url.Values{
+		"username": {"upgraded-host"},
+		"password": {"upgrade-password"},
+	})
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Contains(webGet(s.T(), hostClient, s.server.URL+"/index"), "/lobby/"+string(lobbyId))
+}
+
+func (s *CrosswordGameE2ESuite) Test_Metrics() {
+	// A server of its own, so the counts are only this test's
+	appMetrics := metrics.NewMetrics()
+	cfg := testConfig()
+	server := httptest.NewServer(newTestHandlerWithMetrics(
+		backgroundLifetime(), &cfg, store.NewInMemoryStore(), broker.NewInProcessBroker(), appMetrics,
+	))
+	defer server.Close()
+	metricsServer := httptest.NewServer(api.NewMetricsHandler(appMetrics))
+	defer metricsServer.Close()
+	apiClient := client.NewClient(&http.Client{}, server.URL).WithToken(testAdminToken)
+
+	playerIds := []playertypes.PlayerId{"metrics0", "metrics1"}
+	boardDim := 2
+	gameId := createGame(s.T(), apiClient, playerIds, &boardDim)
+	for turn := 0; turn < boardDim*boardDim; turn++ {
+		submitAnnouncement(s.T(), apiClient, gameId, playerIds[turn%len(playerIds)], "a")
+		for _, playerId := range playerIds {
+			submitPlacement(s.T(), apiClient, gameId, playerId, turn/boardDim, turn%boardDim)
+		}
+	}
+	createGame(s.T(), apiClient, playerIds, &boardDim)
+
+	hostClient := webLogin(s.T(), server.URL, "metrics-host", "")
+	lobbyId := webHostLobby(s.T(), hostClient, server.URL, "metrics-lobby")
+	_, closeSSE := openLobbySSE(s.T(), hostClient, server.URL, lobbyId)
+	defer closeSSE()
+
+	// Metrics are only served on their own address, not publicly alongside the API
+	resp, err := http.Get(server.URL + "/metrics")
+	s.Require().NoError(err)
+	resp.Body.Close()
+	s.Equal(http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Get(metricsServer.URL + "/metrics")
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+	s.Equal(http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	s.Require().NoError(err)
+	exposition := string(body)
+
+	// Requests are labelled by the route they matched, not their path
+	s.Contains(exposition, `crosswordgame_http_requests_total{code="200",method="POST",route="/api/v1/game/{gameId}/player/{playerId}/place"} 8`)
+	s.Contains(exposition, `crosswordgame_http_request_duration_seconds_count{method="POST",route="/api/v1/game"} 2`)
+	s.NotContains(exposition, string(gameId))
+
+	s.Contains(exposition, `crosswordgame_games_created_total{board_size="2"} 2`)
+	s.Contains(exposition, `crosswordgame_games_finished_total{board_size="2"} 1`)
+	s.Contains(exposition, "crosswordgame_games_active 1")
+	s.Contains(exposition, `crosswordgame_turn_duration_seconds_count{board_size="2"} 4`)
+	s.Contains(exposition, `crosswordgame_game_scores_count{board_size="2"} 2`)
+
+	s.Contains(exposition, "crosswordgame_sse_connections 1")
+	s.Contains(exposition, `crosswordgame_store_operation_duration_seconds_count{operation="store_game"}`)
+	s.Contains(exposition, "crosswordgame_dictionary_load_duration_seconds ")
+}
+
+func (s *CrosswordGameE2ESuite) Test_GracefulShutdown() {
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	connectionsCtx, closeConnections := context.WithCancel(backgroundCtx)
+	defer closeConnections()
+	handler := newTestHandler(
+		api.Lifetime{Connections: connectionsCtx, Background: backgroundCtx},
+		store.NewInMemoryStore(),
+		broker.NewInProcessBroker(),
+	)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	s.Require().NoError(err)
+	serverUrl := "http://" + listener.Addr().String()
+	serveCtx, shutdown := context.WithCancel(context.Background())
+	defer shutdown()
+	served := make(chan error, 1)
+	go func() {
+		served <- api.Serve(serveCtx, zap.NewNop().Sugar(), listener, handler, config.Default().Server, closeConnections)
+	}()
+
+	hostClient := webLogin(s.T(), serverUrl, "shutdown-host", "")
+	lobbyId := webHostLobby(s.T(), hostClient, serverUrl, "shutdown-lobby")
+	sse, closeSSE := openLobbySSE(s.T(), hostClient, serverUrl, lobbyId)
+	defer closeSSE()
+	ws, _, err := dialLobbyWebSocket(s.T(), hostClient, serverUrl, lobbyId)
+	s.Require().NoError(err)
+	defer ws.Close()
+
+	shutdown()
+
+	// Live connections are told to reconnect, rather than being held open until the shutdown times out
+	var lines []string
+	for {
+		line, err := sse.ReadString('\n')
+		if err != nil {
+			s.ErrorIs(err, io.EOF)
+			break
+		}
+		lines = append(lines, strings.TrimRight(line, "\r\n"))
+	}
+	s.Contains(lines, "retry: 1000")
+
+	_, _, err = ws.conn.ReadMessage()
+	s.True(websocket.IsCloseError(err, websocket.CloseServiceRestart), "unexpected error: %v", err)
+
+	// The server waits up to 5s on connections the client dialled but never used, so allow longer than that
+	select {
+	case err := <-served:
+		s.NoError(err)
+	case <-time.After(10 * time.Second):
+		s.FailNow("server did not shut down")
+	}
+
+	// New connections are refused once the server has shut down
+	_, err = hostClient.Get(serverUrl + "/index")
+	s.Error(err)
+}
+
+func (s *CrosswordGameE2ESuite) Test_OIDCLogin() {
+	provider := ssotest.NewProvider(s.T(), "crosswordgame", "client-secret")
+	// The server's address is needed before it starts, as its callback is part of the config
+	server := httptest.NewUnstartedServer(nil)
+	serverUrl := "http://" + server.Listener.Addr().String()
+	cfg := testConfig()
+	cfg.OIDC = config.OIDCConfig{
+		IssuerURL:    provider.IssuerURL(),
+		ClientID:     provider.ClientID,
+		ClientSecret: provider.ClientSecret,
+		RedirectURL:  serverUrl + "/login/oidc/callback",
+		ProviderName: "Office SSO",
+	}
+	server.Config.Handler = newTestHandlerWithConfig(backgroundLifetime(), &cfg, store.NewInMemoryStore(), broker.NewInProcessBroker())
+	server.Start()
+	defer server.Close()
+	apiClient := client.NewClient(&http.Client{}, serverUrl).WithToken(testAdminToken)
+
+	s.Contains(webGet(s.T(), newWebClient(s.T()), serverUrl+"/index"), "Sign in with Office SSO")
+	// Servers without a provider configured don't offer it
+	s.NotContains(webGet(s.T(), newWebClient(s.T()), s.server.URL+"/index"), "/login/oidc")
+
+	// Sign-in fails if the provider denies it
+	resp, err := newWebClient(s.T()).Get(serverUrl + "/login/oidc")
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+
+	// The first sign-in creates a registered player named after the identity
+	alice := &ssotest.User{Subject: "alice-subject", PreferredUsername: "Alice.Smith", Name: "Alice Smith"}
+	provider.SetUser(alice)
+	aliceClient := newWebClient(s.T())
+	page := webGet(s.T(), aliceClient, serverUrl+"/login/oidc")
+	s.Contains(page, "Logged in as: Alice Smith")
+	s.Contains(page, "Player ID: alice-smith</p>")
+	s.Contains(webGet(s.T(), aliceClient, serverUrl+"/account"), "Your account is linked to Office SSO")
+	lobbyId := webHostLobby(s.T(), aliceClient, serverUrl, "oidc-lobby")
+
+	// A callback can't be completed twice, nor in a session which didn't start it
+	resp, err = aliceClient.Get(serverUrl + "/login/oidc/callback?state=forged&code=forged")
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+
+	// A different identity suggesting a taken username gets one of its own, and joins the lobby it was invited to
+	provider.SetUser(&ssotest.User{Subject: "other-subject", Email: "alice.smith@example.com"})
+	otherClient := newWebClient(s.T())
+	resp, err = otherClient.Get(serverUrl + "/login/oidc?join_lobby=" + string(lobbyId))
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal("/lobby/"+string(lobbyId), resp.Request.URL.Path)
+	s.ElementsMatch(
+		[]playertypes.PlayerId{"alice-smith", "alice-smith-2"},
+		getLobbyState(s.T(), apiClient, lobbyId).Players,
+	)
+
+	// Identities invited to a lobby which turns them away are still signed in, and told why
+	s.Equal(http.StatusOK, webPostForm(s.T(), aliceClient, serverUrl+"/lobby/"+string(lobbyId)+"/lock", url.Values{"locked": {"true"}}))
+	provider.SetUser(&ssotest.User{Subject: "late-subject", PreferredUsername: "late"})
+	page = webGet(s.T(), newWebClient(s.T()), serverUrl+"/login/oidc?join_lobby="+string(lobbyId))
+	s.Contains(page, "Player ID: late</p>")
+	s.Contains(page, fmt.Sprintf("lobby %s is locked", lobbyId))
+
+	// Signing in again finds the same player, even if the provider's profile changed
+	provider.SetUser(&ssotest.User{Subject: alice.Subject, PreferredUsername: "asmith", Name: "A. Smith"})
+	s.Contains(webGet(s.T(), newWebClient(s.T()), serverUrl+"/login/oidc"), "Player ID: alice-smith</p>")
+
+	// Registered players can link an identity, then sign in with it
+	carolClient := webSignup(s.T(), serverUrl, "carol", "carol-password")
+	s.Contains(webGet(s.T(), carolClient, serverUrl+"/account"), "Link your account to Office SSO")
+	provider.SetUser(&ssotest.User{Subject: "carol-subject", PreferredUsername: "someone-else"})
+	s.Contains(webGet(s.T(), carolClient, serverUrl+"/login/oidc"), "Your account is linked to Office SSO")
+	s.Contains(webGet(s.T(), newWebClient(s.T()), serverUrl+"/login/oidc"), "Player ID: carol</p>")
+
+	// An identity can only be linked to one player
+	dave := webSignup(s.T(), serverUrl, "dave", "dave-password")
+	resp, err = dave.Get(serverUrl + "/login/oidc")
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	// Guests register an account before linking one
+	guest := webLogin(s.T(), serverUrl, "guest", "")
+	resp, err = guest.Get(serverUrl + "/login/oidc")
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+}
@@ -1,13 +1,30 @@
 package e2e
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/mcoot/crosswordgame-go/internal/api/webapi/rendering"
+	apitokentypes "github.com/mcoot/crosswordgame-go/internal/apitoken/types"
 	"github.com/mcoot/crosswordgame-go/internal/apitypes"
 	"github.com/mcoot/crosswordgame-go/internal/client"
+	"github.com/mcoot/crosswordgame-go/internal/events"
 	gametypes "github.com/mcoot/crosswordgame-go/internal/game/types"
 	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
 	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func createGame(t *testing.T, client *client.Client, players []playertypes.PlayerId, boardDimension *int) gametypes.GameId {
@@ -99,7 +116,7 @@ func getLobbyState(t *testing.T, client *client.Client, lobbyId lobbytypes.Lobby
 func joinLobby(t *testing.T, client *client.Client, lobbyId lobbytypes.LobbyId, playerId playertypes.PlayerId) *apitypes.JoinLobbyResponse {
 	t.Helper()
 
-	resp, err := client.JoinLobby(lobbyId, playerId)
+	resp, err := client.JoinLobby(lobbyId, playerId, "")
 	assert.NoError(t, err)
 	return resp
 }
@@ -127,3 +144,310 @@ func detachGameFromLobby(t *testing.T, client *client.Client, lobbyId lobbytypes
 	assert.NoError(t, err)
 	return resp
 }
+
+// webLogin logs in a new player through the web UI, returning a client holding their session cookie
+func webLogin(t *testing.T, serverUrl, displayName string, lobbyToJoin lobbytypes.LobbyId) *http.Client {
+	t.Helper()
+
+	webClient := newWebClient(t)
+
+	loginUrl := serverUrl + "/login"
+	if lobbyToJoin != "" {
+		loginUrl += "?join_lobby=" + url.QueryEscape(string(lobbyToJoin))
+	}
+	resp, err := webClient.PostForm(loginUrl, url.Values{"display_name": {displayName}})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	return webClient
+}
+
+// newWebClient makes a client which keeps its session cookie between requests, as a browser would,
+// and sends the session's CSRF token with everything but reads, as the web UI's pages do
+func newWebClient(t *testing.T) *http.Client {
+	t.Helper()
+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	webClient := &http.Client{Jar: jar}
+	webClient.Transport = &csrfTransport{client: webClient}
+	return webClient
+}
+
+var csrfFieldPattern = regexp.MustCompile(`name="` + rendering.CSRFFormField + `" value="([^"]+)"`)
+
+// csrfTransport adds the session's CSRF token to requests changing something which don't already have one
+// The token is read from the index page each time, as logging in or out replaces it, which also starts the session if need be
+type csrfTransport struct {
+	client *http.Client
+}
+
+func (t *csrfTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == "GET" || req.Method == "HEAD" || req.Header.Get(apitypes.CSRFHeader) != "" {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+
+	token, err := t.getToken(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set(apitypes.CSRFHeader, token)
+	// The session may have only just started, after the post's cookies were chosen
+	req.Header.Del("Cookie")
+	for _, cookie := range t.client.Jar.Cookies(req.URL) {
+		req.AddCookie(cookie)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func (t *csrfTransport) getToken(serverUrl *url.URL) (string, error) {
+	resp, err := t.client.Get(serverUrl.Scheme + "://" + serverUrl.Host + "/index")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	match := csrfFieldPattern.FindSubmatch(body)
+	if match == nil {
+		return "", fmt.Errorf("no CSRF token on the index page")
+	}
+	return string(match[1]), nil
+}
+
+// webSignup registers an account through the web UI, returning a client logged in to it
+func webSignup(t *testing.T, serverUrl, username, password string) *http.Client {
+	t.Helper()
+
+	webClient := newWebClient(t)
+	resp, err := webClient.PostForm(serverUrl+"/account/signup", url.Values{
+		"username": {username},
+		"password": {password},
+	})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	return webClient
+}
+
+// webGet fetches a page as the given client, returning its body
+func webGet(t *testing.T, webClient *http.Client, pageUrl string) string {
+	t.Helper()
+
+	resp, err := webClient.Get(pageUrl)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+// webPostForm posts a form as the given client, returning the status code it ends up with
+func webPostForm(t *testing.T, webClient *http.Client, formUrl string, values url.Values) int {
+	t.Helper()
+
+	resp, err := webClient.PostForm(formUrl, values)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return resp.StatusCode
+}
+
+// postJSON posts body to the JSON API as the given client, decoding a successful response into respBody
+func postJSON(t *testing.T, apiClient *http.Client, serverUrl, path string, body any, respBody any) *http.Response {
+	t.Helper()
+
+	encoded, err := json.Marshal(body)
+	require.NoError(t, err)
+	resp, err := apiClient.Post(serverUrl+"/api/v1"+path, "application/json", bytes.NewReader(encoded))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 && respBody != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(respBody))
+	}
+	return resp
+}
+
+// issueToken signs up an account through the web UI, returning a client acting as it with a new API token
+func issueToken(t *testing.T, serverUrl, username string, scopes []apitokentypes.Scope) *client.Client {
+	t.Helper()
+
+	webClient := webSignup(t, serverUrl, username, username+"-password")
+	resp, err := client.NewClient(webClient, serverUrl).CreateToken(username+"-token", scopes)
+	require.NoError(t, err)
+	return client.NewClient(&http.Client{}, serverUrl).WithToken(resp.BearerToken)
+}
+
+// requireAPIError checks the JSON API rejected a request with the given status code
+func requireAPIError(t *testing.T, err error, httpCode int) {
+	t.Helper()
+
+	var apiErr *apitypes.ErrorResponse
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, httpCode, apiErr.HTTPCode)
+}
+
+// webHostLobby creates a lobby through the web UI with the logged-in player as host
+func webHostLobby(t *testing.T, webClient *http.Client, serverUrl, name string) lobbytypes.LobbyId {
+	t.Helper()
+
+	resp, err := webClient.PostForm(serverUrl+"/host", url.Values{"lobby_name": {name}})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// The host is redirected to the new lobby's page
+	lobbyId, ok := strings.CutPrefix(resp.Request.URL.Path, "/lobby/")
+	require.True(t, ok)
+	return lobbytypes.LobbyId(lobbyId)
+}
+
+func webStartGame(t *testing.T, webClient *http.Client, serverUrl string, lobbyId lobbytypes.LobbyId, boardSize int) {
+	t.Helper()
+
+	resp, err := webClient.PostForm(
+		serverUrl+"/lobby/"+string(lobbyId)+"/start",
+		url.Values{"board_size": {strconv.Itoa(boardSize)}},
+	)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+// wsTestConn is a WebSocket connection for tests, which lets them wait for messages in any order
+type wsTestConn struct {
+	t       *testing.T
+	conn    *websocket.Conn
+	skipped []apitypes.WebSocketMessage
+}
+
+// dialLobbyWebSocket connects to the lobby's WebSocket as the player logged in on webClient
+func dialLobbyWebSocket(t *testing.T, webClient *http.Client, serverUrl string, lobbyId lobbytypes.LobbyId) (*wsTestConn, *http.Response, error) {
+	t.Helper()
+
+	dialer := websocket.Dialer{Jar: webClient.Jar, HandshakeTimeout: 5 * time.Second}
+	return dialWebSocket(t, dialer, serverUrl, lobbyId, nil)
+}
+
+// dialLobbyWebSocketWithToken connects to the lobby's WebSocket as the player the API token belongs to
+func dialLobbyWebSocketWithToken(t *testing.T, serverUrl string, lobbyId lobbytypes.LobbyId, bearerToken string) (*wsTestConn, *http.Response, error) {
+	t.Helper()
+
+	dialer := websocket.Dialer{HandshakeTimeout: 5 * time.Second}
+	return dialWebSocket(t, dialer, serverUrl, lobbyId, http.Header{"Authorization": {"Bearer " + bearerToken}})
+}
+
+func dialWebSocket(
+	t *testing.T,
+	dialer websocket.Dialer,
+	serverUrl string,
+	lobbyId lobbytypes.LobbyId,
+	header http.Header,
+) (*wsTestConn, *http.Response, error) {
+	wsUrl := "ws" + strings.TrimPrefix(serverUrl, "http") + "/lobby/" + string(lobbyId) + "/ws"
+	conn, resp, err := dialer.Dial(wsUrl, header)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &wsTestConn{t: t, conn: conn}, resp, nil
+}
+
+func (c *wsTestConn) Close() {
+	_ = c.conn.Close()
+}
+
+// send sends the command as it is, without waiting for an answer
+func (c *wsTestConn) send(cmd apitypes.WebSocketCommand) {
+	c.t.Helper()
+
+	data, err := json.Marshal(cmd)
+	require.NoError(c.t, err)
+	require.NoError(c.t, c.conn.WriteMessage(websocket.TextMessage, data))
+}
+
+// await returns the first message matching, which may have arrived while awaiting an earlier one
+func (c *wsTestConn) await(matches func(msg apitypes.WebSocketMessage) bool) apitypes.WebSocketMessage {
+	c.t.Helper()
+
+	for i, msg := range c.skipped {
+		if matches(msg) {
+			c.skipped = append(c.skipped[:i], c.skipped[i+1:]...)
+			return msg
+		}
+	}
+
+	require.NoError(c.t, c.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for {
+		var msg apitypes.WebSocketMessage
+		require.NoError(c.t, c.conn.ReadJSON(&msg))
+		require.Equal(c.t, apitypes.WebSocketProtocolVersion, msg.Version)
+		if matches(msg) {
+			return msg
+		}
+		c.skipped = append(c.skipped, msg)
+	}
+}
+
+// command sends the command, returning the ack or error answering it
+func (c *wsTestConn) command(cmd apitypes.WebSocketCommand) apitypes.WebSocketMessage {
+	c.t.Helper()
+
+	c.send(cmd)
+	return c.await(func(msg apitypes.WebSocketMessage) bool {
+		return msg.Type != apitypes.WebSocketMessageEvent && msg.Id == cmd.Id
+	})
+}
+
+// awaitEvent returns the next event of the kind
+func (c *wsTestConn) awaitEvent(kind events.Kind) apitypes.WebSocketMessage {
+	c.t.Helper()
+
+	return c.await(func(msg apitypes.WebSocketMessage) bool {
+		return msg.Type == apitypes.WebSocketMessageEvent && msg.Event == kind
+	})
+}
+
+// openLobbySSE opens the lobby page's SSE connection as the player logged in on webClient
+func openLobbySSE(t *testing.T, webClient *http.Client, serverUrl string, lobbyId lobbytypes.LobbyId) (*bufio.Reader, func()) {
+	t.Helper()
+
+	resp, err := webClient.Get(serverUrl + "/lobby/" + string(lobbyId) + "/sse/refresh")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	return bufio.NewReader(resp.Body), func() { _ = resp.Body.Close() }
+}
+
+// readSSEUntil reads Server-Sent Events, returning the data of the first with the given name
+func readSSEUntil(t *testing.T, reader *bufio.Reader, name string) string {
+	t.Helper()
+
+	var event string
+	var data []string
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			if event == name {
+				return strings.Join(data, "\n")
+			}
+			event, data = "", nil
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+}
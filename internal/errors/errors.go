@@ -3,6 +3,7 @@ package errors
 import (
 	"errors"
 	"fmt"
+	"time"
 )
 
 type GameErrorKind string
@@ -12,6 +13,10 @@ const (
 	GameErrorNotFound            GameErrorKind = "not_found"
 	GameErrorInvalidAction       GameErrorKind = "invalid_action"
 	GameErrorUnexpectedGameLogic GameErrorKind = "unexpected_game_logic_error"
+	GameErrorInternal            GameErrorKind = "internal_error"
+	GameErrorUnauthorized        GameErrorKind = "unauthorized"
+	GameErrorForbidden           GameErrorKind = "forbidden"
+	GameErrorRateLimited         GameErrorKind = "rate_limited"
 )
 
 type GameError interface {
@@ -37,6 +42,11 @@ func IsNotFoundError(err error) bool {
 	return ok && ge.Kind() == GameErrorNotFound
 }
 
+func IsForbiddenError(err error) bool {
+	ge, ok := AsGameError(err)
+	return ok && ge.Kind() == GameErrorForbidden
+}
+
 type InvalidInputError struct {
 	ErrMessage string
 }
@@ -124,3 +134,87 @@ func (e *UnexpectedGameLogicError) Message() string {
 func (e *UnexpectedGameLogicError) Error() string {
 	return e.Message()
 }
+
+// UnauthorizedError is returned when the caller has not proven who they are, e.g. by giving the wrong password
+type UnauthorizedError struct {
+	Reason string
+}
+
+func (e *UnauthorizedError) HTTPCode() int {
+	return 401
+}
+
+func (e *UnauthorizedError) Kind() GameErrorKind {
+	return GameErrorUnauthorized
+}
+
+func (e *UnauthorizedError) Message() string {
+	return e.Reason
+}
+
+func (e *UnauthorizedError) Error() string {
+	return e.Message()
+}
+
+// ForbiddenError is returned when the caller is known, but may not do what they asked, e.g. act as another player
+type ForbiddenError struct {
+	Reason string
+}
+
+func (e *ForbiddenError) HTTPCode() int {
+	return 403
+}
+
+func (e *ForbiddenError) Kind() GameErrorKind {
+	return GameErrorForbidden
+}
+
+func (e *ForbiddenError) Message() string {
+	return e.Reason
+}
+
+func (e *ForbiddenError) Error() string {
+	return e.Message()
+}
+
+// RateLimitedError is returned when the caller has made too many requests of a kind, and must wait to make another
+type RateLimitedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitedError) HTTPCode() int {
+	return 429
+}
+
+func (e *RateLimitedError) Kind() GameErrorKind {
+	return GameErrorRateLimited
+}
+
+func (e *RateLimitedError) Message() string {
+	return fmt.Sprintf("too many requests, so try again in %s", e.RetryAfter.Round(time.Second))
+}
+
+func (e *RateLimitedError) Error() string {
+	return e.Message()
+}
+
+// InternalError is a failure of the server itself, e.g. a bug, rather than anything the caller did
+type InternalError struct {
+	ErrMessage string
+}
+
+func (e *InternalError) HTTPCode() int {
+	return 500
+}
+
+func (e *InternalError) Kind() GameErrorKind {
+	return GameErrorInternal
+}
+
+func (e *InternalError) Message() string {
+	return e.ErrMessage
+}
+
+func (e *InternalError) Error() string {
+	return e.Message()
+}
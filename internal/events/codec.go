@@ -0,0 +1,56 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Codec serialises events to JSON and back, e.g. to share them between server replicas
+// Only kinds registered with their payload type can be decoded
+type Codec struct {
+	decoders map[Kind]func(data json.RawMessage) (Event, error)
+}
+
+func NewCodec() *Codec {
+	return &Codec{
+		decoders: make(map[Kind]func(data json.RawMessage) (Event, error)),
+	}
+}
+
+// Register lets the codec decode events of the given kinds as TypedEvent[T]
+func Register[T any](c *Codec, kinds ...Kind) {
+	for _, kind := range kinds {
+		c.decoders[kind] = func(data json.RawMessage) (Event, error) {
+			var payload T
+			if err := json.Unmarshal(data, &payload); err != nil {
+				return nil, err
+			}
+			return NewTypedEvent(kind, payload), nil
+		}
+	}
+}
+
+type encodedEvent struct {
+	Kind Kind            `json:"kind"`
+	Data json.RawMessage `json:"data"`
+}
+
+func (c *Codec) Encode(event Event) ([]byte, error) {
+	data, err := json.Marshal(event.Payload())
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(encodedEvent{Kind: event.Kind(), Data: data})
+}
+
+func (c *Codec) Decode(data []byte) (Event, error) {
+	var encoded encodedEvent
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return nil, err
+	}
+	decode, ok := c.decoders[encoded.Kind]
+	if !ok {
+		return nil, fmt.Errorf("unregistered event kind %q", encoded.Kind)
+	}
+	return decode(encoded.Data)
+}
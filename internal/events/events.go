@@ -1,15 +1,21 @@
 package events
 
-import "sync"
-
-// TODO: Test this in the abstract
-// TODO: Realistically, can't use this without
-// 		 rearchitecting game logic to be in a separate routine, at the least
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+)
 
 type Kind string
 
+// AnyKind subscribes to every kind of event
+const AnyKind Kind = "*"
+
 type Event interface {
 	Kind() Kind
+	// Payload is the event's data, for consumers handling events generically e.g. to serialise them
+	Payload() any
 }
 
 type TypedEvent[T any] struct {
@@ -17,51 +23,181 @@ type TypedEvent[T any] struct {
 	Data T
 }
 
+func NewTypedEvent[T any](kind Kind, data T) TypedEvent[T] {
+	return TypedEvent[T]{
+		kind: kind,
+		Data: data,
+	}
+}
+
 func (e TypedEvent[T]) Kind() Kind {
 	return e.kind
 }
 
+func (e TypedEvent[T]) Payload() any {
+	return e.Data
+}
+
+// Publisher is anything events can be published to
+type Publisher interface {
+	Publish(event Event)
+}
+
+// EventBuffer holds published events until they are released to another publisher
+// e.g. so events from a store transaction are only seen once it commits
+type EventBuffer struct {
+	events []Event
+}
+
+func NewEventBuffer() *EventBuffer {
+	return &EventBuffer{}
+}
+
+func (b *EventBuffer) Publish(event Event) {
+	b.events = append(b.events, event)
+}
+
+// PublishTo releases the buffered events in the order they were published
+func (b *EventBuffer) PublishTo(publisher Publisher) {
+	for _, event := range b.events {
+		publisher.Publish(event)
+	}
+	b.events = nil
+}
+
+// OverflowPolicy decides what happens when an event is published to a subscriber whose queue is full
+type OverflowPolicy int
+
+const (
+	// DropOldest discards the longest-queued event to make room for the new one
+	DropOldest OverflowPolicy = iota
+	// DropNewest discards the new event, keeping the queue as it is
+	DropNewest
+	// Disconnect unsubscribes the subscriber, closing its channel
+	Disconnect
+)
+
+type BusConfig struct {
+	// QueueSize is the number of events buffered for each subscriber
+	QueueSize      int
+	OverflowPolicy OverflowPolicy
+}
+
+var DefaultBusConfig = BusConfig{
+	QueueSize:      256,
+	OverflowPolicy: DropOldest,
+}
+
+// ErrDisconnected is returned by EventConsumer.Run when the bus disconnects a consumer that fell behind
+var ErrDisconnected = errors.New("subscriber disconnected by event bus")
+
+// EventBus fans published events out to subscribers
+// Publishing never blocks: each subscriber has its own queue, and the bus's overflow policy
+// applies when a subscriber is not keeping up
 type EventBus struct {
-	subscribers map[Kind][]chan Event
+	config      BusConfig
+	subscribers []*Subscription
 	mutex       *sync.Mutex
 }
 
 func NewEventBus() *EventBus {
+	return NewEventBusWithConfig(DefaultBusConfig)
+}
+
+func NewEventBusWithConfig(config BusConfig) *EventBus {
 	return &EventBus{
-		subscribers: make(map[Kind][]chan Event),
-		mutex:       &sync.Mutex{},
+		config: config,
+		mutex:  &sync.Mutex{},
 	}
 }
 
-func (b *EventBus) Subscribe(kind Kind) chan Event {
+type Subscription struct {
+	kinds        []Kind
+	events       chan Event
+	disconnected bool
+}
+
+// Events is closed once the subscription ends, either by Unsubscribe or by the bus disconnecting it
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Disconnected reports whether the bus ended the subscription due to overflow
+// Only meaningful once Events has been closed
+func (s *Subscription) Disconnected() bool {
+	return s.disconnected
+}
+
+func (s *Subscription) matches(kind Kind) bool {
+	return slices.Contains(s.kinds, AnyKind) || slices.Contains(s.kinds, kind)
+}
+
+// Subscribe to events of the given kinds, or every event if AnyKind is included
+// Events of all the kinds are delivered on a single channel, in the order they were published
+func (b *EventBus) Subscribe(kinds ...Kind) *Subscription {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
-	ch := make(chan Event)
-	b.subscribers[kind] = append(b.subscribers[kind], ch)
-	return ch
+	sub := &Subscription{
+		kinds:  kinds,
+		events: make(chan Event, b.config.QueueSize),
+	}
+	b.subscribers = append(b.subscribers, sub)
+	return sub
 }
 
-func (b *EventBus) Unsubscribe(kind Kind, ch chan Event) {
+// Unsubscribe ends the subscription and closes its channel
+// Safe to call more than once, including after the bus has disconnected the subscriber
+func (b *EventBus) Unsubscribe(sub *Subscription) {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
-	subs := b.subscribers[kind]
-	for i, sub := range subs {
-		if sub == ch {
-			b.subscribers[kind] = append(subs[:i], subs[i+1:]...)
-			close(ch)
-			return
-		}
-	}
+	b.remove(sub)
 }
 
 func (b *EventBus) Publish(event Event) {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
-	for _, ch := range b.subscribers[event.Kind()] {
-		ch <- event
+	for _, sub := range slices.Clone(b.subscribers) {
+		if sub.matches(event.Kind()) {
+			b.deliver(sub, event)
+		}
 	}
 }
 
+func (b *EventBus) deliver(sub *Subscription, event Event) {
+	select {
+	case sub.events <- event:
+		return
+	default:
+	}
+
+	switch b.config.OverflowPolicy {
+	case DropOldest:
+		select {
+		case <-sub.events:
+		default:
+		}
+		// Only publishers send, and they hold the mutex, so there is now room
+		select {
+		case sub.events <- event:
+		default:
+		}
+	case DropNewest:
+	case Disconnect:
+		sub.disconnected = true
+		b.remove(sub)
+	}
+}
+
+// remove must be called with the mutex held
+func (b *EventBus) remove(sub *Subscription) {
+	i := slices.Index(b.subscribers, sub)
+	if i < 0 {
+		return
+	}
+	b.subscribers = slices.Delete(b.subscribers, i, i+1)
+	close(sub.events)
+}
+
 type EventConsumer struct {
 	bus   *EventBus
 	kinds []Kind
@@ -78,24 +214,25 @@ func NewEventConsumer(bus *EventBus, kinds ...Kind) *EventConsumer {
 // or false if the consumer should unsubscribe
 type EventHandler func(e Event) bool
 
-// Run subscribes to the consumer's event kinds, and blocks while processing events for them
-// terminates when the handler for all event kinds returns false
-func (c *EventConsumer) Run(f EventHandler) {
-	wg := sync.WaitGroup{}
-	for _, kind := range c.kinds {
-		ch := c.bus.Subscribe(kind)
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for event := range ch {
-				if !f(event) {
-					c.bus.Unsubscribe(kind, ch)
-					return
-				}
+// Run subscribes to the consumer's event kinds, and blocks while processing events for them one at a time
+// Returns nil once the handler returns false, the context's error once it is done,
+// or ErrDisconnected if the bus dropped the consumer for falling behind
+func (c *EventConsumer) Run(ctx context.Context, f EventHandler) error {
+	sub := c.bus.Subscribe(c.kinds...)
+	defer c.bus.Unsubscribe(sub)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-sub.Events():
+			if !ok {
+				return ErrDisconnected
+			}
+			if !f(event) {
+				return nil
 			}
-		}()
+		}
 	}
-	wg.Wait()
 }
 
 type TypedEventHandler[T any] func(e TypedEvent[T]) bool
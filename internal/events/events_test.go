@@ -0,0 +1,294 @@
+package events
+
+import (
+	"context"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+const (
+	kindA Kind = "test.a"
+	kindB Kind = "test.b"
+)
+
+type EventsSuite struct {
+	suite.Suite
+}
+
+func TestEventsSuite(t *testing.T) {
+	suite.Run(t, new(EventsSuite))
+}
+
+func (s *EventsSuite) newBus(queueSize int, policy OverflowPolicy) *EventBus {
+	return NewEventBusWithConfig(BusConfig{
+		QueueSize:      queueSize,
+		OverflowPolicy: policy,
+	})
+}
+
+func (s *EventsSuite) receiveAll(sub *Subscription) []int {
+	var received []int
+	for {
+		select {
+		case e, ok := <-sub.Events():
+			if !ok {
+				return received
+			}
+			received = append(received, e.(TypedEvent[int]).Data)
+		default:
+			return received
+		}
+	}
+}
+
+func (s *EventsSuite) runInBackground(consumer *EventConsumer, ctx context.Context, f EventHandler) chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- consumer.Run(ctx, f)
+	}()
+	return result
+}
+
+// awaitSubscribers waits for consumers started in the background to subscribe
+func (s *EventsSuite) awaitSubscribers(bus *EventBus, count int) {
+	s.Eventually(func() bool {
+		bus.mutex.Lock()
+		defer bus.mutex.Unlock()
+		return len(bus.subscribers) == count
+	}, 5*time.Second, time.Millisecond)
+}
+
+func (s *EventsSuite) awaitResult(result chan error) error {
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(5 * time.Second):
+		s.FailNow("timed out waiting for consumer to stop")
+		return nil
+	}
+}
+
+func (s *EventsSuite) TestSubscribersOnlyReceiveTheirKinds() {
+	bus := NewEventBus()
+	subA := bus.Subscribe(kindA)
+	subAny := bus.Subscribe(AnyKind)
+
+	bus.Publish(NewTypedEvent(kindA, 1))
+	bus.Publish(NewTypedEvent(kindB, 2))
+	bus.Publish(NewTypedEvent(kindA, 3))
+
+	s.Equal([]int{1, 3}, s.receiveAll(subA))
+	s.Equal([]int{1, 2, 3}, s.receiveAll(subAny))
+}
+
+func (s *EventsSuite) TestPublishDoesNotBlockOnSlowSubscriber() {
+	bus := s.newBus(1, DropNewest)
+	bus.Subscribe(kindA)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			bus.Publish(NewTypedEvent(kindA, i))
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		s.FailNow("publish blocked on a full subscriber")
+	}
+}
+
+func (s *EventsSuite) TestDropOldestKeepsNewestEvents() {
+	bus := s.newBus(2, DropOldest)
+	sub := bus.Subscribe(kindA)
+
+	for i := 0; i < 5; i++ {
+		bus.Publish(NewTypedEvent(kindA, i))
+	}
+
+	s.Equal([]int{3, 4}, s.receiveAll(sub))
+}
+
+func (s *EventsSuite) TestDropNewestKeepsOldestEvents() {
+	bus := s.newBus(2, DropNewest)
+	sub := bus.Subscribe(kindA)
+
+	for i := 0; i < 5; i++ {
+		bus.Publish(NewTypedEvent(kindA, i))
+	}
+
+	s.Equal([]int{0, 1}, s.receiveAll(sub))
+}
+
+func (s *EventsSuite) TestDisconnectClosesOverflowingSubscriber() {
+	bus := s.newBus(2, Disconnect)
+	slow := bus.Subscribe(kindA)
+	other := bus.Subscribe(kindA)
+
+	bus.Publish(NewTypedEvent(kindA, 0))
+	bus.Publish(NewTypedEvent(kindA, 1))
+	s.Equal([]int{0, 1}, s.receiveAll(other))
+	bus.Publish(NewTypedEvent(kindA, 2))
+
+	// The queued events are still delivered before the channel is closed
+	s.Equal([]int{0, 1}, s.receiveAll(slow))
+	s.True(slow.Disconnected())
+
+	// The subscriber keeping up is unaffected
+	bus.Publish(NewTypedEvent(kindA, 3))
+	s.Equal([]int{2, 3}, s.receiveAll(other))
+	s.False(other.Disconnected())
+}
+
+func (s *EventsSuite) TestUnsubscribeIsIdempotent() {
+	bus := s.newBus(1, Disconnect)
+	sub := bus.Subscribe(kindA)
+	bus.Publish(NewTypedEvent(kindA, 0))
+	bus.Publish(NewTypedEvent(kindA, 1))
+
+	s.True(sub.Disconnected())
+	bus.Unsubscribe(sub)
+	bus.Unsubscribe(sub)
+	s.Equal([]int{0}, s.receiveAll(sub))
+}
+
+func (s *EventsSuite) TestConsumerStopsWhenHandlerReturnsFalse() {
+	bus := NewEventBus()
+	var handled []int
+	result := s.runInBackground(NewEventConsumer(bus, kindA, kindB), context.Background(), func(e Event) bool {
+		handled = append(handled, e.(TypedEvent[int]).Data)
+		return len(handled) < 2
+	})
+	s.awaitSubscribers(bus, 1)
+
+	for i := 1; i <= 3; i++ {
+		bus.Publish(NewTypedEvent(kindA, i))
+	}
+
+	s.NoError(s.awaitResult(result))
+	s.Equal([]int{1, 2}, handled)
+	// The consumer unsubscribes once it stops
+	s.awaitSubscribers(bus, 0)
+}
+
+func (s *EventsSuite) TestConsumerStopsWhenContextDone() {
+	bus := NewEventBus()
+	ctx, cancel := context.WithCancel(context.Background())
+	result := s.runInBackground(NewEventConsumer(bus, AnyKind), ctx, func(e Event) bool {
+		return true
+	})
+
+	cancel()
+	s.ErrorIs(s.awaitResult(result), context.Canceled)
+}
+
+func (s *EventsSuite) TestConsumerReportsDisconnection() {
+	bus := s.newBus(1, Disconnect)
+	blocked := make(chan struct{}, 1)
+	release := make(chan struct{})
+	result := s.runInBackground(NewEventConsumer(bus, kindA), context.Background(), func(e Event) bool {
+		blocked <- struct{}{}
+		<-release
+		return true
+	})
+	s.awaitSubscribers(bus, 1)
+
+	// Once the consumer is stuck in its handler, overflow its queue
+	bus.Publish(NewTypedEvent(kindA, 0))
+	<-blocked
+	bus.Publish(NewTypedEvent(kindA, 1))
+	bus.Publish(NewTypedEvent(kindA, 2))
+	close(release)
+
+	s.ErrorIs(s.awaitResult(result), ErrDisconnected)
+}
+
+func (s *EventsSuite) TestHandlerCanUnsubscribeDuringDelivery() {
+	bus := s.newBus(1, DropOldest)
+	sub := bus.Subscribe(kindA)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range sub.Events() {
+			// Publishers must not hold anything the unsubscribe needs
+			bus.Publish(NewTypedEvent(kindA, 1))
+			bus.Unsubscribe(sub)
+		}
+	}()
+
+	bus.Publish(NewTypedEvent(kindA, 0))
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		s.FailNow("unsubscribing during delivery deadlocked")
+	}
+}
+
+func (s *EventsSuite) TestEventBufferHoldsEventsUntilReleased() {
+	bus := NewEventBus()
+	sub := bus.Subscribe(kindA)
+	buffer := NewEventBuffer()
+
+	buffer.Publish(NewTypedEvent(kindA, 0))
+	buffer.Publish(NewTypedEvent(kindA, 1))
+	s.Empty(s.receiveAll(sub))
+
+	buffer.PublishTo(bus)
+	s.Equal([]int{0, 1}, s.receiveAll(sub))
+
+	// Released events are not published again
+	buffer.PublishTo(bus)
+	s.Empty(s.receiveAll(sub))
+}
+
+func (s *EventsSuite) TestMuxEventHandlers() {
+	var gotA int
+	var gotB string
+	handler := MuxEventHandlers(map[Kind]EventHandler{
+		kindA: TypedEventHandler[int](func(e TypedEvent[int]) bool {
+			gotA = e.Data
+			return true
+		}).ToEventHandler(),
+		kindB: TypedEventHandler[string](func(e TypedEvent[string]) bool {
+			gotB = e.Data
+			return false
+		}).ToEventHandler(),
+	})
+
+	s.True(handler(NewTypedEvent(kindA, 7)))
+	s.False(handler(NewTypedEvent(kindB, "b")))
+	// Unhandled kinds and mismatched payloads are skipped
+	s.True(handler(NewTypedEvent(Kind("test.c"), 1)))
+	s.True(handler(NewTypedEvent(kindA, "not an int")))
+	s.Equal(7, gotA)
+	s.Equal("b", gotB)
+}
+
+func (s *EventsSuite) TestCodecRoundTripsRegisteredKinds() {
+	type payload struct {
+		Name string `json:"name"`
+	}
+	codec := NewCodec()
+	Register[payload](codec, kindA)
+	Register[int](codec, kindB)
+
+	data, err := codec.Encode(NewTypedEvent(kindA, payload{Name: "a"}))
+	s.Require().NoError(err)
+	decoded, err := codec.Decode(data)
+	s.Require().NoError(err)
+	s.Equal(NewTypedEvent(kindA, payload{Name: "a"}), decoded)
+
+	data, err = codec.Encode(NewTypedEvent(kindB, 3))
+	s.Require().NoError(err)
+	decoded, err = codec.Decode(data)
+	s.Require().NoError(err)
+	s.Equal(NewTypedEvent(kindB, 3), decoded)
+
+	data, err = codec.Encode(NewTypedEvent(Kind("test.c"), 1))
+	s.Require().NoError(err)
+	_, err = codec.Decode(data)
+	s.Error(err)
+}
@@ -0,0 +1,11 @@
+package events
+
+import "go.uber.org/zap"
+
+// NewLoggingHandler returns a handler which logs every event it receives
+func NewLoggingHandler(logger *zap.SugaredLogger) EventHandler {
+	return func(e Event) bool {
+		logger.Infow("domain event", "kind", e.Kind(), "event", e)
+		return true
+	}
+}
@@ -0,0 +1,52 @@
+package public
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	"github.com/mcoot/crosswordgame-go/internal/game"
+	gametypes "github.com/mcoot/crosswordgame-go/internal/game/types"
+	"github.com/mcoot/crosswordgame-go/internal/lobby"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	"github.com/mcoot/crosswordgame-go/internal/presence"
+)
+
+// Event is a domain event as shown outside the server, to API clients and webhook receivers,
+// with the game or lobby it concerns
+type Event struct {
+	GameId  gametypes.GameId
+	LobbyId lobbytypes.LobbyId
+	Data    any
+}
+
+// FromEvent converts a domain event for showing outside the server, or returns false if it is kept internal
+// Payloads are passed through as they are, except where they would reveal private game state
+func FromEvent(e events.Event) (Event, bool) {
+	switch e := e.(type) {
+	case events.TypedEvent[game.GameCreated]:
+		return Event{GameId: e.Data.GameId, Data: e.Data}, true
+	case events.TypedEvent[game.LetterAnnounced]:
+		return Event{GameId: e.Data.GameId, Data: e.Data}, true
+	case events.TypedEvent[game.LetterPlaced]:
+		// Other players should only learn who has placed, not where
+		return Event{GameId: e.Data.GameId, Data: e.Data.Redacted()}, true
+	case events.TypedEvent[game.TurnCompleted]:
+		return Event{GameId: e.Data.GameId, Data: e.Data}, true
+	case events.TypedEvent[game.GameFinished]:
+		return Event{GameId: e.Data.GameId, Data: e.Data}, true
+	case events.TypedEvent[game.PlayerRenamed]:
+		return Event{GameId: e.Data.GameId, Data: e.Data}, true
+	case events.TypedEvent[lobby.PlayerJoinedLobby]:
+		return Event{LobbyId: e.Data.LobbyId, Data: e.Data}, true
+	case events.TypedEvent[lobby.PlayerLeftLobby]:
+		return Event{LobbyId: e.Data.LobbyId, Data: e.Data}, true
+	case events.TypedEvent[lobby.GameAttached]:
+		return Event{LobbyId: e.Data.LobbyId, Data: e.Data}, true
+	case events.TypedEvent[lobby.GameDetached]:
+		return Event{LobbyId: e.Data.LobbyId, Data: e.Data}, true
+	case events.TypedEvent[lobby.PlayerRenamed]:
+		return Event{LobbyId: e.Data.LobbyId, Data: e.Data}, true
+	case events.TypedEvent[presence.PresenceChanged]:
+		return Event{LobbyId: e.Data.LobbyId, Data: e.Data}, true
+	default:
+		return Event{}, false
+	}
+}
@@ -0,0 +1,87 @@
+package game
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	"github.com/mcoot/crosswordgame-go/internal/game/types"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+)
+
+const (
+	EventGameCreated     events.Kind = "game.created"
+	EventLetterAnnounced events.Kind = "game.letter_announced"
+	EventLetterPlaced    events.Kind = "game.letter_placed"
+	EventTurnCompleted   events.Kind = "game.turn_completed"
+	EventGameFinished    events.Kind = "game.finished"
+	EventPlayerRenamed   events.Kind = "game.player_renamed"
+)
+
+// EventKinds lists every kind of event published by the game manager
+var EventKinds = []events.Kind{
+	EventGameCreated,
+	EventLetterAnnounced,
+	EventLetterPlaced,
+	EventTurnCompleted,
+	EventGameFinished,
+	EventPlayerRenamed,
+}
+
+// RegisterEventTypes lets the codec decode every kind of event published by the game manager
+func RegisterEventTypes(codec *events.Codec) {
+	events.Register[GameCreated](codec, EventGameCreated)
+	events.Register[LetterAnnounced](codec, EventLetterAnnounced)
+	events.Register[LetterPlaced](codec, EventLetterPlaced)
+	events.Register[TurnCompleted](codec, EventTurnCompleted)
+	events.Register[GameFinished](codec, EventGameFinished)
+	events.Register[PlayerRenamed](codec, EventPlayerRenamed)
+}
+
+type GameCreated struct {
+	GameId         types.GameId           `json:"game_id"`
+	Players        []playertypes.PlayerId `json:"players"`
+	BoardDimension int                    `json:"board_dimension"`
+}
+
+type LetterAnnounced struct {
+	GameId   types.GameId         `json:"game_id"`
+	PlayerId playertypes.PlayerId `json:"player_id"`
+	Letter   string               `json:"letter"`
+}
+
+// LetterPlaced includes where the letter went, which is private to the player until the game ends
+type LetterPlaced struct {
+	GameId   types.GameId         `json:"game_id"`
+	PlayerId playertypes.PlayerId `json:"player_id"`
+	Letter   string               `json:"letter"`
+	Row      int                  `json:"row"`
+	Column   int                  `json:"column"`
+}
+
+// LetterPlacedRedacted is LetterPlaced as other players see it, which leaves out where the letter went
+type LetterPlacedRedacted struct {
+	GameId   types.GameId         `json:"game_id"`
+	PlayerId playertypes.PlayerId `json:"player_id"`
+}
+
+func (e LetterPlaced) Redacted() LetterPlacedRedacted {
+	return LetterPlacedRedacted{GameId: e.GameId, PlayerId: e.PlayerId}
+}
+
+// TurnCompleted is published once every player has placed the announced letter
+type TurnCompleted struct {
+	GameId                  types.GameId         `json:"game_id"`
+	SquaresFilled           int                  `json:"squares_filled"`
+	Status                  types.Status         `json:"status"`
+	CurrentAnnouncingPlayer playertypes.PlayerId `json:"current_announcing_player"`
+}
+
+type GameFinished struct {
+	GameId types.GameId                 `json:"game_id"`
+	Scores map[playertypes.PlayerId]int `json:"scores"`
+}
+
+// PlayerRenamed is published when a player in the game takes a new ID, e.g. on registering an account
+type PlayerRenamed struct {
+	GameId           types.GameId         `json:"game_id"`
+	PreviousPlayerId playertypes.PlayerId `json:"previous_player_id"`
+	PlayerId         playertypes.PlayerId `json:"player_id"`
+}
@@ -3,35 +3,83 @@ package game
 import (
 	"fmt"
 	"github.com/mcoot/crosswordgame-go/internal/errors"
+	"github.com/mcoot/crosswordgame-go/internal/events"
 	"github.com/mcoot/crosswordgame-go/internal/game/scoring"
 	"github.com/mcoot/crosswordgame-go/internal/game/types"
 	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
 	"github.com/mcoot/crosswordgame-go/internal/store"
 	"slices"
 	"strings"
+	"time"
 )
 
+// activeGameIdleAfter is how long an unfinished game can go without a move before it no longer counts as active,
+// e.g. as its lobby abandoned it or its players left
+const activeGameIdleAfter = time.Hour
+
 type Manager struct {
-	store  store.GameStore
-	scorer scoring.Scorer
+	store     store.GameStore
+	scorer    scoring.Scorer
+	publisher events.Publisher
+	metrics   Metrics
+	now       func() time.Time
 }
 
-func NewGameManager(store store.GameStore, scorer scoring.Scorer) *Manager {
+func NewGameManager(store store.GameStore, scorer scoring.Scorer, publisher events.Publisher) *Manager {
 	return &Manager{
-		store:  store,
-		scorer: scorer,
+		store:     store,
+		scorer:    scorer,
+		publisher: publisher,
+		metrics:   NoopMetrics{},
+		now:       time.Now,
 	}
 }
 
+// WithStore returns a copy of the manager operating on the given store, e.g. a transaction
+func (m *Manager) WithStore(store store.GameStore) *Manager {
+	copied := *m
+	copied.store = store
+	return &copied
+}
+
+// WithPublisher returns a copy of the manager publishing its events to the given publisher
+func (m *Manager) WithPublisher(publisher events.Publisher) *Manager {
+	copied := *m
+	copied.publisher = publisher
+	return &copied
+}
+
+// WithMetrics returns a copy of the manager recording how games are played to the given metrics
+func (m *Manager) WithMetrics(metrics Metrics) *Manager {
+	copied := *m
+	copied.metrics = metrics
+	return &copied
+}
+
+// Metrics returns what the manager records how games are played to
+func (m *Manager) Metrics() Metrics {
+	return m.metrics
+}
+
 func (m *Manager) CreateGame(players []playertypes.PlayerId, boardDimension int) (types.GameId, error) {
 	game, err := types.NewGame(players, boardDimension)
 	if err != nil {
 		return "", err
 	}
+	game.TurnStartedAt = m.now()
+	game.LastMoveAt = game.TurnStartedAt
 	err = m.store.StoreGame(game)
 	if err != nil {
 		return "", err
 	}
+	m.metrics.GameCreated(game.BoardDimension)
+
+	m.publisher.Publish(events.NewTypedEvent(EventGameCreated, GameCreated{
+		GameId:         game.Id,
+		Players:        game.Players,
+		BoardDimension: game.BoardDimension,
+	}))
+
 	return game.Id, nil
 }
 
@@ -43,6 +91,47 @@ func (m *Manager) GetGameState(gameId types.GameId) (*types.Game, error) {
 	return game, nil
 }
 
+// CountActiveGames counts the stored games which are yet to finish and are still being played
+// Games nobody has moved in for activeGameIdleAfter don't count, as unfinished games are kept once abandoned
+func (m *Manager) CountActiveGames() (int, error) {
+	games, err := m.store.RetrieveAllGames()
+	if err != nil {
+		return 0, err
+	}
+	idleSince := m.now().Add(-activeGameIdleAfter)
+	active := 0
+	for _, game := range games {
+		if game.Status != types.StatusFinished && game.LastMoveAt.After(idleSince) {
+			active++
+		}
+	}
+	return active, nil
+}
+
+// RenamePlayer moves the player's place in every game they have played, finished or not, to their new ID
+func (m *Manager) RenamePlayer(from playertypes.PlayerId, to playertypes.PlayerId) error {
+	// TODO: A database should index games by player, rather than searching them all
+	games, err := m.store.RetrieveAllGames()
+	if err != nil {
+		return err
+	}
+	for _, game := range games {
+		if !game.RenamePlayer(from, to) {
+			continue
+		}
+		err = m.store.StoreGame(game)
+		if err != nil {
+			return err
+		}
+		m.publisher.Publish(events.NewTypedEvent(EventPlayerRenamed, PlayerRenamed{
+			GameId:           game.Id,
+			PreviousPlayerId: from,
+			PlayerId:         to,
+		}))
+	}
+	return nil
+}
+
 func (m *Manager) GetPlayerBoard(gameId types.GameId, playerId playertypes.PlayerId) (*types.Board, error) {
 	game, err := m.store.RetrieveGame(gameId)
 	if err != nil {
@@ -120,9 +209,21 @@ func (m *Manager) SubmitAnnouncement(gameId types.GameId, playerId playertypes.P
 
 	game.Status = types.StatusAwaitingPlacement
 	game.CurrentAnnouncedLetter = announcedLetter
+	game.LastMoveAt = m.now()
 	rotateAnnouncingPlayer(game)
 
-	return m.store.StoreGame(game)
+	err = m.store.StoreGame(game)
+	if err != nil {
+		return err
+	}
+
+	m.publisher.Publish(events.NewTypedEvent(EventLetterAnnounced, LetterAnnounced{
+		GameId:   game.Id,
+		PlayerId: playerId,
+		Letter:   announcedLetter,
+	}))
+
+	return nil
 }
 
 func (m *Manager) SubmitPlacement(gameId types.GameId, playerId playertypes.PlayerId, row, column int) error {
@@ -151,13 +252,82 @@ func (m *Manager) SubmitPlacement(gameId types.GameId, playerId playertypes.Play
 	if err != nil {
 		return err
 	}
+	game.LastMoveAt = m.now()
 
+	squaresFilledBefore := game.SquaresFilled
+	turnStartedAt := game.TurnStartedAt
 	err = m.checkAndProcessEndTurnOrGame(game)
 	if err != nil {
 		return err
 	}
 
-	return m.store.StoreGame(game)
+	err = m.store.StoreGame(game)
+	if err != nil {
+		return err
+	}
+
+	m.publishPlacementEvents(game, playerId, row, column, squaresFilledBefore)
+	m.recordPlacementMetrics(game, squaresFilledBefore, turnStartedAt)
+
+	return nil
+}
+
+func (m *Manager) publishPlacementEvents(
+	game *types.Game,
+	playerId playertypes.PlayerId,
+	row int,
+	column int,
+	squaresFilledBefore int,
+) {
+	m.publisher.Publish(events.NewTypedEvent(EventLetterPlaced, LetterPlaced{
+		GameId:   game.Id,
+		PlayerId: playerId,
+		Letter:   game.CurrentAnnouncedLetter,
+		Row:      row,
+		Column:   column,
+	}))
+
+	if game.SquaresFilled == squaresFilledBefore {
+		// Other players are yet to place this turn
+		return
+	}
+
+	m.publisher.Publish(events.NewTypedEvent(EventTurnCompleted, TurnCompleted{
+		GameId:                  game.Id,
+		SquaresFilled:           game.SquaresFilled,
+		Status:                  game.Status,
+		CurrentAnnouncingPlayer: game.CurrentAnnouncingPlayer,
+	}))
+
+	if game.Status == types.StatusFinished {
+		scores := make(map[playertypes.PlayerId]int, len(game.PlayerScores))
+		for scoringPlayerId, score := range game.PlayerScores {
+			scores[scoringPlayerId] = score.TotalScore
+		}
+		m.publisher.Publish(events.NewTypedEvent(EventGameFinished, GameFinished{
+			GameId: game.Id,
+			Scores: scores,
+		}))
+	}
+}
+
+func (m *Manager) recordPlacementMetrics(game *types.Game, squaresFilledBefore int, turnStartedAt time.Time) {
+	if game.SquaresFilled == squaresFilledBefore {
+		return
+	}
+
+	// Games stored before turns were timed have no start for the turn in progress
+	if !turnStartedAt.IsZero() {
+		m.metrics.TurnCompleted(game.BoardDimension, game.TurnStartedAt.Sub(turnStartedAt))
+	}
+
+	if game.Status == types.StatusFinished {
+		scores := make([]int, 0, len(game.PlayerScores))
+		for _, score := range game.PlayerScores {
+			scores = append(scores, score.TotalScore)
+		}
+		m.metrics.GameFinished(game.BoardDimension, scores)
+	}
 }
 
 func (m *Manager) fillPlayerSquare(
@@ -224,6 +394,7 @@ func (m *Manager) checkAndProcessEndTurnOrGame(game *types.Game) error {
 
 	// All players have had their turn, so end the round
 	game.SquaresFilled++
+	game.TurnStartedAt = m.now()
 
 	// Check if the game is over
 	if game.SquaresFilled == game.TotalSquares() {
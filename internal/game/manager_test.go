@@ -0,0 +1,162 @@
+package game
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	"github.com/mcoot/crosswordgame-go/internal/game/types"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"github.com/mcoot/crosswordgame-go/internal/store"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+// fixedScorer scores every board the same, as the words made don't matter to the events
+type fixedScorer struct {
+	score int
+}
+
+func (f fixedScorer) Score(board [][]string) *types.ScoreResult {
+	return &types.ScoreResult{TotalScore: f.score}
+}
+
+// recordingPublisher keeps every event published to it, in order
+type recordingPublisher struct {
+	published []events.Event
+}
+
+func (p *recordingPublisher) Publish(event events.Event) {
+	p.published = append(p.published, event)
+}
+
+type GameManagerSuite struct {
+	suite.Suite
+	db        *store.InMemoryStore
+	publisher *recordingPublisher
+	manager   *Manager
+}
+
+func TestGameManagerSuite(t *testing.T) {
+	suite.Run(t, new(GameManagerSuite))
+}
+
+func (s *GameManagerSuite) SetupTest() {
+	s.db = store.NewInMemoryStore()
+	s.publisher = &recordingPublisher{}
+	s.manager = NewGameManager(s.db, fixedScorer{score: 7}, s.publisher)
+}
+
+// takePublished returns the events published since it was last called
+func (s *GameManagerSuite) takePublished() []events.Event {
+	published := s.publisher.published
+	s.publisher.published = nil
+	return published
+}
+
+func (s *GameManagerSuite) TestPublishesEventsThroughAGame() {
+	players := []playertypes.PlayerId{"player0", "player1"}
+	gameId, err := s.manager.CreateGame(players, 2)
+	s.Require().NoError(err)
+	s.Equal([]events.Event{
+		events.NewTypedEvent(EventGameCreated, GameCreated{GameId: gameId, Players: players, BoardDimension: 2}),
+	}, s.takePublished())
+
+	s.Require().NoError(s.manager.SubmitAnnouncement(gameId, "player0", "a"))
+	s.Equal([]events.Event{
+		events.NewTypedEvent(EventLetterAnnounced, LetterAnnounced{GameId: gameId, PlayerId: "player0", Letter: "A"}),
+	}, s.takePublished())
+
+	// The turn only completes once every player has placed
+	s.Require().NoError(s.manager.SubmitPlacement(gameId, "player0", 0, 0))
+	s.Equal([]events.Event{
+		events.NewTypedEvent(EventLetterPlaced, LetterPlaced{GameId: gameId, PlayerId: "player0", Letter: "A", Row: 0, Column: 0}),
+	}, s.takePublished())
+	s.Require().NoError(s.manager.SubmitPlacement(gameId, "player1", 1, 1))
+	s.Equal([]events.Event{
+		events.NewTypedEvent(EventLetterPlaced, LetterPlaced{GameId: gameId, PlayerId: "player1", Letter: "A", Row: 1, Column: 1}),
+		events.NewTypedEvent(EventTurnCompleted, TurnCompleted{
+			GameId:                  gameId,
+			SquaresFilled:           1,
+			Status:                  types.StatusAwaitingAnnouncement,
+			CurrentAnnouncingPlayer: "player1",
+		}),
+	}, s.takePublished())
+
+	// Fill the rest of the boards, so the last placement finishes the game
+	squares := [][2]int{{0, 1}, {1, 0}, {1, 1}}
+	for turn, square := range squares {
+		announcer := players[(turn+1)%len(players)]
+		s.Require().NoError(s.manager.SubmitAnnouncement(gameId, announcer, "b"))
+		s.Require().NoError(s.manager.SubmitPlacement(gameId, "player0", square[0], square[1]))
+		s.Require().NoError(s.manager.SubmitPlacement(gameId, "player1", 1-square[0], 1-square[1]))
+	}
+	published := s.takePublished()
+	s.Require().NotEmpty(published)
+	s.Equal(
+		events.NewTypedEvent(EventGameFinished, GameFinished{
+			GameId: gameId,
+			Scores: map[playertypes.PlayerId]int{"player0": 7, "player1": 7},
+		}),
+		published[len(published)-1],
+	)
+	s.Equal(
+		events.NewTypedEvent(EventTurnCompleted, TurnCompleted{
+			GameId:                  gameId,
+			SquaresFilled:           4,
+			Status:                  types.StatusFinished,
+			CurrentAnnouncingPlayer: "player0",
+		}),
+		published[len(published)-2],
+	)
+}
+
+func (s *GameManagerSuite) TestRenamePublishesForEachGame() {
+	first, err := s.manager.CreateGame([]playertypes.PlayerId{"old", "other"}, 2)
+	s.Require().NoError(err)
+	_, err = s.manager.CreateGame([]playertypes.PlayerId{"other"}, 2)
+	s.Require().NoError(err)
+	s.takePublished()
+
+	s.Require().NoError(s.manager.RenamePlayer("old", "new"))
+	s.Equal([]events.Event{
+		events.NewTypedEvent(EventPlayerRenamed, PlayerRenamed{GameId: first, PreviousPlayerId: "old", PlayerId: "new"}),
+	}, s.takePublished())
+}
+
+func (s *GameManagerSuite) TestRejectedMovesPublishNothing() {
+	gameId, err := s.manager.CreateGame([]playertypes.PlayerId{"player0", "player1"}, 2)
+	s.Require().NoError(err)
+	s.takePublished()
+
+	s.Error(s.manager.SubmitAnnouncement(gameId, "player1", "a"))
+	s.Error(s.manager.SubmitPlacement(gameId, "player0", 0, 0))
+	s.Require().NoError(s.manager.SubmitAnnouncement(gameId, "player0", "a"))
+	s.takePublished()
+	s.Error(s.manager.SubmitPlacement(gameId, "player0", 5, 5))
+
+	s.Empty(s.takePublished())
+}
+
+func (s *GameManagerSuite) TestGamesStopBeingActiveOnceIdle() {
+	now := time.Now()
+	s.manager.now = func() time.Time { return now }
+	gameId, err := s.manager.CreateGame([]playertypes.PlayerId{"player0", "player1"}, 2)
+	s.Require().NoError(err)
+	_, err = s.manager.CreateGame([]playertypes.PlayerId{"player0"}, 2)
+	s.Require().NoError(err)
+	s.Equal(2, s.countActiveGames())
+
+	// Moving keeps a game active, while the one nobody plays drops out
+	now = now.Add(50 * time.Minute)
+	s.Require().NoError(s.manager.SubmitAnnouncement(gameId, "player0", "a"))
+	now = now.Add(50 * time.Minute)
+	s.Equal(1, s.countActiveGames())
+
+	now = now.Add(time.Hour)
+	s.Equal(0, s.countActiveGames())
+}
+
+func (s *GameManagerSuite) countActiveGames() int {
+	active, err := s.manager.CountActiveGames()
+	s.Require().NoError(err)
+	return active
+}
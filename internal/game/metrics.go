@@ -0,0 +1,57 @@
+package game
+
+import "time"
+
+// Metrics is told how games are played, so they can be monitored
+type Metrics interface {
+	GameCreated(boardDimension int)
+	// TurnCompleted is given how long the turn took, from the game starting or the previous turn completing
+	TurnCompleted(boardDimension int, duration time.Duration)
+	// GameFinished is given every player's final score
+	GameFinished(boardDimension int, scores []int)
+}
+
+// NoopMetrics records nothing, for when games are not monitored
+type NoopMetrics struct{}
+
+func (NoopMetrics) GameCreated(int) {}
+
+func (NoopMetrics) TurnCompleted(int, time.Duration) {}
+
+func (NoopMetrics) GameFinished(int, []int) {}
+
+// MetricsBuffer holds what games record until it is released to other metrics
+// e.g. so games created in a store transaction are only counted once it commits
+type MetricsBuffer struct {
+	records []func(metrics Metrics)
+}
+
+func NewMetricsBuffer() *MetricsBuffer {
+	return &MetricsBuffer{}
+}
+
+func (b *MetricsBuffer) GameCreated(boardDimension int) {
+	b.records = append(b.records, func(metrics Metrics) {
+		metrics.GameCreated(boardDimension)
+	})
+}
+
+func (b *MetricsBuffer) TurnCompleted(boardDimension int, duration time.Duration) {
+	b.records = append(b.records, func(metrics Metrics) {
+		metrics.TurnCompleted(boardDimension, duration)
+	})
+}
+
+func (b *MetricsBuffer) GameFinished(boardDimension int, scores []int) {
+	b.records = append(b.records, func(metrics Metrics) {
+		metrics.GameFinished(boardDimension, scores)
+	})
+}
+
+// RecordTo releases the buffered records in the order they were made
+func (b *MetricsBuffer) RecordTo(metrics Metrics) {
+	for _, record := range b.records {
+		record(metrics)
+	}
+	b.records = nil
+}
@@ -1,7 +1,9 @@
 package types
 
+import "slices"
+
 type Board struct {
-	Data [][]string
+	Data [][]string `json:"data"`
 }
 
 func NewBoard(size int) *Board {
@@ -36,3 +38,13 @@ func (b *Board) FilledSquares() int {
 func IsValidLetter(letter string) bool {
 	return len(letter) == 1 && letter[0] >= 'A' && letter[0] <= 'Z'
 }
+
+func (b *Board) Clone() *Board {
+	data := make([][]string, len(b.Data))
+	for i := range b.Data {
+		data[i] = slices.Clone(b.Data[i])
+	}
+	return &Board{
+		Data: data,
+	}
+}
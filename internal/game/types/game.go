@@ -4,7 +4,9 @@ import (
 	"github.com/hashicorp/go-uuid"
 	"github.com/mcoot/crosswordgame-go/internal/errors"
 	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"maps"
 	"slices"
+	"time"
 )
 
 type GameId string
@@ -18,18 +20,29 @@ const (
 )
 
 type Game struct {
-	Id                      GameId
-	Status                  Status
-	Players                 []playertypes.PlayerId
-	SquaresFilled           int
-	BoardDimension          int
-	CurrentAnnouncingPlayer playertypes.PlayerId
-	CurrentAnnouncedLetter  string
-	PlayerBoards            map[playertypes.PlayerId]*Board
-	PlayerScores            map[playertypes.PlayerId]*ScoreResult
+	Id                      GameId                                `json:"id"`
+	Status                  Status                                `json:"status"`
+	Players                 []playertypes.PlayerId                `json:"players"`
+	SquaresFilled           int                                   `json:"squares_filled"`
+	BoardDimension          int                                   `json:"board_dimension"`
+	CurrentAnnouncingPlayer playertypes.PlayerId                  `json:"current_announcing_player"`
+	CurrentAnnouncedLetter  string                                `json:"current_announced_letter"`
+	PlayerBoards            map[playertypes.PlayerId]*Board       `json:"player_boards"`
+	PlayerScores            map[playertypes.PlayerId]*ScoreResult `json:"player_scores"`
+	// TurnStartedAt is when the current turn began, which is unknown for games stored before it was recorded
+	TurnStartedAt time.Time `json:"turn_started_at,omitzero"`
+	// LastMoveAt is when the game was created or last had a letter announced or placed, which is unknown for
+	// games stored before it was recorded
+	LastMoveAt time.Time `json:"last_move_at,omitzero"`
 }
 
 func NewGame(players []playertypes.PlayerId, boardDimension int) (*Game, error) {
+	if len(players) == 0 {
+		return nil, &errors.InvalidInputError{
+			ErrMessage: "a game needs at least one player",
+		}
+	}
+
 	rawId, err := uuid.GenerateUUID()
 	if err != nil {
 		return nil, err
@@ -100,3 +113,62 @@ func (g *Game) HasPlayerPlacedThisTurn(playerId playertypes.PlayerId) (bool, err
 	}
 	return board.FilledSquares() == g.SquaresFilled+1, nil
 }
+
+// WaitingOnPlayers lists the players the game is waiting on to announce or place this turn
+func (g *Game) WaitingOnPlayers() ([]playertypes.PlayerId, error) {
+	switch g.Status {
+	case StatusAwaitingAnnouncement:
+		return []playertypes.PlayerId{g.CurrentAnnouncingPlayer}, nil
+	case StatusAwaitingPlacement:
+		var waitingOn []playertypes.PlayerId
+		for _, playerId := range g.Players {
+			hasPlaced, err := g.HasPlayerPlacedThisTurn(playerId)
+			if err != nil {
+				return nil, err
+			}
+			if !hasPlaced {
+				waitingOn = append(waitingOn, playerId)
+			}
+		}
+		return waitingOn, nil
+	default:
+		return nil, nil
+	}
+}
+
+// RenamePlayer replaces every reference to the player with their new ID, reporting whether they were in the game
+func (g *Game) RenamePlayer(from playertypes.PlayerId, to playertypes.PlayerId) bool {
+	index := g.GetIndexForPlayer(from)
+	if index == -1 {
+		return false
+	}
+
+	g.Players[index] = to
+	if g.CurrentAnnouncingPlayer == from {
+		g.CurrentAnnouncingPlayer = to
+	}
+	if board, ok := g.PlayerBoards[from]; ok {
+		delete(g.PlayerBoards, from)
+		g.PlayerBoards[to] = board
+	}
+	if score, ok := g.PlayerScores[from]; ok {
+		delete(g.PlayerScores, from)
+		g.PlayerScores[to] = score
+	}
+	return true
+}
+
+// Clone returns a deep copy of the game, so it can be mutated without affecting the original
+func (g *Game) Clone() *Game {
+	playerBoards := make(map[playertypes.PlayerId]*Board, len(g.PlayerBoards))
+	for playerId, board := range g.PlayerBoards {
+		playerBoards[playerId] = board.Clone()
+	}
+
+	clone := *g
+	clone.Players = slices.Clone(g.Players)
+	clone.PlayerBoards = playerBoards
+	// Score results are never mutated once calculated, so they can be shared
+	clone.PlayerScores = maps.Clone(g.PlayerScores)
+	return &clone
+}
@@ -8,8 +8,8 @@ const (
 )
 
 type ScoreResult struct {
-	TotalScore int
-	Words      []*ScoredWord
+	TotalScore int           `json:"total_score"`
+	Words      []*ScoredWord `json:"words"`
 }
 
 type ScoredWord struct {
@@ -0,0 +1,102 @@
+package lobby
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	gametypes "github.com/mcoot/crosswordgame-go/internal/game/types"
+	"github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+)
+
+const (
+	EventLobbyCreated      events.Kind = "lobby.created"
+	EventPlayerJoinedLobby events.Kind = "lobby.player_joined"
+	EventPlayerLeftLobby   events.Kind = "lobby.player_left"
+	EventGameAttached      events.Kind = "lobby.game_attached"
+	EventGameDetached      events.Kind = "lobby.game_detached"
+	EventPlayerRenamed     events.Kind = "lobby.player_renamed"
+	EventHostChanged       events.Kind = "lobby.host_changed"
+	EventLockChanged       events.Kind = "lobby.lock_changed"
+	EventSettingsChanged   events.Kind = "lobby.settings_changed"
+)
+
+// EventKinds lists every kind of event published by the lobby manager
+var EventKinds = []events.Kind{
+	EventLobbyCreated,
+	EventPlayerJoinedLobby,
+	EventPlayerLeftLobby,
+	EventGameAttached,
+	EventGameDetached,
+	EventPlayerRenamed,
+	EventHostChanged,
+	EventLockChanged,
+	EventSettingsChanged,
+}
+
+// RegisterEventTypes lets the codec decode every kind of event published by the lobby manager
+func RegisterEventTypes(codec *events.Codec) {
+	events.Register[LobbyCreated](codec, EventLobbyCreated)
+	events.Register[PlayerJoinedLobby](codec, EventPlayerJoinedLobby)
+	events.Register[PlayerLeftLobby](codec, EventPlayerLeftLobby)
+	events.Register[GameAttached](codec, EventGameAttached)
+	events.Register[GameDetached](codec, EventGameDetached)
+	events.Register[PlayerRenamed](codec, EventPlayerRenamed)
+	events.Register[HostChanged](codec, EventHostChanged)
+	events.Register[LockChanged](codec, EventLockChanged)
+	events.Register[SettingsChanged](codec, EventSettingsChanged)
+}
+
+type LobbyCreated struct {
+	LobbyId types.LobbyId        `json:"lobby_id"`
+	Name    string               `json:"name"`
+	Host    playertypes.PlayerId `json:"host,omitempty"`
+}
+
+type PlayerJoinedLobby struct {
+	LobbyId  types.LobbyId        `json:"lobby_id"`
+	PlayerId playertypes.PlayerId `json:"player_id"`
+}
+
+type PlayerLeftLobby struct {
+	LobbyId  types.LobbyId        `json:"lobby_id"`
+	PlayerId playertypes.PlayerId `json:"player_id"`
+	// KickedBy is the host who removed the player, if they didn't leave by themselves
+	KickedBy playertypes.PlayerId `json:"kicked_by,omitempty"`
+}
+
+type GameAttached struct {
+	LobbyId types.LobbyId    `json:"lobby_id"`
+	GameId  gametypes.GameId `json:"game_id"`
+}
+
+type GameDetached struct {
+	LobbyId types.LobbyId    `json:"lobby_id"`
+	GameId  gametypes.GameId `json:"game_id"`
+}
+
+// PlayerRenamed is published when a player in the lobby takes a new ID, e.g. on registering an account
+type PlayerRenamed struct {
+	LobbyId          types.LobbyId        `json:"lobby_id"`
+	PreviousPlayerId playertypes.PlayerId `json:"previous_player_id"`
+	PlayerId         playertypes.PlayerId `json:"player_id"`
+}
+
+// HostChanged is published when the host hands the lobby over, or leaves and it passes to another player
+type HostChanged struct {
+	LobbyId      types.LobbyId        `json:"lobby_id"`
+	PreviousHost playertypes.PlayerId `json:"previous_host,omitempty"`
+	Host         playertypes.PlayerId `json:"host,omitempty"`
+}
+
+type LockChanged struct {
+	LobbyId types.LobbyId `json:"lobby_id"`
+	Locked  bool          `json:"locked"`
+}
+
+// SettingsChanged is published when the host changes the lobby's settings, leaving out its password
+type SettingsChanged struct {
+	LobbyId      types.LobbyId     `json:"lobby_id"`
+	MaxPlayers   int               `json:"max_players"`
+	Visibility   types.Visibility  `json:"visibility"`
+	HasPassword  bool              `json:"has_password"`
+	GameDefaults types.GameOptions `json:"game_defaults"`
+}
@@ -3,31 +3,60 @@ package lobby
 import (
 	"fmt"
 	"github.com/mcoot/crosswordgame-go/internal/errors"
+	"github.com/mcoot/crosswordgame-go/internal/events"
 	gametypes "github.com/mcoot/crosswordgame-go/internal/game/types"
 	"github.com/mcoot/crosswordgame-go/internal/lobby/types"
 	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
 	"github.com/mcoot/crosswordgame-go/internal/store"
+	"slices"
 )
 
 type Manager struct {
-	store store.LobbyStore
+	store     store.LobbyStore
+	publisher events.Publisher
 }
 
-func NewLobbyManager(store store.LobbyStore) *Manager {
+func NewLobbyManager(store store.LobbyStore, publisher events.Publisher) *Manager {
 	return &Manager{
-		store: store,
+		store:     store,
+		publisher: publisher,
 	}
 }
 
-func (m *Manager) CreateLobby(name string) (types.LobbyId, error) {
+// WithStore returns a copy of the manager operating on the given store, e.g. a transaction
+func (m *Manager) WithStore(store store.LobbyStore) *Manager {
+	return &Manager{
+		store:     store,
+		publisher: m.publisher,
+	}
+}
+
+// WithPublisher returns a copy of the manager publishing its events to the given publisher
+func (m *Manager) WithPublisher(publisher events.Publisher) *Manager {
+	return &Manager{
+		store:     m.store,
+		publisher: publisher,
+	}
+}
+
+// CreateLobby creates an empty lobby run by the given host, or by any of its players if host is empty
+func (m *Manager) CreateLobby(name string, host playertypes.PlayerId) (types.LobbyId, error) {
 	lobby, err := types.NewLobby(name)
 	if err != nil {
 		return "", err
 	}
+	lobby.Host = host
 	err = m.store.StoreLobby(lobby)
 	if err != nil {
 		return "", err
 	}
+
+	m.publisher.Publish(events.NewTypedEvent(EventLobbyCreated, LobbyCreated{
+		LobbyId: lobby.Id,
+		Name:    lobby.Name,
+		Host:    lobby.Host,
+	}))
+
 	return lobby.Id, nil
 }
 
@@ -39,7 +68,12 @@ func (m *Manager) GetLobbyState(id types.LobbyId) (*types.Lobby, error) {
 	return lobby, nil
 }
 
-func (m *Manager) JoinPlayerToLobby(lobbyId types.LobbyId, playerId playertypes.PlayerId) error {
+func (m *Manager) GetLobbyForGame(gameId gametypes.GameId) (*types.Lobby, error) {
+	return m.store.RetrieveLobbyForGame(gameId)
+}
+
+// JoinPlayerToLobby adds the player to the lobby, if it isn't locked or full and the password is right
+func (m *Manager) JoinPlayerToLobby(lobbyId types.LobbyId, playerId playertypes.PlayerId, password string) error {
 	lobby, err := m.store.RetrieveLobby(lobbyId)
 	if err != nil {
 		return err
@@ -51,33 +85,206 @@ func (m *Manager) JoinPlayerToLobby(lobbyId types.LobbyId, playerId playertypes.
 			Reason: fmt.Sprintf("player %s is already in lobby %s", playerId, lobbyId),
 		}
 	}
+	err = checkCanJoin(lobby, password)
+	if err != nil {
+		return err
+	}
 
 	lobby.Players = append(lobby.Players, playerId)
-	return m.store.StoreLobby(lobby)
+	err = m.store.StoreLobby(lobby)
+	if err != nil {
+		return err
+	}
+
+	m.publisher.Publish(events.NewTypedEvent(EventPlayerJoinedLobby, PlayerJoinedLobby{
+		LobbyId:  lobbyId,
+		PlayerId: playerId,
+	}))
+
+	return nil
 }
 
+// RemovePlayerFromLobby takes the player out of the lobby, e.g. as they leave it
+// If they were its host, hosting passes to whoever has been in the lobby longest
 func (m *Manager) RemovePlayerFromLobby(lobbyId types.LobbyId, playerId playertypes.PlayerId) error {
 	lobby, err := m.store.RetrieveLobby(lobbyId)
 	if err != nil {
 		return err
 	}
-	foundPlayer := false
-	for i, p := range lobby.Players {
-		if p == playerId {
-			lobby.Players = append(lobby.Players[:i], lobby.Players[i+1:]...)
-			foundPlayer = true
-			break
+	return m.removePlayer(lobby, playerId, "")
+}
+
+// KickPlayer removes another player from the lobby, on behalf of its host
+func (m *Manager) KickPlayer(lobbyId types.LobbyId, host playertypes.PlayerId, playerId playertypes.PlayerId) error {
+	lobby, err := m.store.RetrieveLobby(lobbyId)
+	if err != nil {
+		return err
+	}
+	err = checkHost(lobby, host)
+	if err != nil {
+		return err
+	}
+	if playerId == host {
+		return &errors.InvalidActionError{
+			Action: "kick_player",
+			Reason: "can't kick yourself, so leave the lobby instead",
 		}
 	}
+	return m.removePlayer(lobby, playerId, host)
+}
 
-	if !foundPlayer {
+func (m *Manager) removePlayer(lobby *types.Lobby, playerId playertypes.PlayerId, kickedBy playertypes.PlayerId) error {
+	index := slices.Index(lobby.Players, playerId)
+	if index == -1 {
 		return &errors.InvalidActionError{
 			Action: "remove_player_from_lobby",
-			Reason: fmt.Sprintf("player %s is not in lobby %s", playerId, lobbyId),
+			Reason: fmt.Sprintf("player %s is not in lobby %s", playerId, lobby.Id),
 		}
 	}
+	lobby.Players = slices.Delete(lobby.Players, index, index+1)
+
+	// Players are kept in the order they joined, so the first left has been there longest
+	// A host leaving an empty lobby still hosts it, as hosts of lobbies created over the JSON API needn't play
+	previousHost := lobby.Host
+	if lobby.Host == playerId && len(lobby.Players) > 0 {
+		lobby.Host = lobby.Players[0]
+	}
 
-	return m.store.StoreLobby(lobby)
+	err := m.store.StoreLobby(lobby)
+	if err != nil {
+		return err
+	}
+
+	m.publisher.Publish(events.NewTypedEvent(EventPlayerLeftLobby, PlayerLeftLobby{
+		LobbyId:  lobby.Id,
+		PlayerId: playerId,
+		KickedBy: kickedBy,
+	}))
+	if lobby.Host != previousHost {
+		m.publisher.Publish(events.NewTypedEvent(EventHostChanged, HostChanged{
+			LobbyId:      lobby.Id,
+			PreviousHost: previousHost,
+			Host:         lobby.Host,
+		}))
+	}
+
+	return nil
+}
+
+// TransferHost makes another player in the lobby its host, on behalf of the current one
+func (m *Manager) TransferHost(lobbyId types.LobbyId, host playertypes.PlayerId, newHost playertypes.PlayerId) error {
+	lobby, err := m.store.RetrieveLobby(lobbyId)
+	if err != nil {
+		return err
+	}
+	err = checkHost(lobby, host)
+	if err != nil {
+		return err
+	}
+	if !isPlayerInLobby(lobby, newHost) {
+		return &errors.InvalidActionError{
+			Action: "transfer_host",
+			Reason: fmt.Sprintf("player %s is not in lobby %s", newHost, lobbyId),
+		}
+	}
+	if lobby.Host == newHost {
+		return &errors.InvalidActionError{
+			Action: "transfer_host",
+			Reason: fmt.Sprintf("player %s is already the host", newHost),
+		}
+	}
+
+	previousHost := lobby.Host
+	lobby.Host = newHost
+	err = m.store.StoreLobby(lobby)
+	if err != nil {
+		return err
+	}
+
+	m.publisher.Publish(events.NewTypedEvent(EventHostChanged, HostChanged{
+		LobbyId:      lobbyId,
+		PreviousHost: previousHost,
+		Host:         newHost,
+	}))
+
+	return nil
+}
+
+// SetLocked locks the lobby against new players joining, or unlocks it, on behalf of its host
+func (m *Manager) SetLocked(lobbyId types.LobbyId, host playertypes.PlayerId, locked bool) error {
+	lobby, err := m.store.RetrieveLobby(lobbyId)
+	if err != nil {
+		return err
+	}
+	err = checkHost(lobby, host)
+	if err != nil {
+		return err
+	}
+	if lobby.Locked == locked {
+		return nil
+	}
+
+	lobby.Locked = locked
+	err = m.store.StoreLobby(lobby)
+	if err != nil {
+		return err
+	}
+
+	m.publisher.Publish(events.NewTypedEvent(EventLockChanged, LockChanged{
+		LobbyId: lobbyId,
+		Locked:  locked,
+	}))
+
+	return nil
+}
+
+// CheckHost returns a ForbiddenError unless the player may run the lobby
+func (m *Manager) CheckHost(lobbyId types.LobbyId, playerId playertypes.PlayerId) error {
+	lobby, err := m.store.RetrieveLobby(lobbyId)
+	if err != nil {
+		return err
+	}
+	return checkHost(lobby, playerId)
+}
+
+func checkHost(lobby *types.Lobby, playerId playertypes.PlayerId) error {
+	if !lobby.IsRunBy(playerId) {
+		return &errors.ForbiddenError{Reason: fmt.Sprintf("only the host of lobby %s can do this", lobby.Id)}
+	}
+	return nil
+}
+
+// RenamePlayer replaces the player in the lobby with their new ID, keeping their place in it
+func (m *Manager) RenamePlayer(lobbyId types.LobbyId, from playertypes.PlayerId, to playertypes.PlayerId) error {
+	lobby, err := m.store.RetrieveLobby(lobbyId)
+	if err != nil {
+		return err
+	}
+
+	index := slices.Index(lobby.Players, from)
+	if index == -1 {
+		return &errors.InvalidActionError{
+			Action: "rename_player_in_lobby",
+			Reason: fmt.Sprintf("player %s is not in lobby %s", from, lobbyId),
+		}
+	}
+
+	lobby.Players[index] = to
+	if lobby.Host == from {
+		lobby.Host = to
+	}
+	err = m.store.StoreLobby(lobby)
+	if err != nil {
+		return err
+	}
+
+	m.publisher.Publish(events.NewTypedEvent(EventPlayerRenamed, PlayerRenamed{
+		LobbyId:          lobbyId,
+		PreviousPlayerId: from,
+		PlayerId:         to,
+	}))
+
+	return nil
 }
 
 func (m *Manager) AttachGameToLobby(lobbyId types.LobbyId, gameId gametypes.GameId) error {
@@ -96,7 +303,17 @@ func (m *Manager) AttachGameToLobby(lobbyId types.LobbyId, gameId gametypes.Game
 	lobby.RunningGame = &types.RunningGame{
 		GameId: gameId,
 	}
-	return m.store.StoreLobby(lobby)
+	err = m.store.StoreLobby(lobby)
+	if err != nil {
+		return err
+	}
+
+	m.publisher.Publish(events.NewTypedEvent(EventGameAttached, GameAttached{
+		LobbyId: lobbyId,
+		GameId:  gameId,
+	}))
+
+	return nil
 }
 
 func (m *Manager) DetachGameFromLobby(lobbyId types.LobbyId) error {
@@ -112,8 +329,19 @@ func (m *Manager) DetachGameFromLobby(lobbyId types.LobbyId) error {
 		}
 	}
 
+	gameId := lobby.RunningGame.GameId
 	lobby.RunningGame = nil
-	return m.store.StoreLobby(lobby)
+	err = m.store.StoreLobby(lobby)
+	if err != nil {
+		return err
+	}
+
+	m.publisher.Publish(events.NewTypedEvent(EventGameDetached, GameDetached{
+		LobbyId: lobbyId,
+		GameId:  gameId,
+	}))
+
+	return nil
 }
 
 func isPlayerInLobby(lobby *types.Lobby, playerId playertypes.PlayerId) bool {
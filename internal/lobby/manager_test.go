@@ -0,0 +1,116 @@
+package lobby
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	"github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	"github.com/mcoot/crosswordgame-go/internal/store"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+// recordingPublisher keeps every event published to it, in order
+type recordingPublisher struct {
+	published []events.Event
+}
+
+func (p *recordingPublisher) Publish(event events.Event) {
+	p.published = append(p.published, event)
+}
+
+type LobbyManagerSuite struct {
+	suite.Suite
+	db        *store.InMemoryStore
+	publisher *recordingPublisher
+	manager   *Manager
+}
+
+func TestLobbyManagerSuite(t *testing.T) {
+	suite.Run(t, new(LobbyManagerSuite))
+}
+
+func (s *LobbyManagerSuite) SetupTest() {
+	s.db = store.NewInMemoryStore()
+	s.publisher = &recordingPublisher{}
+	s.manager = NewLobbyManager(s.db, s.publisher)
+}
+
+// takePublished returns the events published since it was last called
+func (s *LobbyManagerSuite) takePublished() []events.Event {
+	published := s.publisher.published
+	s.publisher.published = nil
+	return published
+}
+
+func (s *LobbyManagerSuite) TestPublishesEventsThroughALobby() {
+	lobbyId, err := s.manager.CreateLobby("lobby", "host")
+	s.Require().NoError(err)
+	s.Equal([]events.Event{
+		events.NewTypedEvent(EventLobbyCreated, LobbyCreated{LobbyId: lobbyId, Name: "lobby", Host: "host"}),
+	}, s.takePublished())
+
+	s.Require().NoError(s.manager.JoinPlayerToLobby(lobbyId, "host", ""))
+	s.Require().NoError(s.manager.JoinPlayerToLobby(lobbyId, "member", ""))
+	s.Equal([]events.Event{
+		events.NewTypedEvent(EventPlayerJoinedLobby, PlayerJoinedLobby{LobbyId: lobbyId, PlayerId: "host"}),
+		events.NewTypedEvent(EventPlayerJoinedLobby, PlayerJoinedLobby{LobbyId: lobbyId, PlayerId: "member"}),
+	}, s.takePublished())
+
+	s.Require().NoError(s.manager.AttachGameToLobby(lobbyId, "game0"))
+	s.Require().NoError(s.manager.DetachGameFromLobby(lobbyId))
+	s.Equal([]events.Event{
+		events.NewTypedEvent(EventGameAttached, GameAttached{LobbyId: lobbyId, GameId: "game0"}),
+		events.NewTypedEvent(EventGameDetached, GameDetached{LobbyId: lobbyId, GameId: "game0"}),
+	}, s.takePublished())
+
+	s.Require().NoError(s.manager.SetLocked(lobbyId, "host", true))
+	s.Require().NoError(s.manager.SetLocked(lobbyId, "host", false))
+	maxPlayers := 4
+	s.Require().NoError(s.manager.UpdateSettings(lobbyId, "host", SettingsUpdate{MaxPlayers: &maxPlayers}))
+	s.Equal([]events.Event{
+		events.NewTypedEvent(EventLockChanged, LockChanged{LobbyId: lobbyId, Locked: true}),
+		events.NewTypedEvent(EventLockChanged, LockChanged{LobbyId: lobbyId, Locked: false}),
+		events.NewTypedEvent(EventSettingsChanged, SettingsChanged{
+			LobbyId:      lobbyId,
+			MaxPlayers:   4,
+			Visibility:   types.VisibilityPrivate,
+			GameDefaults: types.GameOptions{BoardSize: types.DefaultBoardSize},
+		}),
+	}, s.takePublished())
+
+	s.Require().NoError(s.manager.RenamePlayer(lobbyId, "member", "registered"))
+	s.Require().NoError(s.manager.TransferHost(lobbyId, "host", "registered"))
+	s.Equal([]events.Event{
+		events.NewTypedEvent(EventPlayerRenamed, PlayerRenamed{LobbyId: lobbyId, PreviousPlayerId: "member", PlayerId: "registered"}),
+		events.NewTypedEvent(EventHostChanged, HostChanged{LobbyId: lobbyId, PreviousHost: "host", Host: "registered"}),
+	}, s.takePublished())
+
+	// The host leaving hands the lobby to whoever has been in it longest
+	s.Require().NoError(s.manager.KickPlayer(lobbyId, "registered", "host"))
+	s.Require().NoError(s.manager.JoinPlayerToLobby(lobbyId, "latecomer", ""))
+	s.Require().NoError(s.manager.RemovePlayerFromLobby(lobbyId, "registered"))
+	s.Equal([]events.Event{
+		events.NewTypedEvent(EventPlayerLeftLobby, PlayerLeftLobby{LobbyId: lobbyId, PlayerId: "host", KickedBy: "registered"}),
+		events.NewTypedEvent(EventPlayerJoinedLobby, PlayerJoinedLobby{LobbyId: lobbyId, PlayerId: "latecomer"}),
+		events.NewTypedEvent(EventPlayerLeftLobby, PlayerLeftLobby{LobbyId: lobbyId, PlayerId: "registered"}),
+		events.NewTypedEvent(EventHostChanged, HostChanged{LobbyId: lobbyId, PreviousHost: "registered", Host: "latecomer"}),
+	}, s.takePublished())
+}
+
+func (s *LobbyManagerSuite) TestRejectedChangesPublishNothing() {
+	lobbyId, err := s.manager.CreateLobby("lobby", "host")
+	s.Require().NoError(err)
+	s.Require().NoError(s.manager.JoinPlayerToLobby(lobbyId, "host", ""))
+	password := "secret"
+	s.Require().NoError(s.manager.UpdateSettings(lobbyId, "host", SettingsUpdate{Password: &password}))
+	s.takePublished()
+
+	s.Error(s.manager.JoinPlayerToLobby(lobbyId, "host", "secret"))
+	s.Error(s.manager.JoinPlayerToLobby(lobbyId, "member", "wrong"))
+	s.Error(s.manager.SetLocked(lobbyId, "member", true))
+	s.Error(s.manager.TransferHost(lobbyId, "host", "member"))
+	s.Error(s.manager.DetachGameFromLobby(lobbyId))
+	// Unlocking a lobby that is already unlocked changes nothing, so nothing is published either
+	s.NoError(s.manager.SetLocked(lobbyId, "host", false))
+
+	s.Empty(s.takePublished())
+}
@@ -0,0 +1,134 @@
+package lobby
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	"github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	"github.com/mcoot/crosswordgame-go/internal/password"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"slices"
+)
+
+// SettingsUpdate is a host's change to the lobby's settings, leaving those which are nil as they are
+type SettingsUpdate struct {
+	MaxPlayers *int
+	Visibility *types.Visibility
+	// Password replaces the join password, with "" removing it
+	Password     *string
+	GameDefaults *types.GameOptions
+}
+
+// UpdateSettings changes the lobby's settings, on behalf of its host
+func (m *Manager) UpdateSettings(lobbyId types.LobbyId, host playertypes.PlayerId, update SettingsUpdate) error {
+	lobby, err := m.store.RetrieveLobby(lobbyId)
+	if err != nil {
+		return err
+	}
+	err = checkHost(lobby, host)
+	if err != nil {
+		return err
+	}
+
+	settings := lobby.Settings.WithDefaults()
+	if update.MaxPlayers != nil {
+		settings.MaxPlayers = *update.MaxPlayers
+	}
+	if update.Visibility != nil {
+		settings.Visibility = *update.Visibility
+	}
+	if update.GameDefaults != nil {
+		settings.GameDefaults = *update.GameDefaults
+	}
+	err = validateSettings(lobby, settings)
+	if err != nil {
+		return err
+	}
+	if update.Password != nil {
+		settings.PasswordHash, err = hashJoinPassword(*update.Password)
+		if err != nil {
+			return err
+		}
+	}
+
+	lobby.Settings = settings
+	err = m.store.StoreLobby(lobby)
+	if err != nil {
+		return err
+	}
+
+	m.publisher.Publish(events.NewTypedEvent(EventSettingsChanged, SettingsChanged{
+		LobbyId:      lobbyId,
+		MaxPlayers:   settings.MaxPlayers,
+		Visibility:   settings.Visibility,
+		HasPassword:  settings.HasPassword(),
+		GameDefaults: settings.GameDefaults,
+	}))
+
+	return nil
+}
+
+func validateSettings(lobby *types.Lobby, settings types.Settings) error {
+	if settings.MaxPlayers < 0 {
+		return &errors.InvalidInputError{ErrMessage: "max_players can't be negative"}
+	}
+	// Players already in the lobby aren't turned out, so it can't be made smaller than it is
+	if settings.MaxPlayers > 0 && settings.MaxPlayers < len(lobby.Players) {
+		return &errors.InvalidInputError{
+			ErrMessage: fmt.Sprintf("max_players can't be below the %d players already in the lobby", len(lobby.Players)),
+		}
+	}
+	if settings.Visibility != types.VisibilityPublic && settings.Visibility != types.VisibilityPrivate {
+		return &errors.InvalidInputError{
+			ErrMessage: fmt.Sprintf("visibility must be %s or %s", types.VisibilityPublic, types.VisibilityPrivate),
+		}
+	}
+	return types.ValidateBoardSize(settings.GameDefaults.BoardSize)
+}
+
+// ListPublicLobbies returns the lobbies anyone can find by name, for players looking for one to join
+func (m *Manager) ListPublicLobbies() ([]*types.Lobby, error) {
+	lobbies, err := m.store.RetrieveAllLobbies()
+	if err != nil {
+		return nil, err
+	}
+	public := make([]*types.Lobby, 0)
+	for _, lobby := range lobbies {
+		if lobby.Settings.IsPublic() {
+			public = append(public, lobby)
+		}
+	}
+	slices.SortFunc(public, func(a, b *types.Lobby) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.Id, b.Id))
+	})
+	return public, nil
+}
+
+// checkCanJoin returns an error if the lobby's settings keep the player out, given the password they joined with
+func checkCanJoin(lobby *types.Lobby, joinPassword string) error {
+	if lobby.Locked {
+		return &errors.InvalidActionError{
+			Action: "join_player_to_lobby",
+			Reason: fmt.Sprintf("lobby %s is locked", lobby.Id),
+		}
+	}
+	if lobby.Settings.IsFull(len(lobby.Players)) {
+		return &errors.InvalidActionError{
+			Action: "join_player_to_lobby",
+			Reason: fmt.Sprintf("lobby %s is full", lobby.Id),
+		}
+	}
+	if lobby.Settings.HasPassword() && !password.Check(lobby.Settings.PasswordHash, joinPassword) {
+		return &errors.ForbiddenError{Reason: fmt.Sprintf("wrong password for lobby %s", lobby.Id)}
+	}
+	return nil
+}
+
+// hashJoinPassword hashes a lobby's join password, or returns "" to remove it
+func hashJoinPassword(joinPassword string) (string, error) {
+	if joinPassword == "" {
+		return "", nil
+	}
+	return password.Hash(joinPassword)
+}
@@ -3,15 +3,21 @@ package types
 import (
 	"github.com/hashicorp/go-uuid"
 	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"slices"
 )
 
 type LobbyId string
 
 type Lobby struct {
-	Id          LobbyId
-	Name        string
-	Players     []playertypes.PlayerId
-	RunningGame *RunningGame
+	Id          LobbyId                `json:"id"`
+	Name        string                 `json:"name"`
+	Players     []playertypes.PlayerId `json:"players"`
+	RunningGame *RunningGame           `json:"running_game,omitempty"`
+	// Host is the player who runs the lobby; lobbies without one let any of their players run them
+	Host playertypes.PlayerId `json:"host,omitempty"`
+	// Locked lobbies can't be joined, though their players may stay
+	Locked   bool     `json:"locked,omitempty"`
+	Settings Settings `json:"settings"`
 }
 
 func NewLobby(name string) (*Lobby, error) {
@@ -26,9 +32,33 @@ func NewLobby(name string) (*Lobby, error) {
 		Name:        name,
 		Players:     make([]playertypes.PlayerId, 0),
 		RunningGame: nil,
+		Settings:    DefaultSettings(),
 	}, nil
 }
 
+func (l *Lobby) HasHost() bool {
+	return l.Host != ""
+}
+
+// IsRunBy is whether the player may run the lobby, e.g. start games in it and kick players
+func (l *Lobby) IsRunBy(playerId playertypes.PlayerId) bool {
+	if l.HasHost() {
+		return l.Host == playerId
+	}
+	return slices.Contains(l.Players, playerId)
+}
+
 func (l *Lobby) HasRunningGame() bool {
 	return l.RunningGame != nil
 }
+
+// Clone returns a deep copy of the lobby, so it can be mutated without affecting the original
+func (l *Lobby) Clone() *Lobby {
+	clone := *l
+	clone.Players = slices.Clone(l.Players)
+	if l.RunningGame != nil {
+		runningGame := *l.RunningGame
+		clone.RunningGame = &runningGame
+	}
+	return &clone
+}
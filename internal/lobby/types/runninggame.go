@@ -5,5 +5,5 @@ import (
 )
 
 type RunningGame struct {
-	GameId types.GameId
+	GameId types.GameId `json:"game_id"`
 }
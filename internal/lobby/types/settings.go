@@ -0,0 +1,76 @@
+package types
+
+import (
+	"fmt"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+)
+
+const (
+	MinBoardSize     = 2
+	MaxBoardSize     = 10
+	DefaultBoardSize = 5
+)
+
+// Visibility is whether a lobby is listed for anyone to find, though either kind can be joined with its ID
+type Visibility string
+
+const (
+	VisibilityPublic  Visibility = "public"
+	VisibilityPrivate Visibility = "private"
+)
+
+// Settings are the host's choices for who can join the lobby and how its games are played
+type Settings struct {
+	// MaxPlayers is how many players the lobby can hold, or 0 for no limit
+	MaxPlayers int        `json:"max_players,omitempty"`
+	Visibility Visibility `json:"visibility,omitempty"`
+	// PasswordHash is the bcrypt hash of the password needed to join, if there is one
+	PasswordHash string      `json:"password_hash,omitempty"`
+	GameDefaults GameOptions `json:"game_defaults"`
+}
+
+// GameOptions are how a game started in the lobby is set up, unless the host chooses otherwise
+// The board size is the only option so far, as games have no rule sets, dictionaries or timers to choose between
+type GameOptions struct {
+	BoardSize int `json:"board_size,omitempty"`
+}
+
+// DefaultSettings are those of new lobbies, which are private, unlimited and have no password
+func DefaultSettings() Settings {
+	return Settings{}.WithDefaults()
+}
+
+// IsPublic is whether the lobby is listed for anyone to find
+func (s Settings) IsPublic() bool {
+	return s.Visibility == VisibilityPublic
+}
+
+func (s Settings) HasPassword() bool {
+	return s.PasswordHash != ""
+}
+
+// IsFull is whether the lobby can't take any more than the given number of players
+func (s Settings) IsFull(playerCount int) bool {
+	return s.MaxPlayers > 0 && playerCount >= s.MaxPlayers
+}
+
+// WithDefaults fills in any settings left unset, e.g. by lobbies stored before they were settings
+func (s Settings) WithDefaults() Settings {
+	if s.Visibility == "" {
+		s.Visibility = VisibilityPrivate
+	}
+	if s.GameDefaults.BoardSize == 0 {
+		s.GameDefaults.BoardSize = DefaultBoardSize
+	}
+	return s
+}
+
+// ValidateBoardSize returns an InvalidInputError unless games can be played on a board of the size
+func ValidateBoardSize(boardSize int) error {
+	if boardSize < MinBoardSize || boardSize > MaxBoardSize {
+		return &errors.InvalidInputError{
+			ErrMessage: fmt.Sprintf("board_size must be between %d and %d", MinBoardSize, MaxBoardSize),
+		}
+	}
+	return nil
+}
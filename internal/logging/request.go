@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"context"
+	"github.com/mcoot/crosswordgame-go/internal/utils"
+	"sync"
+)
+
+const (
+	requestIdKey       = utils.ContextKey("requestId")
+	accessLogFieldsKey = utils.ContextKey("accessLogFields")
+)
+
+// RequestIdHeader carries the request's ID, which is taken from the request if the client or a proxy set it,
+// and echoed on the response so users can quote it when reporting a problem
+const RequestIdHeader = "X-Request-ID"
+
+func AddRequestIdToContext(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdKey, requestId)
+}
+
+// GetRequestId returns the ID of the request being served, or "" outside of a request
+func GetRequestId(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey).(string)
+	return requestId
+}
+
+// AccessLogFields collects fields for a request's access log line from the handlers serving it,
+// since the access log is written by middleware that never sees the contexts they derive
+type AccessLogFields struct {
+	mutex  sync.Mutex
+	fields []any
+}
+
+// Add appends key-value pairs, as for zap's Infow
+func (f *AccessLogFields) Add(keysAndValues ...any) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.fields = append(f.fields, keysAndValues...)
+}
+
+func (f *AccessLogFields) Fields() []any {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]any(nil), f.fields...)
+}
+
+func AddAccessLogFieldsToContext(ctx context.Context) (context.Context, *AccessLogFields) {
+	fields := &AccessLogFields{}
+	return context.WithValue(ctx, accessLogFieldsKey, fields), fields
+}
+
+// GetAccessLogFields returns the request's access log fields, which are discarded if there is no access log
+func GetAccessLogFields(ctx context.Context) *AccessLogFields {
+	fields, ok := ctx.Value(accessLogFieldsKey).(*AccessLogFields)
+	if !ok {
+		return &AccessLogFields{}
+	}
+	return fields
+}
@@ -0,0 +1,176 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "crosswordgame"
+
+// RouteUnmatched labels requests which matched no route, so arbitrary paths can't create new series
+const RouteUnmatched = "unmatched"
+
+// Metrics holds everything the server reports to Prometheus, in a registry of its own
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests        *prometheus.CounterVec
+	httpRequestDuration *prometheus.HistogramVec
+
+	gamesCreated  *prometheus.CounterVec
+	gamesFinished *prometheus.CounterVec
+	turnDuration  *prometheus.HistogramVec
+	scores        *prometheus.HistogramVec
+
+	sseConnections         prometheus.Gauge
+	storeOperationDuration *prometheus.HistogramVec
+	dictionaryLoadDuration prometheus.Gauge
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests handled, by route template, method and status code",
+		}, []string{"route", "method", "code"}),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to handle HTTP requests, by route template and method; live connections last until they close",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		gamesCreated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "games_created_total",
+			Help:      "Games created, by board size",
+		}, []string{"board_size"}),
+		gamesFinished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "games_finished_total",
+			Help:      "Games played to the end, by board size",
+		}, []string{"board_size"}),
+		turnDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "turn_duration_seconds",
+			Help:      "Time from a turn starting until every player has placed its letter, by board size",
+			Buckets:   []float64{5, 10, 15, 30, 45, 60, 90, 120, 180, 300, 600},
+		}, []string{"board_size"}),
+		scores: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "game_scores",
+			Help:      "Players' final scores in finished games, by board size",
+			Buckets:   prometheus.LinearBuckets(0, 5, 12),
+		}, []string{"board_size"}),
+		sseConnections: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "sse_connections",
+			Help:      "Open server-sent event connections from lobby pages",
+		}),
+		storeOperationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "store_operation_duration_seconds",
+			Help:      "Time taken by datastore operations, by operation",
+			Buckets:   []float64{.00001, .00005, .0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+		}, []string{"operation"}),
+		dictionaryLoadDuration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "dictionary_load_duration_seconds",
+			Help:      "Time taken to load the dictionary and build its word matcher at startup",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpRequestDuration,
+		m.gamesCreated,
+		m.gamesFinished,
+		m.turnDuration,
+		m.scores,
+		m.sseConnections,
+		m.storeOperationDuration,
+		m.dictionaryLoadDuration,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format, counting scrapes as it does
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.InstrumentMetricHandler(
+		m.registry,
+		promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry}),
+	)
+}
+
+func (m *Metrics) ObserveHTTPRequest(route string, method string, code int, duration time.Duration) {
+	m.httpRequests.WithLabelValues(route, method, strconv.Itoa(code)).Inc()
+	m.httpRequestDuration.WithLabelValues(route, method).Observe(duration.Seconds())
+}
+
+func (m *Metrics) GameCreated(boardDimension int) {
+	m.gamesCreated.WithLabelValues(strconv.Itoa(boardDimension)).Inc()
+}
+
+func (m *Metrics) TurnCompleted(boardDimension int, duration time.Duration) {
+	m.turnDuration.WithLabelValues(strconv.Itoa(boardDimension)).Observe(duration.Seconds())
+}
+
+func (m *Metrics) GameFinished(boardDimension int, scores []int) {
+	boardSize := strconv.Itoa(boardDimension)
+	m.gamesFinished.WithLabelValues(boardSize).Inc()
+	for _, score := range scores {
+		m.scores.WithLabelValues(boardSize).Observe(float64(score))
+	}
+}
+
+// SSEConnections counts open lobby page connections, for the SSE server to keep up to date
+func (m *Metrics) SSEConnections() prometheus.Gauge {
+	return m.sseConnections
+}
+
+func (m *Metrics) ObserveStoreOperation(operation string, duration time.Duration) {
+	m.storeOperationDuration.WithLabelValues(operation).Observe(duration.Seconds())
+}
+
+func (m *Metrics) SetDictionaryLoadDuration(duration time.Duration) {
+	m.dictionaryLoadDuration.Set(duration.Seconds())
+}
+
+// ObserveActiveGames reports the number of games being played, counted by count each time metrics are collected
+// Counting from the store, rather than from games starting and finishing, keeps it right across restarts and imports
+func (m *Metrics) ObserveActiveGames(count func() (int, error)) {
+	m.registry.MustRegister(&activeGamesCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "games_active"),
+			"Unfinished games with a move in the last hour",
+			nil,
+			nil,
+		),
+		count: count,
+	})
+}
+
+type activeGamesCollector struct {
+	desc  *prometheus.Desc
+	count func() (int, error)
+}
+
+func (c *activeGamesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *activeGamesCollector) Collect(ch chan<- prometheus.Metric) {
+	active, err := c.count()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(active))
+}
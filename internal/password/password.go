@@ -0,0 +1,30 @@
+package password
+
+import (
+	"fmt"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MaxLength is the most bcrypt will hash, beyond which passwords would be silently truncated
+const MaxLength = 72
+
+// Hash hashes a password for storing, rejecting those too long to hash whole
+func Hash(plaintext string) (string, error) {
+	if len(plaintext) > MaxLength {
+		return "", &errors.InvalidInputError{
+			ErrMessage: fmt.Sprintf("password can't be longer than %d characters", MaxLength),
+		}
+	}
+	// bcrypt salts each hash itself, and its cost makes guessing passwords from a stolen hash slow
+	hash, err := bcrypt.GenerateFromPassword([]byte(plaintext), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Check reports whether the password is the one the hash was made from
+func Check(hash string, plaintext string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(plaintext)) == nil
+}
@@ -0,0 +1,193 @@
+package player
+
+import (
+	"fmt"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	"github.com/mcoot/crosswordgame-go/internal/password"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"strings"
+	"time"
+)
+
+const minPasswordLength = 8
+
+// errInvalidCredentials is deliberately the same whether or not the username exists
+var errInvalidCredentials = &errors.UnauthorizedError{Reason: "invalid username or password"}
+
+// dummyPasswordHash is checked against when logging in as a player who doesn't exist or has no password,
+// so the response takes as long as for a wrong password and doesn't reveal which usernames are taken
+var dummyPasswordHash = mustHashPassword("not a real password")
+
+// Register creates a registered player who logs in with the given password
+// The username is lower-cased, and the display name defaults to it
+func (m *Manager) Register(username playertypes.PlayerId, displayName string, password string) (playertypes.PlayerId, error) {
+	player, err := m.newAccount(username, displayName, password)
+	if err != nil {
+		return "", err
+	}
+
+	err = m.store.StorePlayer(player)
+	if err != nil {
+		return "", err
+	}
+
+	m.publisher.Publish(events.NewTypedEvent(EventPlayerCreated, PlayerCreated{
+		PlayerId:    player.Username,
+		Kind:        player.Kind,
+		DisplayName: player.DisplayName,
+	}))
+
+	return player.Username, nil
+}
+
+// UpgradeToRegistered creates a registered player to take over from an ephemeral one, keeping their display name
+// The caller is responsible for moving the player's lobby and games to the returned ID
+func (m *Manager) UpgradeToRegistered(
+	ephemeralId playertypes.PlayerId,
+	username playertypes.PlayerId,
+	password string,
+) (playertypes.PlayerId, error) {
+	ephemeral, err := m.store.RetrievePlayer(ephemeralId)
+	if err != nil {
+		return "", err
+	}
+	if ephemeral.IsRegistered() {
+		return "", &errors.InvalidActionError{
+			Action: "upgrade_to_registered",
+			Reason: "player is already registered",
+		}
+	}
+
+	player, err := m.newAccount(username, ephemeral.DisplayName, password)
+	if err != nil {
+		return "", err
+	}
+
+	// The ephemeral player is left behind, like those whose sessions expire, so old references to it still resolve
+	err = m.store.StorePlayer(player)
+	if err != nil {
+		return "", err
+	}
+
+	m.publisher.Publish(events.NewTypedEvent(EventPlayerUpgraded, PlayerUpgraded{
+		PreviousPlayerId: ephemeral.Username,
+		PlayerId:         player.Username,
+		DisplayName:      player.DisplayName,
+	}))
+
+	return player.Username, nil
+}
+
+// newAccount builds a registered player with a hashed password, checking the username is free
+func (m *Manager) newAccount(username playertypes.PlayerId, displayName string, password string) (*playertypes.Player, error) {
+	username = playertypes.PlayerId(strings.ToLower(string(username)))
+	if displayName == "" {
+		displayName = string(username)
+	}
+	player, err := playertypes.NewRegisteredPlayer(username, displayName)
+	if err != nil {
+		return nil, err
+	}
+	player.PasswordHash, err = hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	// TODO: a database should enforce unique usernames, as concurrent sign-ups can both pass this check
+	_, err = m.store.RetrievePlayer(username)
+	if err == nil {
+		return nil, &errors.InvalidActionError{
+			Action: "register",
+			Reason: fmt.Sprintf("username %s is taken", username),
+		}
+	}
+	if !errors.IsNotFoundError(err) {
+		return nil, err
+	}
+	return player, nil
+}
+
+// LoginWithPassword checks a registered player's password, recording the login if it is right
+func (m *Manager) LoginWithPassword(username playertypes.PlayerId, plaintext string) (playertypes.PlayerId, error) {
+	username = playertypes.PlayerId(strings.ToLower(string(username)))
+	player, err := m.store.RetrievePlayer(username)
+	if err != nil && !errors.IsNotFoundError(err) {
+		return "", err
+	}
+	if player == nil || !player.IsRegistered() || player.PasswordHash == "" {
+		_ = password.Check(dummyPasswordHash, plaintext)
+		return "", errInvalidCredentials
+	}
+	if !password.Check(player.PasswordHash, plaintext) {
+		return "", errInvalidCredentials
+	}
+
+	player.LastLogin = time.Now()
+	err = m.store.StorePlayer(player)
+	if err != nil {
+		return "", err
+	}
+	return player.Username, nil
+}
+
+// ChangePassword replaces a registered player's password, which requires their current one
+// It logs them out of every session, as RevokeSessions does, so the caller should log the current one back in
+func (m *Manager) ChangePassword(playerId playertypes.PlayerId, currentPassword string, newPassword string) error {
+	player, err := m.store.RetrievePlayer(playerId)
+	if err != nil {
+		return err
+	}
+	if !player.IsRegistered() {
+		return &errors.InvalidActionError{
+			Action: "change_password",
+			Reason: "only registered players have a password",
+		}
+	}
+	if !password.Check(player.PasswordHash, currentPassword) {
+		return &errors.UnauthorizedError{Reason: "current password is incorrect"}
+	}
+
+	player.PasswordHash, err = hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	// Whoever knew the old password may still be logged in with it
+	player.SessionsRevokedAt = time.Now()
+	return m.store.StorePlayer(player)
+}
+
+// RevokeSessions logs a registered player out of every session they have logged in to so far
+func (m *Manager) RevokeSessions(playerId playertypes.PlayerId) error {
+	player, err := m.store.RetrievePlayer(playerId)
+	if err != nil {
+		return err
+	}
+	if !player.IsRegistered() {
+		return &errors.InvalidActionError{
+			Action: "revoke_sessions",
+			Reason: "guests only have the one session, so should log out instead",
+		}
+	}
+
+	player.SessionsRevokedAt = time.Now()
+	return m.store.StorePlayer(player)
+}
+
+// hashPassword hashes a registered player's password, which needs to be long enough to be hard to guess
+func hashPassword(plaintext string) (string, error) {
+	if len(plaintext) < minPasswordLength || len(plaintext) > password.MaxLength {
+		return "", &errors.InvalidInputError{
+			ErrMessage: fmt.Sprintf("password must be %d to %d characters", minPasswordLength, password.MaxLength),
+		}
+	}
+	return password.Hash(plaintext)
+}
+
+func mustHashPassword(plaintext string) string {
+	hash, err := hashPassword(plaintext)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+}
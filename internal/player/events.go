@@ -0,0 +1,36 @@
+package player
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+)
+
+const (
+	EventPlayerCreated  events.Kind = "player.created"
+	EventPlayerUpgraded events.Kind = "player.upgraded"
+)
+
+// EventKinds lists every kind of event published by the player manager
+var EventKinds = []events.Kind{
+	EventPlayerCreated,
+	EventPlayerUpgraded,
+}
+
+// RegisterEventTypes lets the codec decode every kind of event published by the player manager
+func RegisterEventTypes(codec *events.Codec) {
+	events.Register[PlayerCreated](codec, EventPlayerCreated)
+	events.Register[PlayerUpgraded](codec, EventPlayerUpgraded)
+}
+
+type PlayerCreated struct {
+	PlayerId    playertypes.PlayerId   `json:"player_id"`
+	Kind        playertypes.PlayerKind `json:"kind"`
+	DisplayName string                 `json:"display_name"`
+}
+
+// PlayerUpgraded is published when an ephemeral player registers, taking on a new ID
+type PlayerUpgraded struct {
+	PreviousPlayerId playertypes.PlayerId `json:"previous_player_id"`
+	PlayerId         playertypes.PlayerId `json:"player_id"`
+	DisplayName      string               `json:"display_name"`
+}
@@ -0,0 +1,155 @@
+package player
+
+import (
+	"fmt"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"strings"
+	"time"
+)
+
+// maxUsernameSuffix bounds how many variations of a suggested username are tried before giving up
+const maxUsernameSuffix = 100
+
+// LoginWithExternalIdentity logs in the registered player linked to an identity, creating one on its first login
+// A new player is named after the provider's suggested username, with a number added if it is taken
+func (m *Manager) LoginWithExternalIdentity(
+	identity playertypes.ExternalIdentity,
+	suggestedUsername string,
+	displayName string,
+) (playertypes.PlayerId, error) {
+	player, err := m.findPlayerByExternalIdentity(identity)
+	if err != nil && !errors.IsNotFoundError(err) {
+		return "", err
+	}
+	if player != nil {
+		player.LastLogin = time.Now()
+		err = m.store.StorePlayer(player)
+		if err != nil {
+			return "", err
+		}
+		return player.Username, nil
+	}
+
+	username, err := m.freeUsername(suggestedUsername)
+	if err != nil {
+		return "", err
+	}
+	if displayName == "" {
+		displayName = string(username)
+	}
+	player, err = playertypes.NewRegisteredPlayer(username, displayName)
+	if err != nil {
+		return "", err
+	}
+	player.ExternalIdentity = &identity
+
+	err = m.store.StorePlayer(player)
+	if err != nil {
+		return "", err
+	}
+
+	m.publisher.Publish(events.NewTypedEvent(EventPlayerCreated, PlayerCreated{
+		PlayerId:    player.Username,
+		Kind:        player.Kind,
+		DisplayName: player.DisplayName,
+	}))
+
+	return player.Username, nil
+}
+
+// LinkExternalIdentity lets a registered player sign in with an identity from then on, replacing any linked before
+// Identities are only ever linked by a logged-in player, never matched up by email, which providers may not verify
+func (m *Manager) LinkExternalIdentity(playerId playertypes.PlayerId, identity playertypes.ExternalIdentity) error {
+	player, err := m.store.RetrievePlayer(playerId)
+	if err != nil {
+		return err
+	}
+	if !player.IsRegistered() {
+		return &errors.InvalidActionError{
+			Action: "link_external_identity",
+			Reason: "only registered players can link an identity",
+		}
+	}
+
+	linked, err := m.findPlayerByExternalIdentity(identity)
+	if err != nil && !errors.IsNotFoundError(err) {
+		return err
+	}
+	if linked != nil && linked.Username != player.Username {
+		return &errors.InvalidActionError{
+			Action: "link_external_identity",
+			Reason: "the identity is already linked to another player",
+		}
+	}
+
+	player.ExternalIdentity = &identity
+	return m.store.StorePlayer(player)
+}
+
+// findPlayerByExternalIdentity returns the player an identity is linked to
+// TODO: this scans every player, and a database should index players by identity instead
+func (m *Manager) findPlayerByExternalIdentity(identity playertypes.ExternalIdentity) (*playertypes.Player, error) {
+	players, err := m.store.RetrieveAllPlayers()
+	if err != nil {
+		return nil, err
+	}
+	for _, player := range players {
+		if player.ExternalIdentity != nil && *player.ExternalIdentity == identity {
+			return player, nil
+		}
+	}
+	return nil, &errors.NotFoundError{
+		ObjectKind: "player",
+		ObjectID:   fmt.Sprintf("%s#%s", identity.Issuer, identity.Subject),
+	}
+}
+
+// freeUsername turns a suggested username into a valid one nobody has taken
+func (m *Manager) freeUsername(suggested string) (playertypes.PlayerId, error) {
+	base := sanitiseUsername(suggested)
+	for i := 1; i <= maxUsernameSuffix; i++ {
+		candidate := base
+		if i > 1 {
+			suffix := fmt.Sprintf("-%d", i)
+			candidate = base[:min(len(base), playertypes.MaxUsernameLength-len(suffix))] + suffix
+		}
+		_, err := m.store.RetrievePlayer(playertypes.PlayerId(candidate))
+		if errors.IsNotFoundError(err) {
+			return playertypes.PlayerId(candidate), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", &errors.InvalidActionError{
+		Action: "register",
+		Reason: fmt.Sprintf("username %s is taken", base),
+	}
+}
+
+const fallbackUsername = "player"
+
+// sanitiseUsername makes a username from a provider's suggestion, such as an email address or a full name
+func sanitiseUsername(suggested string) string {
+	suggested, _, _ = strings.Cut(strings.ToLower(suggested), "@")
+	var b strings.Builder
+	for _, c := range suggested {
+		switch {
+		case (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '_':
+			b.WriteRune(c)
+		default:
+			b.WriteRune('-')
+		}
+	}
+	username := strings.Trim(b.String(), "-")
+	if len(username) > playertypes.MaxUsernameLength {
+		username = username[:playertypes.MaxUsernameLength]
+	}
+	// Suggestions which are still invalid, e.g. too short, get a generic name instead
+	if err := playertypes.ValidateUsername(playertypes.PlayerId(username)); err != nil {
+		return fallbackUsername
+	}
+	return username
+}
@@ -1,18 +1,37 @@
 package player
 
 import (
+	"github.com/mcoot/crosswordgame-go/internal/events"
 	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
 	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
 	"github.com/mcoot/crosswordgame-go/internal/store"
 )
 
 type Manager struct {
-	store store.PlayerStore
+	store     store.PlayerStore
+	publisher events.Publisher
 }
 
-func NewPlayerManager(store store.PlayerStore) *Manager {
+func NewPlayerManager(store store.PlayerStore, publisher events.Publisher) *Manager {
 	return &Manager{
-		store: store,
+		store:     store,
+		publisher: publisher,
+	}
+}
+
+// WithStore returns a copy of the manager operating on the given store, e.g. a transaction
+func (m *Manager) WithStore(store store.PlayerStore) *Manager {
+	return &Manager{
+		store:     store,
+		publisher: m.publisher,
+	}
+}
+
+// WithPublisher returns a copy of the manager publishing its events to the given publisher
+func (m *Manager) WithPublisher(publisher events.Publisher) *Manager {
+	return &Manager{
+		store:     m.store,
+		publisher: publisher,
 	}
 }
 
@@ -26,6 +45,12 @@ func (m *Manager) LoginAsEphemeral(displayName string) (playertypes.PlayerId, er
 		return "", err
 	}
 
+	m.publisher.Publish(events.NewTypedEvent(EventPlayerCreated, PlayerCreated{
+		PlayerId:    player.Username,
+		Kind:        player.Kind,
+		DisplayName: player.DisplayName,
+	}))
+
 	return player.Username, nil
 }
 
@@ -0,0 +1,88 @@
+package player
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"github.com/mcoot/crosswordgame-go/internal/store"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+// recordingPublisher keeps every event published to it, in order
+type recordingPublisher struct {
+	published []events.Event
+}
+
+func (p *recordingPublisher) Publish(event events.Event) {
+	p.published = append(p.published, event)
+}
+
+type PlayerManagerSuite struct {
+	suite.Suite
+	publisher *recordingPublisher
+	manager   *Manager
+}
+
+func TestPlayerManagerSuite(t *testing.T) {
+	suite.Run(t, new(PlayerManagerSuite))
+}
+
+func (s *PlayerManagerSuite) SetupTest() {
+	s.publisher = &recordingPublisher{}
+	s.manager = NewPlayerManager(store.NewInMemoryStore(), s.publisher)
+}
+
+// takePublished returns the events published since it was last called
+func (s *PlayerManagerSuite) takePublished() []events.Event {
+	published := s.publisher.published
+	s.publisher.published = nil
+	return published
+}
+
+func (s *PlayerManagerSuite) TestPublishesPlayerEvents() {
+	guestId, err := s.manager.LoginAsEphemeral("Guest")
+	s.Require().NoError(err)
+	s.Equal([]events.Event{
+		events.NewTypedEvent(EventPlayerCreated, PlayerCreated{
+			PlayerId:    guestId,
+			Kind:        playertypes.PlayerKindEphemeral,
+			DisplayName: "Guest",
+		}),
+	}, s.takePublished())
+
+	registeredId, err := s.manager.Register("Alice", "", "alice-password")
+	s.Require().NoError(err)
+	s.Equal([]events.Event{
+		events.NewTypedEvent(EventPlayerCreated, PlayerCreated{
+			PlayerId:    "alice",
+			Kind:        playertypes.PlayerKindRegistered,
+			DisplayName: "alice",
+		}),
+	}, s.takePublished())
+	s.Equal(playertypes.PlayerId("alice"), registeredId)
+
+	upgradedId, err := s.manager.UpgradeToRegistered(guestId, "guest-no-more", "guest-password")
+	s.Require().NoError(err)
+	s.Equal([]events.Event{
+		events.NewTypedEvent(EventPlayerUpgraded, PlayerUpgraded{
+			PreviousPlayerId: guestId,
+			PlayerId:         upgradedId,
+			DisplayName:      "Guest",
+		}),
+	}, s.takePublished())
+}
+
+func (s *PlayerManagerSuite) TestRejectedSignupsPublishNothing() {
+	_, err := s.manager.Register("alice", "", "alice-password")
+	s.Require().NoError(err)
+	s.takePublished()
+
+	_, err = s.manager.Register("Alice", "", "another-password")
+	s.Error(err)
+	_, err = s.manager.Register("bob", "", "short")
+	s.Error(err)
+	_, err = s.manager.UpgradeToRegistered("alice", "alice2", "alice-password")
+	s.Error(err)
+
+	s.Empty(s.takePublished())
+}
@@ -20,10 +20,22 @@ const (
 type PlayerId string
 
 type Player struct {
-	Kind        PlayerKind
-	Username    PlayerId
-	DisplayName string
-	LastLogin   time.Time
+	Kind        PlayerKind `json:"kind"`
+	Username    PlayerId   `json:"username"`
+	DisplayName string     `json:"display_name"`
+	LastLogin   time.Time  `json:"last_login"`
+	// PasswordHash is the salted bcrypt hash of a registered player's password
+	PasswordHash string `json:"password_hash,omitempty"`
+	// ExternalIdentity is the account at an OpenID Connect provider a registered player can sign in with, if any
+	ExternalIdentity *ExternalIdentity `json:"external_identity,omitempty"`
+	// SessionsRevokedAt ends every login made before it, when a registered player logs out everywhere
+	SessionsRevokedAt time.Time `json:"sessions_revoked_at,omitzero"`
+}
+
+// ExternalIdentity identifies an account at an OpenID Connect provider, which only the issuer and subject do reliably
+type ExternalIdentity struct {
+	Issuer  string `json:"issuer"`
+	Subject string `json:"subject"`
 }
 
 func newPlayer(kind PlayerKind, username PlayerId, displayName string, lastLogin time.Time) *Player {
@@ -46,12 +58,52 @@ func NewEphemeralPlayer(displayName string) (*Player, error) {
 }
 
 func NewRegisteredPlayer(username PlayerId, displayName string) (*Player, error) {
+	if err := ValidateUsername(username); err != nil {
+		return nil, err
+	}
+
+	// TODO: Creation shouldn't count as a login
+	return newPlayer(PlayerKindRegistered, username, displayName, time.Now()), nil
+}
+
+const (
+	minUsernameLength = 3
+	// MaxUsernameLength is the longest username a registered player can have
+	MaxUsernameLength = 32
+)
+
+// ValidateUsername checks a username chosen for a registered player
+// Usernames appear in URLs and are compared exactly, so only lower-case letters, digits, '-' and '_' are allowed
+func ValidateUsername(username PlayerId) error {
 	if strings.HasPrefix(string(username), ephemeralPlayerPrefix) {
-		return nil, &errors.InvalidInputError{
+		return &errors.InvalidInputError{
 			ErrMessage: fmt.Sprintf("username cannot start with %s", ephemeralPlayerPrefix),
 		}
 	}
+	if len(username) < minUsernameLength || len(username) > MaxUsernameLength {
+		return &errors.InvalidInputError{
+			ErrMessage: fmt.Sprintf("username must be %d to %d characters", minUsernameLength, MaxUsernameLength),
+		}
+	}
+	for _, c := range username {
+		if !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') && c != '-' && c != '_' {
+			return &errors.InvalidInputError{
+				ErrMessage: "username may only contain lower-case letters, digits, '-' and '_'",
+			}
+		}
+	}
+	return nil
+}
 
-	// TODO: Creation shouldn't count as a login
-	return newPlayer(PlayerKindRegistered, username, displayName, time.Now()), nil
+func (p *Player) IsRegistered() bool {
+	return p.Kind == PlayerKindRegistered
+}
+
+func (p *Player) Clone() *Player {
+	clone := *p
+	if p.ExternalIdentity != nil {
+		identity := *p.ExternalIdentity
+		clone.ExternalIdentity = &identity
+	}
+	return &clone
 }
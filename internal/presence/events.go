@@ -0,0 +1,29 @@
+package presence
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+)
+
+const (
+	EventPresenceChanged events.Kind = "presence.changed"
+)
+
+// EventKinds lists every kind of event published by the presence tracker
+var EventKinds = []events.Kind{
+	EventPresenceChanged,
+}
+
+// RegisterEventTypes lets the codec decode every kind of event published by the presence tracker
+func RegisterEventTypes(codec *events.Codec) {
+	events.Register[PresenceChanged](codec, EventPresenceChanged)
+}
+
+// PresenceChanged is published when a lobby member comes online, goes idle or disconnects
+// Going idle is only noticed when the member's presence is next read, or they change otherwise
+type PresenceChanged struct {
+	LobbyId  lobbytypes.LobbyId   `json:"lobby_id"`
+	PlayerId playertypes.PlayerId `json:"player_id"`
+	Status   Status               `json:"status"`
+}
@@ -0,0 +1,164 @@
+package presence
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusOnline       Status = "online"
+	StatusIdle         Status = "idle"
+	StatusDisconnected Status = "disconnected"
+)
+
+// Presence is how present a lobby member is
+// LastSeen is when they last did something in the lobby, and is zero if they never have
+type Presence struct {
+	Status   Status    `json:"status"`
+	LastSeen time.Time `json:"last_seen,omitzero"`
+}
+
+type Config struct {
+	// IdleAfter is how long a connected member may do nothing before they are idle
+	IdleAfter time.Duration
+	// DisconnectGrace is how long a member may be without a connection before they are disconnected,
+	// so reloading a page or briefly losing signal doesn't count
+	DisconnectGrace time.Duration
+}
+
+var DefaultConfig = Config{
+	IdleAfter:       2 * time.Minute,
+	DisconnectGrace: 10 * time.Second,
+}
+
+// Tracker follows the presence of lobby members from their live connections and activity
+type Tracker struct {
+	config    Config
+	publisher events.Publisher
+	now       func() time.Time
+	mutex     sync.Mutex
+	members   map[memberKey]*member
+}
+
+type memberKey struct {
+	lobbyId  lobbytypes.LobbyId
+	playerId playertypes.PlayerId
+}
+
+type member struct {
+	connections    int
+	lastSeen       time.Time
+	disconnectedAt time.Time
+	// reported is the status last published for the member
+	reported Status
+}
+
+func NewTracker(publisher events.Publisher, config Config) *Tracker {
+	return &Tracker{
+		config:    config,
+		publisher: publisher,
+		now:       time.Now,
+		members:   make(map[memberKey]*member),
+	}
+}
+
+// Connected records a new live connection from the member, e.g. an open lobby page or WebSocket
+func (t *Tracker) Connected(lobbyId lobbytypes.LobbyId, playerId playertypes.PlayerId) {
+	t.update(lobbyId, playerId, func(m *member, now time.Time) {
+		m.connections++
+		m.lastSeen = now
+	})
+}
+
+// Disconnected records that one of the member's connections has closed
+// Once they have had none for the grace period, they are reported as disconnected
+func (t *Tracker) Disconnected(lobbyId lobbytypes.LobbyId, playerId playertypes.PlayerId) {
+	lastConnection := false
+	t.update(lobbyId, playerId, func(m *member, now time.Time) {
+		if m.connections == 0 {
+			return
+		}
+		m.connections--
+		if m.connections == 0 {
+			m.disconnectedAt = now
+			lastConnection = true
+		}
+	})
+
+	if lastConnection {
+		// Check again once the grace period is over, in case they have not come back
+		time.AfterFunc(t.config.DisconnectGrace, func() {
+			t.update(lobbyId, playerId, func(m *member, now time.Time) {})
+		})
+	}
+}
+
+// Seen records activity from the member, e.g. a request or command
+func (t *Tracker) Seen(lobbyId lobbytypes.LobbyId, playerId playertypes.PlayerId) {
+	t.update(lobbyId, playerId, func(m *member, now time.Time) {
+		m.lastSeen = now
+	})
+}
+
+func (t *Tracker) Get(lobbyId lobbytypes.LobbyId, playerId playertypes.PlayerId) Presence {
+	return t.GetAll(lobbyId, []playertypes.PlayerId{playerId})[playerId]
+}
+
+// GetAll returns the presence of each of the players in the lobby
+func (t *Tracker) GetAll(lobbyId lobbytypes.LobbyId, playerIds []playertypes.PlayerId) map[playertypes.PlayerId]Presence {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.now()
+	result := make(map[playertypes.PlayerId]Presence, len(playerIds))
+	for _, playerId := range playerIds {
+		m, ok := t.members[memberKey{lobbyId: lobbyId, playerId: playerId}]
+		if !ok {
+			result[playerId] = Presence{Status: StatusDisconnected}
+			continue
+		}
+		result[playerId] = Presence{Status: t.status(m, now), LastSeen: m.lastSeen}
+	}
+	return result
+}
+
+// update changes the member's record, publishing their presence if it has changed
+func (t *Tracker) update(lobbyId lobbytypes.LobbyId, playerId playertypes.PlayerId, f func(m *member, now time.Time)) {
+	key := memberKey{lobbyId: lobbyId, playerId: playerId}
+
+	t.mutex.Lock()
+	m, ok := t.members[key]
+	if !ok {
+		m = &member{reported: StatusDisconnected}
+		t.members[key] = m
+	}
+	now := t.now()
+	f(m, now)
+	status := t.status(m, now)
+	changed := status != m.reported
+	m.reported = status
+	t.mutex.Unlock()
+
+	if changed {
+		t.publisher.Publish(events.NewTypedEvent(EventPresenceChanged, PresenceChanged{
+			LobbyId:  lobbyId,
+			PlayerId: playerId,
+			Status:   status,
+		}))
+	}
+}
+
+func (t *Tracker) status(m *member, now time.Time) Status {
+	if m.connections == 0 && now.Sub(m.disconnectedAt) >= t.config.DisconnectGrace {
+		return StatusDisconnected
+	}
+	if now.Sub(m.lastSeen) >= t.config.IdleAfter {
+		return StatusIdle
+	}
+	return StatusOnline
+}
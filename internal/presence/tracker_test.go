@@ -0,0 +1,138 @@
+package presence
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	"github.com/stretchr/testify/suite"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingPublisher keeps the presence changes published to it
+type recordingPublisher struct {
+	mutex   sync.Mutex
+	changes []PresenceChanged
+}
+
+func (p *recordingPublisher) Publish(event events.Event) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.changes = append(p.changes, event.(events.TypedEvent[PresenceChanged]).Data)
+}
+
+func (p *recordingPublisher) statuses() []Status {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	var statuses []Status
+	for _, c := range p.changes {
+		statuses = append(statuses, c.Status)
+	}
+	return statuses
+}
+
+type fakeClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
+type TrackerSuite struct {
+	suite.Suite
+	publisher *recordingPublisher
+	tracker   *Tracker
+	clock     *fakeClock
+}
+
+func TestTrackerSuite(t *testing.T) {
+	suite.Run(t, new(TrackerSuite))
+}
+
+func (s *TrackerSuite) SetupTest() {
+	s.publisher = &recordingPublisher{}
+	s.tracker = NewTracker(s.publisher, Config{
+		IdleAfter:       time.Minute,
+		DisconnectGrace: 10 * time.Millisecond,
+	})
+	s.clock = &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	s.tracker.now = s.clock.Now
+}
+
+func (s *TrackerSuite) TestUnknownMembersAreDisconnected() {
+	p := s.tracker.Get("lobby0", "player0")
+	s.Equal(StatusDisconnected, p.Status)
+	s.True(p.LastSeen.IsZero())
+}
+
+func (s *TrackerSuite) TestConnectedMembersGoIdleWithoutActivity() {
+	s.tracker.Connected("lobby0", "player0")
+	connectedAt := s.clock.Now()
+	s.Equal(Presence{Status: StatusOnline, LastSeen: connectedAt}, s.tracker.Get("lobby0", "player0"))
+
+	s.clock.Advance(2 * time.Minute)
+	s.Equal(Presence{Status: StatusIdle, LastSeen: connectedAt}, s.tracker.Get("lobby0", "player0"))
+
+	s.tracker.Seen("lobby0", "player0")
+	s.Equal(StatusOnline, s.tracker.Get("lobby0", "player0").Status)
+	s.Equal(s.clock.Now(), s.tracker.Get("lobby0", "player0").LastSeen)
+
+	// Presence is per lobby
+	s.Equal(StatusDisconnected, s.tracker.Get("lobby1", "player0").Status)
+}
+
+func (s *TrackerSuite) TestDisconnectionWaitsOutGracePeriod() {
+	s.tracker.Connected("lobby0", "player0")
+	s.tracker.Connected("lobby0", "player0")
+
+	// Closing one of several connections changes nothing
+	s.tracker.Disconnected("lobby0", "player0")
+	s.Equal(StatusOnline, s.tracker.Get("lobby0", "player0").Status)
+
+	s.tracker.Disconnected("lobby0", "player0")
+	s.Equal(StatusOnline, s.tracker.Get("lobby0", "player0").Status)
+
+	s.clock.Advance(time.Second)
+	s.Eventually(func() bool {
+		return len(s.publisher.statuses()) == 2
+	}, 5*time.Second, time.Millisecond)
+	s.Equal([]Status{StatusOnline, StatusDisconnected}, s.publisher.statuses())
+	s.Equal(StatusDisconnected, s.tracker.Get("lobby0", "player0").Status)
+}
+
+func (s *TrackerSuite) TestReconnectingWithinGracePeriodIsNotReported() {
+	s.tracker.Connected("lobby0", "player0")
+	s.tracker.Disconnected("lobby0", "player0")
+	s.tracker.Connected("lobby0", "player0")
+
+	// Let the grace period's check run, which must find them connected again
+	s.clock.Advance(time.Second)
+	time.Sleep(50 * time.Millisecond)
+	s.Equal([]Status{StatusOnline}, s.publisher.statuses())
+}
+
+func (s *TrackerSuite) TestActivityWithoutConnectionUpdatesLastSeen() {
+	s.tracker.Seen("lobby0", "player0")
+
+	p := s.tracker.Get("lobby0", "player0")
+	s.Equal(StatusDisconnected, p.Status)
+	s.Equal(s.clock.Now(), p.LastSeen)
+	s.Empty(s.publisher.statuses())
+}
+
+func (s *TrackerSuite) TestPublishesChangesWithLobbyAndPlayer() {
+	s.tracker.Connected("lobby0", "player0")
+
+	s.publisher.mutex.Lock()
+	defer s.publisher.mutex.Unlock()
+	s.Equal([]PresenceChanged{{LobbyId: "lobby0", PlayerId: "player0", Status: StatusOnline}}, s.publisher.changes)
+}
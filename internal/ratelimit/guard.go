@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+	"github.com/mcoot/crosswordgame-go/internal/logging"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Action is a kind of request, limited separately from the others
+type Action string
+
+const (
+	// ActionLogin covers everything which logs in or creates a player, limited by client IP as there is no player yet
+	ActionLogin Action = "login"
+	// ActionJoinLobby covers joining lobbies, limited by client IP so lobby passwords can't be guessed by many players
+	ActionJoinLobby   Action = "join_lobby"
+	ActionCreateLobby Action = "create_lobby"
+	ActionCreateGame  Action = "create_game"
+	// ActionMove covers announcing and placing letters
+	ActionMove Action = "move"
+)
+
+// ErrorSender responds with an error, as the API serving the request sends them
+type ErrorSender func(w http.ResponseWriter, r *http.Request, err error)
+
+// KeyFunc identifies who a request is limited as, e.g. with PlayerKey, or returns "" to limit it by client IP
+type KeyFunc func(r *http.Request) string
+
+// Guard limits how often each action may be taken, using a bucket per action and client IP or player
+type Guard struct {
+	limiter Limiter
+	limits  map[Action]Limit
+	// clientIPHeader is set by a trusted proxy to the client's IP, or is empty to use the address requests come from
+	clientIPHeader string
+}
+
+// NewGuard limits the actions given limits, leaving others unlimited
+func NewGuard(limiter Limiter, limits map[Action]Limit, clientIPHeader string) *Guard {
+	return &Guard{
+		limiter:        limiter,
+		limits:         limits,
+		clientIPHeader: clientIPHeader,
+	}
+}
+
+// PlayerKey limits a player's requests together, wherever they come from
+func PlayerKey(playerId playertypes.PlayerId) string {
+	return "player:" + string(playerId)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Allow returns a RateLimitedError once the key has used up its limit for the action
+func (g *Guard) Allow(ctx context.Context, action Action, key string) error {
+	limit, ok := g.limits[action]
+	if !ok {
+		return nil
+	}
+
+	result, err := g.limiter.Allow(ctx, fmt.Sprintf("%s:%s", action, key), limit)
+	if err != nil {
+		// Failing open keeps the game playable if a shared limiter is unavailable
+		logging.GetLogger(ctx).Errorw("error checking rate limit, so allowing the request", "action", action, "error", err)
+		return nil
+	}
+	if result.Allowed {
+		return nil
+	}
+	// Clients are told whole seconds, so round up to be sure a retry then is allowed
+	retryAfter := (result.RetryAfter + time.Second - 1).Truncate(time.Second)
+	return &errors.RateLimitedError{RetryAfter: max(time.Second, retryAfter)}
+}
+
+// Middleware rejects requests for the action once their key has used up its limit, with a Retry-After header
+// Requests are limited by client IP if key is nil or returns ""
+func (g *Guard) Middleware(action Action, key KeyFunc, sendError ErrorSender) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestKey := ""
+			if key != nil {
+				requestKey = key(r)
+			}
+			if requestKey == "" {
+				requestKey = ipKey(g.ClientIP(r))
+			}
+
+			err := g.Allow(r.Context(), action, requestKey)
+			if err != nil {
+				if limited, ok := err.(*errors.RateLimitedError); ok {
+					w.Header().Set("Retry-After", strconv.Itoa(int(limited.RetryAfter.Seconds())))
+				}
+				logging.GetAccessLogFields(r.Context()).Add("rate_limited", action)
+				sendError(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP is the address a request came from, or that the trusted proxy in front of the server says it came from
+func (g *Guard) ClientIP(r *http.Request) string {
+	if g.clientIPHeader != "" {
+		// Proxies append to lists such as X-Forwarded-For, so only the last entry is from the trusted one
+		values := strings.Split(r.Header.Get(g.clientIPHeader), ",")
+		if ip := strings.TrimSpace(values[len(values)-1]); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets which have refilled are forgotten, so clients seen once don't use memory forever
+const sweepInterval = time.Minute
+
+// InMemoryLimiter keeps its buckets in process, for running a single replica
+type InMemoryLimiter struct {
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	lastSwept time.Time
+	// now is overridden by tests to move time on
+	now func() time.Time
+}
+
+type bucket struct {
+	limit   Limit
+	tokens  float64
+	updated time.Time
+}
+
+func NewInMemoryLimiter() *InMemoryLimiter {
+	return &InMemoryLimiter{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (l *InMemoryLimiter) Allow(_ context.Context, key string, limit Limit) (Result, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limit: limit, tokens: float64(limit.Burst), updated: now}
+		l.buckets[key] = b
+	}
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return Result{Allowed: true}, nil
+	}
+	return Result{RetryAfter: time.Duration((1 - b.tokens) * float64(limit.Interval))}, nil
+}
+
+// sweep forgets full buckets, which are no different from the new buckets that would replace them
+func (l *InMemoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSwept) < sweepInterval {
+		return
+	}
+	l.lastSwept = now
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated)
+	if elapsed <= 0 {
+		return
+	}
+	b.tokens = min(float64(b.limit.Burst), b.tokens+float64(elapsed)/float64(b.limit.Interval))
+	b.updated = now
+}
@@ -0,0 +1,33 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limit is a token bucket, letting Burst requests through at once and then one more every Interval
+type Limit struct {
+	Burst    int
+	Interval time.Duration
+}
+
+// Result is whether a request may go ahead, and if not, how long until one may
+type Result struct {
+	Allowed    bool
+	RetryAfter time.Duration
+}
+
+// Limiter keeps a token bucket for each key, which requests take tokens from
+// Buckets may be kept in process, so each replica limits separately, or shared between replicas
+type Limiter interface {
+	// Allow takes a token from the key's bucket if it has one
+	// Each key must always be checked against the same limit
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// Unlimited lets every request through, for when rate limiting is turned off
+type Unlimited struct{}
+
+func (Unlimited) Allow(context.Context, string, Limit) (Result, error) {
+	return Result{Allowed: true}, nil
+}
@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testLimit = Limit{Burst: 2, Interval: 10 * time.Second}
+
+type RateLimitSuite struct {
+	suite.Suite
+	limiter *InMemoryLimiter
+	now     time.Time
+}
+
+func TestRateLimitSuite(t *testing.T) {
+	suite.Run(t, new(RateLimitSuite))
+}
+
+func (s *RateLimitSuite) SetupTest() {
+	s.now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.limiter = NewInMemoryLimiter()
+	s.limiter.now = func() time.Time { return s.now }
+}
+
+func (s *RateLimitSuite) allow(key string) Result {
+	result, err := s.limiter.Allow(context.Background(), key, testLimit)
+	s.Require().NoError(err)
+	return result
+}
+
+func (s *RateLimitSuite) TestBucketsAllowABurstThenRefill() {
+	s.True(s.allow("alice").Allowed)
+	s.True(s.allow("alice").Allowed)
+	s.Equal(Result{RetryAfter: 10 * time.Second}, s.allow("alice"))
+	// Other keys have their own buckets
+	s.True(s.allow("bob").Allowed)
+
+	s.now = s.now.Add(4 * time.Second)
+	s.Equal(Result{RetryAfter: 6 * time.Second}, s.allow("alice"))
+	s.now = s.now.Add(6 * time.Second)
+	s.True(s.allow("alice").Allowed)
+	s.False(s.allow("alice").Allowed)
+
+	// Buckets refill no further than the burst
+	s.now = s.now.Add(time.Hour)
+	s.True(s.allow("alice").Allowed)
+	s.True(s.allow("alice").Allowed)
+	s.False(s.allow("alice").Allowed)
+}
+
+func (s *RateLimitSuite) TestFullBucketsAreForgotten() {
+	s.allow("alice")
+	slowLimit := Limit{Burst: 1, Interval: time.Hour}
+	_, err := s.limiter.Allow(context.Background(), "bob", slowLimit)
+	s.Require().NoError(err)
+
+	// Alice's bucket has refilled by the next sweep, but Bob's hasn't
+	s.now = s.now.Add(sweepInterval + time.Second)
+	s.allow("carol")
+	s.Len(s.limiter.buckets, 2)
+	s.Contains(s.limiter.buckets, "carol")
+	s.Contains(s.limiter.buckets, "bob")
+}
+
+func (s *RateLimitSuite) TestMiddlewareRejectsWithRetryAfter() {
+	guard := NewGuard(s.limiter, map[Action]Limit{ActionLogin: testLimit}, "")
+	var sent error
+	handler := guard.Middleware(ActionLogin, nil, func(w http.ResponseWriter, r *http.Request, err error) {
+		sent = err
+		w.WriteHeader(http.StatusTooManyRequests)
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	serve := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/login", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	s.Equal(http.StatusNoContent, serve("192.0.2.1:1234").Code)
+	s.Equal(http.StatusNoContent, serve("192.0.2.1:5678").Code)
+
+	s.now = s.now.Add(1500 * time.Millisecond)
+	w := serve("192.0.2.1:1234")
+	s.Equal(http.StatusTooManyRequests, w.Code)
+	s.Equal("9", w.Header().Get("Retry-After"))
+	s.Equal(&errors.RateLimitedError{RetryAfter: 9 * time.Second}, sent)
+	s.Equal(http.StatusNoContent, serve("192.0.2.2:1234").Code)
+}
+
+func (s *RateLimitSuite) TestActionsWithoutLimitsAreUnlimited() {
+	guard := NewGuard(s.limiter, map[Action]Limit{ActionLogin: testLimit}, "")
+	for range 10 {
+		s.NoError(guard.Allow(context.Background(), ActionMove, PlayerKey("alice")))
+	}
+}
+
+func (s *RateLimitSuite) TestClientIPFromTrustedProxy() {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9, 198.51.100.7")
+
+	s.Equal("10.0.0.1", NewGuard(Unlimited{}, nil, "").ClientIP(req))
+	// Only the address the proxy added is trusted, not the ones the client may have sent
+	s.Equal("198.51.100.7", NewGuard(Unlimited{}, nil, "X-Forwarded-For").ClientIP(req))
+	s.Equal("10.0.0.1", NewGuard(Unlimited{}, nil, "X-Real-IP").ClientIP(req))
+}
@@ -0,0 +1,120 @@
+package sso
+
+import (
+	"context"
+	"fmt"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+type Config struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is where the provider sends players back to after they sign in
+	RedirectURL string
+	// Name is how the provider is shown to players
+	Name string
+}
+
+// Provider signs players in with an OpenID Connect provider, through the authorization code flow with PKCE
+type Provider struct {
+	name         string
+	oauth2Config oauth2.Config
+	verifier     *oidc.IDTokenVerifier
+}
+
+// Identity is who the provider says signed in, with the profile it suggests for them
+type Identity struct {
+	Issuer            string
+	Subject           string
+	PreferredUsername string
+	Name              string
+	Email             string
+}
+
+// NewProvider discovers the provider's endpoints and keys from its issuer URL
+// The context is used for discovery and for fetching the provider's keys later, so should last as long as the server
+func NewProvider(ctx context.Context, config Config) (*Provider, error) {
+	provider, err := oidc.NewProvider(ctx, config.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("error discovering OIDC provider %s: %w", config.IssuerURL, err)
+	}
+
+	return &Provider{
+		name: config.Name,
+		oauth2Config: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: config.ClientID}),
+	}, nil
+}
+
+func (p *Provider) Name() string {
+	return p.name
+}
+
+// AuthCodeURL is where to send a player to sign in
+// The state, nonce and code verifier must be kept until the provider redirects back, and passed on to Exchange
+func (p *Provider) AuthCodeURL(state string, nonce string, codeVerifier string) string {
+	return p.oauth2Config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(codeVerifier))
+}
+
+// Exchange swaps the code the provider redirected back with for the identity that signed in, verifying its ID token
+func (p *Provider) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (*Identity, error) {
+	token, err := p.oauth2Config.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("error exchanging OIDC code: %w", err)
+	}
+	rawIdToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("OIDC token response has no id_token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIdToken)
+	if err != nil {
+		return nil, fmt.Errorf("error verifying OIDC ID token: %w", err)
+	}
+	// The nonce ties the ID token to this sign-in, so one captured from another can't be replayed
+	if idToken.Nonce != nonce {
+		return nil, fmt.Errorf("OIDC ID token has the wrong nonce")
+	}
+
+	var claims struct {
+		PreferredUsername string `json:"preferred_username"`
+		Name              string `json:"name"`
+		Email             string `json:"email"`
+	}
+	err = idToken.Claims(&claims)
+	if err != nil {
+		return nil, fmt.Errorf("error reading OIDC ID token claims: %w", err)
+	}
+
+	return &Identity{
+		Issuer:            idToken.Issuer,
+		Subject:           idToken.Subject,
+		PreferredUsername: claims.PreferredUsername,
+		Name:              claims.Name,
+		Email:             claims.Email,
+	}, nil
+}
+
+// SuggestedUsername is what to name a player signing in for the first time, which may need changing to be valid
+func (i *Identity) SuggestedUsername() string {
+	if i.PreferredUsername != "" {
+		return i.PreferredUsername
+	}
+	if i.Email != "" {
+		return i.Email
+	}
+	return i.Name
+}
+
+// NewCodeVerifier generates the PKCE secret for a sign-in, which proves the code is redeemed by whoever started it
+func NewCodeVerifier() string {
+	return oauth2.GenerateVerifier()
+}
@@ -0,0 +1,218 @@
+// Package ssotest runs a fake OpenID Connect provider in process, for testing sign-in without a real one
+package ssotest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/go-jose/go-jose/v4"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+const keyId = "ssotest"
+
+// User is who the provider signs in as, without asking, when a player is sent to it
+type User struct {
+	Subject           string
+	PreferredUsername string
+	Name              string
+	Email             string
+}
+
+// Provider is a fake OpenID Connect provider supporting discovery and the authorization code flow with PKCE
+type Provider struct {
+	ClientID     string
+	ClientSecret string
+
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mutex  sync.Mutex
+	user   *User
+	grants map[string]grant
+}
+
+// grant is an authorization code the provider has handed out, and what it was handed out for
+type grant struct {
+	user          User
+	clientId      string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+}
+
+// NewProvider starts a provider which is closed at the end of the test
+// It denies every sign-in until SetUser is called
+func NewProvider(t testing.TB, clientId string, clientSecret string) *Provider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+
+	p := &Provider{
+		ClientID:     clientId,
+		ClientSecret: clientSecret,
+		key:          key,
+		grants:       make(map[string]grant),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("GET /authorize", p.authorize)
+	mux.HandleFunc("POST /token", p.token)
+	mux.HandleFunc("GET /keys", p.keys)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *Provider) IssuerURL() string {
+	return p.server.URL
+}
+
+// SetUser changes who is signed in as from then on, or denies sign-ins if nil
+func (p *Provider) SetUser(user *User) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.user = user
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.server.URL,
+		"authorization_endpoint":                p.server.URL + "/authorize",
+		"token_endpoint":                        p.server.URL + "/token",
+		"jwks_uri":                              p.server.URL + "/keys",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || query.Get("client_id") != p.ClientID {
+		http.Error(w, "unknown client or redirect URI", http.StatusBadRequest)
+		return
+	}
+
+	response := url.Values{"state": {query.Get("state")}}
+	p.mutex.Lock()
+	switch {
+	case p.user == nil:
+		response.Set("error", "access_denied")
+	case query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256":
+		response.Set("error", "invalid_request")
+	default:
+		code := rand.Text()
+		p.grants[code] = grant{
+			user:          *p.user,
+			clientId:      p.ClientID,
+			redirectURI:   redirectURI.String(),
+			nonce:         query.Get("nonce"),
+			codeChallenge: query.Get("code_challenge"),
+		}
+		response.Set("code", code)
+	}
+	p.mutex.Unlock()
+
+	redirectURI.RawQuery = response.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		writeTokenError(w, "invalid_request")
+		return
+	}
+	clientId, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientId, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientId != p.ClientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(p.ClientSecret)) != 1 {
+		writeTokenError(w, "invalid_client")
+		return
+	}
+
+	// Codes may only be used once, whether or not the exchange succeeds
+	p.mutex.Lock()
+	g, ok := p.grants[r.PostForm.Get("code")]
+	delete(p.grants, r.PostForm.Get("code"))
+	p.mutex.Unlock()
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok ||
+		r.PostForm.Get("grant_type") != "authorization_code" ||
+		g.redirectURI != r.PostForm.Get("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(challenge[:]) != g.codeChallenge {
+		writeTokenError(w, "invalid_grant")
+		return
+	}
+
+	idToken, err := p.signIdToken(g)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": rand.Text(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (p *Provider) signIdToken(g grant) (string, error) {
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: p.key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", keyId),
+	)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims, err := json.Marshal(map[string]any{
+		"iss":                p.server.URL,
+		"sub":                g.user.Subject,
+		"aud":                g.clientId,
+		"iat":                now.Unix(),
+		"exp":                now.Add(time.Hour).Unix(),
+		"nonce":              g.nonce,
+		"preferred_username": g.user.PreferredUsername,
+		"name":               g.user.Name,
+		"email":              g.user.Email,
+	})
+	if err != nil {
+		return "", err
+	}
+	signed, err := signer.Sign(claims)
+	if err != nil {
+		return "", err
+	}
+	return signed.CompactSerialize()
+}
+
+func (p *Provider) keys(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{{Key: &p.key.PublicKey, KeyID: keyId, Algorithm: string(jose.RS256), Use: "sig"}},
+	})
+}
+
+func writeTokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -1,16 +1,31 @@
 package store
 
 import (
+	apitokentypes "github.com/mcoot/crosswordgame-go/internal/apitoken/types"
 	"github.com/mcoot/crosswordgame-go/internal/errors"
 	gametypes "github.com/mcoot/crosswordgame-go/internal/game/types"
 	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
 	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	webhooktypes "github.com/mcoot/crosswordgame-go/internal/webhook/types"
+	"slices"
+	"sync"
 )
 
+// InMemoryStore keeps all data in process memory
+// Objects are copied on the way in and out, so callers mutating a retrieved object
+// never affect the stored state until they store it again
 type InMemoryStore struct {
 	games   map[gametypes.GameId]*gametypes.Game
 	lobbies map[lobbytypes.LobbyId]*lobbytypes.Lobby
 	players map[playertypes.PlayerId]*playertypes.Player
+	mutex   *sync.RWMutex
+	// transactionMutex is held for the whole of each transaction, so none can commit over another's reads
+	transactionMutex *sync.Mutex
+
+	webhooks   map[webhooktypes.WebhookId]*webhooktypes.Webhook
+	deliveries map[webhooktypes.WebhookId][]*webhooktypes.Delivery
+
+	tokens map[apitokentypes.TokenId]*apitokentypes.Token
 }
 
 func NewInMemoryStore() *InMemoryStore {
@@ -18,15 +33,27 @@ func NewInMemoryStore() *InMemoryStore {
 		games:   make(map[gametypes.GameId]*gametypes.Game),
 		lobbies: make(map[lobbytypes.LobbyId]*lobbytypes.Lobby),
 		players: make(map[playertypes.PlayerId]*playertypes.Player),
+		mutex:   &sync.RWMutex{},
+
+		transactionMutex: &sync.Mutex{},
+
+		webhooks:   make(map[webhooktypes.WebhookId]*webhooktypes.Webhook),
+		deliveries: make(map[webhooktypes.WebhookId][]*webhooktypes.Delivery),
+
+		tokens: make(map[apitokentypes.TokenId]*apitokentypes.Token),
 	}
 }
 
 func (s *InMemoryStore) StoreGame(game *gametypes.Game) error {
-	s.games[game.Id] = game
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.games[game.Id] = game.Clone()
 	return nil
 }
 
 func (s *InMemoryStore) RetrieveGame(gameId gametypes.GameId) (*gametypes.Game, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	game, ok := s.games[gameId]
 	if !ok {
 		return nil, &errors.NotFoundError{
@@ -34,15 +61,25 @@ func (s *InMemoryStore) RetrieveGame(gameId gametypes.GameId) (*gametypes.Game,
 			ObjectID:   gameId,
 		}
 	}
-	return game, nil
+	return game.Clone(), nil
+}
+
+func (s *InMemoryStore) RetrieveAllGames() ([]*gametypes.Game, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return cloneAll(s.games, nil, (*gametypes.Game).Clone), nil
 }
 
 func (s *InMemoryStore) StoreLobby(lobby *lobbytypes.Lobby) error {
-	s.lobbies[lobby.Id] = lobby
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lobbies[lobby.Id] = lobby.Clone()
 	return nil
 }
 
 func (s *InMemoryStore) RetrieveLobby(lobbyId lobbytypes.LobbyId) (*lobbytypes.Lobby, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	lobby, ok := s.lobbies[lobbyId]
 	if !ok {
 		return nil, &errors.NotFoundError{
@@ -50,15 +87,39 @@ func (s *InMemoryStore) RetrieveLobby(lobbyId lobbytypes.LobbyId) (*lobbytypes.L
 			ObjectID:   lobbyId,
 		}
 	}
-	return lobby, nil
+	return lobby.Clone(), nil
+}
+
+func (s *InMemoryStore) RetrieveAllLobbies() ([]*lobbytypes.Lobby, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return cloneAll(s.lobbies, nil, (*lobbytypes.Lobby).Clone), nil
+}
+
+func (s *InMemoryStore) RetrieveLobbyForGame(gameId gametypes.GameId) (*lobbytypes.Lobby, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	lobby, ok := findLobbyForGame(s.lobbies, gameId, nil)
+	if !ok {
+		return nil, &errors.NotFoundError{
+			ObjectKind: "lobby",
+			KeyKind:    "game",
+			ObjectID:   gameId,
+		}
+	}
+	return lobby.Clone(), nil
 }
 
 func (s *InMemoryStore) StorePlayer(player *playertypes.Player) error {
-	s.players[player.Username] = player
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.players[player.Username] = player.Clone()
 	return nil
 }
 
 func (s *InMemoryStore) RetrievePlayer(playerId playertypes.PlayerId) (*playertypes.Player, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	player, ok := s.players[playerId]
 	if !ok {
 		return nil, &errors.NotFoundError{
@@ -66,21 +127,223 @@ func (s *InMemoryStore) RetrievePlayer(playerId playertypes.PlayerId) (*playerty
 			ObjectID:   playerId,
 		}
 	}
-	return player, nil
+	return player.Clone(), nil
+}
+
+func (s *InMemoryStore) RetrieveAllPlayers() ([]*playertypes.Player, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return cloneAll(s.players, nil, (*playertypes.Player).Clone), nil
 }
 
 func (s *InMemoryStore) RetrieveLobbyForPlayer(playerId playertypes.PlayerId) (*lobbytypes.Lobby, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	lobby, ok := findLobbyForPlayer(s.lobbies, playerId, nil)
+	if !ok {
+		return nil, &errors.NotFoundError{
+			ObjectKind: "lobby",
+			KeyKind:    "player",
+			ObjectID:   playerId,
+		}
+	}
+	return lobby.Clone(), nil
+}
+
+// Transact runs transactions one at a time, so what f read is still current when its writes are committed
+func (s *InMemoryStore) Transact(f func(tx Store) error) error {
+	s.transactionMutex.Lock()
+	defer s.transactionMutex.Unlock()
+
+	tx := newInMemoryTransaction(s)
+	err := f(tx)
+	if err != nil {
+		return err
+	}
+	tx.commit()
+	return nil
+}
+
+// findLobbyForPlayer searches the lobbies for one containing the player, skipping any lobby for which skip returns true
+func findLobbyForPlayer(
+	lobbies map[lobbytypes.LobbyId]*lobbytypes.Lobby,
+	playerId playertypes.PlayerId,
+	skip func(lobbyId lobbytypes.LobbyId) bool,
+) (*lobbytypes.Lobby, bool) {
 	// TODO: For an actual database, the DB layer should enforce the player being in one lobby
-	for _, lobby := range s.lobbies {
-		for _, playerIdInLobby := range lobby.Players {
-			if playerIdInLobby == playerId {
-				return lobby, nil
-			}
+	for _, lobby := range lobbies {
+		if skip != nil && skip(lobby.Id) {
+			continue
+		}
+		if slices.Contains(lobby.Players, playerId) {
+			return lobby, true
+		}
+	}
+	return nil, false
+}
+
+// findLobbyForGame searches the lobbies for one running the game, skipping any lobby for which skip returns true
+func findLobbyForGame(
+	lobbies map[lobbytypes.LobbyId]*lobbytypes.Lobby,
+	gameId gametypes.GameId,
+	skip func(lobbyId lobbytypes.LobbyId) bool,
+) (*lobbytypes.Lobby, bool) {
+	for _, lobby := range lobbies {
+		if skip != nil && skip(lobby.Id) {
+			continue
+		}
+		if lobby.HasRunningGame() && lobby.RunningGame.GameId == gameId {
+			return lobby, true
+		}
+	}
+	return nil, false
+}
+
+// cloneAll copies every object in the map, excluding those whose key is in exclude
+func cloneAll[K comparable, V any](objects map[K]V, exclude map[K]V, clone func(V) V) []V {
+	result := make([]V, 0, len(objects))
+	for key, object := range objects {
+		if _, excluded := exclude[key]; excluded {
+			continue
 		}
+		result = append(result, clone(object))
+	}
+	return result
+}
+
+// inMemoryTransaction stages writes in its own maps, reading through to the parent store for anything
+// it has not written itself; staged writes are only applied to the parent on commit
+type inMemoryTransaction struct {
+	parent  *InMemoryStore
+	games   map[gametypes.GameId]*gametypes.Game
+	lobbies map[lobbytypes.LobbyId]*lobbytypes.Lobby
+	players map[playertypes.PlayerId]*playertypes.Player
+}
+
+func newInMemoryTransaction(parent *InMemoryStore) *inMemoryTransaction {
+	return &inMemoryTransaction{
+		parent:  parent,
+		games:   make(map[gametypes.GameId]*gametypes.Game),
+		lobbies: make(map[lobbytypes.LobbyId]*lobbytypes.Lobby),
+		players: make(map[playertypes.PlayerId]*playertypes.Player),
+	}
+}
+
+func (t *inMemoryTransaction) StoreGame(game *gametypes.Game) error {
+	t.games[game.Id] = game.Clone()
+	return nil
+}
+
+func (t *inMemoryTransaction) RetrieveGame(gameId gametypes.GameId) (*gametypes.Game, error) {
+	if game, ok := t.games[gameId]; ok {
+		return game.Clone(), nil
+	}
+	return t.parent.RetrieveGame(gameId)
+}
+
+func (t *inMemoryTransaction) RetrieveAllGames() ([]*gametypes.Game, error) {
+	t.parent.mutex.RLock()
+	defer t.parent.mutex.RUnlock()
+	games := cloneAll(t.parent.games, t.games, (*gametypes.Game).Clone)
+	return append(games, cloneAll(t.games, nil, (*gametypes.Game).Clone)...), nil
+}
+
+func (t *inMemoryTransaction) StoreLobby(lobby *lobbytypes.Lobby) error {
+	t.lobbies[lobby.Id] = lobby.Clone()
+	return nil
+}
+
+func (t *inMemoryTransaction) RetrieveLobby(lobbyId lobbytypes.LobbyId) (*lobbytypes.Lobby, error) {
+	if lobby, ok := t.lobbies[lobbyId]; ok {
+		return lobby.Clone(), nil
+	}
+	return t.parent.RetrieveLobby(lobbyId)
+}
+
+func (t *inMemoryTransaction) RetrieveAllLobbies() ([]*lobbytypes.Lobby, error) {
+	t.parent.mutex.RLock()
+	defer t.parent.mutex.RUnlock()
+	lobbies := cloneAll(t.parent.lobbies, t.lobbies, (*lobbytypes.Lobby).Clone)
+	return append(lobbies, cloneAll(t.lobbies, nil, (*lobbytypes.Lobby).Clone)...), nil
+}
+
+func (t *inMemoryTransaction) RetrieveLobbyForGame(gameId gametypes.GameId) (*lobbytypes.Lobby, error) {
+	if lobby, ok := findLobbyForGame(t.lobbies, gameId, nil); ok {
+		return lobby.Clone(), nil
+	}
+
+	t.parent.mutex.RLock()
+	defer t.parent.mutex.RUnlock()
+	lobby, ok := findLobbyForGame(t.parent.lobbies, gameId, t.isLobbyStaged)
+	if !ok {
+		return nil, &errors.NotFoundError{
+			ObjectKind: "lobby",
+			KeyKind:    "game",
+			ObjectID:   gameId,
+		}
+	}
+	return lobby.Clone(), nil
+}
+
+func (t *inMemoryTransaction) StorePlayer(player *playertypes.Player) error {
+	t.players[player.Username] = player.Clone()
+	return nil
+}
+
+func (t *inMemoryTransaction) RetrievePlayer(playerId playertypes.PlayerId) (*playertypes.Player, error) {
+	if player, ok := t.players[playerId]; ok {
+		return player.Clone(), nil
+	}
+	return t.parent.RetrievePlayer(playerId)
+}
+
+func (t *inMemoryTransaction) RetrieveAllPlayers() ([]*playertypes.Player, error) {
+	t.parent.mutex.RLock()
+	defer t.parent.mutex.RUnlock()
+	players := cloneAll(t.parent.players, t.players, (*playertypes.Player).Clone)
+	return append(players, cloneAll(t.players, nil, (*playertypes.Player).Clone)...), nil
+}
+
+func (t *inMemoryTransaction) RetrieveLobbyForPlayer(playerId playertypes.PlayerId) (*lobbytypes.Lobby, error) {
+	if lobby, ok := findLobbyForPlayer(t.lobbies, playerId, nil); ok {
+		return lobby.Clone(), nil
+	}
+
+	t.parent.mutex.RLock()
+	defer t.parent.mutex.RUnlock()
+	lobby, ok := findLobbyForPlayer(t.parent.lobbies, playerId, t.isLobbyStaged)
+	if !ok {
+		return nil, &errors.NotFoundError{
+			ObjectKind: "lobby",
+			KeyKind:    "player",
+			ObjectID:   playerId,
+		}
+	}
+	return lobby.Clone(), nil
+}
+
+// isLobbyStaged reports whether the lobby was written in this transaction, in which case the
+// staged copy takes precedence over the parent's
+func (t *inMemoryTransaction) isLobbyStaged(lobbyId lobbytypes.LobbyId) bool {
+	_, staged := t.lobbies[lobbyId]
+	return staged
+}
+
+func (t *inMemoryTransaction) Transact(f func(tx Store) error) error {
+	// Nested transactions join the outer one, which decides whether everything is committed
+	return f(t)
+}
+
+func (t *inMemoryTransaction) commit() {
+	t.parent.mutex.Lock()
+	defer t.parent.mutex.Unlock()
+	for id, game := range t.games {
+		t.parent.games[id] = game
+	}
+	for id, lobby := range t.lobbies {
+		t.parent.lobbies[id] = lobby
 	}
-	return nil, &errors.NotFoundError{
-		ObjectKind: "lobby",
-		KeyKind:    "player",
-		ObjectID:   playerId,
+	for id, player := range t.players {
+		t.parent.players[id] = player
 	}
 }
@@ -0,0 +1,208 @@
+package store
+
+import (
+	"fmt"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+	gametypes "github.com/mcoot/crosswordgame-go/internal/game/types"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"github.com/stretchr/testify/suite"
+	"sync"
+	"testing"
+	"time"
+)
+
+type InMemoryStoreSuite struct {
+	suite.Suite
+	store *InMemoryStore
+}
+
+func TestInMemoryStoreSuite(t *testing.T) {
+	suite.Run(t, new(InMemoryStoreSuite))
+}
+
+func (s *InMemoryStoreSuite) SetupTest() {
+	s.store = NewInMemoryStore()
+}
+
+func (s *InMemoryStoreSuite) newLobby(players ...playertypes.PlayerId) *lobbytypes.Lobby {
+	lobby, err := lobbytypes.NewLobby("lobby")
+	s.NoError(err)
+	lobby.Players = append(lobby.Players, players...)
+	return lobby
+}
+
+func (s *InMemoryStoreSuite) TestRetrievedObjectsAreCopies() {
+	lobby := s.newLobby("player0")
+	s.NoError(s.store.StoreLobby(lobby))
+
+	// Mutating the stored object should not affect the store
+	lobby.Players = append(lobby.Players, "player1")
+
+	retrieved, err := s.store.RetrieveLobby(lobby.Id)
+	s.NoError(err)
+	s.Equal([]playertypes.PlayerId{"player0"}, retrieved.Players)
+
+	// Mutating a retrieved object should not affect the store either
+	retrieved.Players[0] = "player2"
+	retrieved, err = s.store.RetrieveLobby(lobby.Id)
+	s.NoError(err)
+	s.Equal([]playertypes.PlayerId{"player0"}, retrieved.Players)
+}
+
+func (s *InMemoryStoreSuite) TestTransactionCommits() {
+	lobby := s.newLobby("player0")
+	s.NoError(s.store.StoreLobby(lobby))
+
+	var gameId gametypes.GameId
+	err := s.store.Transact(func(tx Store) error {
+		game, err := gametypes.NewGame([]playertypes.PlayerId{"player0"}, 2)
+		s.NoError(err)
+		gameId = game.Id
+		s.NoError(tx.StoreGame(game))
+
+		txLobby, err := tx.RetrieveLobby(lobby.Id)
+		s.NoError(err)
+		txLobby.RunningGame = &lobbytypes.RunningGame{GameId: game.Id}
+		s.NoError(tx.StoreLobby(txLobby))
+
+		// Writes are visible within the transaction, but not outside it until commit
+		txLobby, err = tx.RetrieveLobbyForPlayer("player0")
+		s.NoError(err)
+		s.True(txLobby.HasRunningGame())
+
+		_, err = s.store.RetrieveGame(game.Id)
+		s.True(errors.IsNotFoundError(err))
+		outsideLobby, err := s.store.RetrieveLobby(lobby.Id)
+		s.NoError(err)
+		s.False(outsideLobby.HasRunningGame())
+
+		return nil
+	})
+	s.NoError(err)
+
+	_, err = s.store.RetrieveGame(gameId)
+	s.NoError(err)
+	committedLobby, err := s.store.RetrieveLobby(lobby.Id)
+	s.NoError(err)
+	s.Equal(gameId, committedLobby.RunningGame.GameId)
+}
+
+func (s *InMemoryStoreSuite) TestTransactionRollsBackOnError() {
+	lobby := s.newLobby("player0")
+	s.NoError(s.store.StoreLobby(lobby))
+
+	var newLobbyId lobbytypes.LobbyId
+	err := s.store.Transact(func(tx Store) error {
+		newLobby := s.newLobby()
+		newLobbyId = newLobby.Id
+		s.NoError(tx.StoreLobby(newLobby))
+
+		txLobby, err := tx.RetrieveLobby(lobby.Id)
+		s.NoError(err)
+		txLobby.Players = nil
+		s.NoError(tx.StoreLobby(txLobby))
+
+		return fmt.Errorf("something went wrong")
+	})
+	s.Error(err)
+
+	_, err = s.store.RetrieveLobby(newLobbyId)
+	s.True(errors.IsNotFoundError(err))
+	retrieved, err := s.store.RetrieveLobby(lobby.Id)
+	s.NoError(err)
+	s.Equal([]playertypes.PlayerId{"player0"}, retrieved.Players)
+}
+
+func (s *InMemoryStoreSuite) TestStagedLobbyHidesPlayerLeaving() {
+	lobby := s.newLobby("player0")
+	s.NoError(s.store.StoreLobby(lobby))
+
+	err := s.store.Transact(func(tx Store) error {
+		txLobby, err := tx.RetrieveLobby(lobby.Id)
+		s.NoError(err)
+		txLobby.Players = nil
+		s.NoError(tx.StoreLobby(txLobby))
+
+		// The committed copy still has the player, but the transaction's view should not
+		_, err = tx.RetrieveLobbyForPlayer("player0")
+		s.True(errors.IsNotFoundError(err))
+		return nil
+	})
+	s.NoError(err)
+}
+
+func (s *InMemoryStoreSuite) TestNestedTransactionJoinsOuter() {
+	err := s.store.Transact(func(tx Store) error {
+		return tx.Transact(func(inner Store) error {
+			return inner.StorePlayer(&playertypes.Player{Username: "player0"})
+		})
+	})
+	s.NoError(err)
+	_, err = s.store.RetrievePlayer("player0")
+	s.NoError(err)
+
+	err = s.store.Transact(func(tx Store) error {
+		err := tx.Transact(func(inner Store) error {
+			return inner.StorePlayer(&playertypes.Player{Username: "player1"})
+		})
+		s.NoError(err)
+		return fmt.Errorf("outer failure")
+	})
+	s.Error(err)
+	_, err = s.store.RetrievePlayer("player1")
+	s.True(errors.IsNotFoundError(err))
+}
+
+func (s *InMemoryStoreSuite) TestConcurrentTransactionsDoNotLoseWrites() {
+	lobby := s.newLobby()
+	s.NoError(s.store.StoreLobby(lobby))
+
+	// Each transaction joins a player by reading the lobby and storing it back, as joining a lobby does
+	const joining = 50
+	var wg sync.WaitGroup
+	for i := range joining {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.store.Transact(func(tx Store) error {
+				current, err := tx.RetrieveLobby(lobby.Id)
+				if err != nil {
+					return err
+				}
+				// Give the other transactions a chance to read the lobby before this one writes it
+				time.Sleep(time.Millisecond)
+				current.Players = append(current.Players, playertypes.PlayerId(fmt.Sprintf("player%d", i)))
+				return tx.StoreLobby(current)
+			})
+			s.NoError(err)
+		}()
+	}
+	wg.Wait()
+
+	retrieved, err := s.store.RetrieveLobby(lobby.Id)
+	s.NoError(err)
+	s.Len(retrieved.Players, joining)
+}
+
+func (s *InMemoryStoreSuite) TestInstrumentedStoreObservesTransactions() {
+	var operations []string
+	instrumented := NewInstrumentedStore(s.store, func(operation string, duration time.Duration) {
+		operations = append(operations, operation)
+	})
+
+	lobby := s.newLobby("player0")
+	err := instrumented.Transact(func(tx Store) error {
+		if err := tx.StoreLobby(lobby); err != nil {
+			return err
+		}
+		_, err := tx.RetrieveLobby(lobby.Id)
+		return err
+	})
+	s.NoError(err)
+
+	// Operations inside the transaction are observed, as is the transaction as a whole once it commits
+	s.Equal([]string{"store_lobby", "retrieve_lobby", "transact"}, operations)
+	_, err = s.store.RetrieveLobby(lobby.Id)
+	s.NoError(err)
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	apitokentypes "github.com/mcoot/crosswordgame-go/internal/apitoken/types"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+)
+
+func (s *InMemoryStore) StoreToken(token *apitokentypes.Token) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tokens[token.Id] = token.Clone()
+	return nil
+}
+
+func (s *InMemoryStore) RetrieveToken(tokenId apitokentypes.TokenId) (*apitokentypes.Token, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	token, ok := s.tokens[tokenId]
+	if !ok {
+		return nil, &errors.NotFoundError{
+			ObjectKind: "token",
+			ObjectID:   tokenId,
+		}
+	}
+	return token.Clone(), nil
+}
+
+func (s *InMemoryStore) RetrieveAllTokens() ([]*apitokentypes.Token, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return cloneAll(s.tokens, nil, (*apitokentypes.Token).Clone), nil
+}
+
+func (s *InMemoryStore) RetrieveTokensForPlayer(playerId playertypes.PlayerId) ([]*apitokentypes.Token, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	result := make([]*apitokentypes.Token, 0)
+	for _, token := range s.tokens {
+		if token.PlayerId == playerId {
+			result = append(result, token.Clone())
+		}
+	}
+	return result, nil
+}
+
+func (s *InMemoryStore) DeleteToken(tokenId apitokentypes.TokenId) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.tokens[tokenId]; !ok {
+		return &errors.NotFoundError{
+			ObjectKind: "token",
+			ObjectID:   tokenId,
+		}
+	}
+	delete(s.tokens, tokenId)
+	return nil
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+	webhooktypes "github.com/mcoot/crosswordgame-go/internal/webhook/types"
+	"slices"
+)
+
+// maxDeliveriesPerWebhook bounds the delivery log kept in memory for each webhook
+const maxDeliveriesPerWebhook = 100
+
+func (s *InMemoryStore) StoreWebhook(webhook *webhooktypes.Webhook) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.webhooks[webhook.Id] = webhook.Clone()
+	return nil
+}
+
+func (s *InMemoryStore) RetrieveWebhook(webhookId webhooktypes.WebhookId) (*webhooktypes.Webhook, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	webhook, ok := s.webhooks[webhookId]
+	if !ok {
+		return nil, &errors.NotFoundError{
+			ObjectKind: "webhook",
+			ObjectID:   webhookId,
+		}
+	}
+	return webhook.Clone(), nil
+}
+
+func (s *InMemoryStore) RetrieveAllWebhooks() ([]*webhooktypes.Webhook, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return cloneAll(s.webhooks, nil, (*webhooktypes.Webhook).Clone), nil
+}
+
+func (s *InMemoryStore) DeleteWebhook(webhookId webhooktypes.WebhookId) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.webhooks[webhookId]; !ok {
+		return &errors.NotFoundError{
+			ObjectKind: "webhook",
+			ObjectID:   webhookId,
+		}
+	}
+	delete(s.webhooks, webhookId)
+	delete(s.deliveries, webhookId)
+	return nil
+}
+
+func (s *InMemoryStore) StoreDelivery(delivery *webhooktypes.Delivery) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.webhooks[delivery.WebhookId]; !ok {
+		// The webhook was deleted while the delivery was in flight, so there is no log to keep it in
+		return nil
+	}
+
+	deliveries := s.deliveries[delivery.WebhookId]
+	i := slices.IndexFunc(deliveries, func(d *webhooktypes.Delivery) bool {
+		return d.Id == delivery.Id
+	})
+	if i >= 0 {
+		deliveries[i] = delivery.Clone()
+		return nil
+	}
+
+	deliveries = append(deliveries, delivery.Clone())
+	if len(deliveries) > maxDeliveriesPerWebhook {
+		deliveries = slices.Delete(deliveries, 0, len(deliveries)-maxDeliveriesPerWebhook)
+	}
+	s.deliveries[delivery.WebhookId] = deliveries
+	return nil
+}
+
+func (s *InMemoryStore) RetrieveDeliveriesForWebhook(webhookId webhooktypes.WebhookId) ([]*webhooktypes.Delivery, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if _, ok := s.webhooks[webhookId]; !ok {
+		return nil, &errors.NotFoundError{
+			ObjectKind: "webhook",
+			ObjectID:   webhookId,
+		}
+	}
+
+	result := make([]*webhooktypes.Delivery, 0, len(s.deliveries[webhookId]))
+	for _, delivery := range s.deliveries[webhookId] {
+		result = append(result, delivery.Clone())
+	}
+	return result, nil
+}
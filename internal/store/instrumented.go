@@ -0,0 +1,108 @@
+package store
+
+import (
+	gametypes "github.com/mcoot/crosswordgame-go/internal/game/types"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"time"
+)
+
+// ObserveFunc is told how long each store operation took
+type ObserveFunc func(operation string, duration time.Duration)
+
+// instrumentedStore times every operation on the store it wraps, including those in its transactions
+type instrumentedStore struct {
+	inner   Store
+	observe ObserveFunc
+}
+
+// NewInstrumentedStore wraps the store so observe is told of every operation made through it
+func NewInstrumentedStore(inner Store, observe ObserveFunc) Store {
+	return &instrumentedStore{
+		inner:   inner,
+		observe: observe,
+	}
+}
+
+func instrument[T any](s *instrumentedStore, operation string, f func() (T, error)) (T, error) {
+	start := time.Now()
+	result, err := f()
+	s.observe(operation, time.Since(start))
+	return result, err
+}
+
+func instrumentWrite(s *instrumentedStore, operation string, f func() error) error {
+	_, err := instrument(s, operation, func() (struct{}, error) {
+		return struct{}{}, f()
+	})
+	return err
+}
+
+func (s *instrumentedStore) StoreGame(game *gametypes.Game) error {
+	return instrumentWrite(s, "store_game", func() error {
+		return s.inner.StoreGame(game)
+	})
+}
+
+func (s *instrumentedStore) RetrieveGame(gameId gametypes.GameId) (*gametypes.Game, error) {
+	return instrument(s, "retrieve_game", func() (*gametypes.Game, error) {
+		return s.inner.RetrieveGame(gameId)
+	})
+}
+
+func (s *instrumentedStore) RetrieveAllGames() ([]*gametypes.Game, error) {
+	return instrument(s, "retrieve_all_games", s.inner.RetrieveAllGames)
+}
+
+func (s *instrumentedStore) StoreLobby(lobby *lobbytypes.Lobby) error {
+	return instrumentWrite(s, "store_lobby", func() error {
+		return s.inner.StoreLobby(lobby)
+	})
+}
+
+func (s *instrumentedStore) RetrieveLobby(lobbyId lobbytypes.LobbyId) (*lobbytypes.Lobby, error) {
+	return instrument(s, "retrieve_lobby", func() (*lobbytypes.Lobby, error) {
+		return s.inner.RetrieveLobby(lobbyId)
+	})
+}
+
+func (s *instrumentedStore) RetrieveAllLobbies() ([]*lobbytypes.Lobby, error) {
+	return instrument(s, "retrieve_all_lobbies", s.inner.RetrieveAllLobbies)
+}
+
+func (s *instrumentedStore) RetrieveLobbyForGame(gameId gametypes.GameId) (*lobbytypes.Lobby, error) {
+	return instrument(s, "retrieve_lobby_for_game", func() (*lobbytypes.Lobby, error) {
+		return s.inner.RetrieveLobbyForGame(gameId)
+	})
+}
+
+func (s *instrumentedStore) StorePlayer(player *playertypes.Player) error {
+	return instrumentWrite(s, "store_player", func() error {
+		return s.inner.StorePlayer(player)
+	})
+}
+
+func (s *instrumentedStore) RetrievePlayer(playerId playertypes.PlayerId) (*playertypes.Player, error) {
+	return instrument(s, "retrieve_player", func() (*playertypes.Player, error) {
+		return s.inner.RetrievePlayer(playerId)
+	})
+}
+
+func (s *instrumentedStore) RetrieveAllPlayers() ([]*playertypes.Player, error) {
+	return instrument(s, "retrieve_all_players", s.inner.RetrieveAllPlayers)
+}
+
+func (s *instrumentedStore) RetrieveLobbyForPlayer(playerId playertypes.PlayerId) (*lobbytypes.Lobby, error) {
+	return instrument(s, "retrieve_lobby_for_player", func() (*lobbytypes.Lobby, error) {
+		return s.inner.RetrieveLobbyForPlayer(playerId)
+	})
+}
+
+// Transact times the whole transaction, including its commit, as well as the operations made in it
+func (s *instrumentedStore) Transact(f func(tx Store) error) error {
+	return instrumentWrite(s, "transact", func() error {
+		return s.inner.Transact(func(tx Store) error {
+			return f(NewInstrumentedStore(tx, s.observe))
+		})
+	})
+}
@@ -1,29 +1,71 @@
 package store
 
 import (
+	apitokentypes "github.com/mcoot/crosswordgame-go/internal/apitoken/types"
 	gametypes "github.com/mcoot/crosswordgame-go/internal/game/types"
 	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
 	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	webhooktypes "github.com/mcoot/crosswordgame-go/internal/webhook/types"
 )
 
 type GameStore interface {
 	StoreGame(game *gametypes.Game) error
 	RetrieveGame(gameId gametypes.GameId) (*gametypes.Game, error)
+	RetrieveAllGames() ([]*gametypes.Game, error)
 }
 
 type LobbyStore interface {
 	StoreLobby(lobby *lobbytypes.Lobby) error
 	RetrieveLobby(lobbyId lobbytypes.LobbyId) (*lobbytypes.Lobby, error)
+	RetrieveAllLobbies() ([]*lobbytypes.Lobby, error)
+	RetrieveLobbyForGame(gameId gametypes.GameId) (*lobbytypes.Lobby, error)
 }
 
 type PlayerStore interface {
 	StorePlayer(player *playertypes.Player) error
 	RetrievePlayer(playerId playertypes.PlayerId) (*playertypes.Player, error)
+	RetrieveAllPlayers() ([]*playertypes.Player, error)
 	RetrieveLobbyForPlayer(playerId playertypes.PlayerId) (*lobbytypes.Lobby, error)
 }
 
+// Flusher is implemented by stores which hold writes before persisting them, to persist them as the server exits
+type Flusher interface {
+	Flush() error
+}
+
+// WebhookStore holds server configuration rather than game state, so it is not part of Store:
+// webhooks are not written in transactions, though they are included in backups
+type WebhookStore interface {
+	StoreWebhook(webhook *webhooktypes.Webhook) error
+	RetrieveWebhook(webhookId webhooktypes.WebhookId) (*webhooktypes.Webhook, error)
+	RetrieveAllWebhooks() ([]*webhooktypes.Webhook, error)
+	// DeleteWebhook removes the webhook along with its delivery log
+	DeleteWebhook(webhookId webhooktypes.WebhookId) error
+	StoreDelivery(delivery *webhooktypes.Delivery) error
+	// RetrieveDeliveriesForWebhook returns the webhook's most recent deliveries, oldest first
+	RetrieveDeliveriesForWebhook(webhookId webhooktypes.WebhookId) ([]*webhooktypes.Delivery, error)
+}
+
+// TokenStore holds players' API tokens, which like webhooks are not written in transactions but are backed up
+type TokenStore interface {
+	StoreToken(token *apitokentypes.Token) error
+	RetrieveToken(tokenId apitokentypes.TokenId) (*apitokentypes.Token, error)
+	RetrieveAllTokens() ([]*apitokentypes.Token, error)
+	RetrieveTokensForPlayer(playerId playertypes.PlayerId) ([]*apitokentypes.Token, error)
+	DeleteToken(tokenId apitokentypes.TokenId) error
+}
+
+// Transactor runs units of work spanning multiple entities
+type Transactor interface {
+	// Transact runs f against a transactional view of the store
+	// Writes made through tx are committed together if f returns nil, and discarded if it returns an error
+	// Calling Transact on tx itself joins the existing transaction
+	Transact(f func(tx Store) error) error
+}
+
 type Store interface {
 	GameStore
 	LobbyStore
 	PlayerStore
+	Transactor
 }
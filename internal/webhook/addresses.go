@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"fmt"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// reservedPrefixes are ranges outside the public internet that net.IP has no check for
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+}
+
+// isPublicAddress reports whether webhooks may be delivered to an address, which excludes this host and private networks
+func isPublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	ip := net.IP(addr.AsSlice())
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// refusePrivateAddresses is a net.Dialer Control which stops connections to non-public addresses
+// It runs once the receiver's name is resolved, so DNS pointing at a private address is caught too
+func refusePrivateAddresses(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !isPublicAddress(addrPort.Addr()) {
+		return fmt.Errorf("webhook receiver address %s is not public", addrPort.Addr())
+	}
+	return nil
+}
+
+// checkReceiverHost rejects webhook URLs which name this host or a private address outright
+// Names resolving to private addresses are only caught when delivering, by refusePrivateAddresses
+func checkReceiverHost(rawUrl string) error {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return err
+	}
+	host := strings.ToLower(strings.TrimSuffix(parsed.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return &errors.InvalidInputError{
+			ErrMessage: fmt.Sprintf("webhook URL must not point at this server, got %q", rawUrl),
+		}
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !isPublicAddress(addr) {
+		return &errors.InvalidInputError{
+			ErrMessage: fmt.Sprintf("webhook URL must be a public address, got %q", rawUrl),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	"github.com/mcoot/crosswordgame-go/internal/events/public"
+	gametypes "github.com/mcoot/crosswordgame-go/internal/game/types"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	"github.com/mcoot/crosswordgame-go/internal/store"
+	"github.com/mcoot/crosswordgame-go/internal/webhook/types"
+	"go.uber.org/zap"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type DispatcherConfig struct {
+	// MaxAttempts is the number of times a delivery is tried before it is dead-lettered
+	MaxAttempts int
+	// Retries back off exponentially from InitialBackoff, up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Timeout applies to each attempt
+	Timeout time.Duration
+	// AllowPrivateAddresses lets webhooks reach this host and private networks, which only suits development
+	AllowPrivateAddresses bool
+}
+
+var DefaultDispatcherConfig = DispatcherConfig{
+	MaxAttempts:    5,
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+	Timeout:        10 * time.Second,
+}
+
+// Payload is the JSON body posted to a webhook
+type Payload struct {
+	DeliveryId types.DeliveryId `json:"delivery_id"`
+	Event      events.Kind      `json:"event"`
+	OccurredAt time.Time        `json:"occurred_at"`
+	Data       json.RawMessage  `json:"data"`
+}
+
+// eventScope picks out which lobby or game an event concerns, which all domain event payloads record
+type eventScope struct {
+	LobbyId lobbytypes.LobbyId `json:"lobby_id"`
+	GameId  gametypes.GameId   `json:"game_id"`
+}
+
+// Dispatcher sends domain events to the webhooks subscribed to them
+type Dispatcher struct {
+	store      store.WebhookStore
+	lobbyStore store.LobbyStore
+	config     DispatcherConfig
+	client     *http.Client
+	logger     *zap.SugaredLogger
+	inFlight   *sync.WaitGroup
+}
+
+func NewDispatcher(
+	store store.WebhookStore,
+	lobbyStore store.LobbyStore,
+	logger *zap.SugaredLogger,
+	config DispatcherConfig,
+) *Dispatcher {
+	return &Dispatcher{
+		store:      store,
+		lobbyStore: lobbyStore,
+		config:     config,
+		client:     newDeliveryClient(config),
+		logger:     logger,
+		inFlight:   &sync.WaitGroup{},
+	}
+}
+
+// newDeliveryClient makes the client deliveries are posted with, which never follows redirects
+// A redirect is treated as a failed delivery, so a receiver can't send requests on to somewhere it could not be registered
+func newDeliveryClient(config DispatcherConfig) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !config.AllowPrivateAddresses {
+		dialer := &net.Dialer{Timeout: config.Timeout, Control: refusePrivateAddresses}
+		transport.DialContext = dialer.DialContext
+		// A proxy would connect to the receiver for us, out of reach of the dialer's check
+		transport.Proxy = nil
+	}
+	return &http.Client{
+		Timeout:   config.Timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Run delivers events from the bus until the context is done, then waits for in-flight deliveries to stop
+// Deliveries interrupted by shutdown are left pending in the delivery log
+func (d *Dispatcher) Run(ctx context.Context, bus *events.EventBus) error {
+	err := events.NewEventConsumer(bus, events.AnyKind).Run(ctx, func(e events.Event) bool {
+		d.dispatch(ctx, e)
+		return true
+	})
+	d.inFlight.Wait()
+	return err
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, e events.Event) {
+	webhooks, err := d.store.RetrieveAllWebhooks()
+	if err != nil {
+		d.logger.Errorw("error retrieving webhooks", "error", err)
+		return
+	}
+
+	data, err := json.Marshal(webhookPayload(e))
+	if err != nil {
+		d.logger.Errorw("error serialising event for webhooks", "event", e.Kind(), "error", err)
+		return
+	}
+	occurredAt := time.Now().UTC()
+
+	var eventLobby *lobbytypes.LobbyId
+	for _, webhook := range webhooks {
+		if !webhook.WantsEvent(e.Kind()) {
+			continue
+		}
+		if !webhook.IsServerWide() {
+			if eventLobby == nil {
+				lobbyId := d.lobbyForEvent(data)
+				eventLobby = &lobbyId
+			}
+			if *eventLobby != webhook.LobbyId {
+				continue
+			}
+		}
+
+		delivery, err := d.newDelivery(webhook, e.Kind(), occurredAt, data)
+		if err != nil {
+			d.logger.Errorw("error creating webhook delivery", "webhook", webhook.Id, "error", err)
+			continue
+		}
+
+		d.inFlight.Add(1)
+		go func() {
+			defer d.inFlight.Done()
+			d.deliver(ctx, webhook, delivery)
+		}()
+	}
+}
+
+// webhookPayload is the event's data as sent to webhooks, redacted the same way as for streaming clients
+func webhookPayload(e events.Event) any {
+	if streamed, ok := public.FromEvent(e); ok {
+		return streamed.Data
+	}
+	return e.Payload()
+}
+
+// lobbyForEvent finds the lobby an event happened in, if any
+// Game events are attributed to the lobby currently running the game
+func (d *Dispatcher) lobbyForEvent(data []byte) lobbytypes.LobbyId {
+	var scope eventScope
+	if err := json.Unmarshal(data, &scope); err != nil {
+		return ""
+	}
+	if scope.LobbyId != "" || scope.GameId == "" {
+		return scope.LobbyId
+	}
+	lobby, err := d.lobbyStore.RetrieveLobbyForGame(scope.GameId)
+	if err != nil {
+		return ""
+	}
+	return lobby.Id
+}
+
+func (d *Dispatcher) newDelivery(
+	webhook *types.Webhook,
+	kind events.Kind,
+	occurredAt time.Time,
+	data json.RawMessage,
+) (*types.Delivery, error) {
+	delivery, err := types.NewDelivery(webhook.Id, kind, nil)
+	if err != nil {
+		return nil, err
+	}
+	delivery.Payload, err = json.Marshal(Payload{
+		DeliveryId: delivery.Id,
+		Event:      kind,
+		OccurredAt: occurredAt,
+		Data:       data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return delivery, d.store.StoreDelivery(delivery)
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, webhook *types.Webhook, delivery *types.Delivery) {
+	logger := d.logger.With("webhook", webhook.Id, "delivery", delivery.Id, "event", delivery.Event)
+	backoff := d.config.InitialBackoff
+
+	for attempt := 1; ; attempt++ {
+		result := d.attempt(ctx, webhook, delivery)
+		delivery.Attempts = append(delivery.Attempts, result)
+
+		switch {
+		case result.Error == "":
+			delivery.Status = types.DeliveryStatusDelivered
+		case attempt >= d.config.MaxAttempts:
+			delivery.Status = types.DeliveryStatusDeadLetter
+			logger.Warnw("webhook delivery failed, giving up", "attempts", attempt, "error", result.Error)
+		}
+		if err := d.store.StoreDelivery(delivery); err != nil {
+			logger.Errorw("error recording webhook delivery", "error", err)
+		}
+		if delivery.Status != types.DeliveryStatusPending {
+			return
+		}
+
+		logger.Infow("webhook delivery failed, retrying", "attempt", attempt, "backoff", backoff, "error", result.Error)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, d.config.MaxBackoff)
+	}
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, webhook *types.Webhook, delivery *types.Delivery) types.DeliveryAttempt {
+	result := types.DeliveryAttempt{At: time.Now().UTC()}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(delivery.Event))
+	req.Header.Set(DeliveryHeader, string(delivery.Id))
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	// Drain the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	result.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		result.Error = fmt.Sprintf("receiver responded with status %d", resp.StatusCode)
+	}
+	return result
+}
@@ -0,0 +1,308 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	"github.com/mcoot/crosswordgame-go/internal/game"
+	gametypes "github.com/mcoot/crosswordgame-go/internal/game/types"
+	"github.com/mcoot/crosswordgame-go/internal/lobby"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	playertypes "github.com/mcoot/crosswordgame-go/internal/player/types"
+	"github.com/mcoot/crosswordgame-go/internal/store"
+	"github.com/mcoot/crosswordgame-go/internal/webhook/types"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver is a webhook endpoint which fails a set number of requests before succeeding
+type receiver struct {
+	server   *httptest.Server
+	mutex    sync.Mutex
+	failures int
+	requests []receivedRequest
+}
+
+func newReceiver(failures int) *receiver {
+	r := &receiver{failures: failures}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		r.requests = append(r.requests, receivedRequest{header: req.Header.Clone(), body: body})
+		if r.failures > 0 {
+			r.failures--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return r
+}
+
+func (r *receiver) received() []receivedRequest {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]receivedRequest(nil), r.requests...)
+}
+
+type DispatcherSuite struct {
+	suite.Suite
+	db         *store.InMemoryStore
+	manager    *Manager
+	dispatcher *Dispatcher
+	receiver   *receiver
+}
+
+func TestDispatcherSuite(t *testing.T) {
+	suite.Run(t, new(DispatcherSuite))
+}
+
+func (s *DispatcherSuite) SetupTest() {
+	s.db = store.NewInMemoryStore()
+	// Receivers are test servers on this host
+	s.manager = NewWebhookManager(s.db, s.db, true)
+	s.dispatcher = NewDispatcher(s.db, s.db, zap.NewNop().Sugar(), testDispatcherConfig(true))
+}
+
+func testDispatcherConfig(allowPrivateAddresses bool) DispatcherConfig {
+	return DispatcherConfig{
+		MaxAttempts:           3,
+		InitialBackoff:        time.Millisecond,
+		MaxBackoff:            5 * time.Millisecond,
+		Timeout:               time.Second,
+		AllowPrivateAddresses: allowPrivateAddresses,
+	}
+}
+
+func (s *DispatcherSuite) TearDownTest() {
+	if s.receiver != nil {
+		s.receiver.server.Close()
+		s.receiver = nil
+	}
+}
+
+func (s *DispatcherSuite) useReceiver(failures int) string {
+	s.receiver = newReceiver(failures)
+	return s.receiver.server.URL
+}
+
+// dispatchAndWait sends the event to matching webhooks and waits for every delivery to finish
+func (s *DispatcherSuite) dispatchAndWait(e events.Event) {
+	s.dispatcher.dispatch(context.Background(), e)
+	s.dispatcher.inFlight.Wait()
+}
+
+func (s *DispatcherSuite) newLobbyWithGame() (lobbytypes.LobbyId, gametypes.GameId) {
+	lobbyState, err := lobbytypes.NewLobby("lobby")
+	s.Require().NoError(err)
+	lobbyState.RunningGame = &lobbytypes.RunningGame{GameId: gametypes.GameId("game-" + lobbyState.Id)}
+	s.Require().NoError(s.db.StoreLobby(lobbyState))
+	return lobbyState.Id, lobbyState.RunningGame.GameId
+}
+
+func (s *DispatcherSuite) gameFinished(gameId gametypes.GameId) events.Event {
+	return events.NewTypedEvent(game.EventGameFinished, game.GameFinished{
+		GameId: gameId,
+		Scores: map[playertypes.PlayerId]int{"player0": 12},
+	})
+}
+
+func (s *DispatcherSuite) TestDeliversSignedPayload() {
+	webhook, err := s.manager.RegisterWebhook(s.useReceiver(0), "", nil)
+	s.Require().NoError(err)
+
+	s.dispatchAndWait(s.gameFinished("game0"))
+
+	requests := s.receiver.received()
+	s.Require().Len(requests, 1)
+	req := requests[0]
+	s.True(VerifySignature(webhook.Secret, req.body, req.header.Get(SignatureHeader)))
+	s.False(VerifySignature("wrong-secret", req.body, req.header.Get(SignatureHeader)))
+	s.Equal(string(game.EventGameFinished), req.header.Get(EventHeader))
+
+	var payload Payload
+	s.Require().NoError(json.Unmarshal(req.body, &payload))
+	s.Equal(game.EventGameFinished, payload.Event)
+	s.Equal(types.DeliveryId(req.header.Get(DeliveryHeader)), payload.DeliveryId)
+	s.JSONEq(`{"game_id": "game0", "scores": {"player0": 12}}`, string(payload.Data))
+
+	deliveries, err := s.manager.GetDeliveries(webhook.Id, "")
+	s.Require().NoError(err)
+	s.Require().Len(deliveries, 1)
+	s.Equal(types.DeliveryStatusDelivered, deliveries[0].Status)
+	s.Equal(payload.DeliveryId, deliveries[0].Id)
+	s.Equal([]byte(deliveries[0].Payload), req.body)
+}
+
+func (s *DispatcherSuite) TestSkipsEventsNotSubscribedTo() {
+	_, err := s.manager.RegisterWebhook(s.useReceiver(0), "", []events.Kind{game.EventGameCreated})
+	s.Require().NoError(err)
+
+	s.dispatchAndWait(s.gameFinished("game0"))
+
+	s.Empty(s.receiver.received())
+}
+
+func (s *DispatcherSuite) TestRetriesFailedDeliveries() {
+	webhook, err := s.manager.RegisterWebhook(s.useReceiver(2), "", nil)
+	s.Require().NoError(err)
+
+	s.dispatchAndWait(s.gameFinished("game0"))
+
+	s.Len(s.receiver.received(), 3)
+	deliveries, err := s.manager.GetDeliveries(webhook.Id, "")
+	s.Require().NoError(err)
+	s.Require().Len(deliveries, 1)
+	s.Equal(types.DeliveryStatusDelivered, deliveries[0].Status)
+	s.Require().Len(deliveries[0].Attempts, 3)
+	s.Equal(http.StatusInternalServerError, deliveries[0].Attempts[0].StatusCode)
+	s.NotEmpty(deliveries[0].Attempts[0].Error)
+	s.Equal(http.StatusNoContent, deliveries[0].Attempts[2].StatusCode)
+	s.Empty(deliveries[0].Attempts[2].Error)
+}
+
+func (s *DispatcherSuite) TestDeadLettersAfterMaxAttempts() {
+	webhook, err := s.manager.RegisterWebhook(s.useReceiver(10), "", nil)
+	s.Require().NoError(err)
+
+	s.dispatchAndWait(s.gameFinished("game0"))
+
+	s.Len(s.receiver.received(), 3)
+	deadLetters, err := s.manager.GetDeliveries(webhook.Id, types.DeliveryStatusDeadLetter)
+	s.Require().NoError(err)
+	s.Require().Len(deadLetters, 1)
+	s.Len(deadLetters[0].Attempts, 3)
+
+	delivered, err := s.manager.GetDeliveries(webhook.Id, types.DeliveryStatusDelivered)
+	s.Require().NoError(err)
+	s.Empty(delivered)
+}
+
+func (s *DispatcherSuite) TestLobbyWebhooksOnlyReceiveTheirLobby() {
+	lobbyId, gameId := s.newLobbyWithGame()
+	otherLobbyId, otherGameId := s.newLobbyWithGame()
+	_, err := s.manager.RegisterWebhook(s.useReceiver(0), lobbyId, nil)
+	s.Require().NoError(err)
+
+	s.dispatchAndWait(events.NewTypedEvent(lobby.EventGameAttached, lobby.GameAttached{LobbyId: otherLobbyId, GameId: otherGameId}))
+	s.dispatchAndWait(s.gameFinished(otherGameId))
+	s.Empty(s.receiver.received())
+
+	// Game events are matched to the lobby running the game
+	s.dispatchAndWait(events.NewTypedEvent(lobby.EventGameAttached, lobby.GameAttached{LobbyId: lobbyId, GameId: gameId}))
+	s.dispatchAndWait(s.gameFinished(gameId))
+	s.Len(s.receiver.received(), 2)
+}
+
+func (s *DispatcherSuite) TestRegisterValidatesInput() {
+	_, err := s.manager.RegisterWebhook("not a url", "", nil)
+	s.Error(err)
+
+	_, err = s.manager.RegisterWebhook("http://example.com", "", []events.Kind{"game.unknown"})
+	s.Error(err)
+
+	_, err = s.manager.RegisterWebhook("http://example.com", "missing-lobby", nil)
+	s.Error(err)
+
+	webhook, err := s.manager.RegisterWebhook("http://example.com", "", nil)
+	s.Require().NoError(err)
+	s.ElementsMatch(DefaultEventKinds, webhook.Events)
+	s.NotEmpty(webhook.Secret)
+}
+
+func (s *DispatcherSuite) TestDeletedWebhookStopsReceiving() {
+	webhook, err := s.manager.RegisterWebhook(s.useReceiver(0), "", nil)
+	s.Require().NoError(err)
+	s.Require().NoError(s.manager.DeleteWebhook(webhook.Id))
+
+	s.dispatchAndWait(s.gameFinished("game0"))
+
+	s.Empty(s.receiver.received())
+	_, err = s.manager.GetDeliveries(webhook.Id, "")
+	s.Error(err)
+}
+
+func (s *DispatcherSuite) TestRedactsPlacements() {
+	_, err := s.manager.RegisterWebhook(s.useReceiver(0), "", []events.Kind{game.EventLetterPlaced})
+	s.Require().NoError(err)
+
+	s.dispatchAndWait(events.NewTypedEvent(game.EventLetterPlaced, game.LetterPlaced{
+		GameId:   "game0",
+		PlayerId: "player0",
+		Letter:   "A",
+		Row:      1,
+		Column:   2,
+	}))
+
+	requests := s.receiver.received()
+	s.Require().Len(requests, 1)
+	var payload Payload
+	s.Require().NoError(json.Unmarshal(requests[0].body, &payload))
+	s.JSONEq(`{"game_id": "game0", "player_id": "player0"}`, string(payload.Data))
+}
+
+func (s *DispatcherSuite) TestDoesNotFollowRedirects() {
+	target := s.useReceiver(0)
+	redirector := httptest.NewServer(http.RedirectHandler(target, http.StatusTemporaryRedirect))
+	defer redirector.Close()
+	webhook, err := s.manager.RegisterWebhook(redirector.URL, "", nil)
+	s.Require().NoError(err)
+
+	s.dispatchAndWait(s.gameFinished("game0"))
+
+	s.Empty(s.receiver.received())
+	deadLetters, err := s.manager.GetDeliveries(webhook.Id, types.DeliveryStatusDeadLetter)
+	s.Require().NoError(err)
+	s.Require().Len(deadLetters, 1)
+	s.Equal(http.StatusTemporaryRedirect, deadLetters[0].Attempts[0].StatusCode)
+}
+
+func (s *DispatcherSuite) TestRefusesToRegisterPrivateAddresses() {
+	manager := NewWebhookManager(s.db, s.db, false)
+	for _, url := range []string{
+		"http://localhost:8080/hook",
+		"http://api.localhost/hook",
+		"http://127.0.0.1/hook",
+		"http://[::1]/hook",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://0.0.0.0/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+	} {
+		_, err := manager.RegisterWebhook(url, "", nil)
+		s.Error(err, url)
+	}
+
+	_, err := manager.RegisterWebhook("https://example.com/hook", "", nil)
+	s.NoError(err)
+}
+
+func (s *DispatcherSuite) TestRefusesToDeliverToPrivateAddresses() {
+	// As if the webhook's host resolved to this machine after it was registered
+	webhook, err := types.NewWebhook(s.useReceiver(0), "", DefaultEventKinds)
+	s.Require().NoError(err)
+	s.Require().NoError(s.db.StoreWebhook(webhook))
+	s.dispatcher = NewDispatcher(s.db, s.db, zap.NewNop().Sugar(), testDispatcherConfig(false))
+
+	s.dispatchAndWait(s.gameFinished("game0"))
+
+	s.Empty(s.receiver.received())
+	deadLetters, err := s.manager.GetDeliveries(webhook.Id, types.DeliveryStatusDeadLetter)
+	s.Require().NoError(err)
+	s.Require().Len(deadLetters, 1)
+	s.Contains(deadLetters[0].Attempts[0].Error, "not public")
+	s.Zero(deadLetters[0].Attempts[0].StatusCode)
+}
@@ -0,0 +1,134 @@
+package webhook
+
+import (
+	"fmt"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	"github.com/mcoot/crosswordgame-go/internal/game"
+	"github.com/mcoot/crosswordgame-go/internal/lobby"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	"github.com/mcoot/crosswordgame-go/internal/player"
+	"github.com/mcoot/crosswordgame-go/internal/store"
+	"github.com/mcoot/crosswordgame-go/internal/webhook/types"
+	"slices"
+)
+
+// SupportedEventKinds are the events a webhook can subscribe to
+var SupportedEventKinds = slices.Concat(game.EventKinds, lobby.EventKinds, player.EventKinds)
+
+// DefaultEventKinds cover the game lifecycle: a game starting in a lobby, each turn and the final scores
+var DefaultEventKinds = []events.Kind{
+	lobby.EventGameAttached,
+	game.EventTurnCompleted,
+	game.EventGameFinished,
+}
+
+type Manager struct {
+	store      store.WebhookStore
+	lobbyStore store.LobbyStore
+	// allowPrivateAddresses lets webhooks be registered for this host and private networks
+	allowPrivateAddresses bool
+}
+
+func NewWebhookManager(store store.WebhookStore, lobbyStore store.LobbyStore, allowPrivateAddresses bool) *Manager {
+	return &Manager{
+		store:                 store,
+		lobbyStore:            lobbyStore,
+		allowPrivateAddresses: allowPrivateAddresses,
+	}
+}
+
+// RegisterWebhook adds a webhook for the given event kinds, or DefaultEventKinds if none are given
+// If lobbyId is empty the webhook is server-wide, otherwise it only receives events from that lobby
+func (m *Manager) RegisterWebhook(url string, lobbyId lobbytypes.LobbyId, eventKinds []events.Kind) (*types.Webhook, error) {
+	if lobbyId != "" {
+		if _, err := m.lobbyStore.RetrieveLobby(lobbyId); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(eventKinds) == 0 {
+		eventKinds = DefaultEventKinds
+	}
+	for _, kind := range eventKinds {
+		if !slices.Contains(SupportedEventKinds, kind) {
+			return nil, &errors.InvalidInputError{
+				ErrMessage: fmt.Sprintf("unsupported webhook event %q", kind),
+			}
+		}
+	}
+
+	webhook, err := types.NewWebhook(url, lobbyId, slices.Compact(slices.Sorted(slices.Values(eventKinds))))
+	if err != nil {
+		return nil, err
+	}
+	if !m.allowPrivateAddresses {
+		if err := checkReceiverHost(webhook.Url); err != nil {
+			return nil, err
+		}
+	}
+	err = m.store.StoreWebhook(webhook)
+	if err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (m *Manager) GetWebhook(webhookId types.WebhookId) (*types.Webhook, error) {
+	return m.store.RetrieveWebhook(webhookId)
+}
+
+// GetLobbyWebhook gets a webhook, treating it as not found if it does not belong to the lobby
+func (m *Manager) GetLobbyWebhook(lobbyId lobbytypes.LobbyId, webhookId types.WebhookId) (*types.Webhook, error) {
+	webhook, err := m.store.RetrieveWebhook(webhookId)
+	if err != nil {
+		return nil, err
+	}
+	if webhook.LobbyId != lobbyId {
+		return nil, &errors.NotFoundError{
+			ObjectKind: "webhook",
+			ObjectID:   webhookId,
+		}
+	}
+	return webhook, nil
+}
+
+// ListWebhooks lists every webhook, both server-wide and lobby-scoped
+func (m *Manager) ListWebhooks() ([]*types.Webhook, error) {
+	webhooks, err := m.store.RetrieveAllWebhooks()
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(webhooks, func(a, b *types.Webhook) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return webhooks, nil
+}
+
+func (m *Manager) ListLobbyWebhooks(lobbyId lobbytypes.LobbyId) ([]*types.Webhook, error) {
+	webhooks, err := m.ListWebhooks()
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(webhooks, func(w *types.Webhook) bool {
+		return w.LobbyId != lobbyId
+	}), nil
+}
+
+func (m *Manager) DeleteWebhook(webhookId types.WebhookId) error {
+	return m.store.DeleteWebhook(webhookId)
+}
+
+// GetDeliveries returns the webhook's delivery log, optionally only those with the given status
+func (m *Manager) GetDeliveries(webhookId types.WebhookId, status types.DeliveryStatus) ([]*types.Delivery, error) {
+	deliveries, err := m.store.RetrieveDeliveriesForWebhook(webhookId)
+	if err != nil {
+		return nil, err
+	}
+	if status == "" {
+		return deliveries, nil
+	}
+	return slices.DeleteFunc(deliveries, func(d *types.Delivery) bool {
+		return d.Status != status
+	}), nil
+}
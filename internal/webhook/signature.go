@@ -0,0 +1,31 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	SignatureHeader = "X-Crosswordgame-Signature"
+	EventHeader     = "X-Crosswordgame-Event"
+	DeliveryHeader  = "X-Crosswordgame-Delivery"
+
+	signaturePrefix = "sha256="
+)
+
+// Sign returns the signature header value for a delivery body: the hex HMAC-SHA256 of the body keyed by the secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks a signature header value against a delivery body, for use by receivers
+func VerifySignature(secret string, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
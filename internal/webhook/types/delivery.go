@@ -0,0 +1,62 @@
+package types
+
+import (
+	"encoding/json"
+	"github.com/hashicorp/go-uuid"
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	"slices"
+	"time"
+)
+
+type DeliveryId string
+
+type DeliveryStatus string
+
+const (
+	DeliveryStatusPending   DeliveryStatus = "pending"
+	DeliveryStatusDelivered DeliveryStatus = "delivered"
+	// DeliveryStatusDeadLetter marks a delivery which failed every attempt and will not be retried
+	DeliveryStatusDeadLetter DeliveryStatus = "dead_letter"
+)
+
+// Delivery records the sending of one event to one webhook, including every attempt made
+type Delivery struct {
+	Id        DeliveryId        `json:"id"`
+	WebhookId WebhookId         `json:"webhook_id"`
+	Event     events.Kind       `json:"event"`
+	Payload   json.RawMessage   `json:"payload"`
+	Status    DeliveryStatus    `json:"status"`
+	Attempts  []DeliveryAttempt `json:"attempts"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+type DeliveryAttempt struct {
+	At time.Time `json:"at"`
+	// StatusCode is 0 if no response was received
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+func NewDelivery(webhookId WebhookId, event events.Kind, payload json.RawMessage) (*Delivery, error) {
+	rawId, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Delivery{
+		Id:        DeliveryId(rawId),
+		WebhookId: webhookId,
+		Event:     event,
+		Payload:   payload,
+		Status:    DeliveryStatusPending,
+		Attempts:  make([]DeliveryAttempt, 0),
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+func (d *Delivery) Clone() *Delivery {
+	clone := *d
+	clone.Payload = slices.Clone(d.Payload)
+	clone.Attempts = slices.Clone(d.Attempts)
+	return &clone
+}
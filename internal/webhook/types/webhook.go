@@ -0,0 +1,70 @@
+package types
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/hashicorp/go-uuid"
+	"github.com/mcoot/crosswordgame-go/internal/errors"
+	"github.com/mcoot/crosswordgame-go/internal/events"
+	lobbytypes "github.com/mcoot/crosswordgame-go/internal/lobby/types"
+	"net/url"
+	"slices"
+	"time"
+)
+
+type WebhookId string
+
+// Webhook is a URL which is sent a signed payload for each matching domain event
+type Webhook struct {
+	Id  WebhookId `json:"id"`
+	Url string    `json:"url"`
+	// Secret is the HMAC key used to sign deliveries, only shown to the client on registration
+	Secret string `json:"secret"`
+	// LobbyId restricts the webhook to events from a single lobby; server-wide webhooks have none
+	LobbyId   lobbytypes.LobbyId `json:"lobby_id,omitempty"`
+	Events    []events.Kind      `json:"events"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+func NewWebhook(rawUrl string, lobbyId lobbytypes.LobbyId, eventKinds []events.Kind) (*Webhook, error) {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, &errors.InvalidInputError{
+			ErrMessage: fmt.Sprintf("webhook URL must be an absolute http(s) URL, got %q", rawUrl),
+		}
+	}
+
+	rawId, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	return &Webhook{
+		Id:        WebhookId(rawId),
+		Url:       rawUrl,
+		Secret:    hex.EncodeToString(secret),
+		LobbyId:   lobbyId,
+		Events:    eventKinds,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+func (w *Webhook) IsServerWide() bool {
+	return w.LobbyId == ""
+}
+
+func (w *Webhook) WantsEvent(kind events.Kind) bool {
+	return slices.Contains(w.Events, kind)
+}
+
+func (w *Webhook) Clone() *Webhook {
+	clone := *w
+	clone.Events = slices.Clone(w.Events)
+	return &clone
+}